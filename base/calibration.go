@@ -0,0 +1,586 @@
+package base
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+)
+
+// CalibrationMethod defines a type enum which (using
+// the constants declared below) lets a user choose how
+// a CalibratedClassifier calibrates its model.
+type CalibrationMethod string
+
+// Constants declare the calibration methods you can
+// use.
+const (
+	// PlattCalibration fits a sigmoid to the log odds
+	// of the model's probabilities (see Platt.) It
+	// works well even with little held out data.
+	PlattCalibration CalibrationMethod = "platt"
+
+	// IsotonicCalibration fits a non-decreasing step
+	// function to the model's probabilities (see
+	// Isotonic.) It can fix any monotonic distortion,
+	// but needs a good amount of held out data.
+	IsotonicCalibration CalibrationMethod = "isotonic"
+)
+
+// calibrationEpsilon keeps the log odds of a
+// probability of 0 or 1 finite.
+const calibrationEpsilon = 1e-12
+
+// logit returns the log odds of the probability p.
+func logit(p float64) float64 {
+	p = math.Max(calibrationEpsilon, math.Min(1-calibrationEpsilon, p))
+	return math.Log(p) - math.Log1p(-p)
+}
+
+// Calibration maps the probabilities a classifier
+// gives (the output of PredictProba) to calibrated
+// ones, with one Platt scaling or Isotonic regression
+// per class fit one-vs-rest. Binary classifiers only
+// need their positive class (the second) calibrated.
+//
+// Calibration is plain data, so it can be stored as
+// JSON alongside whatever model it was fit for.
+type Calibration struct {
+	Method CalibrationMethod `json:"method"`
+
+	// Classes is the number of probabilities the
+	// classifier gives, which Calibrate checks for.
+	Classes int `json:"classes"`
+
+	// Platt or Isotonic (depending on the method)
+	// hold the calibration of each class, in order,
+	// or only of the positive class if Classes is 2.
+	Platt    []*Platt    `json:"platt,omitempty"`
+	Isotonic []*Isotonic `json:"isotonic,omitempty"`
+}
+
+// FitCalibration fits a Calibration to the probabilities
+// a classifier gave to held out points (one row per
+// point, as returned by PredictProba) along with the
+// index of each point's true class within those rows.
+//
+// Fitting on the same data the classifier learned from
+// will give overconfident probabilities, so hold some
+// data out for it.
+func FitCalibration(method CalibrationMethod, probabilities [][]float64, classes []int) (*Calibration, error) {
+	if len(probabilities) == 0 || len(probabilities) != len(classes) {
+		return nil, fmt.Errorf("ERROR: need the same (non zero) number of probabilities and classes to fit a calibration\n\tlength of probabilities: %v\n\tlength of classes: %v\n", len(probabilities), len(classes))
+	}
+
+	if method != PlattCalibration && method != IsotonicCalibration {
+		return nil, fmt.Errorf("ERROR: unknown calibration method %q", method)
+	}
+
+	k := len(probabilities[0])
+	if k < 2 {
+		return nil, fmt.Errorf("ERROR: need the probabilities of at least 2 classes to fit a calibration, given %v", k)
+	}
+
+	for i := range probabilities {
+		if len(probabilities[i]) != k {
+			return nil, fmt.Errorf("ERROR: probabilities of point %v have %v classes but the first point's have %v", i, len(probabilities[i]), k)
+		}
+		if classes[i] < 0 || classes[i] >= k {
+			return nil, fmt.Errorf("ERROR: class %v of point %v is outside of the %v classes", classes[i], i, k)
+		}
+	}
+
+	columns := []int{}
+	if k == 2 {
+		columns = append(columns, 1)
+	} else {
+		for j := 0; j < k; j++ {
+			columns = append(columns, j)
+		}
+	}
+
+	c := &Calibration{
+		Method:  method,
+		Classes: k,
+	}
+
+	scores := make([]float64, len(probabilities))
+	targets := make([]float64, len(probabilities))
+	for _, j := range columns {
+		for i := range probabilities {
+			scores[i] = probabilities[i][j]
+			if method == PlattCalibration {
+				scores[i] = logit(scores[i])
+			}
+
+			targets[i] = 0
+			if classes[i] == j {
+				targets[i] = 1
+			}
+		}
+
+		switch method {
+		case PlattCalibration:
+			platt, err := FitPlatt(scores, targets)
+			if err != nil {
+				return nil, err
+			}
+			c.Platt = append(c.Platt, platt)
+		case IsotonicCalibration:
+			iso, err := FitIsotonic(scores, targets)
+			if err != nil {
+				return nil, err
+			}
+			c.Isotonic = append(c.Isotonic, iso)
+		}
+	}
+
+	return c, nil
+}
+
+// calibrate returns the calibrated probability for the
+// i-th calibrated class given the model's probability.
+func (c *Calibration) calibrate(i int, p float64) float64 {
+	if c.Method == PlattCalibration {
+		return c.Platt[i].Probability(logit(p))
+	}
+
+	return c.Isotonic[i].Probability(p)
+}
+
+// Calibrate takes the probabilities a classifier gave
+// a point and returns the calibrated probabilities, in
+// the same order. They still add up to 1.
+func (c *Calibration) Calibrate(probabilities []float64) ([]float64, error) {
+	if len(probabilities) != c.Classes {
+		return nil, fmt.Errorf("ERROR: calibration was fit for %v classes but given the probabilities of %v", c.Classes, len(probabilities))
+	}
+
+	fitted := len(c.Platt)
+	if c.Method == IsotonicCalibration {
+		fitted = len(c.Isotonic)
+	}
+	if (c.Classes == 2 && fitted != 1) || (c.Classes != 2 && fitted != c.Classes) {
+		return nil, fmt.Errorf("ERROR: calibration hasn't been fit! Call FitCalibration first")
+	}
+
+	if c.Classes == 2 {
+		p := c.calibrate(0, probabilities[1])
+		return []float64{1 - p, p}, nil
+	}
+
+	calibrated := make([]float64, len(probabilities))
+	var sum float64
+	for i := range probabilities {
+		calibrated[i] = c.calibrate(i, probabilities[i])
+		sum += calibrated[i]
+	}
+
+	for i := range calibrated {
+		if sum == 0 {
+			calibrated[i] = 1 / float64(len(calibrated))
+		} else {
+			calibrated[i] /= sum
+		}
+	}
+
+	return calibrated, nil
+}
+
+// ReliabilityBin is a single bar of a reliability
+// diagram. Of the Count points whose predicted
+// probability fell in [Lower, Upper), the mean
+// predicted probability was MeanPredicted and the
+// fraction that actually were positive was
+// FractionPositive. The two are close for a well
+// calibrated model.
+type ReliabilityBin struct {
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+	Count int     `json:"count"`
+
+	MeanPredicted    float64 `json:"meanPredicted"`
+	FractionPositive float64 `json:"fractionPositive"`
+}
+
+// ReliabilityDiagram splits [0, 1] into the given number
+// of equal width bins and returns, for each bin, how the
+// predicted probabilities of the points falling into it
+// compare to the fraction of them which were positive.
+// Labels greater than 0 are counted as the positive
+// class. Empty bins are returned with a Count of 0.
+func ReliabilityDiagram(probabilities []float64, y []float64, bins int) ([]ReliabilityBin, error) {
+	if len(probabilities) == 0 || len(probabilities) != len(y) {
+		return nil, fmt.Errorf("ERROR: need the same (non zero) number of probabilities and labels for a reliability diagram\n\tlength of probabilities: %v\n\tlength of y: %v\n", len(probabilities), len(y))
+	}
+
+	if bins < 1 {
+		return nil, fmt.Errorf("ERROR: need at least 1 bin for a reliability diagram, given %v", bins)
+	}
+
+	diagram := make([]ReliabilityBin, bins)
+	for i := range diagram {
+		diagram[i].Lower = float64(i) / float64(bins)
+		diagram[i].Upper = float64(i+1) / float64(bins)
+	}
+
+	for i, p := range probabilities {
+		if math.IsNaN(p) || p < 0 || p > 1 {
+			return nil, fmt.Errorf("ERROR: probability %v of point %v isn't within [0, 1]", p, i)
+		}
+
+		// a probability of exactly 1 goes in the
+		// last bin
+		bin := int(p * float64(bins))
+		if bin == bins {
+			bin--
+		}
+
+		diagram[bin].Count++
+		diagram[bin].MeanPredicted += p
+		if y[i] > 0 {
+			diagram[bin].FractionPositive++
+		}
+	}
+
+	for i := range diagram {
+		if diagram[i].Count == 0 {
+			continue
+		}
+
+		diagram[i].MeanPredicted /= float64(diagram[i].Count)
+		diagram[i].FractionPositive /= float64(diagram[i].Count)
+	}
+
+	return diagram, nil
+}
+
+// ExpectedCalibrationError sums up a reliability
+// diagram into a single number: the average gap
+// between the predicted probability and the fraction
+// of positives of each bin, weighted by the number
+// of points in the bin. 0 is perfectly calibrated.
+func ExpectedCalibrationError(diagram []ReliabilityBin) float64 {
+	var total, sum float64
+	for _, bin := range diagram {
+		total += float64(bin.Count)
+		sum += float64(bin.Count) * math.Abs(bin.MeanPredicted-bin.FractionPositive)
+	}
+
+	if total == 0 {
+		return 0
+	}
+
+	return sum / total
+}
+
+// classLister is a classifier which knows which label
+// each of the probabilities from PredictProba is for
+// (like KNN.)
+type classLister interface {
+	Classes() []float64
+}
+
+/*
+CalibratedClassifier wraps any goml classifier with
+PredictProba (LeastSquares with the logistic
+hypothesis, Softmax, Perceptron, KernelPerceptron,
+KNN...) so its probabilities are calibrated, meaning
+that of all the points given a probability of 0.8,
+about 80% really are in that class. Raw scores,
+especially from margin based models like the
+perceptrons, are rarely like that.
+
+Train the model first, then Fit the calibration on
+held out data the model never learned from.
+
+Classes holds the label each of the model's
+probabilities is for, which Predict returns and Fit
+uses to read the labels. It's taken from the model
+if it has a Classes method (like KNN.) Otherwise,
+if it's nil when Fit is called, binary models are
+assumed to use -1/1 labels if any label in y is
+negative (like the perceptrons) and 0/1 otherwise
+(like logistic regression), and other models to use
+0, 1, ..., k-1 (like Softmax.)
+
+PersistToFile saves the calibration along with the
+model, so the model has to be able to persist
+itself as JSON (all of the linear and perceptron
+models can.) Restore into a CalibratedClassifier
+wrapping the same type of model.
+
+Example Calibrating A Perceptron:
+
+	model := perceptron.NewPerceptron(0.1, 2, stream)
+	// ...learn
+
+	calibrated := base.NewCalibratedClassifier(model, base.IsotonicCalibration)
+	err := calibrated.Fit(heldOutX, heldOutY)
+	if err != nil {
+		panic("couldn't calibrate the model!")
+	}
+
+	// [P(y = -1), P(y = 1)]
+	proba, err := calibrated.PredictProba([]float64{0.3, 1.2})
+
+	// how well calibrated is it on the test set?
+	diagram, err := calibrated.Reliability(testX, testY, 10)
+	fmt.Printf("ECE: %v\n", base.ExpectedCalibrationError(diagram))
+*/
+type CalibratedClassifier struct {
+	Model       ProbabilisticClassifier
+	Method      CalibrationMethod
+	Classes     []float64
+	Calibration *Calibration
+}
+
+// persistedCalibratedClassifier is how a
+// CalibratedClassifier is stored on disk.
+type persistedCalibratedClassifier struct {
+	Type        string          `json:"type"`
+	Classes     []float64       `json:"classes"`
+	Calibration *Calibration    `json:"calibration"`
+	Model       json.RawMessage `json:"model"`
+}
+
+// NewCalibratedClassifier returns a pointer to a
+// CalibratedClassifier wrapping the (already trained)
+// model, which will be calibrated with method once
+// Fit is called.
+func NewCalibratedClassifier(model ProbabilisticClassifier, method CalibrationMethod) *CalibratedClassifier {
+	c := &CalibratedClassifier{
+		Model:  model,
+		Method: method,
+	}
+
+	if lister, ok := model.(classLister); ok {
+		c.Classes = lister.Classes()
+	}
+
+	return c
+}
+
+// Fit fits the calibration to the model's probabilities
+// on held out data x with labels y. The normalize
+// argument is passed on to the model's PredictProba.
+func (c *CalibratedClassifier) Fit(x [][]float64, y []float64, normalize ...bool) error {
+	if len(x) == 0 || len(x) != len(y) {
+		return fmt.Errorf("ERROR: need the same (non zero) number of points and labels to calibrate a model\n\tlength of x: %v\n\tlength of y: %v\n", len(x), len(y))
+	}
+
+	probabilities := make([][]float64, len(x))
+	for i := range x {
+		proba, err := c.Model.PredictProba(x[i], normalize...)
+		if err != nil {
+			return err
+		}
+		probabilities[i] = proba
+	}
+
+	classes := c.Classes
+	if classes == nil {
+		classes = defaultClasses(len(probabilities[0]), y)
+	}
+
+	index := make(map[float64]int, len(classes))
+	for i := range classes {
+		index[classes[i]] = i
+	}
+
+	columns := make([]int, len(y))
+	for i := range y {
+		j, ok := index[y[i]]
+		if !ok {
+			return fmt.Errorf("ERROR: label %v of point %v isn't one of the model's classes %v", y[i], i, classes)
+		}
+		columns[i] = j
+	}
+
+	calibration, err := FitCalibration(c.Method, probabilities, columns)
+	if err != nil {
+		return err
+	}
+
+	c.Classes = classes
+	c.Calibration = calibration
+
+	return nil
+}
+
+// defaultClasses guesses the labels of a model with k
+// probabilities, as described on CalibratedClassifier.
+func defaultClasses(k int, y []float64) []float64 {
+	if k == 2 {
+		for i := range y {
+			if y[i] < 0 {
+				return []float64{-1, 1}
+			}
+		}
+	}
+
+	classes := make([]float64, k)
+	for i := range classes {
+		classes[i] = float64(i)
+	}
+
+	return classes
+}
+
+// PredictProba returns the calibrated probability of x
+// being in each of the model's classes, in the same
+// order as the model's PredictProba (and Classes.)
+func (c *CalibratedClassifier) PredictProba(x []float64, normalize ...bool) ([]float64, error) {
+	if c.Calibration == nil {
+		return nil, fmt.Errorf("ERROR: the classifier hasn't been calibrated! Call Fit first")
+	}
+
+	proba, err := c.Model.PredictProba(x, normalize...)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Calibration.Calibrate(proba)
+}
+
+// Predict returns the class (from Classes) with the
+// highest calibrated probability, which might not be
+// the class the model itself predicts when the
+// calibration moves its decision threshold.
+func (c *CalibratedClassifier) Predict(x []float64, normalize ...bool) ([]float64, error) {
+	proba, err := c.PredictProba(x, normalize...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(proba) != len(c.Classes) {
+		return nil, fmt.Errorf("ERROR: the classifier has %v classes but the model gave %v probabilities", len(c.Classes), len(proba))
+	}
+
+	best := 0
+	for i := range proba {
+		if proba[i] > proba[best] {
+			best = i
+		}
+	}
+
+	return []float64{c.Classes[best]}, nil
+}
+
+// Reliability returns the reliability diagram (see
+// ReliabilityDiagram) of the calibrated classifier on
+// the labeled data x, y. For binary classifiers it
+// compares the probability of the positive (second)
+// class to how often points were in it. Otherwise it
+// compares the probability of the predicted class to
+// how often the prediction was right.
+func (c *CalibratedClassifier) Reliability(x [][]float64, y []float64, bins int, normalize ...bool) ([]ReliabilityBin, error) {
+	if len(x) != len(y) {
+		return nil, fmt.Errorf("ERROR: need the same number of points and labels for a reliability diagram\n\tlength of x: %v\n\tlength of y: %v\n", len(x), len(y))
+	}
+
+	predicted := make([]float64, len(x))
+	positive := make([]float64, len(x))
+	for i := range x {
+		proba, err := c.PredictProba(x[i], normalize...)
+		if err != nil {
+			return nil, err
+		}
+
+		best := 0
+		if len(proba) == 2 {
+			best = 1
+		} else {
+			for j := range proba {
+				if proba[j] > proba[best] {
+					best = j
+				}
+			}
+		}
+
+		predicted[i] = proba[best]
+		if best < len(c.Classes) && y[i] == c.Classes[best] {
+			positive[i] = 1
+		}
+	}
+
+	return ReliabilityDiagram(predicted, positive, bins)
+}
+
+// PersistToFile takes in an absolute filepath and saves
+// the calibration along with the model to a single
+// file, which can be restored later with
+// RestoreFromFile.
+func (c *CalibratedClassifier) PersistToFile(path string) error {
+	if path == "" {
+		return fmt.Errorf("ERROR: you just tried to persist your model to a file with no path!! That's a no-no. Try it with a valid filepath")
+	}
+
+	model, ok := c.Model.(Persister)
+	if !ok {
+		return fmt.Errorf("ERROR: the calibrated model (%T) can't be persisted", c.Model)
+	}
+
+	state, err := PersistToBytes(model)
+	if err != nil {
+		return err
+	}
+
+	bytes, err := json.Marshal(persistedCalibratedClassifier{
+		Type:        fmt.Sprintf("%T", c.Model),
+		Classes:     c.Classes,
+		Calibration: c.Calibration,
+		Model:       state,
+	})
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, bytes, os.ModePerm)
+}
+
+// RestoreFromFile takes in a path to a persisted
+// CalibratedClassifier and restores both the
+// calibration and the model. The classifier must wrap
+// the same type of model as the one that was
+// persisted.
+func (c *CalibratedClassifier) RestoreFromFile(path string) error {
+	if path == "" {
+		return fmt.Errorf("ERROR: you just tried to restore your model from a file with no path! That's a no-no. Try it with a valid filepath")
+	}
+
+	model, ok := c.Model.(Persister)
+	if !ok {
+		return fmt.Errorf("ERROR: the calibrated model (%T) can't be restored", c.Model)
+	}
+
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var persisted persistedCalibratedClassifier
+	err = json.Unmarshal(bytes, &persisted)
+	if err != nil {
+		return err
+	}
+
+	if persisted.Type != fmt.Sprintf("%T", c.Model) {
+		return fmt.Errorf("ERROR: the persisted model is a %v but this classifier wraps a %T", persisted.Type, c.Model)
+	}
+	if persisted.Calibration == nil {
+		return fmt.Errorf("ERROR: the persisted classifier was never calibrated")
+	}
+
+	err = RestoreFromBytes(model, persisted.Model)
+	if err != nil {
+		return err
+	}
+
+	c.Method = persisted.Calibration.Method
+	c.Classes = persisted.Classes
+	c.Calibration = persisted.Calibration
+
+	return nil
+}
@@ -0,0 +1,258 @@
+package base
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// overconfident is a binary classifier whose true
+// probability of the positive class is sigmoid(x[0])
+// but which reports sigmoid(Scale * x[0])
+type overconfident struct {
+	Scale float64 `json:"scale"`
+}
+
+func (o *overconfident) Predict(x []float64, normalize ...bool) ([]float64, error) {
+	if x[0] > 0 {
+		return []float64{1}, nil
+	}
+	return []float64{-1}, nil
+}
+
+func (o *overconfident) PredictProba(x []float64, normalize ...bool) ([]float64, error) {
+	p := 1 / (1 + math.Exp(-o.Scale*x[0]))
+	return []float64{1 - p, p}, nil
+}
+
+func (o *overconfident) PersistToFile(path string) error {
+	bytes, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, bytes, os.ModePerm)
+}
+
+func (o *overconfident) RestoreFromFile(path string) error {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bytes, o)
+}
+
+// sampleOverconfident draws points whose label is
+// positive with probability sigmoid(x)
+func sampleOverconfident(random *rand.Rand, n int) ([][]float64, []float64) {
+	x := make([][]float64, n)
+	y := make([]float64, n)
+	for i := range x {
+		x[i] = []float64{random.Float64()*8 - 4}
+		y[i] = -1
+		if random.Float64() < 1/(1+math.Exp(-x[i][0])) {
+			y[i] = 1
+		}
+	}
+
+	return x, y
+}
+
+func TestFitIsotonicShouldPass1(t *testing.T) {
+	iso, err := FitIsotonic([]float64{3, 1, 2, 4, 6, 5}, []float64{0, 0, 1, 1, 1, 1})
+	assert.Nil(t, err, "Fit error should be nil")
+
+	assert.Equal(t, []float64{1, 2, 3, 4, 5, 6}, iso.X, "Breakpoints should be the sorted scores")
+	assert.Equal(t, []float64{0, 0.5, 0.5, 1, 1, 1}, iso.Y, "Violating neighbors should be pooled")
+
+	assert.Equal(t, 0.0, iso.Probability(-10), "Scores below the fit should be clamped")
+	assert.Equal(t, 1.0, iso.Probability(10), "Scores above the fit should be clamped")
+	assert.Equal(t, 0.5, iso.Probability(2.5), "Scores within a pooled block should get its probability")
+	assert.InDelta(t, 0.75, iso.Probability(3.5), 1e-12, "Scores between blocks should be interpolated")
+
+	// ties are always pooled
+	iso, err = FitIsotonic([]float64{1, 1, 2}, []float64{-1, 1, 1})
+	assert.Nil(t, err, "Fit error should be nil")
+	assert.Equal(t, []float64{1, 2}, iso.X, "Equal scores should share a breakpoint")
+	assert.Equal(t, []float64{0.5, 1}, iso.Y, "Equal scores should share a probability")
+}
+
+func TestFitIsotonicShouldFail1(t *testing.T) {
+	_, err := FitIsotonic(nil, nil)
+	assert.NotNil(t, err, "Fitting to no scores should return an error")
+
+	_, err = FitIsotonic([]float64{1, 2}, []float64{1})
+	assert.NotNil(t, err, "Fitting to a different number of scores and labels should return an error")
+}
+
+func TestReliabilityDiagramShouldPass1(t *testing.T) {
+	diagram, err := ReliabilityDiagram([]float64{0.1, 0.2, 0.6, 0.8, 1}, []float64{0, 1, 1, 0, 1}, 2)
+	assert.Nil(t, err, "Reliability diagram error should be nil")
+	assert.Len(t, diagram, 2, "There should be one bin per bin asked for")
+
+	assert.Equal(t, 0.0, diagram[0].Lower, "The first bin should start at 0")
+	assert.Equal(t, 2, diagram[0].Count, "The first bin should hold the two low probabilities")
+	assert.InDelta(t, 0.15, diagram[0].MeanPredicted, 1e-12, "The mean prediction should be averaged within the bin")
+	assert.InDelta(t, 0.5, diagram[0].FractionPositive, 1e-12, "The fraction of positives should be counted within the bin")
+
+	assert.Equal(t, 1.0, diagram[1].Upper, "The last bin should end at 1")
+	assert.Equal(t, 3, diagram[1].Count, "A probability of 1 should go in the last bin")
+	assert.InDelta(t, 0.8, diagram[1].MeanPredicted, 1e-12, "The mean prediction should be averaged within the bin")
+	assert.InDelta(t, 2.0/3, diagram[1].FractionPositive, 1e-12, "The fraction of positives should be counted within the bin")
+
+	assert.InDelta(t, (2*0.35+3*(0.8-2.0/3))/5, ExpectedCalibrationError(diagram), 1e-12, "ECE should be the weighted mean gap")
+
+	_, err = ReliabilityDiagram([]float64{0.5}, []float64{1}, 0)
+	assert.NotNil(t, err, "A diagram with no bins should return an error")
+
+	_, err = ReliabilityDiagram([]float64{1.5}, []float64{1}, 10)
+	assert.NotNil(t, err, "Probabilities outside of [0, 1] should return an error")
+}
+
+// both methods should fix an overconfident model
+func TestCalibratedClassifierShouldPass1(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	x, y := sampleOverconfident(random, 4000)
+	testX, testY := sampleOverconfident(random, 4000)
+
+	model := &overconfident{Scale: 4}
+
+	raw := make([]float64, len(testX))
+	positive := make([]float64, len(testX))
+	for i := range testX {
+		proba, err := model.PredictProba(testX[i])
+		assert.Nil(t, err, "Prediction error should be nil")
+		raw[i] = proba[1]
+		if testY[i] > 0 {
+			positive[i] = 1
+		}
+	}
+	diagram, err := ReliabilityDiagram(raw, positive, 10)
+	assert.Nil(t, err, "Reliability diagram error should be nil")
+	before := ExpectedCalibrationError(diagram)
+
+	for _, method := range []CalibrationMethod{PlattCalibration, IsotonicCalibration} {
+		calibrated := NewCalibratedClassifier(model, method)
+		err := calibrated.Fit(x, y)
+		assert.Nil(t, err, "Fit error should be nil")
+		assert.Equal(t, []float64{-1, 1}, calibrated.Classes, "Binary models with negative labels should use -1/1 classes")
+
+		proba, err := calibrated.PredictProba([]float64{2})
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.InDelta(t, 1, proba[0]+proba[1], 1e-9, "Probabilities should add up to 1")
+		assert.InDelta(t, 1/(1+math.Exp(-2)), proba[1], 0.08, "Calibrated probability should be close to the true one")
+
+		guess, err := calibrated.Predict([]float64{2})
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.Equal(t, []float64{1}, guess, "Predict should return the most likely class")
+
+		diagram, err := calibrated.Reliability(testX, testY, 10)
+		assert.Nil(t, err, "Reliability diagram error should be nil")
+		assert.True(t, ExpectedCalibrationError(diagram) < before/2, "Calibration should fix most of the calibration error")
+	}
+}
+
+func TestCalibratedClassifierShouldPass2(t *testing.T) {
+	random := rand.New(rand.NewSource(7))
+	x, y := sampleOverconfident(random, 500)
+
+	calibrated := NewCalibratedClassifier(&overconfident{Scale: 3}, PlattCalibration)
+	err := calibrated.Fit(x, y)
+	assert.Nil(t, err, "Fit error should be nil")
+
+	err = calibrated.PersistToFile("/tmp/.goml/calibrated.json")
+	assert.Nil(t, err, "Persistence error should be nil")
+
+	restored := NewCalibratedClassifier(&overconfident{}, IsotonicCalibration)
+	err = restored.RestoreFromFile("/tmp/.goml/calibrated.json")
+	assert.Nil(t, err, "Restore error should be nil")
+
+	assert.Equal(t, 3.0, restored.Model.(*overconfident).Scale, "The model should be restored")
+	assert.Equal(t, PlattCalibration, restored.Method, "The method should be restored")
+	assert.Equal(t, calibrated.Classes, restored.Classes, "The classes should be restored")
+
+	for _, point := range [][]float64{{-3}, {0}, {1.5}} {
+		expected, err := calibrated.PredictProba(point)
+		assert.Nil(t, err, "Prediction error should be nil")
+		proba, err := restored.PredictProba(point)
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.Equal(t, expected, proba, "Restored classifier should give the same probabilities")
+	}
+}
+
+// multiclass calibration is fit one-vs-rest and
+// renormalized
+func TestFitCalibrationShouldPass1(t *testing.T) {
+	probabilities := [][]float64{
+		{0.9, 0.05, 0.05},
+		{0.8, 0.1, 0.1},
+		{0.1, 0.8, 0.1},
+		{0.2, 0.7, 0.1},
+		{0.1, 0.1, 0.8},
+		{0.3, 0.1, 0.6},
+	}
+	classes := []int{0, 1, 1, 1, 2, 2}
+
+	for _, method := range []CalibrationMethod{PlattCalibration, IsotonicCalibration} {
+		calibration, err := FitCalibration(method, probabilities, classes)
+		assert.Nil(t, err, "Fit error should be nil")
+		assert.Equal(t, 3, calibration.Classes, "Calibration should remember the number of classes")
+
+		for i := range probabilities {
+			calibrated, err := calibration.Calibrate(probabilities[i])
+			assert.Nil(t, err, "Calibration error should be nil")
+			assert.Len(t, calibrated, 3, "There should be a probability per class")
+
+			var sum float64
+			for j := range calibrated {
+				assert.True(t, calibrated[j] >= 0 && calibrated[j] <= 1, "Probabilities should be within [0, 1]")
+				sum += calibrated[j]
+			}
+			assert.InDelta(t, 1, sum, 1e-9, "Probabilities should add up to 1")
+		}
+	}
+}
+
+func TestFitCalibrationShouldFail1(t *testing.T) {
+	_, err := FitCalibration(PlattCalibration, nil, nil)
+	assert.NotNil(t, err, "Fitting to no probabilities should return an error")
+
+	_, err = FitCalibration("magic", [][]float64{{0.5, 0.5}}, []int{1})
+	assert.NotNil(t, err, "Unknown methods should return an error")
+
+	_, err = FitCalibration(PlattCalibration, [][]float64{{0.5, 0.5}, {1}}, []int{1, 0})
+	assert.NotNil(t, err, "Rows of different lengths should return an error")
+
+	_, err = FitCalibration(PlattCalibration, [][]float64{{0.5, 0.5}}, []int{2})
+	assert.NotNil(t, err, "Classes outside of the rows should return an error")
+
+	calibration, err := FitCalibration(IsotonicCalibration, [][]float64{{0.5, 0.5}, {0.2, 0.8}}, []int{0, 1})
+	assert.Nil(t, err, "Fit error should be nil")
+	_, err = calibration.Calibrate([]float64{0.2, 0.3, 0.5})
+	assert.NotNil(t, err, "Calibrating the wrong number of classes should return an error")
+}
+
+func TestCalibratedClassifierShouldFail1(t *testing.T) {
+	calibrated := NewCalibratedClassifier(&overconfident{Scale: 1}, PlattCalibration)
+
+	_, err := calibrated.PredictProba([]float64{1})
+	assert.NotNil(t, err, "Predicting before calibrating should return an error")
+
+	err = calibrated.Fit([][]float64{{1}, {2}}, []float64{1, 2})
+	assert.NotNil(t, err, "Labels which aren't one of the classes should return an error")
+
+	err = calibrated.Fit([][]float64{{1}}, []float64{1, 0})
+	assert.NotNil(t, err, "A different number of points and labels should return an error")
+
+	err = calibrated.PersistToFile("")
+	assert.NotNil(t, err, "Persisting to no path should return an error")
+
+	err = ioutil.WriteFile("/tmp/.goml/calibrated_other.json", []byte(`{"type":"*base.other","calibration":{},"model":{}}`), os.ModePerm)
+	assert.Nil(t, err, "Writing the file should not fail")
+	err = calibrated.RestoreFromFile("/tmp/.goml/calibrated_other.json")
+	assert.NotNil(t, err, "Restoring a different type of model should return an error")
+}
@@ -0,0 +1,476 @@
+package base
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// CSVOptions configures how NewCSVReader and LoadCSV
+// read a CSV file. The zero value reads a file just
+// like LoadDataFromCSV: comma delimited, no header,
+// every column numeric and the label in the last
+// column.
+type CSVOptions struct {
+	// Header is true if the first line of the
+	// file holds the column names.
+	Header bool
+
+	// Delimiter separates fields. Defaults to
+	// a comma.
+	Delimiter rune
+
+	// Comment, if not 0, marks lines to skip
+	// when it's the first character.
+	Comment rune
+
+	// LabelColumns selects the label (Y) columns
+	// by name (so Header must be true) and
+	// LabelIndices selects them by index, where
+	// negative indices count back from the end
+	// (-1 is the last column.) Giving more than
+	// one column gives multi-output labels. If
+	// neither is given the last column is the
+	// label.
+	LabelColumns []string
+	LabelIndices []int
+
+	// NoLabel reads every column as a feature,
+	// leaving Y empty, for unsupervised models.
+	NoLabel bool
+
+	// MissingValues are the fields (like "",
+	// "NA" or "?") that mean a value is missing.
+	// They're read as NaN, which the imputers in
+	// the preprocess package know how to fill.
+	// Surrounding whitespace is ignored, here and
+	// in the file, so " NA" is missing too.
+	MissingValues []string
+
+	// CategoricalColumns (by name) and
+	// CategoricalIndices (by index, negative
+	// counting from the end) mark columns which
+	// hold categories instead of numbers. Each
+	// category is mapped to an index in order
+	// of first appearance. Categories are trimmed
+	// of surrounding whitespace, so "paris" and
+	// " paris" are the same category.
+	CategoricalColumns []string
+	CategoricalIndices []int
+
+	// Categories optionally seeds the category
+	// indices of categorical columns (keyed by
+	// column index) so a file read at serving
+	// time maps categories exactly like the
+	// training file did. New categories are
+	// appended.
+	Categories map[int][]string
+}
+
+// CSVError is returned when a row of a CSV file
+// can't be read. Line is the line number in the
+// file (starting at 1) and Column is the index of
+// the offending column, or -1 if the row isn't
+// valid CSV at all (like a stray quote), since its
+// columns can't be told apart then.
+type CSVError struct {
+	Line   int
+	Column int
+	Err    error
+}
+
+// Error implements the error interface.
+func (e *CSVError) Error() string {
+	return fmt.Sprintf("ERROR: line %v, column %v: %v", e.Line, e.Column, e.Err)
+}
+
+// Unwrap returns the underlying error, so errors.Is
+// can check for things like csv.ErrBareQuote.
+func (e *CSVError) Unwrap() error {
+	return e.Err
+}
+
+// wrapParseError turns the *csv.ParseError the
+// encoding/csv reader returns for malformed rows
+// into a *CSVError like every other bad row.
+// Anything else is returned as is.
+func wrapParseError(err error) error {
+	parseErr, ok := err.(*csv.ParseError)
+	if !ok {
+		return err
+	}
+
+	return &CSVError{Line: parseErr.Line, Column: -1, Err: parseErr.Err}
+}
+
+// CSVReader reads Datapoints one row at a time from
+// a CSV file, following its CSVOptions, so large
+// files never have to be held in memory.
+type CSVReader struct {
+	reader *csv.Reader
+
+	// columns holds the name of every column (its
+	// index, if there is no header)
+	columns []string
+
+	features []int
+	labels   []int
+
+	missing     map[string]bool
+	categorical map[int]bool
+	categories  map[int][]string
+	index       map[int]map[string]int
+
+	// first holds the first record when it had to
+	// be read early to learn the number of columns
+	first []string
+}
+
+// NewCSVReader returns a CSVReader reading from r.
+// The header (if any) is read right away, so an
+// error is returned if it's missing or if the given
+// label or categorical columns don't exist.
+//
+// Example Reading A File With A Header:
+//
+//	file, err := os.Open("/tmp/.goml/houses.csv")
+//	if err != nil {
+//	    panic("couldn't open the file!")
+//	}
+//
+//	reader, err := base.NewCSVReader(file, base.CSVOptions{
+//	    Header:             true,
+//	    LabelColumns:       []string{"price"},
+//	    MissingValues:      []string{"", "NA"},
+//	    CategoricalColumns: []string{"neighborhood"},
+//	})
+//	if err != nil {
+//	    panic("couldn't read the header!")
+//	}
+//
+//	for {
+//	    point, err := reader.Read()
+//	    if err == io.EOF {
+//	        break
+//	    }
+//	    if err != nil {
+//	        panic(err.Error()) // tells you the line number
+//	    }
+//
+//	    // use point.X and point.Y
+//	}
+func NewCSVReader(r io.Reader, opts CSVOptions) (*CSVReader, error) {
+	reader := csv.NewReader(r)
+	if opts.Delimiter != 0 {
+		reader.Comma = opts.Delimiter
+	}
+	reader.Comment = opts.Comment
+
+	// row lengths are checked in Read so the
+	// error can say which line was wrong
+	reader.FieldsPerRecord = -1
+
+	c := &CSVReader{
+		reader:      reader,
+		missing:     map[string]bool{},
+		categorical: map[int]bool{},
+		categories:  map[int][]string{},
+		index:       map[int]map[string]int{},
+	}
+
+	for _, m := range opts.MissingValues {
+		c.missing[strings.TrimSpace(m)] = true
+	}
+
+	record, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("ERROR: CSV file is empty")
+	}
+	if err != nil {
+		return nil, wrapParseError(err)
+	}
+
+	if opts.Header {
+		for i := range record {
+			record[i] = strings.TrimSpace(record[i])
+		}
+		c.columns = record
+	} else {
+		c.columns = make([]string, len(record))
+		for i := range record {
+			c.columns[i] = strconv.Itoa(i)
+		}
+		c.first = record
+	}
+
+	resolve := func(names []string, indices []int) ([]int, error) {
+		result := []int{}
+		for _, name := range names {
+			if !opts.Header {
+				return nil, fmt.Errorf("ERROR: can't select column %q by name without a header", name)
+			}
+
+			found := -1
+			for i := range c.columns {
+				if c.columns[i] == name {
+					found = i
+					break
+				}
+			}
+			if found == -1 {
+				return nil, fmt.Errorf("ERROR: column %q isn't in the header", name)
+			}
+			result = append(result, found)
+		}
+
+		for _, i := range indices {
+			if i < 0 {
+				i += len(c.columns)
+			}
+			if i < 0 || i >= len(c.columns) {
+				return nil, fmt.Errorf("ERROR: column index out of range for a file with %v columns", len(c.columns))
+			}
+			result = append(result, i)
+		}
+
+		return result, nil
+	}
+
+	if !opts.NoLabel {
+		c.labels, err = resolve(opts.LabelColumns, opts.LabelIndices)
+		if err != nil {
+			return nil, err
+		}
+		if len(c.labels) == 0 {
+			c.labels = []int{len(c.columns) - 1}
+		}
+	}
+
+	categorical, err := resolve(opts.CategoricalColumns, opts.CategoricalIndices)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range categorical {
+		c.categorical[i] = true
+		c.index[i] = map[string]int{}
+		for _, category := range opts.Categories[i] {
+			c.addCategory(i, strings.TrimSpace(category))
+		}
+	}
+
+	isLabel := map[int]bool{}
+	for _, i := range c.labels {
+		isLabel[i] = true
+	}
+	for i := range c.columns {
+		if !isLabel[i] {
+			c.features = append(c.features, i)
+		}
+	}
+
+	return c, nil
+}
+
+// addCategory gives category the next index in
+// column i if it doesn't have one yet.
+func (c *CSVReader) addCategory(i int, category string) int {
+	index, ok := c.index[i][category]
+	if !ok {
+		index = len(c.categories[i])
+		c.index[i][category] = index
+		c.categories[i] = append(c.categories[i], category)
+	}
+
+	return index
+}
+
+// parse turns a single field of column i into
+// a float64.
+func (c *CSVReader) parse(i int, field string) (float64, error) {
+	field = strings.TrimSpace(field)
+	if c.missing[field] {
+		return math.NaN(), nil
+	}
+
+	if c.categorical[i] {
+		return float64(c.addCategory(i, field)), nil
+	}
+
+	return strconv.ParseFloat(field, 64)
+}
+
+// Read returns the next row of the file as a
+// Datapoint. It returns io.EOF when there are no
+// rows left, and a *CSVError (which holds the line
+// number) when a row can't be parsed, whether it's
+// a bad value or malformed CSV. Reading can
+// continue past a row that couldn't be parsed.
+func (c *CSVReader) Read() (Datapoint, error) {
+	var record []string
+	var err error
+
+	if c.first != nil {
+		record, c.first = c.first, nil
+	} else {
+		record, err = c.reader.Read()
+		if err != nil {
+			return Datapoint{}, wrapParseError(err)
+		}
+	}
+
+	line, _ := c.reader.FieldPos(0)
+	if len(record) != len(c.columns) {
+		return Datapoint{}, &CSVError{
+			Line:   line,
+			Column: len(record),
+			Err:    fmt.Errorf("row has %v fields but the file has %v columns", len(record), len(c.columns)),
+		}
+	}
+
+	point := Datapoint{
+		X: make([]float64, len(c.features)),
+	}
+	if len(c.labels) != 0 {
+		point.Y = make([]float64, len(c.labels))
+	}
+
+	for j, i := range c.features {
+		point.X[j], err = c.parse(i, record[i])
+		if err != nil {
+			return Datapoint{}, &CSVError{Line: line, Column: i, Err: err}
+		}
+	}
+	for j, i := range c.labels {
+		point.Y[j], err = c.parse(i, record[i])
+		if err != nil {
+			return Datapoint{}, &CSVError{Line: line, Column: i, Err: err}
+		}
+	}
+
+	return point, nil
+}
+
+// FeatureNames returns the names of the columns
+// which make up X, in order. Without a header the
+// names are the column indices.
+func (c *CSVReader) FeatureNames() []string {
+	names := make([]string, len(c.features))
+	for j, i := range c.features {
+		names[j] = c.columns[i]
+	}
+
+	return names
+}
+
+// LabelNames returns the names of the columns
+// which make up Y, in order.
+func (c *CSVReader) LabelNames() []string {
+	names := make([]string, len(c.labels))
+	for j, i := range c.labels {
+		names[j] = c.columns[i]
+	}
+
+	return names
+}
+
+// Categories returns the categories seen so far in
+// each categorical column (keyed by column index),
+// where a category's position is the value it was
+// read as. Pass it as CSVOptions.Categories to read
+// another file the same way.
+func (c *CSVReader) Categories() map[int][]string {
+	categories := make(map[int][]string, len(c.categories))
+	for i := range c.categories {
+		categories[i] = append([]string{}, c.categories[i]...)
+	}
+
+	return categories
+}
+
+// CSVDataset holds a whole CSV file loaded by
+// LoadCSV.
+type CSVDataset struct {
+	X [][]float64
+	Y [][]float64
+
+	FeatureNames []string
+	LabelNames   []string
+
+	// Categories maps each categorical column
+	// (by index in the file) to its categories.
+	Categories map[int][]string
+}
+
+// Labels returns the first label of every row,
+// which is the form most models take their
+// expected results in.
+func (d *CSVDataset) Labels() []float64 {
+	y := make([]float64, len(d.Y))
+	for i := range d.Y {
+		if len(d.Y[i]) != 0 {
+			y[i] = d.Y[i][0]
+		}
+	}
+
+	return y
+}
+
+// LoadCSV reads a whole CSV file following opts,
+// returning the first row that fails to parse as a
+// *CSVError holding its line number.
+//
+// Example Loading A Multi-Output Dataset:
+//
+//	data, err := base.LoadCSV("/tmp/.goml/weather.csv", base.CSVOptions{
+//	    Header:        true,
+//	    Delimiter:     ';',
+//	    LabelColumns:  []string{"high", "low"},
+//	    MissingValues: []string{"?"},
+//	})
+//	if err != nil {
+//	    panic(err.Error())
+//	}
+//
+//	// data.X[i] are the features and data.Y[i]
+//	// holds both labels of row i
+func LoadCSV(filepath string, opts CSVOptions) (*CSVDataset, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader, err := NewCSVReader(file, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &CSVDataset{
+		FeatureNames: reader.FeatureNames(),
+		LabelNames:   reader.LabelNames(),
+	}
+
+	for {
+		point, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		data.X = append(data.X, point.X)
+		data.Y = append(data.Y, point.Y)
+	}
+
+	if len(data.X) == 0 {
+		return nil, fmt.Errorf("ERROR: Training set has no valid examples")
+	}
+
+	data.Categories = reader.Categories()
+	return data, nil
+}
@@ -0,0 +1,200 @@
+package base
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSVReaderShouldPass1(t *testing.T) {
+	// same format as LoadDataFromCSV by default
+	reader, err := NewCSVReader(strings.NewReader("1,2,3\n4,5,6\n"), CSVOptions{})
+	assert.Nil(t, err, "Reader error should be nil")
+
+	point, err := reader.Read()
+	assert.Nil(t, err, "Read error should be nil")
+	assert.Equal(t, Datapoint{X: []float64{1, 2}, Y: []float64{3}}, point, "First row should be read")
+
+	point, err = reader.Read()
+	assert.Nil(t, err, "Read error should be nil")
+	assert.Equal(t, Datapoint{X: []float64{4, 5}, Y: []float64{6}}, point, "Second row should be read")
+
+	_, err = reader.Read()
+	assert.Equal(t, io.EOF, err, "Reader should return io.EOF at the end")
+
+	assert.Equal(t, []string{"0", "1"}, reader.FeatureNames(), "Feature names should be indices without a header")
+	assert.Equal(t, []string{"2"}, reader.LabelNames(), "Label names should be indices without a header")
+}
+
+func TestCSVReaderShouldPass2(t *testing.T) {
+	file := "price;city;rooms;size\n" +
+		"100;paris;3;NA\n" +
+		"# a comment\n" +
+		"250;berlin;?;80\n" +
+		"175;paris;2;60\n"
+
+	reader, err := NewCSVReader(strings.NewReader(file), CSVOptions{
+		Header:             true,
+		Delimiter:          ';',
+		Comment:            '#',
+		LabelColumns:       []string{"price"},
+		MissingValues:      []string{"NA", "?"},
+		CategoricalColumns: []string{"city"},
+	})
+	assert.Nil(t, err, "Reader error should be nil")
+	assert.Equal(t, []string{"city", "rooms", "size"}, reader.FeatureNames(), "Feature names should come from the header")
+	assert.Equal(t, []string{"price"}, reader.LabelNames(), "Label names should come from the header")
+
+	point, err := reader.Read()
+	assert.Nil(t, err, "Read error should be nil")
+	assert.Equal(t, []float64{100}, point.Y, "Label should be the price")
+	assert.Equal(t, []float64{0, 3}, point.X[:2], "City should be category 0")
+	assert.True(t, math.IsNaN(point.X[2]), "Missing value should be NaN")
+
+	point, err = reader.Read()
+	assert.Nil(t, err, "Read error should be nil")
+	assert.Equal(t, 1.0, point.X[0], "City should be category 1")
+	assert.True(t, math.IsNaN(point.X[1]), "Missing value should be NaN")
+
+	point, err = reader.Read()
+	assert.Nil(t, err, "Read error should be nil")
+	assert.Equal(t, []float64{0, 2, 60}, point.X, "Repeated city should keep its category")
+
+	assert.Equal(t, map[int][]string{1: {"paris", "berlin"}}, reader.Categories(), "Categories should be in order of appearance")
+}
+
+// multi-output labels selected by index, and
+// categories seeded from an earlier file
+func TestCSVReaderShouldPass3(t *testing.T) {
+	reader, err := NewCSVReader(strings.NewReader("a,1,2,3\nb,4,5,6\n"), CSVOptions{
+		LabelIndices:       []int{1, -1},
+		CategoricalIndices: []int{0},
+		Categories:         map[int][]string{0: {"b", "a"}},
+	})
+	assert.Nil(t, err, "Reader error should be nil")
+
+	point, err := reader.Read()
+	assert.Nil(t, err, "Read error should be nil")
+	assert.Equal(t, Datapoint{X: []float64{1, 2}, Y: []float64{1, 3}}, point, "Labels should be columns 1 and 3")
+
+	point, err = reader.Read()
+	assert.Nil(t, err, "Read error should be nil")
+	assert.Equal(t, Datapoint{X: []float64{0, 5}, Y: []float64{4, 6}}, point, "Seeded category should keep its index")
+}
+
+// whitespace around missing values and categories
+func TestCSVReaderShouldPass4(t *testing.T) {
+	reader, err := NewCSVReader(strings.NewReader("paris, NA,1\n paris,2 ,2\nberlin , ?,3\n"), CSVOptions{
+		MissingValues:      []string{"NA", " ? "},
+		CategoricalIndices: []int{0},
+		Categories:         map[int][]string{0: {" berlin"}},
+	})
+	assert.Nil(t, err, "Reader error should be nil")
+
+	point, err := reader.Read()
+	assert.Nil(t, err, "Read error should be nil")
+	assert.Equal(t, 1.0, point.X[0], "City should be category 1")
+	assert.True(t, math.IsNaN(point.X[1]), "Missing value with spaces should be NaN")
+
+	point, err = reader.Read()
+	assert.Nil(t, err, "Read error should be nil")
+	assert.Equal(t, []float64{1, 2}, point.X, "City with spaces should keep its category")
+
+	point, err = reader.Read()
+	assert.Nil(t, err, "Read error should be nil")
+	assert.Equal(t, 0.0, point.X[0], "Seeded category should be trimmed")
+	assert.True(t, math.IsNaN(point.X[1]), "Trimmed missing value should be NaN")
+
+	assert.Equal(t, map[int][]string{0: {"berlin", "paris"}}, reader.Categories(), "Categories should be trimmed")
+}
+
+func TestCSVReaderShouldFail1(t *testing.T) {
+	reader, err := NewCSVReader(strings.NewReader("x,y\n1,2\n1,oops\n3\n5,6\n"), CSVOptions{Header: true})
+	assert.Nil(t, err, "Reader error should be nil")
+
+	_, err = reader.Read()
+	assert.Nil(t, err, "Read error should be nil")
+
+	_, err = reader.Read()
+	assert.IsType(t, &CSVError{}, err, "Bad value should return a CSVError")
+	assert.Equal(t, 3, err.(*CSVError).Line, "Error should be on line 3")
+	assert.Equal(t, 1, err.(*CSVError).Column, "Error should be in column 1")
+
+	_, err = reader.Read()
+	assert.IsType(t, &CSVError{}, err, "Short row should return a CSVError")
+	assert.Equal(t, 4, err.(*CSVError).Line, "Error should be on line 4")
+
+	point, err := reader.Read()
+	assert.Nil(t, err, "Reading should continue after a bad row")
+	assert.Equal(t, Datapoint{X: []float64{5}, Y: []float64{6}}, point, "Row after the bad ones should be read")
+}
+
+// malformed CSV
+func TestCSVReaderShouldFail3(t *testing.T) {
+	reader, err := NewCSVReader(strings.NewReader("1,2\n3,x\"4\n5,6\n"), CSVOptions{})
+	assert.Nil(t, err, "Reader error should be nil")
+
+	_, err = reader.Read()
+	assert.Nil(t, err, "Read error should be nil")
+
+	_, err = reader.Read()
+	assert.IsType(t, &CSVError{}, err, "Malformed row should return a CSVError")
+	assert.Equal(t, 2, err.(*CSVError).Line, "Error should be on line 2")
+	assert.Equal(t, -1, err.(*CSVError).Column, "Malformed row shouldn't have a column")
+	assert.True(t, errors.Is(err, csv.ErrBareQuote), "CSVError should wrap the csv error")
+
+	point, err := reader.Read()
+	assert.Nil(t, err, "Reading should continue after a malformed row")
+	assert.Equal(t, Datapoint{X: []float64{5}, Y: []float64{6}}, point, "Row after the malformed one should be read")
+
+	_, err = NewCSVReader(strings.NewReader("x,\"y\n"), CSVOptions{Header: true})
+	assert.IsType(t, &CSVError{}, err, "Malformed header should return a CSVError")
+}
+
+func TestCSVReaderShouldFail2(t *testing.T) {
+	_, err := NewCSVReader(strings.NewReader(""), CSVOptions{})
+	assert.NotNil(t, err, "Empty file should return an error")
+
+	_, err = NewCSVReader(strings.NewReader("1,2\n"), CSVOptions{LabelColumns: []string{"y"}})
+	assert.NotNil(t, err, "Selecting a column by name without a header should return an error")
+
+	_, err = NewCSVReader(strings.NewReader("x,y\n1,2\n"), CSVOptions{Header: true, LabelColumns: []string{"z"}})
+	assert.NotNil(t, err, "Selecting a column that isn't in the header should return an error")
+
+	_, err = NewCSVReader(strings.NewReader("1,2\n"), CSVOptions{LabelIndices: []int{2}})
+	assert.NotNil(t, err, "Selecting a column out of range should return an error")
+}
+
+func TestLoadCSVShouldPass1(t *testing.T) {
+	err := ioutil.WriteFile("/tmp/.goml/load_csv.csv", []byte("a,b,label\n1,2,cat\n3,4,dog\n5,6,cat\n"), 0666)
+	assert.Nil(t, err, "Writing the file should not fail")
+
+	data, err := LoadCSV("/tmp/.goml/load_csv.csv", CSVOptions{
+		Header:             true,
+		CategoricalColumns: []string{"label"},
+	})
+	assert.Nil(t, err, "Loading error should be nil")
+	assert.Equal(t, [][]float64{{1, 2}, {3, 4}, {5, 6}}, data.X, "Features should be loaded")
+	assert.Equal(t, []float64{0, 1, 0}, data.Labels(), "Class names should be mapped to indices")
+	assert.Equal(t, []string{"a", "b"}, data.FeatureNames, "Feature names should be loaded")
+	assert.Equal(t, map[int][]string{2: {"cat", "dog"}}, data.Categories, "Categories should be loaded")
+
+	data, err = LoadCSV("/tmp/.goml/load_csv.csv", CSVOptions{Header: true, NoLabel: true, CategoricalIndices: []int{-1}})
+	assert.Nil(t, err, "Loading error should be nil")
+	assert.Equal(t, []float64{1, 2, 0}, data.X[0], "Every column should be a feature without a label")
+	assert.Nil(t, data.Y[0], "There should be no labels")
+}
+
+func TestLoadCSVShouldFail1(t *testing.T) {
+	_, err := LoadCSV("/tmp/.goml/load_csv.csv", CSVOptions{Header: true})
+	assert.IsType(t, &CSVError{}, err, "Categories in a numeric column should return a CSVError")
+
+	_, err = LoadCSV("/tmp/.goml/does_not_exist.csv", CSVOptions{})
+	assert.NotNil(t, err, "Missing file should return an error")
+}
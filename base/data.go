@@ -92,6 +92,10 @@ func LoadDataFromCSV(filepath string) ([][]float64, []float64, error) {
 // an error, or at the end of reading, both the
 // data stream channel and the errors channel will
 // be closed.
+//
+// Use a Stream if you need headers, other formats,
+// more than one epoch or shuffling, or want to keep
+// your channels open.
 func LoadDataFromCSVToStream(filepath string, data chan Datapoint, errors chan error) {
 	_, err := os.Stat(filepath)
 	if err != nil {
@@ -1,7 +1,9 @@
 package base
 
 import (
+	"fmt"
 	"math"
+	"reflect"
 )
 
 // DistanceMeasure is any function that
@@ -55,6 +57,13 @@ func ManhattanDistance(u []float64, v []float64) float64 {
 // LNorm returns a DistanceMeasure of the
 // l-p norm. L norms are a generalized family
 // of the Euclidean and Manhattan distance.
+// For p of at least 1 it's the same as
+// Minkowski(float64(p)). Smaller p still give
+// (Σ|u[i] - v[i]|^p)^(1/p) like they always did,
+// but that isn't a distance (it breaks the
+// triangle inequality), so neither IsMinkowski
+// nor IsMetric recognize it, and p = 0 gives
+// +Inf or NaN.
 //
 // https://en.wikipedia.org/wiki/Norm_(mathematics)
 //
@@ -66,13 +75,357 @@ func ManhattanDistance(u []float64, v []float64) float64 {
 // computation speed in, say, KNN.) Make
 // sure you pass in same-length vectors.
 func LNorm(p int) DistanceMeasure {
+	if p < 1 {
+		return lnorm(float64(p))
+	}
+
+	d, _ := Minkowski(float64(p))
+	return d
+}
+
+// lnorm returns the l-p "norm" for p below 1. It's
+// the same as minkowski, but it isn't shared with
+// it, so IsMinkowski doesn't take it for a distance.
+func lnorm(p float64) DistanceMeasure {
+	return func(u []float64, v []float64) float64 {
+		var sum float64
+		for i := range u {
+			sum += math.Pow(math.Abs(u[i]-v[i]), p)
+		}
+		return math.Pow(sum, 1/p)
+	}
+}
+
+// Minkowski returns the DistanceMeasure of the
+// Minkowski distance of order p
+//
+//	(Σ|u[i] - v[i]|^p)^(1/p)
+//
+// p = 1 is the Manhattan distance, p = 2 the
+// Euclidean distance, and p = +Inf the Chebyshev
+// distance (those are returned for them, since
+// they're faster.) p has to be at least 1 for this
+// to be a distance at all, so an error is returned
+// if it isn't.
+//
+// https://en.wikipedia.org/wiki/Minkowski_distance
+func Minkowski(p float64) (DistanceMeasure, error) {
+	switch {
+	case math.IsNaN(p) || p < 1:
+		return nil, fmt.Errorf("ERROR: Minkowski distance needs p of at least 1, given %v", p)
+	case p == 1:
+		return ManhattanDistance, nil
+	case p == 2:
+		return EuclideanDistance, nil
+	case math.IsInf(p, 1):
+		return ChebyshevDistance, nil
+	}
+
+	return minkowski(p), nil
+}
+
+// minkowski returns the Minkowski distance for any
+// other p. Every distance it returns shares the same
+// code, which is how IsMinkowski recognizes them.
+func minkowski(p float64) DistanceMeasure {
 	return func(u []float64, v []float64) float64 {
 		var sum float64
 		for i := range u {
-			sum += math.Pow(u[i]-v[i], float64(p))
+			sum += math.Pow(math.Abs(u[i]-v[i]), p)
+		}
+		return math.Pow(sum, 1/p)
+	}
+}
+
+// ChebyshevDistance returns the largest difference
+// between two float64 vectors along any one of
+// their features. It's the limit of the Minkowski
+// distance as p goes to infinity.
+//
+// https://en.wikipedia.org/wiki/Chebyshev_distance
+func ChebyshevDistance(u []float64, v []float64) float64 {
+	var max float64
+	for i := range u {
+		if d := math.Abs(u[i] - v[i]); d > max {
+			max = d
+		}
+	}
+	return max
+}
+
+// CosineDistance returns 1 minus the cosine of the
+// angle between two float64 vectors, which is 0 for
+// vectors pointing the same way, 1 for orthogonal
+// ones and 2 for opposite ones, no matter their
+// length. A zero vector is at a distance of 1 from
+// everything except another zero vector.
+//
+// NOTE that this isn't a metric (it doesn't obey the
+// triangle inequality), so tree indexes can't be
+// used with it.
+//
+// https://en.wikipedia.org/wiki/Cosine_similarity
+func CosineDistance(u []float64, v []float64) float64 {
+	var dot, uu, vv float64
+	for i := range u {
+		dot += u[i] * v[i]
+		uu += u[i] * u[i]
+		vv += v[i] * v[i]
+	}
+
+	return cosine(dot, uu, vv)
+}
+
+// cosine returns the cosine distance given the dot
+// product of two vectors and their squared lengths.
+func cosine(dot, uu, vv float64) float64 {
+	if uu == 0 || vv == 0 {
+		if uu == vv {
+			return 0
+		}
+		return 1
+	}
+
+	// rounding can put the cosine a hair past 1
+	return math.Max(0, 1-dot/math.Sqrt(uu*vv))
+}
+
+// HammingDistance returns the number of features
+// two float64 vectors differ in.
+//
+// https://en.wikipedia.org/wiki/Hamming_distance
+func HammingDistance(u []float64, v []float64) float64 {
+	var count float64
+	for i := range u {
+		if u[i] != v[i] {
+			count++
+		}
+	}
+	return count
+}
+
+// JaccardDistance returns the (weighted) Jaccard
+// distance between two float64 vectors
+//
+//	1 - Σmin(u[i], v[i]) / Σmax(u[i], v[i])
+//
+// For vectors of 0s and 1s (like sets of items) this
+// is 1 minus the size of their intersection over the
+// size of their union. The features shouldn't be
+// negative. Two zero vectors are at a distance of 0.
+//
+// It's only a metric when no feature is negative,
+// which IsMetric can't check, so it doesn't report
+// it as one. Set Metric on KNN (or TriangleKMeans)
+// if you know your features never are.
+//
+// https://en.wikipedia.org/wiki/Jaccard_index
+func JaccardDistance(u []float64, v []float64) float64 {
+	var min, max float64
+	for i := range u {
+		min += math.Min(u[i], v[i])
+		max += math.Max(u[i], v[i])
+	}
+
+	if max == 0 {
+		return 0
+	}
+	return 1 - min/max
+}
+
+// CanberraDistance returns the Canberra distance
+// between two float64 vectors
+//
+//	Σ|u[i] - v[i]| / (|u[i]| + |v[i]|)
+//
+// which weighs the difference along each feature by
+// how big the feature is, so it's sensitive to small
+// changes near 0. Features which are 0 in both
+// vectors are skipped.
+//
+// https://en.wikipedia.org/wiki/Canberra_distance
+func CanberraDistance(u []float64, v []float64) float64 {
+	var sum float64
+	for i := range u {
+		denominator := math.Abs(u[i]) + math.Abs(v[i])
+		if denominator != 0 {
+			sum += math.Abs(u[i]-v[i]) / denominator
+		}
+	}
+	return sum
+}
+
+// MahalanobisDistance returns the DistanceMeasure of
+// the Mahalanobis distance for data with the given
+// covariance matrix
+//
+//	sqrt((u - v)ᵀ S⁻¹ (u - v))
+//
+// which is the Euclidean distance after decorrelating
+// the features and scaling each to unit variance, so
+// features with big (or correlated) spreads don't
+// drown out the rest. The covariance has to be
+// symmetric and positive definite, or an error is
+// returned. Covariance estimates one from data.
+//
+// https://en.wikipedia.org/wiki/Mahalanobis_distance
+func MahalanobisDistance(covariance [][]float64) (DistanceMeasure, error) {
+	n := len(covariance)
+	if n == 0 {
+		return nil, fmt.Errorf("ERROR: need a covariance matrix for the Mahalanobis distance")
+	}
+
+	for i := range covariance {
+		if len(covariance[i]) != n {
+			return nil, fmt.Errorf("ERROR: covariance matrix has to be square, but row %v has %v columns instead of %v", i, len(covariance[i]), n)
+		}
+		for j := 0; j < i; j++ {
+			if covariance[i][j] != covariance[j][i] {
+				return nil, fmt.Errorf("ERROR: covariance matrix has to be symmetric, but [%v][%v] = %v and [%v][%v] = %v", i, j, covariance[i][j], j, i, covariance[j][i])
+			}
+		}
+	}
+
+	// Cholesky decomposition S = LLᵀ
+	l := make([][]float64, n)
+	for i := range l {
+		l[i] = make([]float64, i+1)
+		for j := 0; j <= i; j++ {
+			sum := covariance[i][j]
+			for k := 0; k < j; k++ {
+				sum -= l[i][k] * l[j][k]
+			}
+
+			if i == j {
+				if sum <= 0 {
+					return nil, fmt.Errorf("ERROR: covariance matrix has to be positive definite (try adding a small value to its diagonal)")
+				}
+				l[i][i] = math.Sqrt(sum)
+			} else {
+				l[i][j] = sum / l[j][j]
+			}
+		}
+	}
+
+	return mahalanobis(l), nil
+}
+
+// mahalanobis returns the Mahalanobis distance given
+// the Cholesky decomposition l of the covariance.
+// Every distance it returns shares the same code,
+// which is how IsMetric recognizes them.
+func mahalanobis(l [][]float64) DistanceMeasure {
+	return func(u []float64, v []float64) float64 {
+		// (u - v)ᵀ S⁻¹ (u - v) = |z|² where Lz = u - v
+		z := make([]float64, len(l))
+		var sum float64
+		for i := range l {
+			d := u[i] - v[i]
+			for k := 0; k < i; k++ {
+				d -= l[i][k] * z[k]
+			}
+			z[i] = d / l[i][i]
+			sum += z[i] * z[i]
+		}
+		return math.Sqrt(sum)
+	}
+}
+
+// Covariance returns the sample covariance matrix of
+// the features of x (one row per point), for use with
+// MahalanobisDistance.
+func Covariance(x [][]float64) ([][]float64, error) {
+	if len(x) < 2 {
+		return nil, fmt.Errorf("ERROR: need at least 2 points to estimate a covariance, given %v", len(x))
+	}
+
+	n := len(x[0])
+	mean := make([]float64, n)
+	for i := range x {
+		if len(x[i]) != n {
+			return nil, fmt.Errorf("ERROR: point %v has %v features but the first point has %v", i, len(x[i]), n)
+		}
+		for j := range mean {
+			mean[j] += x[i][j]
+		}
+	}
+	for j := range mean {
+		mean[j] /= float64(len(x))
+	}
+
+	covariance := make([][]float64, n)
+	for j := range covariance {
+		covariance[j] = make([]float64, n)
+	}
+	for i := range x {
+		for j := 0; j < n; j++ {
+			for k := 0; k <= j; k++ {
+				covariance[j][k] += (x[i][j] - mean[j]) * (x[i][k] - mean[k])
+			}
+		}
+	}
+	for j := 0; j < n; j++ {
+		for k := 0; k <= j; k++ {
+			covariance[j][k] /= float64(len(x) - 1)
+			covariance[k][j] = covariance[j][k]
 		}
-		return math.Pow(sum, 1/float64(p))
 	}
+
+	return covariance, nil
+}
+
+// FuncPointer returns the address of the code of d
+// (0 for nil), which tells distance functions apart.
+// It's the same for every closure returned by the
+// same function (like every Minkowski distance of
+// order other than 1, 2 and +Inf), so it can't tell
+// apart their parameters.
+func FuncPointer(d DistanceMeasure) uintptr {
+	if d == nil {
+		return 0
+	}
+	return reflect.ValueOf(d).Pointer()
+}
+
+var (
+	minkowskiCode   = FuncPointer(minkowski(3))
+	mahalanobisCode = FuncPointer(mahalanobis(nil))
+)
+
+// IsMinkowski reports whether d is one of the
+// Minkowski distances defined here: EuclideanDistance,
+// ManhattanDistance, ChebyshevDistance, or any distance
+// returned by Minkowski or LNorm. No two points are
+// closer under those than their difference along any
+// single feature, which lets indexes like KD-trees
+// skip most of the data.
+func IsMinkowski(d DistanceMeasure) bool {
+	p := FuncPointer(d)
+	if p == 0 {
+		return false
+	}
+
+	return p == FuncPointer(EuclideanDistance) || p == FuncPointer(ManhattanDistance) ||
+		p == FuncPointer(ChebyshevDistance) || p == minkowskiCode
+}
+
+// IsMetric reports whether d is one of the distances
+// defined here which is a true metric, obeying the
+// triangle inequality: every Minkowski distance, along
+// with HammingDistance, CanberraDistance and any
+// MahalanobisDistance. CosineDistance isn't one, and
+// neither is JaccardDistance for features which can be
+// negative, so it isn't reported either; models which
+// take a Metric flag (like KNN) let you vouch for it
+// when your features never are.
+func IsMetric(d DistanceMeasure) bool {
+	if IsMinkowski(d) {
+		return true
+	}
+
+	p := FuncPointer(d)
+	return p != 0 && (p == FuncPointer(HammingDistance) ||
+		p == FuncPointer(CanberraDistance) || p == mahalanobisCode)
 }
 
 func NormAbs(in float64) float64 {
@@ -84,4 +437,147 @@ func NormAbs(in float64) float64 {
 	default:
 		return 0
 	}
-}
\ No newline at end of file
+}
+// SparseDistanceMeasure is any function that maps
+// two sparse vectors (feature index -> value) to a
+// float greater than or equal to 0. Features missing
+// from a vector are 0. They mirror the dense
+// distances for data like bags of words, where most
+// features are 0.
+type SparseDistanceMeasure func(map[int]float64, map[int]float64) float64
+
+// sparseEach calls f with the values of u and v along
+// every feature which isn't 0 in at least one of them
+func sparseEach(u, v map[int]float64, f func(a, b float64)) {
+	for i, a := range u {
+		f(a, v[i])
+	}
+	for i, b := range v {
+		if _, ok := u[i]; !ok {
+			f(0, b)
+		}
+	}
+}
+
+// SparseEuclideanDistance returns the Euclidean
+// distance between two sparse vectors.
+func SparseEuclideanDistance(u map[int]float64, v map[int]float64) float64 {
+	var sum float64
+	sparseEach(u, v, func(a, b float64) {
+		sum += (a - b) * (a - b)
+	})
+	return math.Sqrt(sum)
+}
+
+// SparseManhattanDistance returns the Manhattan
+// distance between two sparse vectors.
+func SparseManhattanDistance(u map[int]float64, v map[int]float64) float64 {
+	var sum float64
+	sparseEach(u, v, func(a, b float64) {
+		sum += math.Abs(a - b)
+	})
+	return sum
+}
+
+// SparseMinkowski returns the SparseDistanceMeasure
+// of the Minkowski distance of order p. Like Minkowski,
+// it returns an error if p is less than 1.
+func SparseMinkowski(p float64) (SparseDistanceMeasure, error) {
+	switch {
+	case math.IsNaN(p) || p < 1:
+		return nil, fmt.Errorf("ERROR: Minkowski distance needs p of at least 1, given %v", p)
+	case p == 1:
+		return SparseManhattanDistance, nil
+	case p == 2:
+		return SparseEuclideanDistance, nil
+	case math.IsInf(p, 1):
+		return SparseChebyshevDistance, nil
+	}
+
+	return func(u map[int]float64, v map[int]float64) float64 {
+		var sum float64
+		sparseEach(u, v, func(a, b float64) {
+			sum += math.Pow(math.Abs(a-b), p)
+		})
+		return math.Pow(sum, 1/p)
+	}, nil
+}
+
+// SparseChebyshevDistance returns the Chebyshev
+// distance between two sparse vectors.
+func SparseChebyshevDistance(u map[int]float64, v map[int]float64) float64 {
+	var max float64
+	sparseEach(u, v, func(a, b float64) {
+		if d := math.Abs(a - b); d > max {
+			max = d
+		}
+	})
+	return max
+}
+
+// SparseCosineDistance returns the cosine distance
+// between two sparse vectors. Only the features
+// both vectors share count towards the dot product,
+// so it's cheap for sparse data.
+func SparseCosineDistance(u map[int]float64, v map[int]float64) float64 {
+	// loop over the smaller vector for the dot product
+	small, large := u, v
+	if len(small) > len(large) {
+		small, large = large, small
+	}
+
+	var dot float64
+	for i, a := range small {
+		dot += a * large[i]
+	}
+
+	var uu, vv float64
+	for _, a := range u {
+		uu += a * a
+	}
+	for _, b := range v {
+		vv += b * b
+	}
+
+	return cosine(dot, uu, vv)
+}
+
+// SparseHammingDistance returns the number of
+// features two sparse vectors differ in.
+func SparseHammingDistance(u map[int]float64, v map[int]float64) float64 {
+	var count float64
+	sparseEach(u, v, func(a, b float64) {
+		if a != b {
+			count++
+		}
+	})
+	return count
+}
+
+// SparseJaccardDistance returns the (weighted)
+// Jaccard distance between two sparse vectors.
+func SparseJaccardDistance(u map[int]float64, v map[int]float64) float64 {
+	var min, max float64
+	sparseEach(u, v, func(a, b float64) {
+		min += math.Min(a, b)
+		max += math.Max(a, b)
+	})
+
+	if max == 0 {
+		return 0
+	}
+	return 1 - min/max
+}
+
+// SparseCanberraDistance returns the Canberra
+// distance between two sparse vectors.
+func SparseCanberraDistance(u map[int]float64, v map[int]float64) float64 {
+	var sum float64
+	sparseEach(u, v, func(a, b float64) {
+		denominator := math.Abs(a) + math.Abs(b)
+		if denominator != 0 {
+			sum += math.Abs(a-b) / denominator
+		}
+	})
+	return sum
+}
@@ -1,6 +1,7 @@
 package base
 
 import (
+	"math"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -33,3 +34,182 @@ func TestDistanceManhattanShouldPass2(t *testing.T) {
 
 	assert.InDelta(t, 213.0522, ManhattanDistance(u, v), 1e-3, "Distance should match")
 }
+
+func TestDistanceLNormShouldPass1(t *testing.T) {
+	u := []float64{0, 2.5, 1.23, -10.013, 1.3}
+	v := []float64{3, 3.1, 2, 1.2, 1.2}
+
+	// odd p used to give negative (or NaN) distances
+	for _, p := range []int{1, 2, 3, 5} {
+		d := LNorm(p)(u, v)
+		assert.False(t, math.IsNaN(d), "Distance with p = %v should be a number", p)
+		assert.InDelta(t, d, LNorm(p)(v, u), 1e-12, "Distance with p = %v should be symmetric", p)
+		assert.InDelta(t, d, minkowskiDistance(t, float64(p))(u, v), 1e-12, "LNorm should be the Minkowski distance")
+	}
+
+	assert.InDelta(t, ManhattanDistance(u, v), LNorm(1)(u, v), 1e-12, "p = 1 should be the Manhattan distance")
+	assert.InDelta(t, EuclideanDistance(u, v), LNorm(2)(u, v), 1e-12, "p = 2 should be the Euclidean distance")
+	assert.InDelta(t, math.Cbrt(6*6*6+8*8*8), minkowskiDistance(t, 3)([]float64{0, 0}, []float64{-6, 8}), 1e-9, "Distance should match")
+	assert.Equal(t, ChebyshevDistance(u, v), minkowskiDistance(t, math.Inf(1))(u, v), "p = +Inf should be the Chebyshev distance")
+
+	for _, p := range []float64{0.5, 0, -1, math.NaN()} {
+		_, err := Minkowski(p)
+		assert.NotNil(t, err, "p = %v isn't a distance", p)
+		_, err = SparseMinkowski(p)
+		assert.NotNil(t, err, "p = %v isn't a distance", p)
+	}
+
+	// LNorm still gives a function for p below 1,
+	// which isn't taken for a distance
+	assert.NotPanics(t, func() { LNorm(0) }, "LNorm shouldn't panic")
+	assert.InDelta(t, 4, LNorm(-1)([]float64{0, 0}, []float64{8, 8}), 1e-12, "p = -1 should still be computed")
+	assert.False(t, IsMinkowski(LNorm(-1)), "p below 1 isn't a Minkowski distance")
+	assert.False(t, IsMetric(LNorm(-1)), "p below 1 isn't a metric")
+}
+
+// minkowskiDistance returns the Minkowski distance
+// of order p, failing the test if there isn't one.
+func minkowskiDistance(t *testing.T, p float64) DistanceMeasure {
+	d, err := Minkowski(p)
+	assert.Nil(t, err, "Minkowski error should be nil")
+	return d
+}
+
+func TestDistanceShouldPass1(t *testing.T) {
+	u := []float64{0, 2.5, 1.23, -10.013, 1.3}
+	v := []float64{3, 3.1, 2, 1.2, 1.3}
+
+	assert.InDelta(t, 11.213, ChebyshevDistance(u, v), 1e-9, "Chebyshev distance should be the largest difference")
+	assert.Equal(t, 4.0, HammingDistance(u, v), "Hamming distance should count the different features")
+	assert.InDelta(t, 1+0.6/5.6+0.77/3.23+1, CanberraDistance(u, v), 1e-9, "Canberra distance should match")
+	assert.Equal(t, 0.0, CanberraDistance([]float64{0, 1}, []float64{0, 1}), "Features which are 0 in both vectors should be skipped")
+
+	assert.InDelta(t, 0, CosineDistance([]float64{1, 2}, []float64{2, 4}), 1e-12, "Vectors pointing the same way should be at a cosine distance of 0")
+	assert.InDelta(t, 1, CosineDistance([]float64{1, 0}, []float64{0, 3}), 1e-12, "Orthogonal vectors should be at a cosine distance of 1")
+	assert.InDelta(t, 2, CosineDistance([]float64{1, 1}, []float64{-1, -1}), 1e-12, "Opposite vectors should be at a cosine distance of 2")
+	assert.Equal(t, 1.0, CosineDistance([]float64{0, 0}, []float64{1, 1}), "A zero vector should be at a cosine distance of 1")
+	assert.Equal(t, 0.0, CosineDistance([]float64{0, 0}, []float64{0, 0}), "Two zero vectors should be at a cosine distance of 0")
+
+	assert.InDelta(t, 1-2.0/4, JaccardDistance([]float64{1, 1, 0, 1}, []float64{0, 1, 1, 1}), 1e-12, "Jaccard distance of sets should be 1 - |intersection| / |union|")
+	assert.InDelta(t, 1-2.0/7, JaccardDistance([]float64{1, 2, 0}, []float64{2, 1, 3}), 1e-12, "Weighted Jaccard distance should match")
+	assert.Equal(t, 0.0, JaccardDistance([]float64{0, 0}, []float64{0, 0}), "Two empty sets should be at a Jaccard distance of 0")
+}
+
+func TestDistanceMahalanobisShouldPass1(t *testing.T) {
+	// the identity covariance gives the Euclidean distance
+	identity, err := MahalanobisDistance([][]float64{{1, 0}, {0, 1}})
+	assert.Nil(t, err, "Mahalanobis error should be nil")
+	assert.InDelta(t, 5, identity([]float64{0, 0}, []float64{3, 4}), 1e-12, "Distance should match")
+
+	// with variances 4 and 9 the features are scaled down
+	scaled, err := MahalanobisDistance([][]float64{{4, 0}, {0, 9}})
+	assert.Nil(t, err, "Mahalanobis error should be nil")
+	assert.InDelta(t, math.Sqrt(2), scaled([]float64{1, 1}, []float64{3, 4}), 1e-12, "Distance should match")
+
+	// correlated features: along the correlation is
+	// closer than across it
+	correlated, err := MahalanobisDistance([][]float64{{1, 0.9}, {0.9, 1}})
+	assert.Nil(t, err, "Mahalanobis error should be nil")
+	along := correlated([]float64{0, 0}, []float64{1, 1})
+	across := correlated([]float64{0, 0}, []float64{1, -1})
+	assert.InDelta(t, math.Sqrt(2/1.9), along, 1e-12, "Distance should match")
+	assert.InDelta(t, math.Sqrt(2/0.1), across, 1e-9, "Distance should match")
+
+	covariance, err := Covariance([][]float64{{1, 2}, {2, 4}, {3, 6.5}})
+	assert.Nil(t, err, "Covariance error should be nil")
+	assert.InDelta(t, 1, covariance[0][0], 1e-12, "Variance should match")
+	assert.InDelta(t, 2.25, covariance[0][1], 1e-12, "Covariance should match")
+	assert.Equal(t, covariance[0][1], covariance[1][0], "Covariance should be symmetric")
+
+	assert.True(t, IsMetric(scaled), "Mahalanobis distances should be metrics")
+	assert.False(t, IsMinkowski(scaled), "Mahalanobis distances aren't Minkowski distances")
+}
+
+func TestDistanceMahalanobisShouldFail1(t *testing.T) {
+	_, err := MahalanobisDistance(nil)
+	assert.NotNil(t, err, "An empty covariance should return an error")
+
+	_, err = MahalanobisDistance([][]float64{{1, 0}, {0}})
+	assert.NotNil(t, err, "A covariance which isn't square should return an error")
+
+	_, err = MahalanobisDistance([][]float64{{1, 0.5}, {0.2, 1}})
+	assert.NotNil(t, err, "A covariance which isn't symmetric should return an error")
+
+	_, err = MahalanobisDistance([][]float64{{1, 2}, {2, 1}})
+	assert.NotNil(t, err, "A covariance which isn't positive definite should return an error")
+
+	_, err = Covariance([][]float64{{1, 2}})
+	assert.NotNil(t, err, "A single point should return an error")
+
+	_, err = Covariance([][]float64{{1, 2}, {1}})
+	assert.NotNil(t, err, "Points of different lengths should return an error")
+}
+
+func TestDistanceIsMetricShouldPass1(t *testing.T) {
+	for _, d := range []DistanceMeasure{EuclideanDistance, ManhattanDistance, ChebyshevDistance, LNorm(3), minkowskiDistance(t, 1.5)} {
+		assert.True(t, IsMinkowski(d), "Minkowski distances should be recognized")
+		assert.True(t, IsMetric(d), "Minkowski distances should be metrics")
+	}
+
+	for _, d := range []DistanceMeasure{HammingDistance, CanberraDistance} {
+		assert.False(t, IsMinkowski(d), "Other metrics aren't Minkowski distances")
+		assert.True(t, IsMetric(d), "Metrics should be recognized")
+	}
+
+	// Jaccard breaks the triangle inequality for
+	// negative features: d(u, w) > d(u, v) + d(v, w)
+	u, v, w := []float64{1}, []float64{0}, []float64{-1}
+	assert.True(t, JaccardDistance(u, w) > JaccardDistance(u, v)+JaccardDistance(v, w), "Jaccard isn't a metric for negative features")
+	assert.False(t, IsMetric(JaccardDistance), "Jaccard distance shouldn't be reported as a metric")
+
+	assert.False(t, IsMetric(CosineDistance), "Cosine distance isn't a metric")
+	assert.False(t, IsMetric(func(u, v []float64) float64 { return 0 }), "Unknown functions shouldn't be recognized")
+	assert.False(t, IsMetric(nil), "nil shouldn't be recognized")
+}
+
+// sparse distances should match their dense versions
+func TestDistanceSparseShouldPass1(t *testing.T) {
+	dense := [][]float64{
+		{0, 2.5, 0, -10.013, 1.3, 0},
+		{3, 0, 0, 1.2, 1.3, 0},
+		{0, 0, 0, 0, 0, 0},
+		{1, 1, 0, 0, 2, 0},
+	}
+	sparse := make([]map[int]float64, len(dense))
+	for i := range dense {
+		sparse[i] = map[int]float64{}
+		for j, value := range dense[i] {
+			if value != 0 {
+				sparse[i][j] = value
+			}
+		}
+	}
+
+	sparseMinkowski, err := SparseMinkowski(3)
+	assert.Nil(t, err, "Minkowski error should be nil")
+
+	pairs := []struct {
+		dense  DistanceMeasure
+		sparse SparseDistanceMeasure
+	}{
+		{EuclideanDistance, SparseEuclideanDistance},
+		{ManhattanDistance, SparseManhattanDistance},
+		{minkowskiDistance(t, 3), sparseMinkowski},
+		{ChebyshevDistance, SparseChebyshevDistance},
+		{CosineDistance, SparseCosineDistance},
+		{HammingDistance, SparseHammingDistance},
+		{CanberraDistance, SparseCanberraDistance},
+	}
+
+	for _, pair := range pairs {
+		for i := range dense {
+			for j := range dense {
+				assert.InDelta(t, pair.dense(dense[i], dense[j]), pair.sparse(sparse[i], sparse[j]), 1e-9, "Sparse distance should match the dense one")
+			}
+		}
+	}
+
+	// Jaccard is for features which aren't negative
+	u, v := []float64{1, 2, 0, 0}, []float64{2, 1, 3, 0}
+	assert.InDelta(t, JaccardDistance(u, v), SparseJaccardDistance(map[int]float64{0: 1, 1: 2}, map[int]float64{0: 2, 1: 1, 2: 3}), 1e-12, "Sparse distance should match the dense one")
+}
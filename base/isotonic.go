@@ -0,0 +1,130 @@
+package base
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Isotonic maps a classifier's score (like the
+// probability it gives the positive class) to a
+// calibrated probability with a non-decreasing step
+// function fit on held out data. Unlike Platt scaling
+// it doesn't assume the scores are distorted in any
+// particular (sigmoid) shape, but it needs more data
+// to fit well, and will overfit on small sets.
+//
+// X holds the scores the function was fit at, in
+// increasing order, and Y the probability at each of
+// them. Scores in between are linearly interpolated
+// and scores outside of the range of X are clamped
+// to the ends.
+//
+// https://en.wikipedia.org/wiki/Isotonic_regression
+type Isotonic struct {
+	X []float64 `json:"x"`
+	Y []float64 `json:"y"`
+}
+
+// isotonicBlock is a run of points pooled together
+// while fitting an Isotonic regression.
+type isotonicBlock struct {
+	lo, hi      float64
+	sum, weight float64
+}
+
+func (b isotonicBlock) mean() float64 {
+	return b.sum / b.weight
+}
+
+// FitIsotonic fits an Isotonic regression to the scores
+// a classifier gave to held out points, along with the
+// points' labels. Labels greater than 0 are counted as
+// the positive class, so both -1/1 and 0/1 labels work.
+//
+// This uses the Pool Adjacent Violators algorithm:
+// points are sorted by score and neighboring groups
+// whose fraction of positives goes down are merged
+// until it only ever goes up.
+func FitIsotonic(scores []float64, y []float64) (*Isotonic, error) {
+	if len(scores) == 0 || len(scores) != len(y) {
+		return nil, fmt.Errorf("ERROR: need the same (non zero) number of scores and labels to fit an isotonic regression\n\tlength of scores: %v\n\tlength of y: %v\n", len(scores), len(y))
+	}
+
+	order := make([]int, len(scores))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] < scores[order[j]]
+	})
+
+	var blocks []isotonicBlock
+	for _, i := range order {
+		target := 0.0
+		if y[i] > 0 {
+			target = 1
+		}
+
+		// equal scores have to get the same probability,
+		// so they always start out pooled
+		if len(blocks) != 0 && blocks[len(blocks)-1].hi == scores[i] {
+			blocks[len(blocks)-1].sum += target
+			blocks[len(blocks)-1].weight++
+		} else {
+			blocks = append(blocks, isotonicBlock{
+				lo:     scores[i],
+				hi:     scores[i],
+				sum:    target,
+				weight: 1,
+			})
+		}
+
+		// pool adjacent violators
+		for len(blocks) > 1 && blocks[len(blocks)-2].mean() > blocks[len(blocks)-1].mean() {
+			last := blocks[len(blocks)-1]
+			blocks = blocks[:len(blocks)-1]
+
+			blocks[len(blocks)-1].hi = last.hi
+			blocks[len(blocks)-1].sum += last.sum
+			blocks[len(blocks)-1].weight += last.weight
+		}
+	}
+
+	iso := &Isotonic{}
+	for _, block := range blocks {
+		iso.X = append(iso.X, block.lo)
+		iso.Y = append(iso.Y, block.mean())
+
+		if block.hi != block.lo {
+			iso.X = append(iso.X, block.hi)
+			iso.Y = append(iso.Y, block.mean())
+		}
+	}
+
+	return iso, nil
+}
+
+// Probability returns the calibrated probability that
+// a point with the given score belongs to the positive
+// class.
+func (iso *Isotonic) Probability(score float64) float64 {
+	if len(iso.X) == 0 {
+		return 0.5
+	}
+
+	if score <= iso.X[0] {
+		return iso.Y[0]
+	}
+	if score >= iso.X[len(iso.X)-1] {
+		return iso.Y[len(iso.Y)-1]
+	}
+
+	// iso.X[i-1] < score <= iso.X[i]
+	i := sort.SearchFloat64s(iso.X, score)
+	if iso.X[i] == score {
+		return iso.Y[i]
+	}
+
+	t := (score - iso.X[i-1]) / (iso.X[i] - iso.X[i-1])
+	return iso.Y[i-1] + t*(iso.Y[i]-iso.Y[i-1])
+}
@@ -0,0 +1,384 @@
+package base
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SparseDatapoint is a Datapoint with sparse
+// features, where X maps (0 based) feature indices
+// to their values like the sparse linear models
+// expect. QID is the query id of the point in
+// LIBSVM/SVMlight ranking datasets, or 0.
+type SparseDatapoint struct {
+	X   map[int]float64 `json:"x"`
+	Y   []float64       `json:"y"`
+	QID int             `json:"qid,omitempty"`
+}
+
+// LIBSVMError is returned when a line of a
+// LIBSVM/SVMlight file can't be read. Line is the
+// line number in the file (starting at 1.)
+type LIBSVMError struct {
+	Line int
+	Err  error
+}
+
+// Error implements the error interface.
+func (e *LIBSVMError) Error() string {
+	return fmt.Sprintf("ERROR: line %v: %v", e.Line, e.Err)
+}
+
+// LIBSVMReader reads SparseDatapoints one line at a
+// time from a LIBSVM/SVMlight file, which looks like
+//
+//	<label>[,<label>...] [qid:<id>] <index>:<value> ... [# comment]
+//
+// Indices in the file are 1 based (the LIBSVM
+// convention) unless ZeroBased is true, and are
+// always 0 based in the returned points.
+type LIBSVMReader struct {
+	ZeroBased bool
+
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewLIBSVMReader returns a LIBSVMReader reading
+// from r.
+func NewLIBSVMReader(r io.Reader, zeroBased bool) *LIBSVMReader {
+	scanner := bufio.NewScanner(r)
+
+	// rows with a lot of features can easily be
+	// longer than the default 64KB limit
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	return &LIBSVMReader{
+		ZeroBased: zeroBased,
+		scanner:   scanner,
+	}
+}
+
+// Read returns the next point in the file. Blank
+// and comment only lines are skipped. It returns
+// io.EOF when there are no points left, and a
+// *LIBSVMError (which holds the line number) when
+// a line can't be parsed. Reading can continue past
+// a line that couldn't be parsed.
+func (r *LIBSVMReader) Read() (SparseDatapoint, error) {
+	for r.scanner.Scan() {
+		r.line++
+
+		text := r.scanner.Text()
+		if i := strings.IndexByte(text, '#'); i != -1 {
+			text = text[:i]
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		point, err := r.parse(fields)
+		if err != nil {
+			return SparseDatapoint{}, &LIBSVMError{Line: r.line, Err: err}
+		}
+
+		return point, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return SparseDatapoint{}, err
+	}
+
+	return SparseDatapoint{}, io.EOF
+}
+
+// parse turns the fields of a single line into
+// a SparseDatapoint.
+func (r *LIBSVMReader) parse(fields []string) (SparseDatapoint, error) {
+	point := SparseDatapoint{
+		X: make(map[int]float64, len(fields)-1),
+	}
+
+	for _, label := range strings.Split(fields[0], ",") {
+		y, err := strconv.ParseFloat(label, 64)
+		if err != nil {
+			return point, fmt.Errorf("invalid label %q", fields[0])
+		}
+		point.Y = append(point.Y, y)
+	}
+
+	for _, field := range fields[1:] {
+		colon := strings.IndexByte(field, ':')
+		if colon == -1 {
+			return point, fmt.Errorf("expected index:value, got %q", field)
+		}
+
+		if field[:colon] == "qid" {
+			qid, err := strconv.Atoi(field[colon+1:])
+			if err != nil {
+				return point, fmt.Errorf("invalid qid %q", field)
+			}
+			point.QID = qid
+			continue
+		}
+
+		index, err := strconv.Atoi(field[:colon])
+		if err != nil {
+			return point, fmt.Errorf("invalid index in %q", field)
+		}
+		if !r.ZeroBased {
+			if index < 1 {
+				return point, fmt.Errorf("index in %q is out of range for a 1 based file", field)
+			}
+			index--
+		}
+		if index < 0 {
+			return point, fmt.Errorf("index in %q is negative", field)
+		}
+
+		value, err := strconv.ParseFloat(field[colon+1:], 64)
+		if err != nil {
+			return point, fmt.Errorf("invalid value in %q", field)
+		}
+
+		point.X[index] = value
+	}
+
+	return point, nil
+}
+
+// LIBSVMDataset holds a whole LIBSVM/SVMlight file
+// loaded by LoadLIBSVM.
+type LIBSVMDataset struct {
+	X   []map[int]float64
+	Y   [][]float64
+	QID []int
+
+	// Features is one more than the largest
+	// feature index in X, which is what you should
+	// give the sparse linear models as their
+	// number of features.
+	Features int
+}
+
+// Labels returns the first label of every point,
+// which is the form the sparse linear models take
+// their expected results in.
+func (d *LIBSVMDataset) Labels() []float64 {
+	y := make([]float64, len(d.Y))
+	for i := range d.Y {
+		if len(d.Y[i]) != 0 {
+			y[i] = d.Y[i][0]
+		}
+	}
+
+	return y
+}
+
+// LoadLIBSVM reads a whole LIBSVM/SVMlight file,
+// returning the first line that fails to parse as
+// a *LIBSVMError holding its line number. Pass
+// zeroBased as true if the indices in the file
+// start at 0 instead of 1.
+//
+// Example Training From A LIBSVM File:
+//
+//	data, err := base.LoadLIBSVM("/tmp/.goml/news.svm", false)
+//	if err != nil {
+//		panic(err.Error())
+//	}
+//
+//	model := linear.NewSparseLogistic(base.StochasticGD, 1e-3, 1e-1, 0, base.L2, 200, data.X, data.Labels(), data.Features)
+func LoadLIBSVM(filepath string, zeroBased bool) (*LIBSVMDataset, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := NewLIBSVMReader(file, zeroBased)
+	data := &LIBSVMDataset{}
+
+	for {
+		point, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range point.X {
+			if i+1 > data.Features {
+				data.Features = i + 1
+			}
+		}
+
+		data.X = append(data.X, point.X)
+		data.Y = append(data.Y, point.Y)
+		data.QID = append(data.QID, point.QID)
+	}
+
+	if len(data.X) == 0 {
+		return nil, fmt.Errorf("ERROR: Training set has no valid examples")
+	}
+
+	return data, nil
+}
+
+// LoadLIBSVMToStream loads a LIBSVM/SVMlight file
+// just like LoadLIBSVM, but it pushes each point
+// into a data channel as it reads, like
+// LoadDataFromCSVToStream does for CSV files.
+//
+// The errors channel will be passed any errors.
+// Lines that can't be parsed are reported and
+// skipped.
+//
+// When the function returns both the data stream
+// channel and the errors channel will be closed.
+func LoadLIBSVMToStream(filepath string, zeroBased bool, data chan SparseDatapoint, errors chan error) {
+	defer close(data)
+	defer close(errors)
+
+	file, err := os.Open(filepath)
+	if err != nil {
+		errors <- err
+		return
+	}
+	defer file.Close()
+
+	reader := NewLIBSVMReader(file, zeroBased)
+	for {
+		point, err := reader.Read()
+		if err == io.EOF {
+			return
+		}
+		if _, ok := err.(*LIBSVMError); ok {
+			errors <- err
+			continue
+		}
+		if err != nil {
+			errors <- err
+			return
+		}
+
+		data <- point
+	}
+}
+
+// LIBSVMWriter writes SparseDatapoints as lines of
+// a LIBSVM/SVMlight file. Indices are written 1
+// based unless ZeroBased is true, in increasing
+// order, and features with a value of 0 are left
+// out. Points with a QID other than 0 get a qid
+// field.
+type LIBSVMWriter struct {
+	ZeroBased bool
+
+	writer *bufio.Writer
+}
+
+// NewLIBSVMWriter returns a LIBSVMWriter writing
+// to w. Call Flush when you're done writing.
+func NewLIBSVMWriter(w io.Writer, zeroBased bool) *LIBSVMWriter {
+	return &LIBSVMWriter{
+		ZeroBased: zeroBased,
+		writer:    bufio.NewWriter(w),
+	}
+}
+
+// Write writes a single point as a line.
+func (w *LIBSVMWriter) Write(point SparseDatapoint) error {
+	if len(point.Y) == 0 {
+		return fmt.Errorf("ERROR: can't write a point with no label in LIBSVM format")
+	}
+
+	labels := make([]string, len(point.Y))
+	for i := range point.Y {
+		labels[i] = strconv.FormatFloat(point.Y[i], 'g', -1, 64)
+	}
+	line := strings.Join(labels, ",")
+
+	if point.QID != 0 {
+		line += " qid:" + strconv.Itoa(point.QID)
+	}
+
+	indices := make([]int, 0, len(point.X))
+	for i, v := range point.X {
+		if i < 0 {
+			return fmt.Errorf("ERROR: can't write negative feature index %v", i)
+		}
+		if v != 0 {
+			indices = append(indices, i)
+		}
+	}
+	sort.Ints(indices)
+
+	offset := 1
+	if w.ZeroBased {
+		offset = 0
+	}
+
+	for _, i := range indices {
+		line += " " + strconv.Itoa(i+offset) + ":" + strconv.FormatFloat(point.X[i], 'g', -1, 64)
+	}
+
+	_, err := w.writer.WriteString(line + "\n")
+	return err
+}
+
+// Flush writes any buffered lines to the
+// underlying io.Writer.
+func (w *LIBSVMWriter) Flush() error {
+	return w.writer.Flush()
+}
+
+// SaveLIBSVM takes in a filepath, sparse features x
+// with their labels y and (optionally, it can be
+// nil) query ids and saves them in LIBSVM/SVMlight
+// format so LoadLIBSVM can read them back.
+func SaveLIBSVM(filepath string, x []map[int]float64, y []float64, qid []int, zeroBased bool) error {
+	if len(x) == 0 || len(x) != len(y) {
+		return fmt.Errorf("ERROR: Training set (either x or y or both) has no examples or the lengths of the dataset don't match\n\tlength of x: %v\n\tlength of y: %v\n", len(x), len(y))
+	}
+	if qid != nil && len(qid) != len(x) {
+		return fmt.Errorf("ERROR: length of the query ids (%v) doesn't match the length of the dataset (%v)", len(qid), len(x))
+	}
+
+	file, err := os.Create(filepath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := NewLIBSVMWriter(file, zeroBased)
+	for i := range x {
+		point := SparseDatapoint{
+			X: x[i],
+			Y: []float64{y[i]},
+		}
+		if qid != nil {
+			point.QID = qid[i]
+		}
+
+		err = writer.Write(point)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = writer.Flush()
+	if err != nil {
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,130 @@
+package base
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLIBSVMReaderShouldPass1(t *testing.T) {
+	file := "# header comment\n" +
+		"1 1:0.5 3:2\n" +
+		"\n" +
+		"-1 qid:7 2:1.5 # trailing comment\n" +
+		"0,2 4:1\n"
+
+	reader := NewLIBSVMReader(strings.NewReader(file), false)
+
+	point, err := reader.Read()
+	assert.Nil(t, err, "Read error should be nil")
+	assert.Equal(t, SparseDatapoint{X: map[int]float64{0: 0.5, 2: 2}, Y: []float64{1}}, point, "Indices should be shifted to 0 based")
+
+	point, err = reader.Read()
+	assert.Nil(t, err, "Read error should be nil")
+	assert.Equal(t, SparseDatapoint{X: map[int]float64{1: 1.5}, Y: []float64{-1}, QID: 7}, point, "qid should be read")
+
+	point, err = reader.Read()
+	assert.Nil(t, err, "Read error should be nil")
+	assert.Equal(t, []float64{0, 2}, point.Y, "Multiple labels should be read")
+
+	_, err = reader.Read()
+	assert.Equal(t, io.EOF, err, "Reader should return io.EOF at the end")
+}
+
+func TestLIBSVMReaderShouldPass2(t *testing.T) {
+	reader := NewLIBSVMReader(strings.NewReader("1 0:4 2:5\n"), true)
+
+	point, err := reader.Read()
+	assert.Nil(t, err, "Read error should be nil")
+	assert.Equal(t, map[int]float64{0: 4, 2: 5}, point.X, "Zero based indices should be kept")
+}
+
+func TestLIBSVMReaderShouldFail1(t *testing.T) {
+	reader := NewLIBSVMReader(strings.NewReader("1 1:2\nfoo 1:2\n1 0:2\n1 1-2\n1 2:x\n1 3:1\n"), false)
+
+	_, err := reader.Read()
+	assert.Nil(t, err, "Read error should be nil")
+
+	for line := 2; line <= 5; line++ {
+		_, err = reader.Read()
+		assert.IsType(t, &LIBSVMError{}, err, "Bad line should return a LIBSVMError")
+		assert.Equal(t, line, err.(*LIBSVMError).Line, "Error should hold the line number")
+	}
+
+	point, err := reader.Read()
+	assert.Nil(t, err, "Reading should continue after a bad line")
+	assert.Equal(t, map[int]float64{2: 1}, point.X, "Line after the bad ones should be read")
+}
+
+func TestLIBSVMWriterShouldPass1(t *testing.T) {
+	buf := &bytes.Buffer{}
+	writer := NewLIBSVMWriter(buf, false)
+
+	assert.Nil(t, writer.Write(SparseDatapoint{X: map[int]float64{4: 1.5, 0: 2, 2: 0}, Y: []float64{1}}), "Write error should be nil")
+	assert.Nil(t, writer.Write(SparseDatapoint{X: map[int]float64{1: -1}, Y: []float64{0, 3}, QID: 2}), "Write error should be nil")
+	assert.Nil(t, writer.Flush(), "Flush error should be nil")
+
+	assert.Equal(t, "1 1:2 5:1.5\n0,3 qid:2 2:-1\n", buf.String(), "Points should be written in 1 based LIBSVM format")
+
+	buf.Reset()
+	writer = NewLIBSVMWriter(buf, true)
+	assert.Nil(t, writer.Write(SparseDatapoint{X: map[int]float64{0: 2}, Y: []float64{1}}), "Write error should be nil")
+	assert.Nil(t, writer.Flush(), "Flush error should be nil")
+	assert.Equal(t, "1 0:2\n", buf.String(), "Points should be written in 0 based LIBSVM format")
+
+	assert.NotNil(t, writer.Write(SparseDatapoint{X: map[int]float64{0: 2}}), "Writing a point with no label should return an error")
+}
+
+func TestLIBSVMRoundTripShouldPass1(t *testing.T) {
+	x := []map[int]float64{
+		{0: 1, 9: 0.25},
+		{3: -2},
+		{},
+	}
+	y := []float64{1, 0, 1}
+	qid := []int{1, 1, 2}
+
+	for _, zeroBased := range []bool{false, true} {
+		err := SaveLIBSVM("/tmp/.goml/round_trip.svm", x, y, qid, zeroBased)
+		assert.Nil(t, err, "Saving error should be nil")
+
+		data, err := LoadLIBSVM("/tmp/.goml/round_trip.svm", zeroBased)
+		assert.Nil(t, err, "Loading error should be nil")
+		assert.Equal(t, x, data.X, "Features should survive a round trip")
+		assert.Equal(t, y, data.Labels(), "Labels should survive a round trip")
+		assert.Equal(t, qid, data.QID, "Query ids should survive a round trip")
+		assert.Equal(t, 10, data.Features, "Features should be one more than the largest index")
+	}
+}
+
+func TestLoadLIBSVMToStreamShouldPass1(t *testing.T) {
+	err := SaveLIBSVM("/tmp/.goml/stream.svm", []map[int]float64{{0: 1}, {1: 2}}, []float64{1, -1}, nil, false)
+	assert.Nil(t, err, "Saving error should be nil")
+
+	data := make(chan SparseDatapoint, 10)
+	errors := make(chan error, 10)
+
+	go LoadLIBSVMToStream("/tmp/.goml/stream.svm", false, data, errors)
+
+	var points []SparseDatapoint
+	for point := range data {
+		points = append(points, point)
+	}
+	for err := range errors {
+		assert.Nil(t, err, "Stream error should be nil")
+	}
+
+	assert.Len(t, points, 2, "Both points should be streamed")
+	assert.Equal(t, map[int]float64{1: 2}, points[1].X, "Points should be read in order")
+}
+
+func TestLIBSVMShouldFail1(t *testing.T) {
+	assert.NotNil(t, SaveLIBSVM("/tmp/.goml/bad.svm", []map[int]float64{{0: 1}}, []float64{}, nil, false), "Mismatched lengths should return an error")
+	assert.NotNil(t, SaveLIBSVM("/tmp/.goml/bad.svm", []map[int]float64{{0: 1}}, []float64{1}, []int{1, 2}, false), "Mismatched query ids should return an error")
+
+	_, err := LoadLIBSVM("/tmp/.goml/does_not_exist.svm", false)
+	assert.NotNil(t, err, "Missing file should return an error")
+}
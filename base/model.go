@@ -6,6 +6,8 @@
 // persisting it to files, and optimizing functions
 package base
 
+import "context"
+
 // OptimizationMethod defines a type enum which
 // (using constants declared below) lets a user
 // pass in a optimization method to use when
@@ -84,6 +86,28 @@ type OnlineModel interface {
 	RestoreFromFile(string) error
 }
 
+// ProbabilisticClassifier is a classifier which can
+// give the probability of the input being in each
+// class, not just its best guess. Each model documents
+// the order of the classes in PredictProba's output,
+// and the probabilities add up to 1.
+type ProbabilisticClassifier interface {
+	Predict([]float64, ...bool) ([]float64, error)
+	PredictProba([]float64, ...bool) ([]float64, error)
+}
+
+// ContextOnlineModel is an online model which learns
+// until its data stream is closed or the given
+// context is done, passing its callbacks a copy
+// of the parameters as described in OnlineOptions.
+// Stats can be called at any time, even while the
+// model is learning.
+type ContextOnlineModel interface {
+	Predict([]float64, ...bool) ([]float64, error)
+	OnlineLearnContext(context.Context, <-chan Datapoint, OnlineOptions) error
+	Stats() OnlineStats
+}
+
 // OnlineTextModel holds the interface for text
 // classifiers. They have the refular learn
 // & predict functions, but don't include
@@ -20,6 +20,11 @@ func Normalize(x [][]float64) {
 // NormalizePoint is the same as Normalize,
 // but it only operates on one singular datapoint,
 // normalizing it's value to unit length.
+//
+// NOTE that this modifies x in place! If the
+// slice is shared with anything else (a cache,
+// a support vector, the caller of a model's
+// Predict) use NormalizedPoint instead.
 func NormalizePoint(x []float64) {
 
 	var sum float64
@@ -40,9 +45,24 @@ func NormalizePoint(x []float64) {
 	}
 }
 
+// NormalizedPoint returns a copy of x normalized
+// to unit length, leaving x itself untouched.
+// This is what the models use when they're asked
+// to normalize an input.
+func NormalizedPoint(x []float64) []float64 {
+	normalized := make([]float64, len(x))
+	copy(normalized, x)
+	NormalizePoint(normalized)
+
+	return normalized
+}
+
 // NormalizeSparsePoint is the same as Normalize,
 // but it only operates on one singular datapoint,
 // normalizing it's value to unit length.
+//
+// NOTE that this modifies x in place! Use
+// NormalizedSparsePoint to get a normalized copy.
 func NormalizeSparsePoint(x map[int]float64) {
 
 	var sum float64
@@ -63,3 +83,15 @@ func NormalizeSparsePoint(x map[int]float64) {
 	}
 }
 
+// NormalizedSparsePoint returns a copy of x
+// normalized to unit length, leaving x itself
+// untouched.
+func NormalizedSparsePoint(x map[int]float64) map[int]float64 {
+	normalized := make(map[int]float64, len(x))
+	for i, v := range x {
+		normalized[i] = v
+	}
+	NormalizeSparsePoint(normalized)
+
+	return normalized
+}
@@ -99,6 +99,32 @@ func TestNormalizePointShouldPass3(t *testing.T) {
 	}
 }
 
+func TestNormalizedPointShouldPass1(t *testing.T) {
+	x := []float64{3, 4}
+
+	normalized := NormalizedPoint(x)
+
+	assert.Equal(t, []float64{0.6, 0.8}, normalized, "Normalized point should have unit length")
+	assert.Equal(t, []float64{3, 4}, x, "Input should not be modified")
+}
+
+func TestNormalizedPointShouldPass2(t *testing.T) {
+	x := []float64{0, 0}
+
+	normalized := NormalizedPoint(x)
+
+	assert.Equal(t, []float64{0, 0}, normalized, "The zero vector should normalize to the zero vector")
+}
+
+func TestNormalizedSparsePointShouldPass1(t *testing.T) {
+	x := map[int]float64{2: 3, 10: 4}
+
+	normalized := NormalizedSparsePoint(x)
+
+	assert.Equal(t, map[int]float64{2: 0.6, 10: 0.8}, normalized, "Normalized point should have unit length")
+	assert.Equal(t, map[int]float64{2: 3, 10: 4}, x, "Input should not be modified")
+}
+
 /* Benchmarks */
 
 func BenchmarkNormalizePoint1Input(b *testing.B) {
@@ -0,0 +1,357 @@
+package base
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultCallbackBuffer is the number of parameter
+// snapshots the old style OnlineLearn methods queue
+// up for their onUpdate callback before learning
+// waits for the callback to catch up.
+const DefaultCallbackBuffer = 64
+
+// OnlineOptions configures the OnlineLearnContext
+// method of the online models.
+type OnlineOptions struct {
+	// Normalize normalizes every point (to unit
+	// length) before learning from it. This will
+	// potentially help the optimization converge
+	// faster. Remember to pass normalize to
+	// Predict too!
+	Normalize bool
+
+	// OnUpdate, if not nil, is called whenever the
+	// model updates its parameters, with a copy of
+	// the parameters taken right after the update.
+	// The copy is yours, so it's safe to keep or
+	// modify while the model keeps learning.
+	OnUpdate func([][]float64)
+
+	// CallbackBuffer controls how OnUpdate is
+	// called. If it's 0, OnUpdate is called from
+	// the learning goroutine itself, so learning
+	// waits for it. Otherwise a single goroutine
+	// calls OnUpdate, one snapshot at a time, and
+	// up to CallbackBuffer snapshots are queued
+	// for it. When the queue is full learning
+	// waits, unless DropUpdates is true, in which
+	// case the snapshot is dropped (and counted
+	// in the model's Stats.)
+	CallbackBuffer int
+	DropUpdates    bool
+
+	// CopyOnWrite makes it safe to call Predict
+	// from other goroutines while the model is
+	// learning. Instead of updating its parameters
+	// in place, the model updates a copy and swaps
+	// it in atomically, so Predict (which never
+	// locks) always sees a consistent set of
+	// parameters. The exported parameter field of
+	// the model (like Parameters or Centroids) is
+	// left alone while learning and only brought
+	// up to date when learning returns.
+	CopyOnWrite bool
+
+	// OnError, if not nil, is called from the
+	// learning goroutine with every error, like a
+	// point of the wrong dimension. The point is
+	// skipped and learning goes on either way.
+	OnError func(error)
+}
+
+// OnlineStats reports the progress of online
+// learning. A model's Stats method can be called
+// at any time, even while it's learning.
+type OnlineStats struct {
+	// Seen is the number of points read off of the
+	// data stream.
+	Seen int64 `json:"seen"`
+
+	// Updates is the number of times the model's
+	// parameters were updated.
+	Updates int64 `json:"updates"`
+
+	// Errors is the number of points which caused
+	// an error (and were skipped.)
+	Errors int64 `json:"errors"`
+
+	// Dropped is the number of updates OnUpdate
+	// was never called for because the callback
+	// queue was full and DropUpdates was true.
+	Dropped int64 `json:"dropped"`
+}
+
+// OnlineCounters keeps OnlineStats which can be read
+// while they're being updated. The online models
+// embed one to implement Stats.
+type OnlineCounters struct {
+	seen, updates, errors, dropped int64
+}
+
+// Stats returns the current counts.
+func (c *OnlineCounters) Stats() OnlineStats {
+	return OnlineStats{
+		Seen:    atomic.LoadInt64(&c.seen),
+		Updates: atomic.LoadInt64(&c.updates),
+		Errors:  atomic.LoadInt64(&c.errors),
+		Dropped: atomic.LoadInt64(&c.dropped),
+	}
+}
+
+// Add adds stats to the counts, for models which
+// can't use LearnOnline because they don't learn
+// from Datapoints.
+func (c *OnlineCounters) Add(stats OnlineStats) {
+	atomic.AddInt64(&c.seen, stats.Seen)
+	atomic.AddInt64(&c.updates, stats.Updates)
+	atomic.AddInt64(&c.errors, stats.Errors)
+	atomic.AddInt64(&c.dropped, stats.Dropped)
+}
+
+// OnlineStep learns from a single point. It returns
+// the parameters to send to OnUpdate if the point
+// caused an update (nil otherwise), or an error if
+// the point had to be skipped.
+type OnlineStep func(point Datapoint) ([][]float64, error)
+
+// LearnOnline runs the parts of online learning that
+// every online model shares: it reads points off of
+// dataset until it's closed (returning nil) or ctx is
+// done (returning ctx.Err()), normalizes them if asked
+// to, calls step with each one, keeps counters, and
+// hands snapshots of the updated parameters to
+// OnUpdate as described in OnlineOptions.
+//
+// Before returning it waits for every queued OnUpdate
+// call to finish, so once it returns the callback
+// won't be called again.
+func LearnOnline(ctx context.Context, dataset <-chan Datapoint, opts OnlineOptions, counters *OnlineCounters, step OnlineStep) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	dispatch := newDispatcher(opts, counters)
+	defer dispatch.close()
+
+	for {
+		var point Datapoint
+		var more bool
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case point, more = <-dataset:
+		}
+
+		if !more {
+			return nil
+		}
+
+		atomic.AddInt64(&counters.seen, 1)
+
+		if opts.Normalize {
+			point.X = NormalizedPoint(point.X)
+		}
+
+		params, err := step(point)
+		if err != nil {
+			atomic.AddInt64(&counters.errors, 1)
+			if opts.OnError != nil {
+				opts.OnError(err)
+			}
+			continue
+		}
+
+		if params == nil {
+			continue
+		}
+
+		atomic.AddInt64(&counters.updates, 1)
+		if opts.OnUpdate != nil {
+			err = dispatch.send(ctx, snapshot(params))
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// snapshot returns a deep copy of params.
+func snapshot(params [][]float64) [][]float64 {
+	copied := make([][]float64, len(params))
+	for i := range params {
+		copied[i] = append([]float64{}, params[i]...)
+	}
+
+	return copied
+}
+
+// dispatcher calls OnUpdate, either right away or
+// from a single goroutine reading off of a bounded
+// queue.
+type dispatcher struct {
+	opts     OnlineOptions
+	counters *OnlineCounters
+
+	queue chan [][]float64
+	wg    sync.WaitGroup
+}
+
+// newDispatcher returns a dispatcher for opts,
+// starting its goroutine if it needs one.
+func newDispatcher(opts OnlineOptions, counters *OnlineCounters) *dispatcher {
+	d := &dispatcher{
+		opts:     opts,
+		counters: counters,
+	}
+
+	if opts.OnUpdate != nil && opts.CallbackBuffer > 0 {
+		d.queue = make(chan [][]float64, opts.CallbackBuffer)
+
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			for params := range d.queue {
+				opts.OnUpdate(params)
+			}
+		}()
+	}
+
+	return d
+}
+
+// send hands params to OnUpdate.
+func (d *dispatcher) send(ctx context.Context, params [][]float64) error {
+	if d.queue == nil {
+		d.opts.OnUpdate(params)
+		return nil
+	}
+
+	if d.opts.DropUpdates {
+		select {
+		case d.queue <- params:
+		default:
+			atomic.AddInt64(&d.counters.dropped, 1)
+		}
+		return nil
+	}
+
+	select {
+	case d.queue <- params:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// close waits for every queued update to be handed
+// to OnUpdate.
+func (d *dispatcher) close() {
+	if d.queue == nil {
+		return
+	}
+
+	close(d.queue)
+	d.wg.Wait()
+}
+
+// Snapshot holds the parameters of a model learning
+// with OnlineOptions.CopyOnWrite. The learning
+// goroutine Stores a fresh copy after every update
+// and Predict Loads whichever copy is the latest,
+// without either of them locking. A stored copy
+// must never be changed.
+//
+// Most models keep their parameters as [][]float64
+// and use Load and Store. Models which keep them as
+// something else (like the support vectors of a
+// KernelPerceptron) use LoadValue and StoreValue.
+//
+// The zero value is empty, and Load returns nil
+// until something is stored.
+type Snapshot struct {
+	value atomic.Value
+}
+
+// snapshotValue wraps whatever is stored, because
+// an atomic.Value has to be given the same type
+// every time
+type snapshotValue struct {
+	params interface{}
+}
+
+// Load returns the latest stored parameters, or
+// nil if there are none.
+func (s *Snapshot) Load() [][]float64 {
+	params, _ := s.LoadValue().([][]float64)
+	return params
+}
+
+// Store swaps in params as the latest parameters.
+func (s *Snapshot) Store(params [][]float64) {
+	s.StoreValue(params)
+}
+
+// LoadValue returns the latest stored parameters,
+// whatever their type, or nil if there are none.
+func (s *Snapshot) LoadValue() interface{} {
+	stored, _ := s.value.Load().(snapshotValue)
+	return stored.params
+}
+
+// StoreValue swaps in params as the latest
+// parameters.
+func (s *Snapshot) StoreValue(params interface{}) {
+	s.value.Store(snapshotValue{params: params})
+}
+
+// Clear empties the snapshot, so Load returns nil.
+// Models clear it once they've copied the final
+// parameters back into their exported fields.
+func (s *Snapshot) Clear() {
+	s.value.Store(snapshotValue{})
+}
+
+// CopyOnWrite calls learn, which learns online
+// (usually through LearnOnline.) If copyOnWrite is
+// true, it first stores params (the model's current
+// parameters, which won't be changed) as the latest
+// snapshot, and once learn returns it passes the
+// latest snapshot to publish, which should bring the
+// model's exported parameter field up to date, before
+// clearing the snapshot so Predict goes back to
+// reading that field. It returns learn's error.
+//
+// Example (in a model's OnlineLearnContext):
+//
+//     err := l.online.CopyOnWrite(opts.CopyOnWrite, [][]float64{l.Parameters}, func(latest interface{}) {
+//         l.Parameters = latest.([][]float64)[0]
+//     }, func() error {
+//         return base.LearnOnline(ctx, dataset, opts, &l.online.OnlineCounters, step)
+//     })
+func (s *Snapshot) CopyOnWrite(copyOnWrite bool, params interface{}, publish func(latest interface{}), learn func() error) error {
+	if !copyOnWrite {
+		return learn()
+	}
+
+	s.StoreValue(params)
+	err := learn()
+
+	// bring the exported field up to date before
+	// Predict stops reading the snapshot
+	publish(s.LoadValue())
+	s.Clear()
+
+	return err
+}
+
+// OnlineState is what a model which can learn online
+// with copy on write keeps: the counters behind its
+// Stats, and the Snapshot Predict reads while it's
+// learning. Models keep one in an unexported field.
+type OnlineState struct {
+	OnlineCounters
+	Snapshot
+}
@@ -0,0 +1,263 @@
+package base
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sumStep keeps a running sum of point.X[0], skipping
+// points with no features and only updating on odd
+// values
+func sumStep(sum []float64) OnlineStep {
+	return func(point Datapoint) ([][]float64, error) {
+		if len(point.X) == 0 {
+			return nil, fmt.Errorf("ERROR: point has no features")
+		}
+
+		if int(point.X[0])%2 == 0 {
+			return nil, nil
+		}
+
+		sum[0] += point.X[0]
+		return [][]float64{sum}, nil
+	}
+}
+
+func TestLearnOnlineShouldPass1(t *testing.T) {
+	data := make(chan Datapoint, 10)
+	for i := 1; i <= 5; i++ {
+		data <- Datapoint{X: []float64{float64(i)}}
+	}
+	data <- Datapoint{}
+	close(data)
+
+	var updates [][][]float64
+	var errs []error
+	counters := &OnlineCounters{}
+	sum := []float64{0}
+
+	err := LearnOnline(context.Background(), data, OnlineOptions{
+		OnUpdate: func(params [][]float64) {
+			updates = append(updates, params)
+		},
+		OnError: func(err error) {
+			errs = append(errs, err)
+		},
+	}, counters, sumStep(sum))
+	assert.Nil(t, err, "Learning should stop without an error when the data is closed")
+
+	assert.Equal(t, OnlineStats{Seen: 6, Updates: 3, Errors: 1}, counters.Stats(), "Stats should count every point")
+	assert.Len(t, errs, 1, "The bad point should be reported")
+	assert.Equal(t, [][][]float64{{{1}}, {{4}}, {{9}}}, updates, "Each update should get a snapshot of the parameters at the time")
+
+	updates[0][0][0] = 100
+	assert.Equal(t, 9.0, sum[0], "Changing a snapshot should not change the parameters")
+}
+
+// callbacks should be called one at a time and all be
+// done by the time learning returns
+func TestLearnOnlineShouldPass2(t *testing.T) {
+	data := make(chan Datapoint, 100)
+	for i := 0; i < 100; i++ {
+		data <- Datapoint{X: []float64{1}}
+	}
+	close(data)
+
+	var mu sync.Mutex
+	running, maxRunning, calls := 0, 0, 0
+
+	err := LearnOnline(context.Background(), data, OnlineOptions{
+		OnUpdate: func(params [][]float64) {
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+
+			time.Sleep(100 * time.Microsecond)
+
+			mu.Lock()
+			running--
+			calls++
+			mu.Unlock()
+		},
+		CallbackBuffer: 4,
+	}, &OnlineCounters{}, sumStep([]float64{0}))
+	assert.Nil(t, err, "Learning should stop without an error when the data is closed")
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 100, calls, "Every update should be handed to the callback before learning returns")
+	assert.Equal(t, 1, maxRunning, "Callbacks should never run at the same time")
+}
+
+// a full queue should drop updates instead of waiting
+// when DropUpdates is set
+func TestLearnOnlineShouldPass3(t *testing.T) {
+	data := make(chan Datapoint, 10)
+	for i := 0; i < 10; i++ {
+		data <- Datapoint{X: []float64{1}}
+	}
+	close(data)
+
+	release := make(chan struct{})
+	counters := &OnlineCounters{}
+	calls := 0
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+	}()
+
+	err := LearnOnline(context.Background(), data, OnlineOptions{
+		OnUpdate: func(params [][]float64) {
+			<-release
+			calls++
+		},
+		CallbackBuffer: 1,
+		DropUpdates:    true,
+	}, counters, sumStep([]float64{0}))
+	assert.Nil(t, err, "Learning should stop without an error when the data is closed")
+
+	stats := counters.Stats()
+	assert.Equal(t, int64(10), stats.Updates, "Every update should be counted")
+	assert.True(t, stats.Dropped > 0, "Updates should be dropped while the callback is blocked")
+	assert.Equal(t, stats.Updates-stats.Dropped, int64(calls), "The callback should get every update which wasn't dropped")
+}
+
+func TestLearnOnlineShouldFail1(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// the data is never closed, so learning can only
+	// stop because of the context
+	data := make(chan Datapoint)
+	done := make(chan error, 1)
+	counters := &OnlineCounters{}
+
+	go func() {
+		done <- LearnOnline(ctx, data, OnlineOptions{}, counters, sumStep([]float64{0}))
+	}()
+
+	data <- Datapoint{X: []float64{1}}
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.Equal(t, context.Canceled, err, "Learning should return the context's error")
+	case <-time.After(time.Second):
+		t.Fatal("Learning should stop when the context is cancelled")
+	}
+
+	assert.Equal(t, int64(1), counters.Stats().Seen, "Points before cancelling should be counted")
+}
+
+// a cancelled context should also unblock learning
+// waiting on a full callback queue
+func TestLearnOnlineShouldFail2(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	data := make(chan Datapoint, 10)
+	for i := 0; i < 10; i++ {
+		data <- Datapoint{X: []float64{1}}
+	}
+
+	release := make(chan struct{})
+	done := make(chan error, 1)
+
+	go func() {
+		done <- LearnOnline(ctx, data, OnlineOptions{
+			OnUpdate: func(params [][]float64) {
+				<-release
+			},
+			CallbackBuffer: 1,
+		}, &OnlineCounters{}, sumStep([]float64{0}))
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	// the blocked callback has to be released for
+	// learning to finish handing out what's queued
+	close(release)
+
+	select {
+	case err := <-done:
+		assert.Equal(t, context.Canceled, err, "Learning should return the context's error")
+	case <-time.After(time.Second):
+		t.Fatal("Learning should stop when the context is cancelled")
+	}
+}
+
+func TestSnapshotShouldPass1(t *testing.T) {
+	var snapshot Snapshot
+	assert.Nil(t, snapshot.Load(), "An empty snapshot should load nil")
+
+	snapshot.Store([][]float64{{1, 2}})
+	assert.Equal(t, [][]float64{{1, 2}}, snapshot.Load(), "Load should return what was stored")
+
+	snapshot.Store([][]float64{{3}})
+	assert.Equal(t, [][]float64{{3}}, snapshot.Load(), "Load should return the latest store")
+
+	snapshot.Clear()
+	assert.Nil(t, snapshot.Load(), "A cleared snapshot should load nil")
+}
+
+func TestSnapshotValueShouldPass1(t *testing.T) {
+	var snapshot Snapshot
+	assert.Nil(t, snapshot.LoadValue(), "An empty snapshot should load nil")
+
+	snapshot.StoreValue([]Datapoint{{X: []float64{1}, Y: []float64{1}}})
+	assert.Equal(t, []Datapoint{{X: []float64{1}, Y: []float64{1}}}, snapshot.LoadValue(), "LoadValue should return what was stored")
+	assert.Nil(t, snapshot.Load(), "Load should return nil when something other than [][]float64 was stored")
+
+	snapshot.Store([][]float64{{3}})
+	assert.Equal(t, [][]float64{{3}}, snapshot.LoadValue(), "LoadValue should return the latest store")
+
+	snapshot.Clear()
+	assert.Nil(t, snapshot.LoadValue(), "A cleared snapshot should load nil")
+}
+
+func TestSnapshotCopyOnWriteShouldPass1(t *testing.T) {
+	var snapshot Snapshot
+	var published interface{}
+	publish := func(latest interface{}) {
+		published = latest
+	}
+
+	// learn sees the stored parameters and its
+	// last store is published
+	err := snapshot.CopyOnWrite(true, [][]float64{{1}}, publish, func() error {
+		assert.Equal(t, [][]float64{{1}}, snapshot.Load(), "The parameters should be stored before learning")
+		snapshot.Store([][]float64{{2}})
+		return nil
+	})
+	assert.Nil(t, err, "CopyOnWrite error should be nil")
+	assert.Equal(t, [][]float64{{2}}, published, "The latest snapshot should be published")
+	assert.Nil(t, snapshot.Load(), "The snapshot should be cleared after learning")
+
+	// errors are returned, but the snapshot is
+	// still published and cleared
+	published = nil
+	err = snapshot.CopyOnWrite(true, [][]float64{{1}}, publish, func() error {
+		return context.Canceled
+	})
+	assert.Equal(t, context.Canceled, err, "CopyOnWrite should return learn's error")
+	assert.Equal(t, [][]float64{{1}}, published, "The latest snapshot should be published")
+	assert.Nil(t, snapshot.Load(), "The snapshot should be cleared after learning")
+
+	// without copy on write nothing is stored
+	// or published
+	published = nil
+	err = snapshot.CopyOnWrite(false, [][]float64{{1}}, publish, func() error {
+		assert.Nil(t, snapshot.Load(), "Nothing should be stored without copy on write")
+		return nil
+	})
+	assert.Nil(t, err, "CopyOnWrite error should be nil")
+	assert.Nil(t, published, "Nothing should be published without copy on write")
+}
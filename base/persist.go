@@ -0,0 +1,137 @@
+package base
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+)
+
+// Persister is a model which can be saved to and
+// restored from a file, like every goml model.
+type Persister interface {
+	PersistToFile(string) error
+	RestoreFromFile(string) error
+}
+
+// PersistToBytes returns what model saves with its
+// PersistToFile, so it can be put inside of a bigger
+// file (like a preprocess.Pipeline or a
+// CalibratedClassifier.) Models only know how to
+// persist themselves to files, so it goes through a
+// temporary one. The model has to persist itself as
+// JSON.
+func PersistToBytes(model Persister) ([]byte, error) {
+	tmp, err := ioutil.TempFile("", "goml-model")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	err = model.PersistToFile(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := ioutil.ReadFile(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(state) {
+		return nil, fmt.Errorf("ERROR: the model (%T) didn't persist itself as JSON", model)
+	}
+
+	return state, nil
+}
+
+// RestoreFromBytes restores model from state (as
+// returned by PersistToBytes) with its own
+// RestoreFromFile, going through a temporary file.
+//
+// If model is a pointer to a struct, it's restored
+// into a copy first (sharing no exported slices, maps
+// or pointers with it), which is only swapped into
+// model once RestoreFromFile succeeds, so a bad state
+// can't leave model half restored.
+func RestoreFromBytes(model Persister, state []byte) error {
+	tmp, err := ioutil.TempFile("", "goml-model")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(state)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	v := reflect.ValueOf(model)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return model.RestoreFromFile(tmp.Name())
+	}
+
+	fresh := reflect.New(v.Elem().Type())
+	fresh.Elem().Set(deepCopy(v.Elem()))
+
+	err = fresh.Interface().(Persister).RestoreFromFile(tmp.Name())
+	if err != nil {
+		return err
+	}
+
+	v.Elem().Set(fresh.Elem())
+	return nil
+}
+
+// deepCopy returns a copy of v which shares none of
+// the slices, maps or pointers v can reach through
+// exported fields, so decoding into the copy can't
+// change v. Unexported fields, funcs, channels and
+// interfaces are copied as is.
+func deepCopy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+
+		c := reflect.New(v.Elem().Type())
+		c.Elem().Set(deepCopy(v.Elem()))
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for _, key := range v.MapKeys() {
+			c.SetMapIndex(key, deepCopy(v.MapIndex(key)))
+		}
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(deepCopy(v.Field(i)))
+			}
+		}
+		return c
+	}
+
+	return v
+}
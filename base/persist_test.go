@@ -0,0 +1,73 @@
+package base
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// halfRestorer decodes its state straight into
+// its fields, then (if Fail is set in the state)
+// errors out, leaving itself half restored
+type halfRestorer struct {
+	Weights []float64 `json:"weights"`
+	Fail    bool      `json:"fail"`
+}
+
+func (h *halfRestorer) PersistToFile(path string) error {
+	bytes, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, bytes, 0775)
+}
+
+func (h *halfRestorer) RestoreFromFile(path string) error {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(bytes, h)
+	if err != nil {
+		return err
+	}
+	if h.Fail {
+		return fmt.Errorf("ERROR: failed after decoding")
+	}
+
+	return nil
+}
+
+func TestRestoreFromBytesShouldPass1(t *testing.T) {
+	model := &halfRestorer{Weights: []float64{1, 2, 3}}
+
+	state, err := PersistToBytes(model)
+	assert.Nil(t, err, "Persist error should be nil")
+
+	restored := &halfRestorer{}
+	assert.Nil(t, RestoreFromBytes(restored, state), "Restore error should be nil")
+	assert.Equal(t, model.Weights, restored.Weights, "Restored weights should match")
+}
+
+func TestRestoreFromBytesShouldFail1(t *testing.T) {
+	weights := make([]float64, 3, 10)
+	copy(weights, []float64{1, 2, 3})
+	model := &halfRestorer{Weights: weights}
+
+	// decodes fine, then fails
+	err := RestoreFromBytes(model, []byte(`{"weights": [7, 8, 9], "fail": true}`))
+	assert.NotNil(t, err, "Restore error should not be nil")
+	assert.Equal(t, []float64{1, 2, 3}, model.Weights, "A failed restore shouldn't change the model")
+	assert.Equal(t, []float64{1, 2, 3}, weights, "A failed restore shouldn't write into the model's slices")
+	assert.False(t, model.Fail, "A failed restore shouldn't change the model")
+
+	// not JSON at all
+	err = RestoreFromBytes(model, []byte(`{"weights": [7, 8`))
+	assert.NotNil(t, err, "Restore error should not be nil")
+	assert.Equal(t, []float64{1, 2, 3}, model.Weights, "A failed restore shouldn't change the model")
+}
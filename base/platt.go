@@ -0,0 +1,174 @@
+package base
+
+import (
+	"fmt"
+	"math"
+)
+
+// Platt maps the raw decision value f of a binary
+// classifier (like the margin θx of a Perceptron) to
+// the probability that the point belongs to the
+// positive class with a sigmoid fit on held out data:
+//
+//	P(y = 1 | f) = 1 / (1 + exp(A*f + B))
+//
+// A is negative when bigger decision values mean the
+// positive class is more likely, which is the usual
+// case.
+//
+// https://en.wikipedia.org/wiki/Platt_scaling
+type Platt struct {
+	A float64 `json:"a"`
+	B float64 `json:"b"`
+}
+
+// NewPlatt returns the uncalibrated Platt scaling
+// (A = -1, B = 0), which is just the logistic sigmoid
+// of the decision value. Use FitPlatt to get
+// probabilities you can actually trust.
+func NewPlatt() *Platt {
+	return &Platt{A: -1}
+}
+
+// Probability returns the probability that a point
+// with the given decision value belongs to the
+// positive class.
+func (p *Platt) Probability(decision float64) float64 {
+	fApB := decision*p.A + p.B
+
+	// written both ways so exp never overflows
+	if fApB >= 0 {
+		return math.Exp(-fApB) / (1 + math.Exp(-fApB))
+	}
+
+	return 1 / (1 + math.Exp(fApB))
+}
+
+// plattObjective is the negative log likelihood of
+// the targets t given decision values f under the
+// sigmoid with parameters a and b.
+func plattObjective(f, t []float64, a, b float64) float64 {
+	var sum float64
+	for i := range f {
+		fApB := f[i]*a + b
+		if fApB >= 0 {
+			sum += t[i]*fApB + math.Log1p(math.Exp(-fApB))
+		} else {
+			sum += (t[i]-1)*fApB + math.Log1p(math.Exp(fApB))
+		}
+	}
+
+	return sum
+}
+
+// FitPlatt fits a Platt scaling to the decision values
+// a classifier gave to held out points, along with the
+// points' labels. Labels greater than 0 are counted as
+// the positive class, so both -1/1 and 0/1 labels work.
+//
+// Fitting on the same data the classifier learned from
+// will give overconfident probabilities, so hold some
+// data out for it.
+//
+// This uses Newton's method with backtracking line
+// search from "A Note on Platt's Probabilistic Outputs
+// for Support Vector Machines" (Lin, Lin and Weng) along
+// with Platt's regularized targets, so it's stable even
+// when the data is perfectly separable.
+func FitPlatt(decisions []float64, y []float64) (*Platt, error) {
+	if len(decisions) == 0 || len(decisions) != len(y) {
+		return nil, fmt.Errorf("ERROR: need the same (non zero) number of decision values and labels to fit a Platt scaling\n\tlength of decisions: %v\n\tlength of y: %v\n", len(decisions), len(y))
+	}
+
+	var positive, negative float64
+	for i := range y {
+		if y[i] > 0 {
+			positive++
+		} else {
+			negative++
+		}
+	}
+
+	// regularized targets keep the fit from pushing
+	// the probabilities all the way to 0 and 1
+	hiTarget := (positive + 1) / (positive + 2)
+	loTarget := 1 / (negative + 2)
+	t := make([]float64, len(y))
+	for i := range y {
+		if y[i] > 0 {
+			t[i] = hiTarget
+		} else {
+			t[i] = loTarget
+		}
+	}
+
+	const (
+		maxIterations = 100
+		minStep       = 1e-10
+		sigma         = 1e-12
+		epsilon       = 1e-5
+	)
+
+	a := 0.0
+	b := math.Log((negative + 1) / (positive + 1))
+	fval := plattObjective(decisions, t, a, b)
+
+	for iter := 0; iter < maxIterations; iter++ {
+		// gradient and Hessian (plus sigma*I so
+		// it's always positive definite)
+		h11, h22 := sigma, sigma
+		var h21, g1, g2 float64
+		for i := range decisions {
+			fApB := decisions[i]*a + b
+
+			var p, q float64
+			if fApB >= 0 {
+				p = math.Exp(-fApB) / (1 + math.Exp(-fApB))
+				q = 1 / (1 + math.Exp(-fApB))
+			} else {
+				p = 1 / (1 + math.Exp(fApB))
+				q = math.Exp(fApB) / (1 + math.Exp(fApB))
+			}
+
+			d2 := p * q
+			h11 += decisions[i] * decisions[i] * d2
+			h22 += d2
+			h21 += decisions[i] * d2
+
+			d1 := t[i] - p
+			g1 += decisions[i] * d1
+			g2 += d1
+		}
+
+		if math.Abs(g1) < epsilon && math.Abs(g2) < epsilon {
+			break
+		}
+
+		// Newton direction
+		det := h11*h22 - h21*h21
+		dA := -(h22*g1 - h21*g2) / det
+		dB := -(-h21*g1 + h11*g2) / det
+		gd := g1*dA + g2*dB
+
+		step := 1.0
+		for step >= minStep {
+			newA := a + step*dA
+			newB := b + step*dB
+			newf := plattObjective(decisions, t, newA, newB)
+
+			if newf < fval+0.0001*step*gd {
+				a, b, fval = newA, newB, newf
+				break
+			}
+
+			step /= 2
+		}
+
+		// the line search couldn't make progress
+		if step < minStep {
+			break
+		}
+	}
+
+	return &Platt{A: a, B: b}, nil
+}
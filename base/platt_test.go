@@ -0,0 +1,64 @@
+package base
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlattShouldPass1(t *testing.T) {
+	platt := NewPlatt()
+	assert.InDelta(t, 0.5, platt.Probability(0), 1e-12, "The uncalibrated probability at 0 should be 0.5")
+	assert.InDelta(t, 1/(1+math.Exp(-2)), platt.Probability(2), 1e-12, "The uncalibrated probability should be the sigmoid")
+
+	// huge decision values shouldn't overflow
+	assert.InDelta(t, 1, platt.Probability(1e6), 1e-12, "Huge positive decision values should give 1")
+	assert.InDelta(t, 0, platt.Probability(-1e6), 1e-12, "Huge negative decision values should give 0")
+}
+
+// fitting labels drawn from a known sigmoid should
+// get close to its parameters
+func TestFitPlattShouldPass1(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	truth := &Platt{A: -2, B: 0.5}
+
+	decisions := make([]float64, 20000)
+	y := make([]float64, len(decisions))
+	for i := range decisions {
+		decisions[i] = 6 * (random.Float64() - 0.5)
+		y[i] = -1
+		if random.Float64() < truth.Probability(decisions[i]) {
+			y[i] = 1
+		}
+	}
+
+	platt, err := FitPlatt(decisions, y)
+	assert.Nil(t, err, "Fitting error should be nil")
+	assert.InDelta(t, truth.A, platt.A, 0.15, "A should be close to the true A")
+	assert.InDelta(t, truth.B, platt.B, 0.15, "B should be close to the true B")
+}
+
+// perfectly separable data shouldn't blow up
+func TestFitPlattShouldPass2(t *testing.T) {
+	decisions := []float64{-3, -2, -1, 1, 2, 3}
+	y := []float64{0, 0, 0, 1, 1, 1}
+
+	platt, err := FitPlatt(decisions, y)
+	assert.Nil(t, err, "Fitting error should be nil")
+	assert.False(t, math.IsNaN(platt.A) || math.IsInf(platt.A, 0), "A should be finite")
+	assert.True(t, platt.A < 0, "A should be negative when positive decisions mean the positive class")
+
+	assert.True(t, platt.Probability(3) > 0.5, "Positive points should be more likely positive")
+	assert.True(t, platt.Probability(3) < 1, "Probabilities shouldn't be pushed all the way to 1")
+	assert.True(t, platt.Probability(-3) < 0.5, "Negative points should be less likely positive")
+}
+
+func TestFitPlattShouldFail1(t *testing.T) {
+	_, err := FitPlatt([]float64{1, 2}, []float64{1})
+	assert.NotNil(t, err, "Mismatched lengths should return an error")
+
+	_, err = FitPlatt(nil, nil)
+	assert.NotNil(t, err, "No data should return an error")
+}
@@ -0,0 +1,388 @@
+package base
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// Source is anything which returns Datapoints one at
+// a time, returning io.EOF when there are no more.
+// CSVReader is a Source, as are the readers returned
+// by the Decoders below.
+type Source interface {
+	Read() (Datapoint, error)
+}
+
+// Decoder turns an io.Reader into a Source. A Stream
+// calls its Decoder once per epoch.
+type Decoder func(io.Reader) (Source, error)
+
+// CSVDecoder returns a Decoder which reads CSV files
+// following opts (see NewCSVReader.)
+func CSVDecoder(opts CSVOptions) Decoder {
+	return func(r io.Reader) (Source, error) {
+		return NewCSVReader(r, opts)
+	}
+}
+
+// JSONLinesDecoder returns a Decoder which reads one
+// JSON encoded Datapoint (like {"x":[1,2],"y":[3]})
+// per line.
+func JSONLinesDecoder() Decoder {
+	return func(r io.Reader) (Source, error) {
+		return NewJSONLinesReader(r), nil
+	}
+}
+
+// LIBSVMDecoder returns a Decoder which reads
+// LIBSVM/SVMlight files (see NewLIBSVMReader) into
+// dense Datapoints with the given number of features,
+// so they can be fed to models which only learn from
+// dense inputs. Points with a feature index past the
+// end return a *LIBSVMError.
+func LIBSVMDecoder(zeroBased bool, features int) Decoder {
+	return func(r io.Reader) (Source, error) {
+		if features < 1 {
+			return nil, fmt.Errorf("ERROR: need at least 1 feature to read LIBSVM files into dense points, given %v", features)
+		}
+
+		return &denseLIBSVMReader{
+			reader:   NewLIBSVMReader(r, zeroBased),
+			features: features,
+		}, nil
+	}
+}
+
+// denseLIBSVMReader adapts a LIBSVMReader to return
+// dense Datapoints.
+type denseLIBSVMReader struct {
+	reader   *LIBSVMReader
+	features int
+}
+
+// Read implements Source.
+func (d *denseLIBSVMReader) Read() (Datapoint, error) {
+	point, err := d.reader.Read()
+	if err != nil {
+		return Datapoint{}, err
+	}
+
+	x := make([]float64, d.features)
+	for i, v := range point.X {
+		if i >= d.features {
+			return Datapoint{}, &LIBSVMError{
+				Line: d.reader.line,
+				Err:  fmt.Errorf("feature index %v is past the %v features given", i, d.features),
+			}
+		}
+		x[i] = v
+	}
+
+	return Datapoint{X: x, Y: point.Y}, nil
+}
+
+// JSONLinesError is returned when a line of a JSON
+// Lines file can't be read. Line is the line number
+// in the file (starting at 1.)
+type JSONLinesError struct {
+	Line int
+	Err  error
+}
+
+// Error implements the error interface.
+func (e *JSONLinesError) Error() string {
+	return fmt.Sprintf("ERROR: line %v: %v", e.Line, e.Err)
+}
+
+// JSONLinesReader reads one JSON encoded Datapoint
+// per line. Blank lines are skipped.
+type JSONLinesReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewJSONLinesReader returns a JSONLinesReader
+// reading from r.
+func NewJSONLinesReader(r io.Reader) *JSONLinesReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	return &JSONLinesReader{
+		scanner: scanner,
+	}
+}
+
+// Read returns the next Datapoint. It returns io.EOF
+// when there are none left, and a *JSONLinesError
+// (which holds the line number) when a line isn't a
+// valid Datapoint.
+func (j *JSONLinesReader) Read() (Datapoint, error) {
+	for j.scanner.Scan() {
+		j.line++
+
+		line := j.scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var point Datapoint
+		err := json.Unmarshal(line, &point)
+		if err != nil {
+			return Datapoint{}, &JSONLinesError{Line: j.line, Err: err}
+		}
+
+		return point, nil
+	}
+
+	if err := j.scanner.Err(); err != nil {
+		return Datapoint{}, err
+	}
+
+	return Datapoint{}, io.EOF
+}
+
+/*
+Stream reads Datapoints from a file or io.Reader and
+feeds them into the data channel the online models
+learn from (LeastSquares, Softmax, Perceptron, KMeans
+and friends all take a chan base.Datapoint in their
+OnlineLearn method.)
+
+A Stream can go over the data more than once (Epochs)
+and can shuffle it within a bounded buffer of
+ShuffleBuffer points, so the model doesn't see the
+data in file order without the whole file having to
+fit in memory. A bigger buffer gives a better shuffle.
+
+Unlike LoadDataFromCSVToStream, Feed never closes the
+channel you give it, so you can feed several sources
+into the same model. Close it yourself when you're
+done so the model knows to stop learning.
+
+Example Streaming A File Into A Model:
+
+	stream := base.NewFileStream("/tmp/.goml/houses.csv", base.CSVDecoder(base.CSVOptions{
+		Header:       true,
+		LabelColumns: []string{"price"},
+	}))
+	stream.Epochs = 5
+	stream.ShuffleBuffer = 1000
+
+	data := make(chan base.Datapoint, 100)
+	errors := make(chan error)
+
+	model := linear.NewLeastSquares(base.StochasticGD, 1e-4, 0, 0, nil, nil, 3)
+	go model.OnlineLearn(errors, data, func(theta [][]float64) {})
+
+	go func() {
+		err := stream.Feed(context.Background(), data)
+		if err != nil {
+			fmt.Printf("stopped streaming: %v\n", err)
+		}
+
+		close(data)
+	}()
+
+	for err := range errors {
+		fmt.Printf("learning error: %v\n", err)
+	}
+*/
+type Stream struct {
+	// Epochs is the number of passes over the
+	// data. Anything less than 1 means 1.
+	Epochs int
+
+	// ShuffleBuffer is the number of points held
+	// in memory to shuffle. 0 or 1 doesn't shuffle.
+	ShuffleBuffer int
+
+	// Seed seeds the shuffle. If it's 0 the shuffle
+	// is seeded with the current time.
+	Seed int64
+
+	// OnError, if not nil, is called with any row
+	// that fails to parse (a *CSVError, *LIBSVMError
+	// or *JSONLinesError) and the row is skipped.
+	// Otherwise Feed stops at the first bad row.
+	OnError func(error)
+
+	decode Decoder
+	path   string
+	reader io.Reader
+}
+
+// NewFileStream returns a Stream which reads the file
+// at path with decode, opening it again for every
+// epoch.
+func NewFileStream(path string, decode Decoder) *Stream {
+	return &Stream{
+		Epochs: 1,
+		decode: decode,
+		path:   path,
+	}
+}
+
+// NewReaderStream returns a Stream which reads r with
+// decode. r can only be read for more than one epoch
+// if it's also an io.Seeker (like an *os.File), so it
+// can be rewound.
+func NewReaderStream(r io.Reader, decode Decoder) *Stream {
+	return &Stream{
+		Epochs: 1,
+		decode: decode,
+		reader: r,
+	}
+}
+
+// open returns the io.Reader for the given epoch,
+// along with a function to call when the epoch is
+// done with it.
+func (s *Stream) open(epoch int) (io.Reader, func(), error) {
+	if s.path != "" {
+		file, err := os.Open(s.path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return file, func() { file.Close() }, nil
+	}
+
+	if s.reader == nil {
+		return nil, nil, fmt.Errorf("ERROR: Attempting to stream with no file or reader!")
+	}
+
+	if epoch != 0 {
+		seeker, ok := s.reader.(io.Seeker)
+		if !ok {
+			return nil, nil, fmt.Errorf("ERROR: can't stream more than one epoch from a reader which can't seek")
+		}
+
+		_, err := seeker.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return s.reader, func() {}, nil
+}
+
+// isRowError reports whether err came from a single
+// bad row (so streaming can go on past it.)
+func isRowError(err error) bool {
+	switch err.(type) {
+	case *CSVError, *LIBSVMError, *JSONLinesError:
+		return true
+	}
+
+	return false
+}
+
+// Feed sends every point of the stream into data,
+// Epochs times, shuffling if ShuffleBuffer is more
+// than 1. It blocks until it's done, ctx is done,
+// or it hits an error, and returns that error (or
+// nil.) data is never closed.
+func (s *Stream) Feed(ctx context.Context, data chan<- Datapoint) error {
+	if s.decode == nil {
+		return fmt.Errorf("ERROR: Attempting to stream with no decoder!")
+	}
+
+	seed := s.Seed
+	if seed == 0 {
+		seed = time.Now().UTC().UnixNano()
+	}
+	random := rand.New(rand.NewSource(seed))
+
+	send := func(point Datapoint) error {
+		select {
+		case data <- point:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	epochs := s.Epochs
+	if epochs < 1 {
+		epochs = 1
+	}
+
+	for epoch := 0; epoch < epochs; epoch++ {
+		r, done, err := s.open(epoch)
+		if err != nil {
+			return err
+		}
+
+		err = s.feedEpoch(r, random, send)
+		done()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// feedEpoch makes a single pass over r.
+func (s *Stream) feedEpoch(r io.Reader, random *rand.Rand, send func(Datapoint) error) error {
+	source, err := s.decode(r)
+	if err != nil {
+		return err
+	}
+
+	var buffer []Datapoint
+	for {
+		point, err := source.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if s.OnError != nil && isRowError(err) {
+				s.OnError(err)
+				continue
+			}
+			return err
+		}
+
+		if s.ShuffleBuffer <= 1 {
+			err = send(point)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if len(buffer) < s.ShuffleBuffer {
+			buffer = append(buffer, point)
+			continue
+		}
+
+		// send a random point from the full buffer
+		// and put the new one in its place
+		i := random.Intn(len(buffer))
+		err = send(buffer[i])
+		if err != nil {
+			return err
+		}
+		buffer[i] = point
+	}
+
+	random.Shuffle(len(buffer), func(i, j int) {
+		buffer[i], buffer[j] = buffer[j], buffer[i]
+	})
+	for i := range buffer {
+		err = send(buffer[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package base
+
+import (
+	"context"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// collect feeds the whole stream into a channel
+// and returns everything that came out of it
+func collect(stream *Stream) ([]Datapoint, error) {
+	data := make(chan Datapoint, 10)
+	done := make(chan error, 1)
+
+	go func() {
+		done <- stream.Feed(context.Background(), data)
+		close(data)
+	}()
+
+	var points []Datapoint
+	for point := range data {
+		points = append(points, point)
+	}
+
+	return points, <-done
+}
+
+func TestStreamShouldPass1(t *testing.T) {
+	err := ioutil.WriteFile("/tmp/.goml/stream.csv", []byte("x,y\n1,2\n3,4\n5,6\n"), 0666)
+	assert.Nil(t, err, "Writing the file should not fail")
+
+	stream := NewFileStream("/tmp/.goml/stream.csv", CSVDecoder(CSVOptions{Header: true}))
+	stream.Epochs = 2
+
+	points, err := collect(stream)
+	assert.Nil(t, err, "Feed error should be nil")
+	assert.Len(t, points, 6, "Every point should be sent once per epoch")
+	assert.Equal(t, Datapoint{X: []float64{1}, Y: []float64{2}}, points[0], "Points should be in file order without shuffling")
+	assert.Equal(t, points[:3], points[3:], "Both epochs should be the same without shuffling")
+}
+
+// shuffling should give a permutation of the data
+func TestStreamShouldPass2(t *testing.T) {
+	lines := []string{}
+	for i := 0; i < 100; i++ {
+		lines = append(lines, `{"x":[`+string(rune('0'+i%10))+`],"y":[`+string(rune('0'+i/10))+`]}`)
+	}
+
+	stream := NewReaderStream(strings.NewReader(strings.Join(lines, "\n\n")), JSONLinesDecoder())
+	stream.ShuffleBuffer = 20
+	stream.Seed = 42
+
+	points, err := collect(stream)
+	assert.Nil(t, err, "Feed error should be nil")
+	assert.Len(t, points, 100, "Every point should be sent")
+
+	inOrder := true
+	seen := []int{}
+	for i := range points {
+		id := int(points[i].Y[0]*10 + points[i].X[0])
+		seen = append(seen, id)
+		if id != i {
+			inOrder = false
+		}
+	}
+	assert.False(t, inOrder, "Points should be shuffled")
+
+	sort.Ints(seen)
+	for i := range seen {
+		assert.Equal(t, i, seen[i], "Every point should be sent exactly once")
+	}
+}
+
+func TestStreamShouldPass3(t *testing.T) {
+	stream := NewReaderStream(strings.NewReader("1 2:4\nbad\n-1 1:3\n"), LIBSVMDecoder(false, 3))
+
+	var bad []error
+	stream.OnError = func(err error) {
+		bad = append(bad, err)
+	}
+
+	points, err := collect(stream)
+	assert.Nil(t, err, "Feed error should be nil")
+	assert.Equal(t, []Datapoint{
+		{X: []float64{0, 4, 0}, Y: []float64{1}},
+		{X: []float64{3, 0, 0}, Y: []float64{-1}},
+	}, points, "LIBSVM points should be made dense")
+	assert.Len(t, bad, 1, "The bad line should be reported")
+	assert.Equal(t, 2, bad[0].(*LIBSVMError).Line, "The bad line should be line 2")
+}
+
+func TestStreamShouldFail1(t *testing.T) {
+	stream := NewReaderStream(strings.NewReader("1,2\nx,4\n5,6\n"), CSVDecoder(CSVOptions{}))
+	points, err := collect(stream)
+	assert.IsType(t, &CSVError{}, err, "Bad row should stop the stream without OnError")
+	assert.Len(t, points, 1, "Points before the bad row should be sent")
+
+	// a reader which can't seek can't be read twice
+	stream = NewReaderStream(ioutil.NopCloser(strings.NewReader("1,2\n")), CSVDecoder(CSVOptions{}))
+	stream.Epochs = 2
+	points, err = collect(stream)
+	assert.NotNil(t, err, "Streaming a second epoch from a reader that can't seek should return an error")
+	assert.Len(t, points, 1, "The first epoch should still be sent")
+
+	stream = NewReaderStream(strings.NewReader("1 5:1\n"), LIBSVMDecoder(false, 3))
+	_, err = collect(stream)
+	assert.IsType(t, &LIBSVMError{}, err, "Indices past the number of features should return an error")
+}
+
+func TestStreamShouldFail2(t *testing.T) {
+	stream := NewReaderStream(strings.NewReader("1,2\n3,4\n"), CSVDecoder(CSVOptions{}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// nobody reads the channel, so the only way out
+	// is the cancelled context
+	err := stream.Feed(ctx, make(chan Datapoint))
+	assert.Equal(t, context.Canceled, err, "Feed should stop when the context is done")
+}
@@ -0,0 +1,694 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bountylabs/goml/base"
+)
+
+// Linkage is how Agglomerative measures the distance
+// between two clusters from the distances between
+// their points.
+type Linkage int
+
+const (
+	// SingleLinkage takes the distance between the
+	// closest points of the two clusters. It finds
+	// long, stringy clusters, but chains clusters
+	// joined by a few points together.
+	SingleLinkage Linkage = iota
+
+	// CompleteLinkage takes the distance between
+	// the farthest points of the two clusters,
+	// which finds compact clusters of about the
+	// same diameter.
+	CompleteLinkage
+
+	// AverageLinkage (UPGMA) takes the mean distance
+	// between the points of the two clusters.
+	AverageLinkage
+
+	// WardLinkage merges the two clusters which
+	// grow the total within cluster variance the
+	// least, like KMeans minimizes it. It only
+	// works with the Euclidean distance.
+	WardLinkage
+)
+
+// String implements the fmt.Stringer interface.
+func (l Linkage) String() string {
+	switch l {
+	case SingleLinkage:
+		return "single"
+	case CompleteLinkage:
+		return "complete"
+	case AverageLinkage:
+		return "average"
+	case WardLinkage:
+		return "Ward"
+	}
+
+	return fmt.Sprintf("Linkage(%v)", int(l))
+}
+
+// Merge is one merge of a Dendrogram: the clusters
+// Left and Right are merged at Distance into a
+// cluster of Size points. Clusters 0 to n-1 are the
+// n points, and merge i makes cluster n+i.
+type Merge struct {
+	Left     int     `json:"left"`
+	Right    int     `json:"right"`
+	Distance float64 `json:"distance"`
+	Size     int     `json:"size"`
+}
+
+// Dendrogram is the tree of merges hierarchical
+// clustering makes, from every point on its own up
+// to one cluster of them all. Merges are in order of
+// their Distance, and can be cut at a number of
+// clusters (Cut) or a distance (CutDistance.)
+//
+// It's exported as JSON with encoding/json, or in
+// the Newick format most tree viewers read with
+// Newick.
+type Dendrogram struct {
+	// Leaves is the number of points.
+	Leaves int `json:"leaves"`
+
+	// Labels, if set, names each point in the
+	// Newick format (instead of its index.)
+	Labels []string `json:"labels,omitempty"`
+
+	Merges []Merge `json:"merges"`
+}
+
+// check returns an error if the merges don't make a
+// tree over the leaves.
+func (d *Dendrogram) check() error {
+	if d.Leaves < 1 || len(d.Merges) != d.Leaves-1 {
+		return fmt.Errorf("ERROR: a dendrogram of %v leaves needs %v merges, not %v", d.Leaves, d.Leaves-1, len(d.Merges))
+	}
+	if d.Labels != nil && len(d.Labels) != d.Leaves {
+		return fmt.Errorf("ERROR: a dendrogram of %v leaves needs a label for each, not %v", d.Leaves, len(d.Labels))
+	}
+
+	size := make([]int, 2*d.Leaves-1)
+	merged := make([]bool, 2*d.Leaves-1)
+	for i := 0; i < d.Leaves; i++ {
+		size[i] = 1
+	}
+	for i, merge := range d.Merges {
+		node := d.Leaves + i
+		for _, child := range []int{merge.Left, merge.Right} {
+			if child < 0 || child >= node || merged[child] {
+				return fmt.Errorf("ERROR: merge %v can't merge cluster %v", i, child)
+			}
+			merged[child] = true
+		}
+		if merge.Left == merge.Right {
+			return fmt.Errorf("ERROR: merge %v merges cluster %v with itself", i, merge.Left)
+		}
+
+		size[node] = size[merge.Left] + size[merge.Right]
+		if merge.Size != size[node] {
+			return fmt.Errorf("ERROR: merge %v should make a cluster of %v points, not %v", i, size[node], merge.Size)
+		}
+	}
+
+	return nil
+}
+
+// cut returns the cluster of each point after the
+// first merges merges, numbered in the order of
+// their first point.
+func (d *Dendrogram) cut(merges int) []int {
+	// union-find over the clusters, with every root
+	// pointing at the newest cluster it merged into
+	parent := make([]int, 2*d.Leaves-1)
+	for i := range parent {
+		parent[i] = i
+	}
+	find := func(i int) int {
+		root := i
+		for parent[root] != root {
+			root = parent[root]
+		}
+		for parent[i] != root {
+			parent[i], i = root, parent[i]
+		}
+
+		return root
+	}
+
+	for i, merge := range d.Merges[:merges] {
+		parent[find(merge.Left)] = d.Leaves + i
+		parent[find(merge.Right)] = d.Leaves + i
+	}
+
+	labels := make([]int, d.Leaves)
+	numbers := map[int]int{}
+	for i := range labels {
+		root := find(i)
+		if _, ok := numbers[root]; !ok {
+			numbers[root] = len(numbers)
+		}
+		labels[i] = numbers[root]
+	}
+
+	return labels
+}
+
+// Cut returns the cluster of each point when the
+// tree is cut into k clusters (numbered in the order
+// of their first point.)
+func (d *Dendrogram) Cut(k int) ([]int, error) {
+	if k < 1 || k > d.Leaves {
+		return nil, fmt.Errorf("ERROR: can only cut %v points into 1 to %v clusters, not %v", d.Leaves, d.Leaves, k)
+	}
+
+	return d.cut(d.Leaves - k), nil
+}
+
+// CutDistance returns the cluster of each point when
+// the tree is cut at the given distance, so only the
+// merges at most that far apart are made (numbered in
+// the order of their first point.)
+func (d *Dendrogram) CutDistance(distance float64) []int {
+	merges := sort.Search(len(d.Merges), func(i int) bool {
+		return d.Merges[i].Distance > distance
+	})
+
+	return d.cut(merges)
+}
+
+// Newick returns the tree in the Newick format, with
+// branch lengths given by the merge distances (so
+// every point is as far from the root as the last
+// merge's distance.) Points are named by their Labels,
+// or their index.
+//
+// https://en.wikipedia.org/wiki/Newick_format
+func (d *Dendrogram) Newick() string {
+	height := func(node int) float64 {
+		if node < d.Leaves {
+			return 0
+		}
+		return d.Merges[node-d.Leaves].Distance
+	}
+
+	format := func(f float64) string {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+
+	var b strings.Builder
+	var write func(node int)
+	write = func(node int) {
+		if node < d.Leaves {
+			b.WriteString(d.label(node))
+			return
+		}
+
+		merge := d.Merges[node-d.Leaves]
+		b.WriteString("(")
+		write(merge.Left)
+		b.WriteString(":" + format(merge.Distance-height(merge.Left)) + ",")
+		write(merge.Right)
+		b.WriteString(":" + format(merge.Distance-height(merge.Right)) + ")")
+	}
+
+	write(2*d.Leaves - 2)
+	b.WriteString(";")
+
+	return b.String()
+}
+
+// label returns the Newick name of point i, quoted
+// if it holds any characters Newick gives a meaning.
+func (d *Dendrogram) label(i int) string {
+	if d.Labels == nil {
+		return strconv.Itoa(i)
+	}
+
+	label := d.Labels[i]
+	if strings.ContainsAny(label, "()[]':;, \t\n") {
+		return "'" + strings.Replace(label, "'", "''", -1) + "'"
+	}
+
+	return label
+}
+
+/*
+Agglomerative implements bottom-up hierarchical
+clustering: every point starts as its own cluster,
+and the two closest clusters (by the Linkage) are
+merged until there's just one. The merges make up
+a Dendrogram, which can be cut into any number of
+clusters, or at any distance, without learning
+again, and exported as JSON or Newick to be drawn.
+
+Clusters are merged with the nearest neighbor chain
+algorithm over the matrix of distances between
+points, so learning takes O(n²) time and memory.
+
+https://en.wikipedia.org/wiki/Hierarchical_clustering
+
+Example Agglomerative Model Usage:
+
+	model := NewAgglomerative(4, species, WardLinkage, nil)
+
+	if model.Learn() != nil {
+		panic("Oh NO!!! There was an error learning!!")
+	}
+
+	// the species cut into 4 clusters
+	genera := model.Guesses()
+
+	// or into the clusters merged at a distance of
+	// at most 2.5
+	families := model.Dendrogram.CutDistance(2.5)
+
+	// the whole tree, to draw
+	model.Dendrogram.Labels = names
+	fmt.Println(model.Dendrogram.Newick())
+*/
+type Agglomerative struct {
+	// k is the number of clusters Learn cuts the
+	// tree into
+	k int
+
+	// trainingSet and guesses are the 'x', and
+	// 'y' of the data, just like KMeans'
+	trainingSet [][]float64
+	guesses     []int
+
+	// Linkage is how the distance between clusters
+	// is measured (SingleLinkage by default.)
+	Linkage Linkage `json:"linkage"`
+
+	// Distance is the distance between points. It
+	// defaults to base.EuclideanDistance, which is
+	// the only one WardLinkage works with.
+	Distance base.DistanceMeasure `json:"-"`
+
+	// Dendrogram holds the merges found by Learn.
+	Dendrogram *Dendrogram `json:"dendrogram"`
+
+	// Output is the io.Writer to write
+	// logging to. Defaults to os.Stdout
+	// but can be changed to any io.Writer
+	Output io.Writer `json:"-"`
+}
+
+// NewAgglomerative returns a pointer to the
+// hierarchical clustering model, which merges the
+// training set into a tree of clusters with the given
+// linkage and distance (base.EuclideanDistance if
+// it's nil), cutting it into k clusters.
+func NewAgglomerative(k int, trainingSet [][]float64, linkage Linkage, distance base.DistanceMeasure) *Agglomerative {
+	if distance == nil {
+		distance = base.EuclideanDistance
+	}
+
+	return &Agglomerative{
+		k: k,
+
+		trainingSet: trainingSet,
+		guesses:     make([]int, len(trainingSet)),
+
+		Linkage:  linkage,
+		Distance: distance,
+
+		Output: os.Stdout,
+	}
+}
+
+// UpdateTrainingSet takes in a new training set (variable x.)
+//
+// Will reset the hidden 'guesses' param of the Agglomerative model.
+func (a *Agglomerative) UpdateTrainingSet(trainingSet [][]float64) error {
+	if len(trainingSet) == 0 {
+		return fmt.Errorf("ERROR: length of given training set is 0! Need data!")
+	}
+
+	a.trainingSet = trainingSet
+	a.guesses = make([]int, len(trainingSet))
+	a.Dendrogram = nil
+
+	return nil
+}
+
+// Examples returns the number of training examples (m)
+// that the model currently is training from.
+func (a *Agglomerative) Examples() int {
+	return len(a.trainingSet)
+}
+
+// condensedIndex returns where the distance between
+// points i and j (i != j) is in a condensed distance
+// matrix of n points.
+func condensedIndex(n, i, j int) int {
+	if i > j {
+		i, j = j, i
+	}
+
+	return n*i - i*(i+1)/2 + j - i - 1
+}
+
+// Learn builds the Dendrogram of the training set and
+// cuts it into k clusters.
+func (a *Agglomerative) Learn() error {
+	if len(a.trainingSet) == 0 || len(a.trainingSet[0]) == 0 {
+		err := fmt.Errorf("ERROR: Attempting to learn with no training examples!\n")
+		fmt.Fprintf(a.Output, err.Error())
+		return err
+	}
+
+	n := len(a.trainingSet)
+	if a.k < 1 || a.k > n {
+		err := fmt.Errorf("ERROR: can only cut %v points into 1 to %v clusters, not %v\n", n, n, a.k)
+		fmt.Fprintf(a.Output, err.Error())
+		return err
+	}
+
+	if a.Linkage < SingleLinkage || a.Linkage > WardLinkage {
+		err := fmt.Errorf("ERROR: unknown linkage %v\n", a.Linkage)
+		fmt.Fprintf(a.Output, err.Error())
+		return err
+	}
+
+	if a.Distance == nil {
+		a.Distance = base.EuclideanDistance
+	}
+
+	if a.Linkage == WardLinkage && base.FuncPointer(a.Distance) != base.FuncPointer(base.EuclideanDistance) {
+		err := fmt.Errorf("ERROR: Ward linkage only works with base.EuclideanDistance\n")
+		fmt.Fprintf(a.Output, err.Error())
+		return err
+	}
+
+	fmt.Fprintf(a.Output, "Training:\n\tModel: Agglomerative (%v linkage) Clustering\n\tTraining Examples: %v\n\tFeatures: %v\n\tClasses: %v\n...\n\n", a.Linkage, n, len(a.trainingSet[0]), a.k)
+
+	dist := make([]float64, n*(n-1)/2)
+	eachPoint(n, func(start, end int) {
+		for i := start; i < end; i++ {
+			for j := i + 1; j < n; j++ {
+				dist[condensedIndex(n, i, j)] = a.Distance(a.trainingSet[i], a.trainingSet[j])
+			}
+		}
+	})
+
+	for _, d := range dist {
+		if math.IsNaN(d) {
+			err := fmt.Errorf("ERROR: the distance between two points is NaN, so they can't be merged in order\n")
+			fmt.Fprintf(a.Output, err.Error())
+			return err
+		}
+	}
+
+	a.Dendrogram = &Dendrogram{
+		Leaves: n,
+		Merges: nnChain(n, dist, a.Linkage),
+	}
+	a.guesses = a.Dendrogram.cut(n - a.k)
+
+	fmt.Fprintf(a.Output, "Training Completed.\n%v\n", a)
+
+	return nil
+}
+
+// nnChain merges the n points with the given
+// condensed distance matrix (which it updates) with
+// the nearest neighbor chain algorithm: it follows
+// nearest neighbors from cluster to cluster until
+// two are each other's nearest, and merges those.
+// Every linkage here is reducible (merging two
+// clusters never brings them closer to a third), so
+// that makes the same merges as always merging the
+// closest pair, in O(n²) time.
+//
+// https://en.wikipedia.org/wiki/Nearest-neighbor_chain_algorithm
+func nnChain(n int, dist []float64, linkage Linkage) []Merge {
+	// each cluster lives at the index of one of its
+	// points
+	size := make([]int, n)
+	active := make([]bool, n)
+	for i := range size {
+		size[i] = 1
+		active[i] = true
+	}
+
+	type pair struct {
+		a, b     int
+		distance float64
+	}
+	pairs := make([]pair, 0, n-1)
+
+	chain := []int{}
+	for len(pairs) < n-1 {
+		if len(chain) == 0 {
+			for i := range active {
+				if active[i] {
+					chain = append(chain, i)
+					break
+				}
+			}
+		}
+
+		var x, y int
+		var nearest float64
+		for {
+			x = chain[len(chain)-1]
+
+			// prefer the previous cluster on the chain
+			// on ties, so it always ends, and start from
+			// any other cluster otherwise, so clusters
+			// infinitely far apart still merge
+			if len(chain) > 1 {
+				y = chain[len(chain)-2]
+			} else {
+				for y = range active {
+					if active[y] && y != x {
+						break
+					}
+				}
+			}
+			nearest = dist[condensedIndex(n, x, y)]
+			for c := range active {
+				if !active[c] || c == x {
+					continue
+				}
+				if d := dist[condensedIndex(n, x, c)]; d < nearest {
+					y, nearest = c, d
+				}
+			}
+
+			if len(chain) > 1 && y == chain[len(chain)-2] {
+				break
+			}
+			chain = append(chain, y)
+		}
+		chain = chain[:len(chain)-2]
+
+		// merge x into y
+		pairs = append(pairs, pair{x, y, nearest})
+		for c := range active {
+			if !active[c] || c == x || c == y {
+				continue
+			}
+
+			dx, dy := dist[condensedIndex(n, x, c)], dist[condensedIndex(n, y, c)]
+			nx, ny, nc := float64(size[x]), float64(size[y]), float64(size[c])
+
+			// Lance-Williams updates
+			var d float64
+			switch linkage {
+			case SingleLinkage:
+				d = math.Min(dx, dy)
+			case CompleteLinkage:
+				d = math.Max(dx, dy)
+			case AverageLinkage:
+				d = (nx*dx + ny*dy) / (nx + ny)
+			case WardLinkage:
+				d = math.Sqrt(math.Max(0, ((nx+nc)*dx*dx+(ny+nc)*dy*dy-nc*nearest*nearest)/(nx+ny+nc)))
+			}
+			dist[condensedIndex(n, y, c)] = d
+		}
+
+		size[y] += size[x]
+		active[x] = false
+	}
+
+	// the chain finds merges out of order, so sort
+	// them and number the clusters they make
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].distance < pairs[j].distance
+	})
+
+	parent := make([]int, 2*n-1)
+	clusterSize := make([]int, 2*n-1)
+	for i := range parent {
+		parent[i] = i
+		if i < n {
+			clusterSize[i] = 1
+		}
+	}
+	find := func(i int) int {
+		root := i
+		for parent[root] != root {
+			root = parent[root]
+		}
+		for parent[i] != root {
+			parent[i], i = root, parent[i]
+		}
+
+		return root
+	}
+
+	merges := make([]Merge, len(pairs))
+	for i, p := range pairs {
+		left, right := find(p.a), find(p.b)
+		if left > right {
+			left, right = right, left
+		}
+
+		node := n + i
+		clusterSize[node] = clusterSize[left] + clusterSize[right]
+		parent[left] = node
+		parent[right] = node
+
+		merges[i] = Merge{
+			Left:     left,
+			Right:    right,
+			Distance: p.distance,
+			Size:     clusterSize[node],
+		}
+	}
+
+	return merges
+}
+
+// Cut cuts the Dendrogram into k clusters, setting
+// the guesses to them, and returns them. It's only
+// valid after Learn (or a restore.)
+func (a *Agglomerative) Cut(k int) ([]int, error) {
+	if a.Dendrogram == nil {
+		return nil, fmt.Errorf("ERROR: the model has no dendrogram! Learn (or restore) the model first")
+	}
+
+	guesses, err := a.Dendrogram.Cut(k)
+	if err != nil {
+		return nil, err
+	}
+
+	a.k = k
+	a.guesses = guesses
+	return guesses, nil
+}
+
+// CutDistance cuts the Dendrogram at the given
+// distance, setting the guesses to the clusters it
+// gives, and returns them. It's only valid after
+// Learn (or a restore.)
+func (a *Agglomerative) CutDistance(distance float64) ([]int, error) {
+	if a.Dendrogram == nil {
+		return nil, fmt.Errorf("ERROR: the model has no dendrogram! Learn (or restore) the model first")
+	}
+
+	a.guesses = a.Dendrogram.CutDistance(distance)
+
+	a.k = 0
+	for _, guess := range a.guesses {
+		if guess+1 > a.k {
+			a.k = guess + 1
+		}
+	}
+
+	return a.guesses, nil
+}
+
+// String implements the fmt interface for clean printing.
+func (a *Agglomerative) String() string {
+	if a.Dendrogram == nil || len(a.Dendrogram.Merges) == 0 {
+		return fmt.Sprintf("Agglomerative(%v linkage)", a.Linkage)
+	}
+
+	return fmt.Sprintf("Agglomerative(%v linkage)\n\tClusters: %v\n\tLast Merge: %v", a.Linkage, a.k, a.Dendrogram.Merges[len(a.Dendrogram.Merges)-1].Distance)
+}
+
+// Guesses returns the cluster of each training
+// example from the last cut.
+func (a *Agglomerative) Guesses() []int {
+	return a.guesses
+}
+
+// SaveClusteredData concatenates the training set
+// with the assigned class from clustering and saves
+// it to file, just like KMeans'.
+func (a *Agglomerative) SaveClusteredData(filepath string) error {
+	floatGuesses := []float64{}
+	for _, val := range a.guesses {
+		floatGuesses = append(floatGuesses, float64(val))
+	}
+
+	return base.SaveDataToCSV(filepath, a.trainingSet, floatGuesses, true)
+}
+
+// PersistToFile takes in an absolute filepath and saves the
+// linkage and the Dendrogram to the file as JSON, which can
+// be restored later.
+func (a *Agglomerative) PersistToFile(path string) error {
+	if path == "" {
+		return fmt.Errorf("ERROR: you just tried to persist your model to a file with no path!! That's a no-no. Try it with a valid filepath")
+	}
+
+	bytes, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, bytes, os.ModePerm)
+}
+
+// RestoreFromFile takes in a path to a persisted model
+// and restores its linkage and Dendrogram, checking
+// that the merges make a tree.
+//
+// The path must ba an absolute path or a path from the current
+// directory
+func (a *Agglomerative) RestoreFromFile(path string) error {
+	if path == "" {
+		return fmt.Errorf("ERROR: you just tried to restore your model from a file with no path! That's a no-no. Try it with a valid filepath")
+	}
+
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	restored := Agglomerative{}
+	err = json.Unmarshal(bytes, &restored)
+	if err != nil {
+		return err
+	}
+
+	if restored.Dendrogram == nil {
+		return fmt.Errorf("ERROR: no dendrogram found in %v", path)
+	}
+	err = restored.Dendrogram.check()
+	if err != nil {
+		return err
+	}
+
+	a.Linkage = restored.Linkage
+	a.Dendrogram = restored.Dendrogram
+
+	return nil
+}
@@ -0,0 +1,240 @@
+package cluster
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/bountylabs/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// linkageDistance is the distance between clusters a
+// and b by the definition of each linkage
+func linkageDistance(x [][]float64, a, b []int, linkage Linkage) float64 {
+	if linkage == WardLinkage {
+		ca, cb := mean(x, a), mean(x, b)
+		na, nb := float64(len(a)), float64(len(b))
+		return math.Sqrt(2*na*nb/(na+nb)) * base.EuclideanDistance(ca, cb)
+	}
+
+	min, max, sum := math.Inf(1), 0.0, 0.0
+	for _, i := range a {
+		for _, j := range b {
+			d := base.EuclideanDistance(x[i], x[j])
+			min, max, sum = math.Min(min, d), math.Max(max, d), sum+d
+		}
+	}
+
+	switch linkage {
+	case SingleLinkage:
+		return min
+	case CompleteLinkage:
+		return max
+	}
+	return sum / float64(len(a)*len(b))
+}
+
+// mean returns the mean of the points of x in c
+func mean(x [][]float64, c []int) []float64 {
+	m := make([]float64, len(x[0]))
+	for _, i := range c {
+		for f := range m {
+			m[f] += x[i][f] / float64(len(c))
+		}
+	}
+	return m
+}
+
+// naiveMerges returns the distance of every merge
+// made by always merging the closest two clusters
+func naiveMerges(x [][]float64, linkage Linkage) []float64 {
+	clusters := [][]int{}
+	for i := range x {
+		clusters = append(clusters, []int{i})
+	}
+
+	distances := []float64{}
+	for len(clusters) > 1 {
+		a, b, nearest := 0, 1, math.Inf(1)
+		for i := range clusters {
+			for j := i + 1; j < len(clusters); j++ {
+				if d := linkageDistance(x, clusters[i], clusters[j], linkage); d < nearest {
+					a, b, nearest = i, j, d
+				}
+			}
+		}
+
+		distances = append(distances, nearest)
+		clusters[a] = append(clusters[a], clusters[b]...)
+		clusters = append(clusters[:b], clusters[b+1:]...)
+	}
+
+	sort.Float64s(distances)
+	return distances
+}
+
+func TestAgglomerativeShouldPass1(t *testing.T) {
+	x := [][]float64{{0}, {1}, {4}, {10}}
+
+	for linkage, expected := range map[Linkage][]float64{
+		SingleLinkage:   {1, 3, 6},
+		CompleteLinkage: {1, 4, 10},
+		AverageLinkage:  {1, 3.5, 25.0 / 3},
+		WardLinkage:     {1, math.Sqrt(4.0/3) * 3.5, math.Sqrt(1.5) * 25 / 3},
+	} {
+		model := NewAgglomerative(2, x, linkage, nil)
+		model.Output = ioutil.Discard
+		assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+		merges := model.Dendrogram.Merges
+		assert.Len(t, merges, 3, "There should be a merge less than points")
+		assert.Equal(t, Merge{Left: 0, Right: 1, Distance: 1, Size: 2}, merges[0], "%v linkage should merge 0 and 1 first", linkage)
+		assert.Equal(t, []int{2, 4}, []int{merges[1].Left, merges[1].Right}, "%v linkage should merge 2 into the first cluster", linkage)
+		assert.Equal(t, []int{3, 5}, []int{merges[2].Left, merges[2].Right}, "%v linkage should merge 3 last", linkage)
+		assert.Equal(t, 4, merges[2].Size, "The last merge should hold every point")
+		for i := range expected {
+			assert.InDelta(t, expected[i], merges[i].Distance, 1e-9, "%v linkage merge %v should be at the right distance", linkage, i)
+		}
+
+		assert.Equal(t, []int{0, 0, 0, 1}, model.Guesses(), "%v linkage should be cut in 2", linkage)
+	}
+
+	model := NewAgglomerative(1, x, SingleLinkage, nil)
+	model.Output = ioutil.Discard
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+	assert.Equal(t, []int{0, 0, 0, 0}, model.Guesses(), "Cutting in 1 should put every point together")
+
+	guesses, err := model.Cut(4)
+	assert.Nil(t, err, "Cut error should be nil")
+	assert.Equal(t, []int{0, 1, 2, 3}, guesses, "Cutting in 4 should leave every point alone")
+
+	guesses, err = model.CutDistance(2)
+	assert.Nil(t, err, "Cut error should be nil")
+	assert.Equal(t, []int{0, 0, 1, 2}, guesses, "Cutting at 2 should only merge 0 and 1")
+	assert.Equal(t, guesses, model.Guesses(), "Cutting should set the guesses")
+	assert.Equal(t, []int{0, 0, 0, 0}, model.Dendrogram.CutDistance(6), "Cutting at the last merge should make it")
+
+	assert.Equal(t, "(3:6,(2:3,(0:1,1:1):2):3);", model.Dendrogram.Newick(), "Newick should give the tree with branch lengths")
+	model.Dendrogram.Labels = []string{"cat", "dog", "sea lion", "o'clock"}
+	assert.Equal(t, "('o''clock':6,('sea lion':3,(cat:1,dog:1):2):3);", model.Dendrogram.Newick(), "Newick should quote labels")
+
+	bytes, err := json.Marshal(model.Dendrogram)
+	assert.Nil(t, err, "Marshal error should be nil")
+	dendrogram := &Dendrogram{}
+	assert.Nil(t, json.Unmarshal(bytes, dendrogram), "Unmarshal error should be nil")
+	assert.Equal(t, model.Dendrogram, dendrogram, "The dendrogram should go through JSON")
+}
+
+// the nearest neighbor chain should make the same
+// merges as always merging the closest clusters
+func TestAgglomerativeShouldPass2(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+
+	for trial := 0; trial < 5; trial++ {
+		x := make([][]float64, 40)
+		for i := range x {
+			x[i] = []float64{random.NormFloat64() * 5, random.NormFloat64() * 5, random.NormFloat64()}
+		}
+
+		for _, linkage := range []Linkage{SingleLinkage, CompleteLinkage, AverageLinkage, WardLinkage} {
+			model := NewAgglomerative(3, x, linkage, nil)
+			model.Output = ioutil.Discard
+			assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+			expected := naiveMerges(x, linkage)
+			for i, merge := range model.Dendrogram.Merges {
+				assert.InDelta(t, expected[i], merge.Distance, 1e-9, "%v linkage merge %v should be at the same distance", linkage, i)
+			}
+		}
+	}
+
+	// and find well separated blobs
+	x, y := blobs(random, 400)
+	for _, linkage := range []Linkage{CompleteLinkage, AverageLinkage, WardLinkage} {
+		model := NewAgglomerative(4, x, linkage, nil)
+		model.Output = ioutil.Discard
+		assert.Nil(t, model.Learn(), "Learning error should be nil")
+		assert.True(t, purity(model.Guesses(), y) > 0.98, "%v linkage should find the blobs", linkage)
+	}
+
+	// any distance works with the other linkages
+	model := NewAgglomerative(4, x, AverageLinkage, base.ManhattanDistance)
+	model.Output = ioutil.Discard
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+	assert.True(t, purity(model.Guesses(), y) > 0.98, "Average linkage should find the blobs by Manhattan distance")
+
+	assert.Nil(t, model.SaveClusteredData("/tmp/.goml/AgglomerativeResults.csv"), "Save results error should be nil")
+}
+
+func TestAgglomerativePersistToFileShouldPass1(t *testing.T) {
+	x, _ := blobs(rand.New(rand.NewSource(3)), 100)
+
+	model := NewAgglomerative(4, x, WardLinkage, nil)
+	model.Output = ioutil.Discard
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+	assert.Nil(t, model.PersistToFile("/tmp/.goml/Agglomerative.json"), "Persist error should be nil")
+
+	restored := NewAgglomerative(1, nil, SingleLinkage, nil)
+	assert.Nil(t, restored.RestoreFromFile("/tmp/.goml/Agglomerative.json"), "Restore error should be nil")
+	assert.Equal(t, WardLinkage, restored.Linkage, "The linkage should be restored")
+	assert.Equal(t, model.Dendrogram, restored.Dendrogram, "The dendrogram should be restored")
+
+	guesses, err := restored.Cut(4)
+	assert.Nil(t, err, "Cut error should be nil")
+	assert.Equal(t, model.Guesses(), guesses, "The restored tree should cut the same way")
+}
+
+func TestAgglomerativeShouldFail1(t *testing.T) {
+	model := NewAgglomerative(2, nil, SingleLinkage, nil)
+	model.Output = ioutil.Discard
+	assert.NotNil(t, model.Learn(), "Learning with no training examples should return an error")
+
+	_, err := model.Cut(1)
+	assert.NotNil(t, err, "Cutting before learning should return an error")
+	_, err = model.CutDistance(1)
+	assert.NotNil(t, err, "Cutting before learning should return an error")
+
+	assert.Nil(t, model.UpdateTrainingSet([][]float64{{0, 0}}), "Update error should be nil")
+	assert.NotNil(t, model.Learn(), "Cutting into more clusters than points should return an error")
+
+	assert.Nil(t, model.UpdateTrainingSet([][]float64{{0, 0}, {1, 1}, {2, 2}}), "Update error should be nil")
+	model.Linkage = WardLinkage
+	model.Distance = base.ManhattanDistance
+	assert.NotNil(t, model.Learn(), "Ward linkage with any distance but the Euclidean should return an error")
+
+	model.Linkage = Linkage(9)
+	assert.NotNil(t, model.Learn(), "Learning with an unknown linkage should return an error")
+
+	model.Linkage = SingleLinkage
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+	_, err = model.Cut(4)
+	assert.NotNil(t, err, "Cutting into more clusters than points should return an error")
+
+	// points infinitely far apart still merge, but NaN
+	// distances can't be ordered
+	model.Distance = func(u, v []float64) float64 { return math.Inf(1) }
+	assert.Nil(t, model.Learn(), "Learning with infinite distances should not fail")
+	assert.Len(t, model.Dendrogram.Merges, 2, "Every point should be merged")
+	assert.True(t, math.IsInf(model.Dendrogram.Merges[1].Distance, 1), "The merges should be infinitely far")
+
+	model.Distance = func(u, v []float64) float64 { return math.NaN() }
+	assert.NotNil(t, model.Learn(), "Learning with NaN distances should return an error")
+
+	for _, broken := range []string{
+		`{"linkage":0}`,
+		`{"dendrogram":{"leaves":3,"merges":[{"left":0,"right":1,"distance":1,"size":2}]}}`,
+		`{"dendrogram":{"leaves":3,"merges":[{"left":0,"right":1,"distance":1,"size":2},{"left":0,"right":2,"distance":2,"size":2}]}}`,
+		`{"dendrogram":{"leaves":3,"merges":[{"left":0,"right":1,"distance":1,"size":2},{"left":3,"right":2,"distance":2,"size":2}]}}`,
+		`{"dendrogram":{"leaves":2,"labels":["a"],"merges":[{"left":0,"right":1,"distance":1,"size":2}]}}`,
+	} {
+		err = ioutil.WriteFile("/tmp/.goml/AgglomerativeBroken.json", []byte(broken), os.ModePerm)
+		assert.Nil(t, err, "Write error should be nil")
+		assert.NotNil(t, model.RestoreFromFile("/tmp/.goml/AgglomerativeBroken.json"), "Restoring %v should return an error", broken)
+	}
+}
@@ -0,0 +1,382 @@
+package cluster
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+
+	"github.com/bountylabs/goml/base"
+)
+
+// Noise is the label density based models (DBSCAN and
+// HDBSCAN) give points which aren't in any cluster.
+const Noise = -1
+
+// PointKind tells apart the points a density based
+// model clustered by how they fit into their cluster.
+type PointKind int
+
+const (
+	// NoisePoint is a point which isn't in any
+	// cluster (labeled Noise.)
+	NoisePoint PointKind = iota
+
+	// BorderPoint is a point on the edge of its
+	// cluster: it's in the cluster, but the
+	// cluster wasn't dense enough around it to
+	// grow from it.
+	BorderPoint
+
+	// CorePoint is a point in the dense heart of
+	// its cluster.
+	CorePoint
+)
+
+// String implements the fmt.Stringer interface.
+func (p PointKind) String() string {
+	switch p {
+	case NoisePoint:
+		return "noise"
+	case BorderPoint:
+		return "border"
+	case CorePoint:
+		return "core"
+	}
+
+	return fmt.Sprintf("PointKind(%v)", int(p))
+}
+
+/*
+DBSCAN implements Density-Based Spatial Clustering of
+Applications with Noise. Points with at least MinPts
+points (themselves included) within Eps of them are
+core points, clusters grow from core point to core
+point within Eps of each other, and take in the other
+points within Eps of their core points as border
+points. Every other point is noise.
+
+Unlike KMeans it finds clusters of any shape (like
+rings, or roads on a map) and doesn't need to be told
+how many there are, but every cluster has to be about
+as dense since there's just the one Eps. HDBSCAN
+doesn't need Eps at all, and handles clusters of
+different densities.
+
+Neighbors within Eps are found with the same indexes
+KNN searches with (see KNNIndex), so it's fast for
+low dimensional data with a Minkowski distance (or
+any metric) and works with any base.DistanceMeasure.
+
+https://en.wikipedia.org/wiki/DBSCAN
+
+Example DBSCAN Model Usage:
+
+	// stops as latitudes and longitudes, with the
+	// haversine distance in kilometers
+	model := NewDBSCAN(0.5, 5, stops, haversine)
+	model.Metric = true
+
+	if model.Learn() != nil {
+		panic("Oh NO!!! There was an error learning!!")
+	}
+
+	// Noise (-1) for points in no cluster
+	labels := model.Guesses()
+	fmt.Println(model.Clusters(), "clusters")
+
+	// which points are core, border or noise
+	kinds := model.Kinds()
+
+	// new points go in the cluster of the nearest
+	// core point within Eps (or are Noise)
+	guess, err := model.Predict([]float64{40.7, -74})
+	if err != nil {
+		panic("prediction error")
+	}
+*/
+type DBSCAN struct {
+	// trainingSet and guesses are the 'x', and
+	// 'y' of the data, just like KMeans' (but the
+	// guesses can be Noise)
+	trainingSet [][]float64
+	guesses     []int
+	kinds       []PointKind
+	clusters    int
+
+	// Eps is how close points have to be to be
+	// neighbors, and MinPts how many neighbors
+	// (counting the point itself) a core point
+	// has at least.
+	Eps    float64
+	MinPts int
+
+	// Distance is the distance the model clusters
+	// with. It defaults to base.EuclideanDistance.
+	Distance base.DistanceMeasure
+
+	// Metric tells the model that Distance is a
+	// true metric, just like KNN's Metric, so it
+	// can search a ball tree.
+	Metric bool
+
+	// Index is the index neighbors are searched
+	// with, just like KNN's (AutoIndex by default.)
+	// HNSWIndex can't search within a radius, so
+	// it can't be used.
+	Index KNNIndex
+
+	// index is the index built over the training
+	// set, which Predict searches as well
+	index radiusIndex
+
+	// Output is the io.Writer to write
+	// logging to. Defaults to os.Stdout
+	// but can be changed to any io.Writer
+	Output io.Writer
+}
+
+// NewDBSCAN returns a pointer to the DBSCAN model,
+// which clusters the training set by density: points
+// with at least minPts points within eps of them (by
+// distance, which defaults to base.EuclideanDistance
+// when nil) are the core of the clusters.
+func NewDBSCAN(eps float64, minPts int, trainingSet [][]float64, distance base.DistanceMeasure) *DBSCAN {
+	if distance == nil {
+		distance = base.EuclideanDistance
+	}
+
+	return &DBSCAN{
+		trainingSet: trainingSet,
+		guesses:     make([]int, len(trainingSet)),
+
+		Eps:      eps,
+		MinPts:   minPts,
+		Distance: distance,
+
+		Output: os.Stdout,
+	}
+}
+
+// UpdateTrainingSet takes in a new training set (variable x.)
+//
+// Will reset the hidden 'guesses' param of the DBSCAN model.
+func (k *DBSCAN) UpdateTrainingSet(trainingSet [][]float64) error {
+	if len(trainingSet) == 0 {
+		return fmt.Errorf("ERROR: length of given training set is 0! Need data!")
+	}
+
+	k.trainingSet = trainingSet
+	k.guesses = make([]int, len(trainingSet))
+	k.kinds = nil
+	k.clusters = 0
+	k.index = nil
+
+	return nil
+}
+
+// Examples returns the number of training examples (m)
+// that the model currently is training from.
+func (k *DBSCAN) Examples() int {
+	return len(k.trainingSet)
+}
+
+// buildSpatialIndex builds the exact index a density
+// based model searches its training set with.
+func buildSpatialIndex(requested KNNIndex, x [][]float64, distance base.DistanceMeasure, metric bool) (radiusIndex, error) {
+	if requested == HNSWIndex {
+		return nil, fmt.Errorf("ERROR: an HNSW graph can't be searched within a radius. Use an exact index")
+	}
+
+	kind := chooseIndex(requested, distance, metric, len(x), len(x[0]))
+	return newExactIndex(kind, x, make([]float64, len(x)), distance), nil
+}
+
+// eachPoint calls fn with chunks of the n points of a
+// training set from one goroutine per CPU.
+func eachPoint(n int, fn func(start, end int)) {
+	workers := runtime.NumCPU()
+	chunk := (n + workers - 1) / workers
+
+	var wg sync.WaitGroup
+	for start := 0; start < n; start += chunk {
+		end := start + chunk
+		if end > n {
+			end = n
+		}
+
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			fn(start, end)
+		}(start, end)
+	}
+	wg.Wait()
+}
+
+// Learn clusters the training set, counting the
+// neighbors of every point (in parallel) to find the
+// core points, and then growing a cluster from each
+// core point which isn't in one yet, in the order of
+// the training set. The neighbors of each core point
+// are searched again as the cluster reaches it, so
+// only the neighbors of one point are held at a time
+// instead of all of them, which could take O(n²)
+// memory. A border point within Eps of core points of
+// several clusters goes in the first of them.
+func (k *DBSCAN) Learn() error {
+	if len(k.trainingSet) == 0 || len(k.trainingSet[0]) == 0 {
+		err := fmt.Errorf("ERROR: Attempting to learn with no training examples!\n")
+		fmt.Fprintf(k.Output, err.Error())
+		return err
+	}
+
+	if k.Eps <= 0 || k.MinPts < 1 {
+		err := fmt.Errorf("ERROR: DBSCAN needs a positive Eps (%v) and MinPts (%v)\n", k.Eps, k.MinPts)
+		fmt.Fprintf(k.Output, err.Error())
+		return err
+	}
+
+	if k.Distance == nil {
+		k.Distance = base.EuclideanDistance
+	}
+
+	index, err := buildSpatialIndex(k.Index, k.trainingSet, k.Distance, k.Metric)
+	if err != nil {
+		fmt.Fprintf(k.Output, err.Error())
+		return err
+	}
+
+	examples := len(k.trainingSet)
+
+	fmt.Fprintf(k.Output, "Training:\n\tModel: DBSCAN Clustering\n\tTraining Examples: %v\n\tFeatures: %v\n\tEps: %v\n\tMinPts: %v\n...\n\n", examples, len(k.trainingSet[0]), k.Eps, k.MinPts)
+
+	kinds := make([]PointKind, examples)
+	eachPoint(examples, func(start, end int) {
+		for i := start; i < end; i++ {
+			if len(index.within(k.trainingSet[i], k.Eps)) >= k.MinPts {
+				kinds[i] = CorePoint
+			}
+		}
+	})
+
+	// points no cluster reaches stay Noise
+	guesses := make([]int, examples)
+	for i := range guesses {
+		guesses[i] = Noise
+	}
+
+	clusters := 0
+	for i := range k.trainingSet {
+		if kinds[i] != CorePoint || guesses[i] != Noise {
+			continue
+		}
+
+		guesses[i] = clusters
+		queue := []int{i}
+		for len(queue) != 0 {
+			p := queue[0]
+			queue = queue[1:]
+
+			for _, q := range index.within(k.trainingSet[p], k.Eps) {
+				if guesses[q] != Noise {
+					continue
+				}
+
+				guesses[q] = clusters
+				if kinds[q] == CorePoint {
+					queue = append(queue, q)
+				} else {
+					kinds[q] = BorderPoint
+				}
+			}
+		}
+
+		clusters++
+	}
+
+	k.guesses = guesses
+	k.kinds = kinds
+	k.clusters = clusters
+	k.index = index
+
+	fmt.Fprintf(k.Output, "Training Completed.\n%v\n", k)
+
+	return nil
+}
+
+// Predict returns the cluster of the nearest core
+// point within Eps of x, or Noise if there isn't
+// one. It can only be called after Learn.
+//
+// if normalize is given as true, then the input will
+// first be normalized to unit length.
+func (k *DBSCAN) Predict(x []float64, normalize ...bool) ([]float64, error) {
+	if k.index == nil {
+		return nil, fmt.Errorf("ERROR: the model has to learn before predicting")
+	}
+
+	if len(x) != len(k.trainingSet[0]) {
+		return nil, fmt.Errorf("ERROR: the input should have %v features, not %v", len(k.trainingSet[0]), len(x))
+	}
+
+	if len(normalize) != 0 && normalize[0] {
+		x = base.NormalizedPoint(x)
+	}
+
+	guess, nearest := Noise, 0.0
+	for _, i := range k.index.within(x, k.Eps) {
+		if k.kinds[i] != CorePoint {
+			continue
+		}
+
+		dist := k.Distance(x, k.trainingSet[i])
+		if guess == Noise || dist < nearest {
+			guess, nearest = k.guesses[i], dist
+		}
+	}
+
+	return []float64{float64(guess)}, nil
+}
+
+// String implements the fmt interface for clean printing.
+func (k *DBSCAN) String() string {
+	noise := 0
+	for _, guess := range k.guesses {
+		if guess == Noise {
+			noise++
+		}
+	}
+
+	return fmt.Sprintf("DBSCAN(ε = %v, minPts = %v)\n\tClusters: %v\n\tNoise: %v", k.Eps, k.MinPts, k.clusters, noise)
+}
+
+// Guesses returns the cluster of each training
+// example found while learning, or Noise.
+func (k *DBSCAN) Guesses() []int {
+	return k.guesses
+}
+
+// Kinds returns whether each training example is a
+// core point, a border point or noise.
+func (k *DBSCAN) Kinds() []PointKind {
+	return k.kinds
+}
+
+// Clusters returns the number of clusters found.
+func (k *DBSCAN) Clusters() int {
+	return k.clusters
+}
+
+// SaveClusteredData concatenates the training set
+// with the assigned class from clustering (-1 for
+// noise) and saves it to file, just like KMeans'.
+func (k *DBSCAN) SaveClusteredData(filepath string) error {
+	floatGuesses := []float64{}
+	for _, val := range k.guesses {
+		floatGuesses = append(floatGuesses, float64(val))
+	}
+
+	return base.SaveDataToCSV(filepath, k.trainingSet, floatGuesses, true)
+}
@@ -0,0 +1,215 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/bountylabs/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// moons returns n points on two interleaved half
+// circles of radius 10, which no centroid can tell
+// apart, and the moon each is on
+func moons(random *rand.Rand, n int) ([][]float64, []int) {
+	x := make([][]float64, n)
+	y := make([]int, n)
+	for i := range x {
+		angle := random.Float64() * math.Pi
+		y[i] = i % 2
+		if y[i] == 0 {
+			x[i] = []float64{10 * math.Cos(angle), 10 * math.Sin(angle)}
+		} else {
+			x[i] = []float64{10 - 10*math.Cos(angle), 5 - 10*math.Sin(angle)}
+		}
+
+		x[i][0] += random.NormFloat64() * 0.5
+		x[i][1] += random.NormFloat64() * 0.5
+	}
+
+	return x, y
+}
+
+// outliers returns n points spread thinly far off
+// to the right of the moons
+func outliers(random *rand.Rand, n int) [][]float64 {
+	x := make([][]float64, n)
+	for i := range x {
+		x[i] = []float64{50 + 40*random.Float64(), -40 + 80*random.Float64()}
+	}
+
+	return x
+}
+
+func TestDBSCANShouldPass1(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	x, y := moons(random, 600)
+	x = append(x, outliers(random, 20)...)
+
+	var expected []int
+	for _, index := range []KNNIndex{BruteForceIndex, KDTreeIndex, BallTreeIndex} {
+		model := NewDBSCAN(1.5, 5, x, nil)
+		model.Index = index
+		model.Output = ioutil.Discard
+		assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+		assert.Equal(t, 2, model.Clusters(), "DBSCAN should find both moons")
+		assert.True(t, purity(model.Guesses()[:600], y) > 0.99, "Each cluster should be one moon")
+		for i := 600; i < len(x); i++ {
+			assert.Equal(t, Noise, model.Guesses()[i], "Outliers should be noise")
+			assert.Equal(t, NoisePoint, model.Kinds()[i], "Outliers should be noise")
+		}
+
+		// every index should find the same clusters
+		if expected == nil {
+			expected = model.Guesses()
+		}
+		assert.Equal(t, expected, model.Guesses(), "Index %v should find the same clusters", index)
+
+		// core points have MinPts neighbors, border
+		// points are next to a core point
+		for i := range x {
+			neighbors := []int{}
+			for j := range x {
+				if base.EuclideanDistance(x[i], x[j]) <= 1.5 {
+					neighbors = append(neighbors, j)
+				}
+			}
+
+			switch model.Kinds()[i] {
+			case CorePoint:
+				assert.True(t, len(neighbors) >= 5, "Core points should have at least MinPts neighbors")
+			case BorderPoint:
+				assert.True(t, len(neighbors) < 5, "Border points should have less than MinPts neighbors")
+				core := false
+				for _, j := range neighbors {
+					core = core || model.Kinds()[j] == CorePoint && model.Guesses()[j] == model.Guesses()[i]
+				}
+				assert.True(t, core, "Border points should be next to a core point of their cluster")
+			case NoisePoint:
+				assert.Equal(t, Noise, model.Guesses()[i], "Only noise should be labeled noise")
+			}
+		}
+
+		// new points go with the nearest core point
+		guess, err := model.Predict(x[0])
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.Equal(t, float64(model.Guesses()[0]), guess[0], "A core point should be predicted in its cluster")
+
+		guess, err = model.Predict([]float64{0, -30})
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.Equal(t, float64(Noise), guess[0], "Points far from any cluster should be noise")
+	}
+
+	// any distance works
+	model := NewDBSCAN(2, 5, x, base.ManhattanDistance)
+	model.Output = ioutil.Discard
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+	assert.Equal(t, 2, model.Clusters(), "DBSCAN should find both moons")
+
+	assert.Nil(t, model.SaveClusteredData("/tmp/.goml/DBSCANResults.csv"), "Save results error should be nil")
+}
+
+// naiveDBSCAN is DBSCAN holding the neighbors of
+// every point, found by comparing every pair
+func naiveDBSCAN(x [][]float64, eps float64, minPts int) ([]int, []PointKind, int) {
+	neighbors := make([][]int, len(x))
+	kinds := make([]PointKind, len(x))
+	guesses := make([]int, len(x))
+	for i := range x {
+		for j := range x {
+			if base.EuclideanDistance(x[i], x[j]) <= eps {
+				neighbors[i] = append(neighbors[i], j)
+			}
+		}
+		if len(neighbors[i]) >= minPts {
+			kinds[i] = CorePoint
+		}
+		guesses[i] = Noise
+	}
+
+	clusters := 0
+	for i := range x {
+		if kinds[i] != CorePoint || guesses[i] != Noise {
+			continue
+		}
+
+		guesses[i] = clusters
+		queue := []int{i}
+		for len(queue) != 0 {
+			p := queue[0]
+			queue = queue[1:]
+			for _, q := range neighbors[p] {
+				if guesses[q] != Noise {
+					continue
+				}
+				guesses[q] = clusters
+				if kinds[q] == CorePoint {
+					queue = append(queue, q)
+				} else {
+					kinds[q] = BorderPoint
+				}
+			}
+		}
+		clusters++
+	}
+
+	return guesses, kinds, clusters
+}
+
+// searching the neighbors of each point as it's
+// reached should cluster just like holding them all
+func TestDBSCANShouldPass2(t *testing.T) {
+	// 0-2 is a cluster with 3 as its border, 5-7
+	// another, and 4 and 9 are noise
+	x := [][]float64{{0}, {0.5}, {1}, {2}, {3.6}, {6}, {6.5}, {7}, {7.5}, {20}}
+	model := NewDBSCAN(1, 3, x, nil)
+	model.Output = ioutil.Discard
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+	assert.Equal(t, 2, model.Clusters(), "There should be 2 clusters")
+	assert.Equal(t, []int{0, 0, 0, 0, Noise, 1, 1, 1, 1, Noise}, model.Guesses(), "Points should be clustered by density")
+	assert.Equal(t, []PointKind{CorePoint, CorePoint, CorePoint, BorderPoint, NoisePoint, CorePoint, CorePoint, CorePoint, CorePoint, NoisePoint}, model.Kinds(), "Points should be told apart by density")
+
+	random := rand.New(rand.NewSource(7))
+	x, _ = moons(random, 400)
+	x = append(x, outliers(random, 30)...)
+	for _, settings := range []struct {
+		eps    float64
+		minPts int
+	}{{0.5, 3}, {1, 5}, {1.5, 10}, {3, 4}} {
+		expected, expectedKinds, expectedClusters := naiveDBSCAN(x, settings.eps, settings.minPts)
+
+		model := NewDBSCAN(settings.eps, settings.minPts, x, nil)
+		model.Output = ioutil.Discard
+		assert.Nil(t, model.Learn(), "Learning error should be nil")
+		assert.Equal(t, expectedClusters, model.Clusters(), "Eps %v and MinPts %v should find the same number of clusters", settings.eps, settings.minPts)
+		assert.Equal(t, expected, model.Guesses(), "Eps %v and MinPts %v should find the same clusters", settings.eps, settings.minPts)
+		assert.Equal(t, expectedKinds, model.Kinds(), "Eps %v and MinPts %v should find the same kinds of points", settings.eps, settings.minPts)
+	}
+}
+
+func TestDBSCANShouldFail1(t *testing.T) {
+	model := NewDBSCAN(1, 5, nil, nil)
+	model.Output = ioutil.Discard
+	assert.NotNil(t, model.Learn(), "Learning with no training examples should return an error")
+
+	_, err := model.Predict([]float64{0, 0})
+	assert.NotNil(t, err, "Predicting before learning should return an error")
+
+	assert.Nil(t, model.UpdateTrainingSet([][]float64{{0, 0}, {1, 1}}), "Update error should be nil")
+
+	model.Eps = 0
+	assert.NotNil(t, model.Learn(), "Learning with no Eps should return an error")
+
+	model.Eps = 1
+	model.Index = HNSWIndex
+	assert.NotNil(t, model.Learn(), "Learning with an HNSW index should return an error")
+
+	model.Index = AutoIndex
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+	_, err = model.Predict([]float64{0})
+	assert.NotNil(t, err, "Predicting a point of the wrong dimension should return an error")
+}
@@ -0,0 +1,806 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+
+	"github.com/bountylabs/goml/base"
+)
+
+// CovarianceType is the shape of the covariance
+// matrix each component of a GMM can have.
+type CovarianceType int
+
+const (
+	// FullCovariance lets each component have any
+	// covariance matrix, so its points can spread
+	// out in any direction (and its features can be
+	// correlated.) It has the most parameters.
+	FullCovariance CovarianceType = iota
+
+	// DiagonalCovariance gives each feature its own
+	// variance within each component, with no
+	// correlation between features.
+	DiagonalCovariance
+
+	// SphericalCovariance gives each component one
+	// variance for every feature, like the round
+	// clusters KMeans finds.
+	SphericalCovariance
+)
+
+const (
+	// DefaultGMMTolerance is the change in the mean
+	// log-likelihood of the training set under which
+	// EM stops, when Tolerance isn't set.
+	DefaultGMMTolerance = 1e-3
+
+	// DefaultGMMRegularization is added to the
+	// variances of each component when
+	// Regularization isn't set, so a component
+	// settling on a handful of points (or features
+	// which never change) can't have a singular
+	// covariance.
+	DefaultGMMRegularization = 1e-6
+)
+
+// String implements the fmt.Stringer interface.
+func (c CovarianceType) String() string {
+	switch c {
+	case FullCovariance:
+		return "full"
+	case DiagonalCovariance:
+		return "diagonal"
+	case SphericalCovariance:
+		return "spherical"
+	}
+
+	return fmt.Sprintf("CovarianceType(%v)", int(c))
+}
+
+/*
+GMM implements a Gaussian mixture model: the points
+are taken to be drawn from k Gaussian distributions
+(the components), each picked with the probability
+given by its weight. Unlike KMeans it gives soft
+assignments, the probability of each point coming
+from each component (PredictProba), and how likely
+points are under the model (Score), so you can tell
+outliers from points in the thick of a cluster and
+compare models with BIC and AIC.
+
+The components are learned with expectation
+maximization (EM) from a k-means++ instantiation,
+until the mean log-likelihood of the training set
+changes by less than Tolerance (or after
+maxIterations.)
+
+https://en.wikipedia.org/wiki/Mixture_model#Gaussian_mixture_model
+
+Example GMM Usage:
+
+	model := NewGMM(3, 100, data, FullCovariance)
+	model.NInit = 4
+
+	if model.Learn() != nil {
+		panic("Oh NO!!! There was an error learning!!")
+	}
+
+	// the probability of each component
+	proba, err := model.PredictProba([]float64{-3, 6})
+	if err != nil {
+		panic("prediction error")
+	}
+
+	// the mean log-likelihood of some points, and
+	// the BIC of the model on them (lower is
+	// better) to compare against other k
+	score, err := model.Score(data)
+	bic, err := model.BIC(data)
+
+	// persist the model to a file
+	err = model.PersistToFile("/tmp/.goml/GMM.json")
+	if err != nil {
+		panic("file save error")
+	}
+
+	// and restore it (at a later time if you want)
+	err = model.RestoreFromFile("/tmp/.goml/GMM.json")
+	if err != nil {
+		panic("file save error")
+	}
+*/
+type GMM struct {
+	// k is the number of components
+	k int
+
+	// maxIterations is the number of EM iterations
+	// learning is cut off at
+	maxIterations int
+
+	// trainingSet and guesses are the 'x', and
+	// 'y' of the data, just like KMeans' (each
+	// guess is the most likely component)
+	trainingSet [][]float64
+	guesses     []int
+
+	// Weights, Means and Covariances describe each
+	// component. Covariances are always given as
+	// full matrices; diagonal and spherical ones
+	// just have zeros off the diagonal (and one
+	// variance all along it for spherical ones.)
+	Weights     []float64     `json:"weights"`
+	Means       [][]float64   `json:"means"`
+	Covariances [][][]float64 `json:"covariances"`
+
+	// Covariance is the shape of the covariances
+	// (FullCovariance by default.)
+	Covariance CovarianceType `json:"covariance_type"`
+
+	// Tolerance is the change in mean log-likelihood
+	// EM stops at (DefaultGMMTolerance if it's 0),
+	// and Regularization what's added to variances
+	// (DefaultGMMRegularization if it's 0.)
+	Tolerance      float64 `json:"tolerance"`
+	Regularization float64 `json:"regularization"`
+
+	// LogLikelihood is the mean log-likelihood of
+	// the training set after learning, Converged
+	// whether EM got within Tolerance, and
+	// Iterations the number of EM iterations it
+	// took.
+	LogLikelihood float64 `json:"log_likelihood"`
+	Converged     bool    `json:"converged"`
+	Iterations    int     `json:"iterations"`
+
+	// NInit is the number of k-means++
+	// instantiations Learn runs EM from (in
+	// parallel), keeping the one with the highest
+	// LogLikelihood, and Seed seeds them, just like
+	// KMeans'.
+	NInit int   `json:"-"`
+	Seed  int64 `json:"-"`
+
+	// cholesky holds the Cholesky decomposition of
+	// each covariance, and logDet the log of each
+	// one's determinant
+	cholesky [][][]float64
+	logDet   []float64
+
+	// Output is the io.Writer to write
+	// logging to. Defaults to os.Stdout
+	// but can be changed to any io.Writer
+	Output io.Writer `json:"-"`
+}
+
+// NewGMM returns a pointer to a Gaussian mixture
+// model of k components with the given shape of
+// covariance, learned from the training set with at
+// most maxIterations iterations of EM.
+func NewGMM(k, maxIterations int, trainingSet [][]float64, covariance CovarianceType) *GMM {
+	return &GMM{
+		k:             k,
+		maxIterations: maxIterations,
+
+		trainingSet: trainingSet,
+		guesses:     make([]int, len(trainingSet)),
+
+		Covariance: covariance,
+
+		Output: os.Stdout,
+	}
+}
+
+// UpdateTrainingSet takes in a new training set (variable x.)
+//
+// Will reset the hidden 'guesses' param of the GMM model.
+func (g *GMM) UpdateTrainingSet(trainingSet [][]float64) error {
+	if len(trainingSet) == 0 {
+		return fmt.Errorf("ERROR: length of given training set is 0! Need data!")
+	}
+
+	g.trainingSet = trainingSet
+	g.guesses = make([]int, len(trainingSet))
+
+	return nil
+}
+
+// Examples returns the number of training examples (m)
+// that the model currently is training from.
+func (g *GMM) Examples() int {
+	return len(g.trainingSet)
+}
+
+// MaxIterations returns the number of maximum iterations
+// of EM the model will go through, in the worst case
+func (g *GMM) MaxIterations() int {
+	return g.maxIterations
+}
+
+// tolerance returns the Tolerance, or its default.
+func (g *GMM) tolerance() float64 {
+	if g.Tolerance <= 0 {
+		return DefaultGMMTolerance
+	}
+
+	return g.Tolerance
+}
+
+// regularization returns the Regularization, or its
+// default.
+func (g *GMM) regularization() float64 {
+	if g.Regularization <= 0 {
+		return DefaultGMMRegularization
+	}
+
+	return g.Regularization
+}
+
+// gmmRun is the result of running EM from one
+// k-means++ instantiation.
+type gmmRun struct {
+	components    *GMM
+	logLikelihood float64
+	converged     bool
+	iterations    int
+	err           error
+}
+
+// Learn fits the components to the training set with
+// EM. Each instantiation puts the means on points
+// picked with k-means++, and starts the covariances
+// and weights from the points closest to each one.
+//
+// With NInit above 1, that many instantiations are
+// learned in parallel and the one with the highest
+// LogLikelihood is kept.
+func (g *GMM) Learn() error {
+	if len(g.trainingSet) == 0 || len(g.trainingSet[0]) == 0 {
+		err := fmt.Errorf("ERROR: Attempting to learn with no training examples!\n")
+		fmt.Fprintf(g.Output, err.Error())
+		return err
+	}
+
+	examples := len(g.trainingSet)
+	if g.k < 1 || g.k > examples {
+		err := fmt.Errorf("ERROR: need between 1 and %v components (the number of training examples), not %v\n", examples, g.k)
+		fmt.Fprintf(g.Output, err.Error())
+		return err
+	}
+
+	if g.Covariance < FullCovariance || g.Covariance > SphericalCovariance {
+		err := fmt.Errorf("ERROR: unknown covariance type %v\n", g.Covariance)
+		fmt.Fprintf(g.Output, err.Error())
+		return err
+	}
+
+	fmt.Fprintf(g.Output, "Training:\n\tModel: Gaussian Mixture Model (%v covariance)\n\tTraining Examples: %v\n\tFeatures: %v\n\tComponents: %v\n\tRestarts: %v\n...\n\n", g.Covariance, examples, len(g.trainingSet[0]), g.k, nInit(g.NInit))
+
+	runs := make([]gmmRun, nInit(g.NInit))
+	restarts(g.Seed, len(runs), func(restart int, random *rand.Rand) {
+		runs[restart] = g.run(random)
+	})
+
+	for _, run := range runs {
+		if run.err != nil {
+			fmt.Fprintf(g.Output, run.err.Error())
+			return run.err
+		}
+	}
+
+	best := bestRestart(len(runs), func(restart int) float64 {
+		return -runs[restart].logLikelihood
+	})
+
+	run := runs[best]
+	g.Weights = run.components.Weights
+	g.Means = run.components.Means
+	g.Covariances = run.components.Covariances
+	g.cholesky = run.components.cholesky
+	g.logDet = run.components.logDet
+	g.LogLikelihood = run.logLikelihood
+	g.Converged = run.converged
+	g.Iterations = run.iterations
+
+	g.guesses = make([]int, examples)
+	for i := range g.trainingSet {
+		g.guesses[i] = argmax(g.logProba(g.trainingSet[i]))
+	}
+
+	if !g.Converged {
+		fmt.Fprintf(g.Output, "WARNING: EM didn't converge within %v iterations. Try more iterations, a larger Tolerance or more Regularization\n", g.maxIterations)
+	}
+
+	fmt.Fprintf(g.Output, "Training Completed in %v iterations.\n%v\n", g.Iterations, g)
+
+	return nil
+}
+
+// run learns from one k-means++ instantiation drawn
+// from random, without changing the model.
+func (g *GMM) run(random *rand.Rand) gmmRun {
+	x := g.trainingSet
+	means := kmeansPlusPlus(x, g.k, diff, random)
+
+	// start from each point fully belonging to the
+	// closest mean
+	resp := make([][]float64, len(x))
+	for i := range x {
+		resp[i] = make([]float64, g.k)
+
+		closest := 0
+		for j := 1; j < g.k; j++ {
+			if diff(x[i], means[j]) < diff(x[i], means[closest]) {
+				closest = j
+			}
+		}
+		resp[i][closest] = 1
+	}
+
+	components := &GMM{
+		k:              g.k,
+		Covariance:     g.Covariance,
+		Regularization: g.Regularization,
+	}
+
+	result := gmmRun{components: components, logLikelihood: math.Inf(-1)}
+	for result.iterations < g.maxIterations {
+		result.err = components.maximize(x, resp)
+		if result.err != nil {
+			return result
+		}
+		result.iterations++
+
+		previous := result.logLikelihood
+		result.logLikelihood = components.expect(x, resp)
+		if math.Abs(result.logLikelihood-previous) < g.tolerance() {
+			result.converged = true
+			break
+		}
+	}
+
+	// there were no iterations to learn from
+	if result.iterations == 0 {
+		result.err = components.maximize(x, resp)
+		result.logLikelihood = components.expect(x, resp)
+	}
+
+	return result
+}
+
+// expect is the E step of EM: it sets the probability
+// of each point coming from each component (its
+// responsibilities), and returns the mean
+// log-likelihood of the points.
+func (g *GMM) expect(x [][]float64, resp [][]float64) float64 {
+	var sum float64
+	for i := range x {
+		logProba := g.logProba(x[i])
+		norm := logSumExp(logProba)
+		for j := range logProba {
+			resp[i][j] = math.Exp(logProba[j] - norm)
+		}
+
+		sum += norm
+	}
+
+	return sum / float64(len(x))
+}
+
+// maximize is the M step of EM: it sets the weights,
+// means and covariances to the ones most likely to
+// give the points with the given responsibilities.
+func (g *GMM) maximize(x [][]float64, resp [][]float64) error {
+	features := len(x[0])
+	reg := g.regularization()
+
+	// a tiny count keeps a component no point
+	// belongs to from dividing by 0
+	counts := make([]float64, g.k)
+	for j := range counts {
+		counts[j] = 10 * 2.220446049250313e-16
+	}
+	for i := range x {
+		for j := range counts {
+			counts[j] += resp[i][j]
+		}
+	}
+
+	g.Weights = make([]float64, g.k)
+	g.Means = make([][]float64, g.k)
+	g.Covariances = make([][][]float64, g.k)
+	for j := range g.Means {
+		g.Weights[j] = counts[j] / float64(len(x))
+
+		g.Means[j] = make([]float64, features)
+		for i := range x {
+			for f := range x[i] {
+				g.Means[j][f] += resp[i][j] * x[i][f]
+			}
+		}
+		for f := range g.Means[j] {
+			g.Means[j][f] /= counts[j]
+		}
+
+		covariance := make([][]float64, features)
+		for f := range covariance {
+			covariance[f] = make([]float64, features)
+		}
+
+		for i := range x {
+			r := resp[i][j]
+			if r == 0 {
+				continue
+			}
+
+			for f := range x[i] {
+				d := x[i][f] - g.Means[j][f]
+				if g.Covariance == FullCovariance {
+					for h := 0; h <= f; h++ {
+						covariance[f][h] += r * d * (x[i][h] - g.Means[j][h])
+					}
+				} else {
+					covariance[f][f] += r * d * d
+				}
+			}
+		}
+
+		var spherical float64
+		for f := range covariance {
+			for h := 0; h <= f; h++ {
+				covariance[f][h] /= counts[j]
+				covariance[h][f] = covariance[f][h]
+			}
+			spherical += covariance[f][f] / float64(features)
+		}
+
+		for f := range covariance {
+			if g.Covariance == SphericalCovariance {
+				covariance[f][f] = spherical
+			}
+			covariance[f][f] += reg
+		}
+
+		g.Covariances[j] = covariance
+	}
+
+	return g.decompose()
+}
+
+// decompose works out the Cholesky decomposition and
+// log determinant of each covariance.
+func (g *GMM) decompose() error {
+	g.cholesky = make([][][]float64, len(g.Covariances))
+	g.logDet = make([]float64, len(g.Covariances))
+	for j, covariance := range g.Covariances {
+		l := make([][]float64, len(covariance))
+		for f := range l {
+			l[f] = make([]float64, f+1)
+			for h := 0; h <= f; h++ {
+				sum := covariance[f][h]
+				for m := 0; m < h; m++ {
+					sum -= l[f][m] * l[h][m]
+				}
+
+				if f == h {
+					if sum <= 0 {
+						return fmt.Errorf("ERROR: the covariance of component %v isn't positive definite. Try more Regularization (or fewer components)\n", j)
+					}
+					l[f][f] = math.Sqrt(sum)
+					g.logDet[j] += 2 * math.Log(l[f][f])
+				} else {
+					l[f][h] = sum / l[h][h]
+				}
+			}
+		}
+
+		g.cholesky[j] = l
+	}
+
+	return nil
+}
+
+// logProba returns the log of the weight times the
+// density of each component at x.
+func (g *GMM) logProba(x []float64) []float64 {
+	logProba := make([]float64, len(g.Means))
+	z := make([]float64, len(x))
+	for j, l := range g.cholesky {
+		// (x - μ)ᵀ Σ⁻¹ (x - μ) = |z|² where Lz = x - μ
+		var mahalanobis float64
+		for f := range l {
+			d := x[f] - g.Means[j][f]
+			for m := 0; m < f; m++ {
+				d -= l[f][m] * z[m]
+			}
+			z[f] = d / l[f][f]
+			mahalanobis += z[f] * z[f]
+		}
+
+		logProba[j] = math.Log(g.Weights[j]) - 0.5*(float64(len(x))*math.Log(2*math.Pi)+g.logDet[j]+mahalanobis)
+	}
+
+	return logProba
+}
+
+// logSumExp returns log(Σ exp(v[i])) without
+// overflowing.
+func logSumExp(v []float64) float64 {
+	max := math.Inf(-1)
+	for _, value := range v {
+		max = math.Max(max, value)
+	}
+	if math.IsInf(max, 0) {
+		return max
+	}
+
+	var sum float64
+	for _, value := range v {
+		sum += math.Exp(value - max)
+	}
+
+	return max + math.Log(sum)
+}
+
+// argmax returns the index of the largest value of
+// v (the first one for ties.)
+func argmax(v []float64) int {
+	best := 0
+	for i := range v {
+		if v[i] > v[best] {
+			best = i
+		}
+	}
+
+	return best
+}
+
+// check returns an error if the model can't predict
+// x.
+func (g *GMM) check(x []float64) error {
+	if len(g.Means) == 0 {
+		return fmt.Errorf("ERROR: the model has no components! Learn (or restore) the model first")
+	}
+	if len(x) != len(g.Means[0]) {
+		return fmt.Errorf("ERROR: Mean vector should be the same length as input vector!\n\tLength of x given: %v\n\tLength of mean: %v\n", len(x), len(g.Means[0]))
+	}
+
+	return nil
+}
+
+// Predict takes in a variable x (an array of floats,) and
+// returns the most likely component to have given it.
+//
+// if normalize is given as true, then the input will
+// first be normalized to unit length. Only use this if
+// you trained off of normalized inputs and are feeding
+// an un-normalized input
+func (g *GMM) Predict(x []float64, normalize ...bool) ([]float64, error) {
+	if err := g.check(x); err != nil {
+		return nil, err
+	}
+
+	if len(normalize) != 0 && normalize[0] {
+		x = base.NormalizedPoint(x)
+	}
+
+	return []float64{float64(argmax(g.logProba(x)))}, nil
+}
+
+// PredictProba returns the probability of x coming
+// from each component, which add up to 1.
+func (g *GMM) PredictProba(x []float64, normalize ...bool) ([]float64, error) {
+	if err := g.check(x); err != nil {
+		return nil, err
+	}
+
+	if len(normalize) != 0 && normalize[0] {
+		x = base.NormalizedPoint(x)
+	}
+
+	proba := g.logProba(x)
+	norm := logSumExp(proba)
+	for j := range proba {
+		proba[j] = math.Exp(proba[j] - norm)
+	}
+
+	return proba, nil
+}
+
+// ScoreSamples returns the log-likelihood of each
+// point of x under the model (the log of its
+// density.)
+func (g *GMM) ScoreSamples(x [][]float64) ([]float64, error) {
+	if len(x) == 0 {
+		return nil, fmt.Errorf("ERROR: need points to score")
+	}
+
+	scores := make([]float64, len(x))
+	for i := range x {
+		if err := g.check(x[i]); err != nil {
+			return nil, err
+		}
+
+		scores[i] = logSumExp(g.logProba(x[i]))
+	}
+
+	return scores, nil
+}
+
+// Score returns the mean log-likelihood of the
+// points of x under the model.
+func (g *GMM) Score(x [][]float64) (float64, error) {
+	scores, err := g.ScoreSamples(x)
+	if err != nil {
+		return 0, err
+	}
+
+	var sum float64
+	for _, score := range scores {
+		sum += score
+	}
+
+	return sum / float64(len(scores)), nil
+}
+
+// Parameters returns the number of free parameters
+// of the model: the weights (less one, since they
+// add up to 1), the means and the covariances.
+func (g *GMM) Parameters() int {
+	if len(g.Means) == 0 {
+		return 0
+	}
+
+	k, features := len(g.Means), len(g.Means[0])
+
+	var covariance int
+	switch g.Covariance {
+	case FullCovariance:
+		covariance = k * features * (features + 1) / 2
+	case DiagonalCovariance:
+		covariance = k * features
+	case SphericalCovariance:
+		covariance = k
+	}
+
+	return k - 1 + k*features + covariance
+}
+
+// BIC returns the Bayesian information criterion of
+// the model on the points of x
+//
+//	-2 log L + p log n
+//
+// where L is their likelihood, p the number of
+// Parameters and n the number of points. Lower is
+// better, so learn models with different numbers of
+// components (or covariance types) and keep the one
+// with the lowest BIC.
+func (g *GMM) BIC(x [][]float64) (float64, error) {
+	score, err := g.Score(x)
+	if err != nil {
+		return 0, err
+	}
+
+	n := float64(len(x))
+	return -2*score*n + float64(g.Parameters())*math.Log(n), nil
+}
+
+// AIC returns the Akaike information criterion of
+// the model on the points of x
+//
+//	-2 log L + 2p
+//
+// which penalizes parameters less than BIC does.
+func (g *GMM) AIC(x [][]float64) (float64, error) {
+	score, err := g.Score(x)
+	if err != nil {
+		return 0, err
+	}
+
+	return -2*score*float64(len(x)) + 2*float64(g.Parameters()), nil
+}
+
+// String implements the fmt interface for clean printing.
+func (g *GMM) String() string {
+	return fmt.Sprintf("p(x) = Σ_j w[j] N(x | μ[j], Σ[j])\n\tw = %v\n\tμ = %v\n\tlog L = %v", g.Weights, g.Means, g.LogLikelihood)
+}
+
+// Guesses returns the most likely component of each
+// training example found while learning.
+func (g *GMM) Guesses() []int {
+	return g.guesses
+}
+
+// SaveClusteredData concatenates the training set
+// with the assigned class from clustering and saves
+// it to file, just like KMeans'.
+func (g *GMM) SaveClusteredData(filepath string) error {
+	floatGuesses := []float64{}
+	for _, val := range g.guesses {
+		floatGuesses = append(floatGuesses, float64(val))
+	}
+
+	return base.SaveDataToCSV(filepath, g.trainingSet, floatGuesses, true)
+}
+
+// PersistToFile takes in an absolute filepath and saves the
+// components (weights, means and covariances) with the
+// settings and results of learning to the file as JSON,
+// which can be restored later.
+func (g *GMM) PersistToFile(path string) error {
+	if path == "" {
+		return fmt.Errorf("ERROR: you just tried to persist your model to a file with no path!! That's a no-no. Try it with a valid filepath")
+	}
+
+	bytes, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, bytes, os.ModePerm)
+}
+
+// RestoreFromFile takes in a path to a persisted model
+// and restores its components and settings, checking
+// that they hold together.
+//
+// The path must ba an absolute path or a path from the current
+// directory
+func (g *GMM) RestoreFromFile(path string) error {
+	if path == "" {
+		return fmt.Errorf("ERROR: you just tried to restore your model from a file with no path! That's a no-no. Try it with a valid filepath")
+	}
+
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	restored := GMM{}
+	err = json.Unmarshal(bytes, &restored)
+	if err != nil {
+		return err
+	}
+
+	k := len(restored.Means)
+	if k == 0 || len(restored.Weights) != k || len(restored.Covariances) != k {
+		return fmt.Errorf("ERROR: %v should hold a weight, mean and covariance for each component", path)
+	}
+	for j := range restored.Means {
+		features := len(restored.Means[0])
+		if len(restored.Means[j]) != features || len(restored.Covariances[j]) != features {
+			return fmt.Errorf("ERROR: component %v in %v doesn't have %v features", j, path, features)
+		}
+		for _, row := range restored.Covariances[j] {
+			if len(row) != features {
+				return fmt.Errorf("ERROR: the covariance of component %v in %v isn't square", j, path)
+			}
+		}
+	}
+
+	err = restored.decompose()
+	if err != nil {
+		return err
+	}
+
+	g.k = k
+	g.Weights = restored.Weights
+	g.Means = restored.Means
+	g.Covariances = restored.Covariances
+	g.Covariance = restored.Covariance
+	g.Tolerance = restored.Tolerance
+	g.Regularization = restored.Regularization
+	g.LogLikelihood = restored.LogLikelihood
+	g.Converged = restored.Converged
+	g.Iterations = restored.Iterations
+	g.cholesky = restored.cholesky
+	g.logDet = restored.logDet
+
+	return nil
+}
@@ -0,0 +1,240 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/bountylabs/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var gaussianCenters = [][]float64{{0, 0}, {12, 0}, {6, 12}}
+
+// gaussians returns n points from stretched and
+// tilted (correlated) Gaussians around
+// gaussianCenters, and the one each came from
+func gaussians(random *rand.Rand, n int) ([][]float64, []int) {
+	x := make([][]float64, n)
+	y := make([]int, n)
+	for i := range x {
+		y[i] = i % len(gaussianCenters)
+		a, b := random.NormFloat64(), random.NormFloat64()
+		x[i] = []float64{gaussianCenters[y[i]][0] + 2*a, gaussianCenters[y[i]][1] + 1.5*a + 0.5*b}
+	}
+
+	return x, y
+}
+
+func TestGMMShouldPass1(t *testing.T) {
+	x, y := gaussians(rand.New(rand.NewSource(42)), 900)
+
+	model := NewGMM(3, 200, x, FullCovariance)
+	model.NInit = 3
+	model.Seed = 42
+	model.Output = ioutil.Discard
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+	assert.True(t, model.Converged, "EM should converge")
+	assert.True(t, model.Iterations > 0, "EM should take some iterations")
+	assert.True(t, purity(model.Guesses(), y) > 0.98, "Each component should be one of the Gaussians")
+
+	var weights float64
+	for _, weight := range model.Weights {
+		weights += weight
+		assert.InDelta(t, 1.0/3, weight, 0.05, "The Gaussians are picked evenly")
+	}
+	assert.InDelta(t, 1, weights, 1e-9, "The weights should add up to 1")
+
+	for _, center := range gaussianCenters {
+		min := math.Inf(1)
+		for _, mean := range model.Means {
+			min = math.Min(min, base.EuclideanDistance(center, mean))
+		}
+		assert.True(t, min < 0.5, "Every Gaussian (%v) should have a mean close to its center (%v away)", center, min)
+	}
+
+	// the covariances should be found too
+	for j, covariance := range model.Covariances {
+		assert.InDelta(t, 4, covariance[0][0], 1, "Component %v should find the variance of the first feature", j)
+		assert.InDelta(t, 2.5, covariance[1][1], 0.6, "Component %v should find the variance of the second feature", j)
+		assert.InDelta(t, 3, covariance[0][1], 0.8, "Component %v should find the covariance of the features", j)
+		assert.Equal(t, covariance[0][1], covariance[1][0], "Covariances should be symmetric")
+	}
+
+	// the same seed learns the same model
+	again := NewGMM(3, 200, x, FullCovariance)
+	again.NInit = 3
+	again.Seed = 42
+	again.Output = ioutil.Discard
+	assert.Nil(t, again.Learn(), "Learning error should be nil")
+	assert.Equal(t, model.Means, again.Means, "The same seed should find the same means")
+
+	// soft assignments
+	for _, center := range gaussianCenters {
+		proba, err := model.PredictProba(center)
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.Len(t, proba, 3, "There should be a probability for each component")
+
+		var sum float64
+		for _, p := range proba {
+			sum += p
+		}
+		assert.InDelta(t, 1, sum, 1e-9, "The probabilities should add up to 1")
+
+		guess, err := model.Predict(center)
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.True(t, proba[int(guess[0])] > 0.99, "The center of a Gaussian should surely come from its component")
+	}
+
+	// points in the thick of a cluster are more
+	// likely than outliers
+	scores, err := model.ScoreSamples([][]float64{gaussianCenters[0], {40, 40}})
+	assert.Nil(t, err, "Score error should be nil")
+	assert.True(t, scores[0] > scores[1], "Outliers should be less likely")
+
+	score, err := model.Score(x)
+	assert.Nil(t, err, "Score error should be nil")
+	assert.InDelta(t, model.LogLikelihood, score, 1e-2, "The score of the training set should be its log-likelihood")
+
+	assert.Nil(t, model.SaveClusteredData("/tmp/.goml/GMMResults.csv"), "Save results error should be nil")
+}
+
+// BIC and AIC should pick the right number of
+// components and the right covariance type
+func TestGMMShouldPass2(t *testing.T) {
+	x, _ := gaussians(rand.New(rand.NewSource(7)), 900)
+
+	criteria := map[string][]float64{}
+	for k := 1; k <= 5; k++ {
+		model := NewGMM(k, 200, x, FullCovariance)
+		model.NInit = 3
+		model.Seed = 7
+		model.Output = ioutil.Discard
+		assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+		bic, err := model.BIC(x)
+		assert.Nil(t, err, "BIC error should be nil")
+		aic, err := model.AIC(x)
+		assert.Nil(t, err, "AIC error should be nil")
+		assert.True(t, aic < bic, "AIC should penalize parameters less than BIC")
+
+		criteria["BIC"] = append(criteria["BIC"], bic)
+		criteria["AIC"] = append(criteria["AIC"], aic)
+	}
+
+	assert.Equal(t, 3, argmax(negate(criteria["BIC"]))+1, "BIC should pick 3 components (%v)", criteria["BIC"])
+	assert.True(t, criteria["AIC"][2] < criteria["AIC"][1], "AIC should prefer 3 components to 2 (%v)", criteria["AIC"])
+
+	bics := map[CovarianceType]float64{}
+	for _, covariance := range []CovarianceType{FullCovariance, DiagonalCovariance, SphericalCovariance} {
+		model := NewGMM(3, 200, x, covariance)
+		model.NInit = 3
+		model.Seed = 7
+		model.Output = ioutil.Discard
+		assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+		for _, c := range model.Covariances {
+			if covariance != FullCovariance {
+				assert.Equal(t, 0.0, c[0][1], "%v covariances shouldn't correlate features", covariance)
+			}
+			if covariance == SphericalCovariance {
+				assert.Equal(t, c[0][0], c[1][1], "Spherical covariances should have one variance")
+			}
+		}
+
+		bic, err := model.BIC(x)
+		assert.Nil(t, err, "BIC error should be nil")
+		bics[covariance] = bic
+	}
+
+	assert.Equal(t, 3*2+2+3*3, gmmParameters(FullCovariance), "Parameters should count the weights, means and covariances")
+	assert.True(t, bics[FullCovariance] < bics[DiagonalCovariance], "The correlated Gaussians should be best fit with full covariances")
+	assert.True(t, bics[DiagonalCovariance] < bics[SphericalCovariance], "Diagonal covariances should beat spherical ones on stretched Gaussians")
+}
+
+// gmmParameters returns the number of parameters
+// of a GMM of 3 components over 2 features
+func gmmParameters(covariance CovarianceType) int {
+	model := &GMM{Means: [][]float64{{0, 0}, {0, 0}, {0, 0}}, Covariance: covariance}
+	return model.Parameters()
+}
+
+// negate returns -v
+func negate(v []float64) []float64 {
+	negated := make([]float64, len(v))
+	for i := range v {
+		negated[i] = -v[i]
+	}
+
+	return negated
+}
+
+func TestGMMPersistToFileShouldPass1(t *testing.T) {
+	x, _ := gaussians(rand.New(rand.NewSource(3)), 300)
+
+	model := NewGMM(3, 100, x, DiagonalCovariance)
+	model.Seed = 3
+	model.Output = ioutil.Discard
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+	assert.Nil(t, model.PersistToFile("/tmp/.goml/GMM.json"), "Persist error should be nil")
+
+	restored := NewGMM(1, 1, nil, FullCovariance)
+	assert.Nil(t, restored.RestoreFromFile("/tmp/.goml/GMM.json"), "Restore error should be nil")
+	assert.Equal(t, DiagonalCovariance, restored.Covariance, "The covariance type should be restored")
+	assert.Equal(t, model.Weights, restored.Weights, "The weights should be restored")
+	assert.Equal(t, model.LogLikelihood, restored.LogLikelihood, "The log-likelihood should be restored")
+
+	for _, point := range x[:20] {
+		expected, err := model.PredictProba(point)
+		assert.Nil(t, err, "Prediction error should be nil")
+		proba, err := restored.PredictProba(point)
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.Equal(t, expected, proba, "The restored model should predict the same")
+	}
+
+	expected, err := model.BIC(x)
+	assert.Nil(t, err, "BIC error should be nil")
+	bic, err := restored.BIC(x)
+	assert.Nil(t, err, "BIC error should be nil")
+	assert.Equal(t, expected, bic, "The restored model should score the same")
+}
+
+func TestGMMShouldFail1(t *testing.T) {
+	model := NewGMM(2, 10, nil, FullCovariance)
+	model.Output = ioutil.Discard
+	assert.NotNil(t, model.Learn(), "Learning with no training examples should return an error")
+
+	_, err := model.Predict([]float64{0, 0})
+	assert.NotNil(t, err, "Predicting before learning should return an error")
+	_, err = model.PredictProba([]float64{0, 0})
+	assert.NotNil(t, err, "Predicting before learning should return an error")
+
+	assert.Nil(t, model.UpdateTrainingSet([][]float64{{0, 0}}), "Update error should be nil")
+	assert.NotNil(t, model.Learn(), "Learning more components than points should return an error")
+
+	model.Covariance = CovarianceType(7)
+	assert.Nil(t, model.UpdateTrainingSet([][]float64{{0, 0}, {1, 1}, {2, 2}}), "Update error should be nil")
+	assert.NotNil(t, model.Learn(), "Learning with an unknown covariance type should return an error")
+
+	model.Covariance = FullCovariance
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+	_, err = model.Predict([]float64{0})
+	assert.NotNil(t, err, "Predicting a point of the wrong dimension should return an error")
+	_, err = model.Score(nil)
+	assert.NotNil(t, err, "Scoring no points should return an error")
+
+	for _, broken := range []string{
+		`{"weights":[1],"means":[],"covariances":[]}`,
+		`{"weights":[1],"means":[[0,0]],"covariances":[[[1,0]]]}`,
+		`{"weights":[1],"means":[[0,0]],"covariances":[[[1,0],[0,-1]]]}`,
+	} {
+		err = ioutil.WriteFile("/tmp/.goml/GMMBroken.json", []byte(broken), os.ModePerm)
+		assert.Nil(t, err, "Write error should be nil")
+		assert.NotNil(t, model.RestoreFromFile("/tmp/.goml/GMMBroken.json"), "Restoring %v should return an error", broken)
+	}
+}
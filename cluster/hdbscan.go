@@ -0,0 +1,558 @@
+package cluster
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/bountylabs/goml/base"
+)
+
+/*
+HDBSCAN implements Hierarchical DBSCAN, which runs
+DBSCAN for every Eps at once and keeps the clusters
+which last the longest as Eps shrinks. It only needs
+the smallest cluster size that matters, finds clusters
+of different densities (which one Eps can't), and
+labels the points which aren't in any of them as
+Noise, just like DBSCAN.
+
+The density around a point is measured by its core
+distance, the distance to its MinSamples-th nearest
+neighbor (itself included), found with the same
+indexes KNN searches with. Points are then linked
+by their mutual reachability distance (the largest
+of their distance and both core distances) in a
+minimum spanning tree, which is cut up into the
+cluster hierarchy. Building the tree measures the
+distance between every pair of points, so learning
+takes O(n²) time (split between goroutines for large
+training sets) but only O(n) memory.
+
+http://link.springer.com/chapter/10.1007%2F978-3-642-37456-2_14
+
+Example HDBSCAN Model Usage:
+
+	model := NewHDBSCAN(15, stops, nil)
+
+	if model.Learn() != nil {
+		panic("Oh NO!!! There was an error learning!!")
+	}
+
+	// Noise (-1) for points in no cluster
+	labels := model.Guesses()
+	fmt.Println(model.Clusters(), "clusters")
+
+	// how strongly each point belongs to its
+	// cluster, and which points are its core
+	probabilities := model.Probabilities()
+	kinds := model.Kinds()
+*/
+type HDBSCAN struct {
+	// trainingSet and guesses are the 'x', and
+	// 'y' of the data, just like DBSCAN's
+	trainingSet   [][]float64
+	guesses       []int
+	kinds         []PointKind
+	probabilities []float64
+	stabilities   []float64
+
+	// MinClusterSize is the fewest points a
+	// cluster can have (at least 2.) Smaller
+	// groups splitting off of a cluster are just
+	// points leaving it.
+	MinClusterSize int
+
+	// MinSamples is the number of neighbors (the
+	// point itself included) the core distance is
+	// measured to. It defaults to MinClusterSize;
+	// larger values make more points Noise.
+	MinSamples int
+
+	// AllowSingleCluster lets the whole training
+	// set be one cluster, when no split of it lasts
+	// as long. Otherwise a training set without any
+	// split is all Noise.
+	AllowSingleCluster bool
+
+	// Distance, Metric and Index work just like
+	// DBSCAN's.
+	Distance base.DistanceMeasure
+	Metric   bool
+	Index    KNNIndex
+
+	// Output is the io.Writer to write
+	// logging to. Defaults to os.Stdout
+	// but can be changed to any io.Writer
+	Output io.Writer
+}
+
+// NewHDBSCAN returns a pointer to the HDBSCAN model,
+// which clusters the training set by density into
+// clusters of at least minClusterSize points, by
+// distance (base.EuclideanDistance if it's nil.)
+func NewHDBSCAN(minClusterSize int, trainingSet [][]float64, distance base.DistanceMeasure) *HDBSCAN {
+	if distance == nil {
+		distance = base.EuclideanDistance
+	}
+
+	return &HDBSCAN{
+		trainingSet: trainingSet,
+		guesses:     make([]int, len(trainingSet)),
+
+		MinClusterSize: minClusterSize,
+		Distance:       distance,
+
+		Output: os.Stdout,
+	}
+}
+
+// UpdateTrainingSet takes in a new training set (variable x.)
+//
+// Will reset the hidden 'guesses' param of the HDBSCAN model.
+func (k *HDBSCAN) UpdateTrainingSet(trainingSet [][]float64) error {
+	if len(trainingSet) == 0 {
+		return fmt.Errorf("ERROR: length of given training set is 0! Need data!")
+	}
+
+	k.trainingSet = trainingSet
+	k.guesses = make([]int, len(trainingSet))
+	k.kinds = nil
+	k.probabilities = nil
+	k.stabilities = nil
+
+	return nil
+}
+
+// Examples returns the number of training examples (m)
+// that the model currently is training from.
+func (k *HDBSCAN) Examples() int {
+	return len(k.trainingSet)
+}
+
+// mstEdge is an edge of the minimum spanning tree,
+// between points a and b.
+type mstEdge struct {
+	a, b   int
+	weight float64
+}
+
+// linkage is the single linkage tree of the training
+// set. Its nodes 0 to n-1 are the points, and each
+// node from n on merges left and right at distance.
+type linkage struct {
+	n           int
+	left, right []int
+	distance    []float64
+	size        []int
+}
+
+// condensedCluster is a cluster of the condensed
+// tree. It's born when its parent splits and dies
+// when it splits itself (or its last points leave),
+// at densities given as λ = 1 / distance.
+type condensedCluster struct {
+	parent      int
+	children    []int
+	birth       float64
+	death       float64
+	stability   float64
+	selected    bool
+	subtreeBest float64
+}
+
+// Learn clusters the training set: it works out the
+// core distances, the minimum spanning tree of the
+// mutual reachability distances, the single linkage
+// tree and its condensed tree, and then picks the
+// clusters of the condensed tree which are the most
+// stable (with the most points lasting in them the
+// longest.)
+func (k *HDBSCAN) Learn() error {
+	if len(k.trainingSet) == 0 || len(k.trainingSet[0]) == 0 {
+		err := fmt.Errorf("ERROR: Attempting to learn with no training examples!\n")
+		fmt.Fprintf(k.Output, err.Error())
+		return err
+	}
+
+	examples := len(k.trainingSet)
+	minSamples := k.MinSamples
+	if minSamples == 0 {
+		minSamples = k.MinClusterSize
+	}
+
+	if k.MinClusterSize < 2 || k.MinClusterSize > examples || minSamples < 1 || minSamples > examples {
+		err := fmt.Errorf("ERROR: HDBSCAN needs 2 <= MinClusterSize (%v) and 1 <= MinSamples (%v), both at most the number of training examples (%v)\n", k.MinClusterSize, minSamples, examples)
+		fmt.Fprintf(k.Output, err.Error())
+		return err
+	}
+
+	if k.Distance == nil {
+		k.Distance = base.EuclideanDistance
+	}
+
+	index, err := buildSpatialIndex(k.Index, k.trainingSet, k.Distance, k.Metric)
+	if err != nil {
+		fmt.Fprintf(k.Output, err.Error())
+		return err
+	}
+
+	fmt.Fprintf(k.Output, "Training:\n\tModel: HDBSCAN Clustering\n\tTraining Examples: %v\n\tFeatures: %v\n\tMin Cluster Size: %v\n\tMin Samples: %v\n...\n\n", examples, len(k.trainingSet[0]), k.MinClusterSize, minSamples)
+
+	core := make([]float64, examples)
+	eachPoint(examples, func(start, end int) {
+		for i := start; i < end; i++ {
+			neighbors := index.search(k.trainingSet[i], minSamples)
+			core[i] = neighbors[len(neighbors)-1].Distance
+		}
+	})
+
+	tree := singleLinkage(examples, k.spanningTree(core))
+	clusters, pointCluster, pointLambda := condense(tree, k.MinClusterSize)
+	selectClusters(clusters, k.AllowSingleCluster)
+
+	// number the selected clusters in order, and
+	// put each point in the selected cluster it
+	// (or the cluster it left from) is part of
+	labels := make([]int, len(clusters))
+	k.stabilities = []float64{}
+	for c := range clusters {
+		labels[c] = Noise
+		if clusters[c].selected {
+			labels[c] = len(k.stabilities)
+			k.stabilities = append(k.stabilities, clusters[c].stability)
+		}
+	}
+
+	k.guesses = make([]int, examples)
+	k.kinds = make([]PointKind, examples)
+	k.probabilities = make([]float64, examples)
+	for i := range k.trainingSet {
+		c := pointCluster[i]
+		for c != -1 && !clusters[c].selected {
+			c = clusters[c].parent
+		}
+
+		if c == -1 {
+			k.guesses[i] = Noise
+			continue
+		}
+
+		// points stay in the selected cluster until
+		// it dies, even if they go on in one of its
+		// children
+		lambda := math.Min(pointLambda[i], clusters[c].death)
+
+		k.guesses[i] = labels[c]
+		k.probabilities[i] = lambda / clusters[c].death
+		k.kinds[i] = BorderPoint
+		if lambda >= clusters[c].death {
+			k.kinds[i] = CorePoint
+		}
+	}
+
+	fmt.Fprintf(k.Output, "Training Completed.\n%v\n", k)
+
+	return nil
+}
+
+// spanningTree returns the minimum spanning tree of
+// the training set under the mutual reachability
+// distance, with Prim's algorithm.
+func (k *HDBSCAN) spanningTree(core []float64) []mstEdge {
+	n := len(k.trainingSet)
+
+	inTree := make([]bool, n)
+	best := make([]float64, n)
+	from := make([]int, n)
+	for i := range best {
+		best[i] = math.Inf(1)
+	}
+
+	edges := make([]mstEdge, 0, n-1)
+	current := 0
+	for len(edges) < n-1 {
+		inTree[current] = true
+
+		update := func(start, end int) {
+			for j := start; j < end; j++ {
+				if inTree[j] {
+					continue
+				}
+
+				dist := math.Max(k.Distance(k.trainingSet[current], k.trainingSet[j]), math.Max(core[current], core[j]))
+				if dist < best[j] {
+					best[j] = dist
+					from[j] = current
+				}
+			}
+		}
+
+		if n >= parallelBruteForceMin {
+			eachPoint(n, update)
+		} else {
+			update(0, n)
+		}
+
+		next := -1
+		for j := range best {
+			if !inTree[j] && (next == -1 || best[j] < best[next]) {
+				next = j
+			}
+		}
+
+		edges = append(edges, mstEdge{a: from[next], b: next, weight: best[next]})
+		current = next
+	}
+
+	return edges
+}
+
+// singleLinkage merges the n points along the edges
+// of their minimum spanning tree, shortest first.
+func singleLinkage(n int, edges []mstEdge) *linkage {
+	sort.SliceStable(edges, func(i, j int) bool {
+		return edges[i].weight < edges[j].weight
+	})
+
+	tree := &linkage{
+		n:        n,
+		left:     make([]int, 2*n-1),
+		right:    make([]int, 2*n-1),
+		distance: make([]float64, 2*n-1),
+		size:     make([]int, 2*n-1),
+	}
+
+	// union-find over the nodes, with every root
+	// pointing at the newest node it merged into
+	parent := make([]int, 2*n-1)
+	for i := range parent {
+		parent[i] = i
+		if i < n {
+			tree.size[i] = 1
+		}
+	}
+
+	find := func(i int) int {
+		root := i
+		for parent[root] != root {
+			root = parent[root]
+		}
+		for parent[i] != root {
+			parent[i], i = root, parent[i]
+		}
+
+		return root
+	}
+
+	for next, edge := range edges {
+		node := n + next
+		a, b := find(edge.a), find(edge.b)
+
+		tree.left[node] = a
+		tree.right[node] = b
+		tree.distance[node] = edge.weight
+		tree.size[node] = tree.size[a] + tree.size[b]
+		parent[a] = node
+		parent[b] = node
+	}
+
+	return tree
+}
+
+// leaves returns the points under node.
+func (t *linkage) leaves(node int) []int {
+	points := []int{}
+	stack := []int{node}
+	for len(stack) != 0 {
+		node = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if node < t.n {
+			points = append(points, node)
+			continue
+		}
+		stack = append(stack, t.left[node], t.right[node])
+	}
+
+	return points
+}
+
+// condense walks the single linkage tree from the
+// top, keeping only the splits where both sides have
+// at least minClusterSize points as new clusters. At
+// every other split the smaller side's points just
+// leave the cluster. It returns the clusters (the
+// whole training set being the first), and for each
+// point the last cluster it was in and the λ it left
+// it at.
+func condense(tree *linkage, minClusterSize int) ([]condensedCluster, []int, []float64) {
+	// points at the same spot are at distance 0, so
+	// λ is capped a bit past the densest other link
+	floor := math.Inf(1)
+	for node := tree.n; node < len(tree.distance); node++ {
+		if tree.distance[node] > 0 {
+			floor = math.Min(floor, tree.distance[node]/2)
+		}
+	}
+	if math.IsInf(floor, 1) {
+		floor = 1
+	}
+	lambda := func(distance float64) float64 {
+		return 1 / math.Max(distance, floor)
+	}
+
+	clusters := []condensedCluster{{parent: -1}}
+	pointCluster := make([]int, tree.n)
+	pointLambda := make([]float64, tree.n)
+
+	leave := func(node, c int, l float64) {
+		for _, p := range tree.leaves(node) {
+			pointCluster[p] = c
+			pointLambda[p] = l
+		}
+		clusters[c].stability += float64(tree.size[node]) * (l - clusters[c].birth)
+	}
+
+	type walk struct {
+		node, cluster int
+	}
+
+	stack := []walk{{len(tree.distance) - 1, 0}}
+	for len(stack) != 0 {
+		node, c := stack[len(stack)-1].node, stack[len(stack)-1].cluster
+		stack = stack[:len(stack)-1]
+
+		for node >= tree.n {
+			left, right := tree.left[node], tree.right[node]
+			l := lambda(tree.distance[node])
+
+			big, small := left, right
+			if tree.size[right] > tree.size[left] {
+				big, small = right, left
+			}
+
+			if tree.size[small] >= minClusterSize {
+				// a true split: the cluster dies and
+				// two new ones are born
+				clusters[c].stability += float64(tree.size[node]) * (l - clusters[c].birth)
+				clusters[c].death = l
+				for _, child := range []int{left, right} {
+					clusters[c].children = append(clusters[c].children, len(clusters))
+					stack = append(stack, walk{child, len(clusters)})
+					clusters = append(clusters, condensedCluster{parent: c, birth: l})
+				}
+				break
+			}
+
+			leave(small, c, l)
+			if tree.size[big] < minClusterSize {
+				// the last of the cluster's points
+				leave(big, c, l)
+				clusters[c].death = l
+				break
+			}
+
+			node = big
+		}
+	}
+
+	return clusters, pointCluster, pointLambda
+}
+
+// selectClusters picks the clusters to label points
+// with: going up from the leaves, a cluster is picked
+// over its descendants when it's at least as stable
+// as the best of them put together. The first cluster
+// (the whole training set) is only considered with
+// allowSingle.
+func selectClusters(clusters []condensedCluster, allowSingle bool) {
+	var unselect func(c int)
+	unselect = func(c int) {
+		for _, child := range clusters[c].children {
+			clusters[child].selected = false
+			unselect(child)
+		}
+	}
+
+	// children always come after their parent
+	for c := len(clusters) - 1; c >= 0; c-- {
+		if c == 0 && !allowSingle {
+			break
+		}
+
+		var children float64
+		for _, child := range clusters[c].children {
+			children += clusters[child].subtreeBest
+		}
+
+		if len(clusters[c].children) == 0 || clusters[c].stability >= children {
+			clusters[c].selected = true
+			clusters[c].subtreeBest = clusters[c].stability
+			unselect(c)
+		} else {
+			clusters[c].subtreeBest = children
+		}
+	}
+}
+
+// String implements the fmt interface for clean printing.
+func (k *HDBSCAN) String() string {
+	noise := 0
+	for _, guess := range k.guesses {
+		if guess == Noise {
+			noise++
+		}
+	}
+
+	return fmt.Sprintf("HDBSCAN(min cluster size = %v)\n\tClusters: %v\n\tNoise: %v", k.MinClusterSize, len(k.stabilities), noise)
+}
+
+// Guesses returns the cluster of each training
+// example found while learning, or Noise.
+func (k *HDBSCAN) Guesses() []int {
+	return k.guesses
+}
+
+// Kinds returns whether each training example is a
+// core point of its cluster (one which lasted in it
+// until the cluster split or ended), a border point
+// (one which left it earlier) or noise.
+func (k *HDBSCAN) Kinds() []PointKind {
+	return k.kinds
+}
+
+// Probabilities returns how strongly each training
+// example belongs to its cluster, from 1 for its core
+// points down towards 0 for points which left it
+// right after it was born (and 0 for noise.)
+func (k *HDBSCAN) Probabilities() []float64 {
+	return k.probabilities
+}
+
+// Stabilities returns the stability of each cluster:
+// the sum over its points of how long (in λ = 1 /
+// distance) they lasted in it. More stable clusters
+// stand out more from their surroundings.
+func (k *HDBSCAN) Stabilities() []float64 {
+	return k.stabilities
+}
+
+// Clusters returns the number of clusters found.
+func (k *HDBSCAN) Clusters() int {
+	return len(k.stabilities)
+}
+
+// SaveClusteredData concatenates the training set
+// with the assigned class from clustering (-1 for
+// noise) and saves it to file, just like KMeans'.
+func (k *HDBSCAN) SaveClusteredData(filepath string) error {
+	floatGuesses := []float64{}
+	for _, val := range k.guesses {
+		floatGuesses = append(floatGuesses, float64(val))
+	}
+
+	return base.SaveDataToCSV(filepath, k.trainingSet, floatGuesses, true)
+}
@@ -0,0 +1,99 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// HDBSCAN should find clusters of different shapes
+// and densities, which no one Eps can
+func TestHDBSCANShouldPass1(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	x, y := moons(random, 600)
+
+	// a wide, sparse blob off to the side
+	for i := 0; i < 300; i++ {
+		x = append(x, []float64{30 + random.NormFloat64()*4, random.NormFloat64() * 4})
+		y = append(y, 2)
+	}
+	x = append(x, outliers(random, 20)...)
+
+	model := NewHDBSCAN(15, x, nil)
+	model.Output = ioutil.Discard
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+	assert.Equal(t, 3, model.Clusters(), "HDBSCAN should find both moons and the blob")
+	assert.Len(t, model.Stabilities(), 3, "Each cluster should have a stability")
+
+	guesses := model.Guesses()
+	clustered, labels := []int{}, []int{}
+	for i := range y {
+		if guesses[i] != Noise {
+			clustered = append(clustered, guesses[i])
+			labels = append(labels, y[i])
+		}
+	}
+	assert.True(t, len(clustered) > 800, "Few of the clustered points should be noise (%v clustered)", len(clustered))
+	assert.True(t, purity(clustered, labels) > 0.99, "Each cluster should be one moon or the blob")
+
+	noise := 0
+	for i := len(y); i < len(x); i++ {
+		if guesses[i] == Noise {
+			noise++
+		}
+	}
+	assert.True(t, noise >= 18, "Outliers should be noise (%v are)", noise)
+
+	core := 0
+	for i := range x {
+		probability := model.Probabilities()[i]
+		switch model.Kinds()[i] {
+		case NoisePoint:
+			assert.Equal(t, Noise, guesses[i], "Only noise should be labeled noise")
+			assert.Equal(t, 0.0, probability, "Noise should have no probability")
+		case BorderPoint:
+			assert.True(t, probability > 0 && probability < 1, "Border points should belong to their cluster less than core points")
+		case CorePoint:
+			assert.Equal(t, 1.0, probability, "Core points should fully belong to their cluster")
+			core++
+		}
+	}
+	assert.True(t, core >= 3, "Every cluster should have core points")
+
+	// a single blob is all noise, unless it's allowed
+	// to be a cluster
+	blob := x[600:900]
+	model = NewHDBSCAN(15, blob, nil)
+	model.Output = ioutil.Discard
+	model.MinSamples = 50
+	model.AllowSingleCluster = true
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+	assert.Equal(t, 1, model.Clusters(), "A single blob should be one cluster")
+
+	assert.Nil(t, model.SaveClusteredData("/tmp/.goml/HDBSCANResults.csv"), "Save results error should be nil")
+}
+
+func TestHDBSCANShouldFail1(t *testing.T) {
+	model := NewHDBSCAN(5, nil, nil)
+	model.Output = ioutil.Discard
+	assert.NotNil(t, model.Learn(), "Learning with no training examples should return an error")
+
+	assert.Nil(t, model.UpdateTrainingSet([][]float64{{0, 0}, {1, 1}, {2, 2}}), "Update error should be nil")
+	assert.NotNil(t, model.Learn(), "Learning with fewer points than MinClusterSize should return an error")
+
+	model.MinClusterSize = 1
+	assert.NotNil(t, model.Learn(), "Learning with a MinClusterSize under 2 should return an error")
+
+	model.MinClusterSize = 2
+	model.Index = HNSWIndex
+	assert.NotNil(t, model.Learn(), "Learning with an HNSW index should return an error")
+
+	// duplicate points are at distance 0
+	model.Index = AutoIndex
+	assert.Nil(t, model.UpdateTrainingSet([][]float64{{0, 0}, {0, 0}, {0, 0}, {9, 9}, {9, 9}, {9, 9}}), "Update error should be nil")
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+	assert.Equal(t, 2, model.Clusters(), "Each group of duplicates should be a cluster")
+}
@@ -0,0 +1,630 @@
+package cluster
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+)
+
+// HNSWDistance defines a type enum which (using the
+// constants declared below) lets a user choose the
+// distance an HNSW graph is built and searched with.
+// It's a name rather than a base.DistanceMeasure so
+// the graph can be persisted along with it.
+type HNSWDistance string
+
+// Constants declare the distances an HNSW graph can
+// use.
+const (
+	// HNSWEuclidean is the Euclidean distance.
+	HNSWEuclidean HNSWDistance = "euclidean"
+
+	// HNSWCosine is the cosine distance, 1 minus the
+	// cosine of the angle between the two vectors.
+	// The length of the vectors doesn't matter, which
+	// is usually what you want for embeddings.
+	HNSWCosine HNSWDistance = "cosine"
+)
+
+// Defaults for NewHNSW's parameters when they're
+// given as 0.
+const (
+	DefaultHNSWM              = 16
+	DefaultHNSWEfConstruction = 200
+	DefaultHNSWEfSearch       = 50
+)
+
+// hnswNode is a single point in an HNSW graph.
+// Friends[l] holds its neighbors at layer l, so the
+// node is on layers 0 up to len(Friends)-1.
+type hnswNode struct {
+	X       []float64 `json:"x"`
+	Y       float64   `json:"y"`
+	Friends [][]int   `json:"friends"`
+
+	// norm is the length of X, cached for the
+	// cosine distance
+	norm float64
+}
+
+/*
+HNSW is a Hierarchical Navigable Small World graph,
+an index for approximate nearest neighbor search.
+Exact indexes (even KD and ball trees) have to look
+at most of the training set when the inputs have
+hundreds of features, like embedding vectors do. An
+HNSW graph instead links every point to a handful of
+its neighbors, in layers which get sparser towards
+the top, and searches by greedily walking the links
+towards the input. It finds most (not always all)
+of the true nearest neighbors while looking at a
+tiny fraction of the points.
+
+M is the number of links made for each point (twice
+that on the bottom layer.) More links give better
+results but take more memory and time to build.
+EfConstruction and EfSearch are the number of
+candidates kept while inserting and searching; the
+bigger they are, the closer to exact (and the
+slower) the search. EfSearch can be changed
+between searches.
+
+Points can be inserted at any time, and Insert and
+Search are safe to call from different goroutines.
+The whole graph, points and links included, can be
+persisted with PersistToFile.
+
+https://arxiv.org/abs/1603.09320
+
+Example Approximate Nearest Neighbors:
+
+	graph := NewHNSW(16, 200, HNSWCosine)
+	for i := range embeddings {
+		graph.Insert(embeddings[i], labels[i])
+	}
+
+	// the 10 (approximately) nearest embeddings
+	graph.EfSearch = 100
+	neighbors, err := graph.Search(query, 10)
+
+	// or classify with it
+	model := NewKNNFromHNSW(10, graph)
+	guess, err := model.Predict(query)
+*/
+type HNSW struct {
+	M              int          `json:"m"`
+	EfConstruction int          `json:"efConstruction"`
+	EfSearch       int          `json:"efSearch"`
+	Distance       HNSWDistance `json:"distance"`
+
+	// Seed seeds the random layer each point is put
+	// on, so the same inserts always build the same
+	// graph.
+	Seed int64 `json:"seed"`
+
+	mu     sync.RWMutex
+	nodes  []hnswNode
+	entry  int
+	random *rand.Rand
+}
+
+// persistedHNSW is how an HNSW graph is stored on
+// disk.
+type persistedHNSW struct {
+	M              int          `json:"m"`
+	EfConstruction int          `json:"efConstruction"`
+	EfSearch       int          `json:"efSearch"`
+	Distance       HNSWDistance `json:"distance"`
+	Seed           int64        `json:"seed"`
+
+	Entry int        `json:"entry"`
+	Nodes []hnswNode `json:"nodes"`
+}
+
+// NewHNSW returns a pointer to an empty HNSW graph
+// making m links per point, keeping efConstruction
+// candidates while inserting, and using the given
+// distance. m and efConstruction default to
+// DefaultHNSWM and DefaultHNSWEfConstruction if
+// they're 0, and EfSearch to DefaultHNSWEfSearch.
+func NewHNSW(m, efConstruction int, distance HNSWDistance) *HNSW {
+	if m <= 0 {
+		m = DefaultHNSWM
+	}
+	if efConstruction <= 0 {
+		efConstruction = DefaultHNSWEfConstruction
+	}
+	if distance == "" {
+		distance = HNSWEuclidean
+	}
+
+	return &HNSW{
+		M:              m,
+		EfConstruction: efConstruction,
+		EfSearch:       DefaultHNSWEfSearch,
+		Distance:       distance,
+		Seed:           1,
+	}
+}
+
+// empty returns an empty graph with the same
+// parameters as h.
+func (h *HNSW) empty() *HNSW {
+	graph := NewHNSW(h.M, h.EfConstruction, h.Distance)
+	graph.EfSearch = h.EfSearch
+	graph.Seed = h.Seed
+
+	return graph
+}
+
+// Len returns the number of points in the graph.
+func (h *HNSW) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return len(h.nodes)
+}
+
+// l2Norm returns the length of x.
+func l2Norm(x []float64) float64 {
+	var sum float64
+	for i := range x {
+		sum += x[i] * x[i]
+	}
+
+	return math.Sqrt(sum)
+}
+
+// distance returns the distance between x (with
+// length xNorm) and node i.
+func (h *HNSW) distance(x []float64, xNorm float64, i int) float64 {
+	v := h.nodes[i].X
+
+	if h.Distance == HNSWCosine {
+		// the same as base.CosineDistance, with the
+		// lengths worked out ahead of time
+		if xNorm == 0 || h.nodes[i].norm == 0 {
+			if xNorm == h.nodes[i].norm {
+				return 0
+			}
+			return 1
+		}
+
+		var dot float64
+		for j := range x {
+			dot += x[j] * v[j]
+		}
+
+		return math.Max(0, 1-dot/(xNorm*h.nodes[i].norm))
+	}
+
+	var sum float64
+	for j := range x {
+		sum += (x[j] - v[j]) * (x[j] - v[j])
+	}
+
+	return math.Sqrt(sum)
+}
+
+// level draws the top layer of a new point. Each
+// layer up has about 1/M as many points.
+func (h *HNSW) level() int {
+	if h.random == nil {
+		h.random = rand.New(rand.NewSource(h.Seed + int64(len(h.nodes))))
+	}
+
+	return int(math.Floor(-math.Log(1-h.random.Float64()) / math.Log(float64(h.M))))
+}
+
+// maxFriends is the most links a point keeps at
+// the given layer.
+func (h *HNSW) maxFriends(layer int) int {
+	if layer == 0 {
+		return 2 * h.M
+	}
+
+	return h.M
+}
+
+// Insert adds x, labeled y, to the graph and returns
+// its index (the number of points inserted before
+// it.) x is copied, so it can be reused afterwards.
+func (h *HNSW) Insert(x []float64, y float64) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(x) == 0 {
+		return 0, fmt.Errorf("ERROR: can't insert an empty point into an HNSW graph")
+	}
+	if len(h.nodes) != 0 && len(x) != len(h.nodes[0].X) {
+		return 0, fmt.Errorf("ERROR: point (len %v) does not match the dimensions of the HNSW graph (len %v)", len(x), len(h.nodes[0].X))
+	}
+
+	if h.M < 2 {
+		return 0, fmt.Errorf("ERROR: an HNSW graph needs M of at least 2, given %v", h.M)
+	}
+
+	// the caller is free to change x afterwards
+	x = append([]float64(nil), x...)
+
+	id := len(h.nodes)
+	top := h.level()
+	xNorm := l2Norm(x)
+
+	h.nodes = append(h.nodes, hnswNode{
+		X:       x,
+		Y:       y,
+		Friends: make([][]int, top+1),
+		norm:    xNorm,
+	})
+
+	if id == 0 {
+		h.entry = id
+		return id, nil
+	}
+
+	entry := h.entry
+	entryTop := len(h.nodes[entry].Friends) - 1
+	entryDistance := h.distance(x, xNorm, entry)
+
+	// walk down to the new point's top layer
+	for layer := entryTop; layer > top; layer-- {
+		entry, entryDistance = h.greedy(x, xNorm, entry, entryDistance, layer)
+	}
+
+	efConstruction := h.EfConstruction
+	if efConstruction < h.M {
+		efConstruction = h.M
+	}
+
+	candidates := []hnswCandidate{{id: entry, distance: entryDistance}}
+	for layer := minInt(top, entryTop); layer >= 0; layer-- {
+		candidates = h.searchLayer(x, xNorm, candidates, efConstruction, layer)
+
+		friends := h.selectFriends(candidates, h.M)
+		h.nodes[id].Friends[layer] = friends
+
+		for _, friend := range friends {
+			h.link(friend, id, layer)
+		}
+	}
+
+	if top > entryTop {
+		h.entry = id
+	}
+
+	return id, nil
+}
+
+// minInt returns the smaller of a and b.
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// link adds a link from node to friend at the given
+// layer, pruning node's links if it has too many.
+func (h *HNSW) link(node, friend, layer int) {
+	friends := append(h.nodes[node].Friends[layer], friend)
+	if len(friends) <= h.maxFriends(layer) {
+		h.nodes[node].Friends[layer] = friends
+		return
+	}
+
+	candidates := make([]hnswCandidate, len(friends))
+	for i, f := range friends {
+		candidates[i] = hnswCandidate{
+			id:       f,
+			distance: h.distance(h.nodes[node].X, h.nodes[node].norm, f),
+		}
+	}
+	sortCandidates(candidates)
+
+	h.nodes[node].Friends[layer] = h.selectFriends(candidates, h.maxFriends(layer))
+}
+
+// selectFriends picks up to m links out of the
+// candidates (sorted closest first) with the
+// heuristic from the paper: a candidate is skipped
+// if it's closer to a friend already picked than to
+// the point itself, which keeps links pointing in
+// different directions. If that leaves fewer than m,
+// the closest skipped candidates fill the rest.
+func (h *HNSW) selectFriends(candidates []hnswCandidate, m int) []int {
+	friends := make([]int, 0, m)
+	skipped := []int{}
+
+	for _, c := range candidates {
+		if len(friends) == m {
+			break
+		}
+
+		keep := true
+		for _, f := range friends {
+			if h.distance(h.nodes[c.id].X, h.nodes[c.id].norm, f) < c.distance {
+				keep = false
+				break
+			}
+		}
+
+		if keep {
+			friends = append(friends, c.id)
+		} else {
+			skipped = append(skipped, c.id)
+		}
+	}
+
+	for _, s := range skipped {
+		if len(friends) == m {
+			break
+		}
+		friends = append(friends, s)
+	}
+
+	return friends
+}
+
+// greedy walks the links at the given layer towards
+// x as long as it keeps getting closer, returning
+// the closest point found.
+func (h *HNSW) greedy(x []float64, xNorm float64, entry int, entryDistance float64, layer int) (int, float64) {
+	for changed := true; changed; {
+		changed = false
+		for _, friend := range h.nodes[entry].Friends[layer] {
+			dist := h.distance(x, xNorm, friend)
+			if dist < entryDistance {
+				entry, entryDistance = friend, dist
+				changed = true
+			}
+		}
+	}
+
+	return entry, entryDistance
+}
+
+// searchLayer finds the ef closest points to x at
+// the given layer, starting from the entry points,
+// and returns them closest first.
+func (h *HNSW) searchLayer(x []float64, xNorm float64, entries []hnswCandidate, ef, layer int) []hnswCandidate {
+	visited := make(map[int]bool, ef*4)
+	candidates := &candidateHeap{}
+	results := &candidateHeap{farthest: true}
+
+	for _, e := range entries {
+		visited[e.id] = true
+		heap.Push(candidates, e)
+		heap.Push(results, e)
+		if results.Len() > ef {
+			heap.Pop(results)
+		}
+	}
+
+	for candidates.Len() != 0 {
+		closest := heap.Pop(candidates).(hnswCandidate)
+		if results.Len() == ef && closest.distance > results.items[0].distance {
+			break
+		}
+
+		for _, friend := range h.nodes[closest.id].Friends[layer] {
+			if visited[friend] {
+				continue
+			}
+			visited[friend] = true
+
+			dist := h.distance(x, xNorm, friend)
+			if results.Len() < ef || dist < results.items[0].distance {
+				c := hnswCandidate{id: friend, distance: dist}
+				heap.Push(candidates, c)
+				heap.Push(results, c)
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	found := append([]hnswCandidate{}, results.items...)
+	sortCandidates(found)
+
+	return found
+}
+
+// Search returns the (approximately) k nearest points
+// in the graph to x, closest first, keeping
+// max(EfSearch, k) candidates while searching.
+// Neighbor.Index is the point's index from Insert.
+func (h *HNSW) Search(x []float64, k int) ([]Neighbor, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	found, err := h.search(x, k)
+	if err != nil {
+		return nil, err
+	}
+
+	neighbors := make([]Neighbor, len(found))
+	for i, c := range found {
+		neighbors[i] = Neighbor{
+			Index:    c.id,
+			X:        h.nodes[c.id].X,
+			Y:        h.nodes[c.id].Y,
+			Distance: c.distance,
+		}
+	}
+
+	return neighbors, nil
+}
+
+// search is Search for callers holding the lock.
+func (h *HNSW) search(x []float64, k int) ([]hnswCandidate, error) {
+	if k < 1 {
+		return nil, fmt.Errorf("ERROR: need to search for at least 1 neighbor, given %v", k)
+	}
+	if len(h.nodes) == 0 {
+		return nil, fmt.Errorf("ERROR: can't search an empty HNSW graph")
+	}
+	if len(x) != len(h.nodes[0].X) {
+		return nil, fmt.Errorf("ERROR: point (len %v) does not match the dimensions of the HNSW graph (len %v)", len(x), len(h.nodes[0].X))
+	}
+
+	xNorm := l2Norm(x)
+	entry := h.entry
+	entryDistance := h.distance(x, xNorm, entry)
+	for layer := len(h.nodes[entry].Friends) - 1; layer > 0; layer-- {
+		entry, entryDistance = h.greedy(x, xNorm, entry, entryDistance, layer)
+	}
+
+	ef := h.EfSearch
+	if ef < k {
+		ef = k
+	}
+
+	found := h.searchLayer(x, xNorm, []hnswCandidate{{id: entry, distance: entryDistance}}, ef, 0)
+	if len(found) > k {
+		found = found[:k]
+	}
+
+	return found, nil
+}
+
+// PersistToFile takes in an absolute filepath and saves
+// the whole graph (its parameters, points, labels and
+// links) to the file, which can be restored later.
+func (h *HNSW) PersistToFile(path string) error {
+	if path == "" {
+		return fmt.Errorf("ERROR: you just tried to persist your model to a file with no path!! That's a no-no. Try it with a valid filepath")
+	}
+
+	h.mu.RLock()
+	bytes, err := json.Marshal(persistedHNSW{
+		M:              h.M,
+		EfConstruction: h.EfConstruction,
+		EfSearch:       h.EfSearch,
+		Distance:       h.Distance,
+		Seed:           h.Seed,
+		Entry:          h.entry,
+		Nodes:          h.nodes,
+	})
+	h.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, bytes, os.ModePerm)
+}
+
+// RestoreFromFile takes in a path to a persisted HNSW
+// graph and replaces the graph it's operating on with
+// it. Points inserted afterwards carry on from where
+// the persisted graph left off.
+func (h *HNSW) RestoreFromFile(path string) error {
+	if path == "" {
+		return fmt.Errorf("ERROR: you just tried to restore your model from a file with no path! That's a no-no. Try it with a valid filepath")
+	}
+
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var persisted persistedHNSW
+	err = json.Unmarshal(bytes, &persisted)
+	if err != nil {
+		return err
+	}
+
+	if persisted.Distance != HNSWEuclidean && persisted.Distance != HNSWCosine {
+		return fmt.Errorf("ERROR: unknown HNSW distance %q", persisted.Distance)
+	}
+	if persisted.M < 2 {
+		return fmt.Errorf("ERROR: persisted HNSW graph has M (%v) below 2", persisted.M)
+	}
+	if len(persisted.Nodes) != 0 && (persisted.Entry < 0 || persisted.Entry >= len(persisted.Nodes)) {
+		return fmt.Errorf("ERROR: persisted HNSW graph has an entry point (%v) outside of its %v points", persisted.Entry, len(persisted.Nodes))
+	}
+
+	for i := range persisted.Nodes {
+		if len(persisted.Nodes[i].X) == 0 || len(persisted.Nodes[i].X) != len(persisted.Nodes[0].X) {
+			return fmt.Errorf("ERROR: point %v of the persisted HNSW graph has %v features, but point 0 has %v", i, len(persisted.Nodes[i].X), len(persisted.Nodes[0].X))
+		}
+		if len(persisted.Nodes[i].Friends) == 0 {
+			return fmt.Errorf("ERROR: point %v of the persisted HNSW graph isn't on any layer", i)
+		}
+		for _, friends := range persisted.Nodes[i].Friends {
+			for _, f := range friends {
+				if f < 0 || f >= len(persisted.Nodes) {
+					return fmt.Errorf("ERROR: point %v of the persisted HNSW graph links to a point (%v) that doesn't exist", i, f)
+				}
+			}
+		}
+
+		persisted.Nodes[i].norm = l2Norm(persisted.Nodes[i].X)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.M = persisted.M
+	h.EfConstruction = persisted.EfConstruction
+	h.EfSearch = persisted.EfSearch
+	h.Distance = persisted.Distance
+	h.Seed = persisted.Seed
+	h.entry = persisted.Entry
+	h.nodes = persisted.Nodes
+	h.random = nil
+
+	return nil
+}
+
+// hnswCandidate is a point found while searching an
+// HNSW graph.
+type hnswCandidate struct {
+	id       int
+	distance float64
+}
+
+// sortCandidates sorts candidates closest first (and
+// then by index.)
+func sortCandidates(candidates []hnswCandidate) {
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].id < candidates[j].id
+	})
+}
+
+// candidateHeap is a heap of candidates, with the
+// closest on top (or the farthest, if farthest is
+// true.)
+type candidateHeap struct {
+	items    []hnswCandidate
+	farthest bool
+}
+
+func (c *candidateHeap) Len() int { return len(c.items) }
+
+func (c *candidateHeap) Less(i, j int) bool {
+	if c.farthest {
+		return c.items[i].distance > c.items[j].distance
+	}
+	return c.items[i].distance < c.items[j].distance
+}
+
+func (c *candidateHeap) Swap(i, j int) { c.items[i], c.items[j] = c.items[j], c.items[i] }
+
+func (c *candidateHeap) Push(x interface{}) { c.items = append(c.items, x.(hnswCandidate)) }
+
+func (c *candidateHeap) Pop() interface{} {
+	last := c.items[len(c.items)-1]
+	c.items = c.items[:len(c.items)-1]
+	return last
+}
@@ -0,0 +1,277 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/bountylabs/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// embeddings returns n random points with the given
+// number of features, spread around a few centers
+// like real embeddings are
+func embeddings(random *rand.Rand, n, features int) ([][]float64, []float64) {
+	centers := make([][]float64, 5)
+	for i := range centers {
+		centers[i] = make([]float64, features)
+		for j := range centers[i] {
+			centers[i][j] = random.NormFloat64() * 3
+		}
+	}
+
+	x := make([][]float64, n)
+	y := make([]float64, n)
+	for i := range x {
+		c := random.Intn(len(centers))
+		x[i] = make([]float64, features)
+		for j := range x[i] {
+			x[i][j] = centers[c][j] + random.NormFloat64()
+		}
+		y[i] = float64(c)
+	}
+
+	return x, y
+}
+
+// recall returns the fraction of the exact nearest
+// neighbors the graph finds
+func recall(t *testing.T, graph *HNSW, x, queries [][]float64, distance base.DistanceMeasure, k int) float64 {
+	exact := NewKNN(k, x, make([]float64, len(x)), distance)
+	exact.Index = BruteForceIndex
+
+	found, total := 0, 0
+	for _, query := range queries {
+		expected, err := exact.Neighbors(query)
+		assert.Nil(t, err, "Neighbors error should be nil")
+
+		neighbors, err := graph.Search(query, k)
+		assert.Nil(t, err, "Search error should be nil")
+		assert.Len(t, neighbors, k, "Search should return k neighbors")
+
+		got := map[int]bool{}
+		for _, n := range neighbors {
+			got[n.Index] = true
+		}
+		for _, e := range expected {
+			if got[e.Index] {
+				found++
+			}
+			total++
+		}
+	}
+
+	return float64(found) / float64(total)
+}
+
+func TestHNSWShouldPass1(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	x, y := embeddings(random, 2000, 64)
+	queries, _ := embeddings(random, 50, 64)
+
+	for _, distance := range []HNSWDistance{HNSWEuclidean, HNSWCosine} {
+		graph := NewHNSW(16, 200, distance)
+		for i := range x {
+			id, err := graph.Insert(x[i], y[i])
+			assert.Nil(t, err, "Insert error should be nil")
+			assert.Equal(t, i, id, "Points should be indexed in insertion order")
+		}
+		assert.Equal(t, len(x), graph.Len(), "Every point should be in the graph")
+
+		exact := base.DistanceMeasure(base.EuclideanDistance)
+		if distance == HNSWCosine {
+			exact = base.CosineDistance
+		}
+
+		// random points in 64 dimensions are a hard
+		// case, so it takes a wide search to find
+		// nearly all of the true neighbors
+		graph.EfSearch = 10
+		narrow := recall(t, graph, x, queries, exact, 10)
+		graph.EfSearch = 300
+		r := recall(t, graph, x, queries, exact, 10)
+		assert.True(t, r > 0.9, "Recall with %v distance (%v) should be over 90 percent", distance, r)
+		assert.True(t, r > narrow, "A wider search (%v) should find more true neighbors than a narrow one (%v)", r, narrow)
+
+		// a point in the graph is its own nearest neighbor
+		neighbors, err := graph.Search(x[17], 1)
+		assert.Nil(t, err, "Search error should be nil")
+		assert.Equal(t, 17, neighbors[0].Index, "A point should be its own nearest neighbor")
+		assert.InDelta(t, 0, neighbors[0].Distance, 1e-12, "A point should be at distance 0 of itself")
+		assert.Equal(t, y[17], neighbors[0].Y, "Neighbors should hold their labels")
+	}
+}
+
+func TestHNSWShouldPass2(t *testing.T) {
+	random := rand.New(rand.NewSource(7))
+	x, y := embeddings(random, 500, 16)
+
+	graph := NewHNSW(8, 50, HNSWCosine)
+	for i := range x {
+		_, err := graph.Insert(x[i], y[i])
+		assert.Nil(t, err, "Insert error should be nil")
+	}
+
+	err := graph.PersistToFile("/tmp/.goml/hnsw.json")
+	assert.Nil(t, err, "Persistence error should be nil")
+
+	restored := &HNSW{}
+	err = restored.RestoreFromFile("/tmp/.goml/hnsw.json")
+	assert.Nil(t, err, "Restore error should be nil")
+	assert.Equal(t, HNSWCosine, restored.Distance, "The distance should be restored")
+	assert.Equal(t, 8, restored.M, "M should be restored")
+	assert.Equal(t, graph.Len(), restored.Len(), "Every point should be restored")
+
+	queries, _ := embeddings(random, 20, 16)
+	for _, query := range queries {
+		expected, err := graph.Search(query, 5)
+		assert.Nil(t, err, "Search error should be nil")
+		neighbors, err := restored.Search(query, 5)
+		assert.Nil(t, err, "Search error should be nil")
+		assert.Equal(t, expected, neighbors, "The restored graph should find the same neighbors")
+	}
+
+	// both should carry on the same way
+	extra, extraY := embeddings(random, 50, 16)
+	for i := range extra {
+		_, err = graph.Insert(extra[i], extraY[i])
+		assert.Nil(t, err, "Insert error should be nil")
+		_, err = restored.Insert(extra[i], extraY[i])
+		assert.Nil(t, err, "Insert error should be nil")
+	}
+	for _, query := range queries {
+		expected, err := graph.Search(query, 5)
+		assert.Nil(t, err, "Search error should be nil")
+		neighbors, err := restored.Search(query, 5)
+		assert.Nil(t, err, "Search error should be nil")
+		assert.Equal(t, expected, neighbors, "The restored graph should insert the same way")
+	}
+}
+
+func TestHNSWKNNShouldPass1(t *testing.T) {
+	random := rand.New(rand.NewSource(3))
+	x, y := embeddings(random, 1000, 32)
+
+	model := NewKNN(5, x[:500], y[:500], base.EuclideanDistance)
+	model.Index = HNSWIndex
+	assert.Equal(t, HNSWIndex, model.ActiveIndex(), "The model should search its graph")
+	assert.Equal(t, 500, model.Graph.Len(), "The training set should be inserted into the graph")
+
+	for i := 500; i < len(x); i++ {
+		err := model.Insert(x[i], y[i])
+		assert.Nil(t, err, "Insert error should be nil")
+	}
+	assert.Equal(t, 1000, model.Examples(), "Inserts should grow the training set")
+	assert.Equal(t, 1000, model.Graph.Len(), "Inserts should go right into the graph")
+
+	wrong := 0
+	for i := 0; i < 200; i++ {
+		guess, err := model.Predict(x[i])
+		assert.Nil(t, err, "Prediction error should be nil")
+		if guess[0] != y[i] {
+			wrong++
+		}
+	}
+	assert.True(t, wrong < 10, "The model should classify the clusters (%v wrong)", wrong)
+
+	// predicting from a restored graph
+	err := model.Graph.PersistToFile("/tmp/.goml/hnsw_knn.json")
+	assert.Nil(t, err, "Persistence error should be nil")
+	graph := &HNSW{}
+	err = graph.RestoreFromFile("/tmp/.goml/hnsw_knn.json")
+	assert.Nil(t, err, "Restore error should be nil")
+
+	restored := NewKNNFromHNSW(5, graph)
+	assert.Equal(t, 1000, restored.Examples(), "The training set should come from the graph")
+	for i := 0; i < 20; i++ {
+		expected, err := model.Predict(x[i])
+		assert.Nil(t, err, "Prediction error should be nil")
+		guess, err := restored.Predict(x[i])
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.Equal(t, expected, guess, "The restored model should predict the same")
+	}
+}
+
+// inserting into a model with an exact index should
+// rebuild it
+func TestKNNInsertShouldPass1(t *testing.T) {
+	model := NewKNN(1, [][]float64{{0}, {10}}, []float64{0, 1}, base.EuclideanDistance)
+
+	err := model.Insert([]float64{5}, 7)
+	assert.Nil(t, err, "Insert error should be nil")
+	assert.Equal(t, []float64{0, 1, 7}, model.Classes(), "New classes should be added in order")
+
+	guess, err := model.Predict([]float64{4.9})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, []float64{7}, guess, "Inserted examples should be searched")
+
+	err = model.Insert([]float64{1, 2}, 0)
+	assert.NotNil(t, err, "Inserting an example of the wrong dimension should return an error")
+}
+
+func TestHNSWShouldFail1(t *testing.T) {
+	graph := NewHNSW(0, 0, "")
+	assert.Equal(t, DefaultHNSWM, graph.M, "M should default")
+	assert.Equal(t, HNSWEuclidean, graph.Distance, "The distance should default to Euclidean")
+
+	_, err := graph.Search([]float64{1}, 1)
+	assert.NotNil(t, err, "Searching an empty graph should return an error")
+
+	_, err = graph.Insert(nil, 0)
+	assert.NotNil(t, err, "Inserting an empty point should return an error")
+
+	point := []float64{1, 2}
+	_, err = graph.Insert(point, 0)
+	assert.Nil(t, err, "Insert error should be nil")
+	point[0] = 7
+	neighbors, err := graph.Search([]float64{1, 2}, 1)
+	assert.Nil(t, err, "Search error should be nil")
+	assert.Equal(t, []float64{1, 2}, neighbors[0].X, "Changing a point after inserting it should not change the graph")
+
+	_, err = graph.Insert([]float64{1}, 0)
+	assert.NotNil(t, err, "Inserting a point of the wrong dimension should return an error")
+
+	_, err = graph.Search([]float64{1, 2}, 0)
+	assert.NotNil(t, err, "Searching for no neighbors should return an error")
+
+	err = graph.RestoreFromFile("/tmp/.goml/does_not_exist.json")
+	assert.NotNil(t, err, "Restoring from a missing file should return an error")
+
+	// inconsistent files shouldn't restore (and panic
+	// on the next search)
+	for _, broken := range []string{
+		`{"m":1,"distance":"euclidean","nodes":[{"x":[1,2],"friends":[[]]}]}`,
+		`{"m":8,"distance":"euclidean","nodes":[{"x":[1,2],"friends":[[1]]},{"x":[1],"friends":[[0]]}]}`,
+		`{"m":8,"distance":"euclidean","nodes":[{"x":[],"friends":[[]]}]}`,
+	} {
+		err = ioutil.WriteFile("/tmp/.goml/hnsw_broken.json", []byte(broken), os.ModePerm)
+		assert.Nil(t, err, "Write error should be nil")
+		assert.NotNil(t, graph.RestoreFromFile("/tmp/.goml/hnsw_broken.json"), "Restoring %v should return an error", broken)
+	}
+	_, err = graph.Search([]float64{1, 2}, 1)
+	assert.Nil(t, err, "A failed restore should leave the graph alone")
+}
+
+// a graph the training set can't be inserted into
+// should make predictions fail instead of panic
+func TestHNSWKNNShouldFail1(t *testing.T) {
+	x, y := embeddings(rand.New(rand.NewSource(4)), 50, 4)
+
+	for _, mode := range []KNNMode{KNNClassification, KNNRegression} {
+		model := NewKNN(3, x, y, base.EuclideanDistance)
+		model.Mode = mode
+		model.Index = HNSWIndex
+		model.Graph = NewHNSW(1, 0, HNSWEuclidean)
+		assert.NotNil(t, model.UpdateTrainingSet(x, y), "Building a graph the training set can't be inserted into should return an error")
+
+		_, err := model.Predict(x[0])
+		assert.NotNil(t, err, "Predicting with a broken graph should return an error")
+		_, err = model.PredictProba(x[0])
+		assert.NotNil(t, err, "Predicting with a broken graph should return an error")
+		_, err = model.Neighbors(x[0])
+		assert.NotNil(t, err, "Searching a broken graph should return an error")
+	}
+}
@@ -1,12 +1,16 @@
 package cluster
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"math/rand"
 	"os"
+	"runtime"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/bountylabs/goml/base"
@@ -135,10 +139,60 @@ type KMeans struct {
 
 	Centroids [][]float64 `json:"centroids"`
 
+	// Counts holds the number of points assigned
+	// to each centroid: the training examples
+	// after Learn, plus every point learned from
+	// online since. It's persisted along with the
+	// centroids so a restored model carries on
+	// counting where it left off.
+	Counts []int64 `json:"counts"`
+
+	// distortion is the Distortion found by Learn,
+	// which Distortion falls back to when the model
+	// was restored without its training set.
+	distortion float64
+
+	// Distance is what points are assigned to
+	// their nearest centroid by. It defaults (when
+	// nil) to the squared Euclidean distance, and
+	// can be any base.DistanceMeasure. Centroids
+	// are still moved to the mean of their points,
+	// which is only the best center for Euclidean
+	// like distances, so for distances like Jaccard
+	// use KMedoids instead.
+	Distance base.DistanceMeasure `json:"-"`
+
+	// NInit is the number of k-means++
+	// instantiations Learn tries (in parallel),
+	// keeping the one with the lowest Distortion.
+	// It defaults to 1. Learn also assigns points
+	// to centroids over runtime.GOMAXPROCS(0)
+	// goroutines, so Distance has to be safe for
+	// concurrent use.
+	NInit int `json:"-"`
+
+	// Seed seeds the random instantiations, so
+	// Learn always finds the same clustering for
+	// the same Seed. If it's 0, a random seed is
+	// used.
+	Seed int64 `json:"-"`
+
+	// Inertia holds the final Distortion of each
+	// instantiation Learn tried, and BestRestart
+	// the index of the one that was kept.
+	Inertia     []float64 `json:"-"`
+	BestRestart int       `json:"-"`
+
 	// Output is the io.Writer to write
 	// logging to. Defaults to os.Stdout
 	// but can be changed to any io.Writer
 	Output io.Writer
+
+	// online counts the points seen while
+	// learning online, and holds the centroids while
+	// learning with copy on write, so Predict
+	// can be called from other goroutines
+	online base.OnlineState
 }
 
 // OnlineParams is used to pass optional
@@ -178,7 +232,7 @@ func NewKMeans(k, maxIterations int, trainingSet [][]float64, params ...OnlinePa
 	var guesses []int
 	guesses = make([]int, len(trainingSet))
 
-	rand.Seed(time.Now().UTC().Unix())
+	rand.Seed(time.Now().UTC().UnixNano())
 	centroids := make([][]float64, k)
 	for i := range centroids {
 		centroids[i] = make([]float64, features)
@@ -240,6 +294,16 @@ func (k *KMeans) MaxIterations() int {
 	return k.maxIterations
 }
 
+// distance returns the distance between u and v
+// under the model's Distance.
+func (k *KMeans) distance(u, v []float64) float64 {
+	if k.Distance == nil {
+		return diff(u, v)
+	}
+
+	return k.Distance(u, v)
+}
+
 // Predict takes in a variable x (an array of floats,) and
 // finds the value of the hypothesis function given the
 // current parameter vector θ
@@ -249,18 +313,19 @@ func (k *KMeans) MaxIterations() int {
 // you trained off of normalized inputs and are feeding
 // an un-normalized input
 func (k *KMeans) Predict(x []float64, normalize ...bool) ([]float64, error) {
-	if len(x) != len(k.Centroids[0]) {
-		return nil, fmt.Errorf("Error: Centroid vector should be the same length as input vector!\n\tLength of x given: %v\n\tLength of centroid: %v\n", len(x), len(k.Centroids[0]))
+	centroids := k.centroids()
+	if len(x) != len(centroids[0]) {
+		return nil, fmt.Errorf("Error: Centroid vector should be the same length as input vector!\n\tLength of x given: %v\n\tLength of centroid: %v\n", len(x), len(centroids[0]))
 	}
 
 	if len(normalize) != 0 && normalize[0] {
-		base.NormalizePoint(x)
+		x = base.NormalizedPoint(x)
 	}
 
 	var guess int
-	minDiff := diff(x, k.Centroids[0])
-	for j := 1; j < len(k.Centroids); j++ {
-		difference := diff(x, k.Centroids[j])
+	minDiff := k.distance(x, centroids[0])
+	for j := 1; j < len(centroids); j++ {
+		difference := k.distance(x, centroids[j])
 		if difference < minDiff {
 			minDiff = difference
 			guess = j
@@ -279,6 +344,11 @@ func (k *KMeans) Predict(x []float64, normalize ...bool) ([]float64, error) {
 // model than regular, randomized instantiation of
 // centroids.
 // Paper: http://ilpubs.stanford.edu:8090/778/1/2006-13.pdf
+//
+// With NInit above 1, that many k-means++ instantiations
+// are learned in parallel and the one with the lowest
+// Distortion is kept. Each one's final distortion is
+// recorded in Inertia.
 func (k *KMeans) Learn() error {
 	if k.trainingSet == nil {
 		err := fmt.Errorf("ERROR: Attempting to learn with no training examples!\n")
@@ -296,18 +366,157 @@ func (k *KMeans) Learn() error {
 	centroids := len(k.Centroids)
 	features := len(k.trainingSet[0])
 
-	fmt.Fprintf(k.Output, "Training:\n\tModel: K-Means++ Classification\n\tTraining Examples: %v\n\tFeatures: %v\n\tClasses: %v\n...\n\n", examples, features, centroids)
+	fmt.Fprintf(k.Output, "Training:\n\tModel: K-Means++ Classification\n\tTraining Examples: %v\n\tFeatures: %v\n\tClasses: %v\n\tRestarts: %v\n...\n\n", examples, features, centroids, nInit(k.NInit))
+
+	runs := make([]kmeansRun, nInit(k.NInit))
+	restarts(k.Seed, len(runs), func(restart int, random *rand.Rand) {
+		runs[restart] = k.run(random)
+	})
+
+	best := bestRestart(len(runs), func(restart int) float64 {
+		return runs[restart].distortion
+	})
+
+	k.Centroids = runs[best].centroids
+	k.guesses = runs[best].guesses
+	k.Counts = clusterCounts(k.guesses, len(k.Centroids))
+	k.distortion = runs[best].distortion
+	k.BestRestart = best
+	k.Inertia = make([]float64, len(runs))
+	for restart := range runs {
+		k.Inertia[restart] = runs[restart].distortion
+	}
+
+	fmt.Fprintf(k.Output, "Training Completed in %v iterations.\n%v\n", runs[best].iterations, k)
+
+	return nil
+}
+
+// kmeansRun is the result of learning from one
+// k-means++ instantiation.
+type kmeansRun struct {
+	centroids  [][]float64
+	guesses    []int
+	distortion float64
+	iterations int
+}
 
+// run learns from one k-means++ instantiation drawn
+// from random, without changing the model.
+func (k *KMeans) run(random *rand.Rand) kmeansRun {
 	// instantiate the centroids using k-means++
-	k.Centroids[0] = k.trainingSet[rand.Intn(len(k.trainingSet))]
+	return k.iterate(kmeansPlusPlus(k.trainingSet, len(k.Centroids), k.distance, random), random)
+}
+
+// iterate learns from the given centroids (which are
+// updated in place), without changing the model.
+// Empty clusters are restarted from a point drawn
+// from random.
+func (k *KMeans) iterate(centroids [][]float64, random *rand.Rand) kmeansRun {
+	guesses := make([]int, len(k.trainingSet))
+
+	// each chunk of points is assigned in parallel,
+	// and the distortion added up chunk by chunk so it
+	// doesn't depend on the number of cores
+	distortions := make([]float64, (len(k.trainingSet)+learnChunk-1)/learnChunk)
+	changes := make([]bool, len(distortions))
+	assign := func() (float64, bool) {
+		eachChunk(len(k.trainingSet), func(chunk, start, end int) {
+			var distortion float64
+			changed := false
+			for i := start; i < end; i++ {
+				x := k.trainingSet[i]
+				guess := 0
+				minDiff := k.distance(x, centroids[0])
+				for j := 1; j < len(centroids); j++ {
+					difference := k.distance(x, centroids[j])
+					if difference < minDiff {
+						minDiff = difference
+						guess = j
+					}
+				}
+
+				if guess != guesses[i] {
+					changed = true
+				}
+				guesses[i] = guess
+				distortion += minDiff
+			}
+
+			distortions[chunk], changes[chunk] = distortion, changed
+		})
+
+		var distortion float64
+		changed := false
+		for chunk := range distortions {
+			distortion += distortions[chunk]
+			changed = changed || changes[chunk]
+		}
+
+		return distortion, changed
+	}
+
+	iter := 0
+	for ; iter < k.maxIterations; iter++ {
+
+		// set new guesses
+		//
+		// stop early once no point changes
+		// its class
+		_, changed := assign()
+		if !changed && iter != 0 {
+			break
+		}
+
+		// sum up the points in each class (in
+		// parallel) to find their means
+		classTotal, classCount := centroidSums(k.trainingSet, guesses, len(centroids))
+
+		for j := range centroids {
+			// if no objects are in the same class,
+			// restart it from a random point
+			if classCount[j] == 0 {
+				copy(centroids[j], k.trainingSet[random.Intn(len(k.trainingSet))])
+				continue
+			}
+
+			for l := range centroids[j] {
+				centroids[j][l] = classTotal[j][l] / float64(classCount[j])
+			}
+		}
+	}
 
-	distances := make([]float64, len(k.trainingSet))
-	for i := 1; i < len(k.Centroids); i++ {
+	// the guesses should match the final
+	// centroids
+	distortion, _ := assign()
+
+	return kmeansRun{
+		centroids:  centroids,
+		guesses:    guesses,
+		distortion: distortion,
+		iterations: iter,
+	}
+}
+
+// kmeansPlusPlus returns k centroids instantiated
+// from x with k-means++: the first is a random point,
+// and each next one is drawn with a probability that
+// grows with the distance from a point to the closest
+// centroid so far, so they start spread out.
+//
+// The centroids are copied out of x, so they can be
+// updated in place.
+func kmeansPlusPlus(x [][]float64, k int, distance base.DistanceMeasure, random *rand.Rand) [][]float64 {
+	centroids := make([][]float64, k)
+	centroids[0] = append([]float64{}, x[random.Intn(len(x))]...)
+
+	distances := make([]float64, len(x))
+	for i := 1; i < k; i++ {
 		var sum float64
-		for j, x := range k.trainingSet {
-			minDiff := diff(x, k.Centroids[0])
+		for j := range x {
+			minDiff := distance(x[j], centroids[0])
 			for l := 1; l < i; l++ {
-				difference := diff(x, k.Centroids[l])
+				difference := distance(x[j], centroids[l])
 				if difference < minDiff {
 					minDiff = difference
 				}
@@ -317,71 +526,189 @@ func (k *KMeans) Learn() error {
 			sum += distances[j]
 		}
 
-		target := rand.Float64() * sum
+		// (rounding can leave the running sum a hair
+		// short of the total, so stop at the last point)
+		target := random.Float64() * sum
 		j := 0
-		for sum = distances[0]; sum < target; sum += distances[j] {
+		for sum = distances[0]; sum < target && j < len(x)-1; sum += distances[j] {
 			j++
 		}
-		k.Centroids[i] = k.trainingSet[j]
+		centroids[i] = append([]float64{}, x[j]...)
+	}
+
+	return centroids
+}
 
+// clusterCounts returns the number of points
+// assigned to each of k clusters by guesses.
+func clusterCounts(guesses []int, k int) []int64 {
+	counts := make([]int64, k)
+	for _, guess := range guesses {
+		counts[guess]++
 	}
 
-	iter := 0
-	for ; iter < k.maxIterations; iter++ {
+	return counts
+}
 
-		// set new guesses
-		//
-		// store counts when assigning classes
-		// so you won't have to sum them again later
-		classTotal := make([][]float64, centroids)
-		classCount := make([]int64, centroids)
+// learnChunk is the number of points each goroutine
+// works through at once while learning. It's fixed,
+// rather than split by runtime.GOMAXPROCS(0), so partial
+// sums over the chunks are added in the same order
+// (and come out the same) on any number of cores.
+const learnChunk = 512
+
+// eachChunk calls fn for every learnChunk points of
+// n (chunk is the index of the chunk) over at most
+// runtime.GOMAXPROCS(0) goroutines, and returns the number
+// of chunks. fn should only write to the points and
+// chunk it's given.
+func eachChunk(n int, fn func(chunk, start, end int)) int {
+	chunks := (n + learnChunk - 1) / learnChunk
+	bounds := func(chunk int) (int, int) {
+		start, end := chunk*learnChunk, (chunk+1)*learnChunk
+		if end > n {
+			end = n
+		}
+		return start, end
+	}
+
+	cores := runtime.GOMAXPROCS(0)
+	if chunks < cores {
+		cores = chunks
+	}
 
-		for j := range k.Centroids {
-			classTotal[j] = make([]float64, features)
+	// don't bother with goroutines for small
+	// training sets
+	if cores < 2 {
+		for chunk := 0; chunk < chunks; chunk++ {
+			start, end := bounds(chunk)
+			fn(chunk, start, end)
 		}
+		return chunks
+	}
 
-		for i, x := range k.trainingSet {
-			k.guesses[i] = 0
-			minDiff := diff(x, k.Centroids[0])
-			for j := 1; j < len(k.Centroids); j++ {
-				difference := diff(x, k.Centroids[j])
-				if difference < minDiff {
-					minDiff = difference
-					k.guesses[i] = j
-				}
+	next := make(chan int)
+	wg := &sync.WaitGroup{}
+	wg.Add(cores)
+	for core := 0; core < cores; core++ {
+		go func() {
+			for chunk := range next {
+				start, end := bounds(chunk)
+				fn(chunk, start, end)
 			}
+			wg.Done()
+		}()
+	}
 
-			classCount[k.guesses[i]]++
-			for j := range x {
-				classTotal[k.guesses[i]][j] += x[j]
-			}
+	for chunk := 0; chunk < chunks; chunk++ {
+		next <- chunk
+	}
+	close(next)
+	wg.Wait()
+
+	return chunks
+}
+
+// centroidSums returns the sum and number of the
+// points of x assigned to each of k clusters by
+// guesses, summing each chunk in parallel and then
+// the chunks in order.
+func centroidSums(x [][]float64, guesses []int, k int) ([][]float64, []int64) {
+	features := len(x[0])
+
+	totals := make([][][]float64, (len(x)+learnChunk-1)/learnChunk)
+	counts := make([][]int64, len(totals))
+	eachChunk(len(x), func(chunk, start, end int) {
+		total := make([][]float64, k)
+		for j := range total {
+			total[j] = make([]float64, features)
 		}
+		count := make([]int64, k)
 
-		newCentroids := append([][]float64{}, k.Centroids...)
-		for j := range k.Centroids {
-			// if no objects are in the same class,
-			// reinitialize it to a random vector
-			if classCount[j] == 0 {
-				for l := range k.Centroids[j] {
-					k.Centroids[j][l] = 10 * (rand.Float64() - 0.5)
-				}
-				continue
+		for i := start; i < end; i++ {
+			count[guesses[i]]++
+			for l := range x[i] {
+				total[guesses[i]][l] += x[i][l]
 			}
+		}
+
+		totals[chunk], counts[chunk] = total, count
+	})
+
+	classTotal := make([][]float64, k)
+	classCount := make([]int64, k)
+	for j := range classTotal {
+		classTotal[j] = make([]float64, features)
+	}
 
-			for l := range k.Centroids[j] {
-				k.Centroids[j][l] = classTotal[j][l] / float64(classCount[j])
+	for chunk := range totals {
+		for j := range classTotal {
+			classCount[j] += counts[chunk][j]
+			for l := range classTotal[j] {
+				classTotal[j][l] += totals[chunk][j][l]
 			}
 		}
+	}
 
-		// only update if something was deleted
-		if len(newCentroids) != len(k.Centroids) {
-			k.Centroids = newCentroids
-		}
+	return classTotal, classCount
+}
+
+// nInit returns the number of restarts to learn
+// with given NInit.
+func nInit(n int) int {
+	if n < 1 {
+		return 1
 	}
 
-	fmt.Fprintf(k.Output, "Training Completed in %v iterations.\n%v\n", iter, k)
+	return n
+}
 
-	return nil
+// restarts calls run for each of n restarts (with
+// a random source of its own, which only depends on
+// the seed and the restart) over at most
+// runtime.GOMAXPROCS(0) goroutines. A seed of 0 picks a
+// random one.
+func restarts(seed int64, n int, run func(restart int, random *rand.Rand)) {
+	if seed == 0 {
+		seed = rand.Int63()
+	}
+
+	cores := runtime.GOMAXPROCS(0)
+	if n < cores {
+		cores = n
+	}
+
+	next := make(chan int)
+	wg := &sync.WaitGroup{}
+	wg.Add(cores)
+	for core := 0; core < cores; core++ {
+		go func() {
+			for restart := range next {
+				run(restart, rand.New(rand.NewSource(seed+int64(restart))))
+			}
+			wg.Done()
+		}()
+	}
+
+	for restart := 0; restart < n; restart++ {
+		next <- restart
+	}
+	close(next)
+	wg.Wait()
+}
+
+// bestRestart returns the restart with the lowest
+// distortion (the first one for ties, so the result
+// doesn't depend on the order they finished in.)
+func bestRestart(n int, distortion func(restart int) float64) int {
+	best := 0
+	for restart := 1; restart < n; restart++ {
+		if distortion(restart) < distortion(best) {
+			best = restart
+		}
+	}
+
+	return best
 }
 
 /*
@@ -392,9 +719,10 @@ The basis of the model is discusses within this
 paper by an MIT student, along with some theoretical
 assurances of the quality of learning.
 
-The onUpdate callback will be called in a separate
-goroutine whenever the model updates a centroid
-of the cluster. The callback will pass two items
+The onUpdate callback will be called (from a
+goroutine of its own, one update at a time)
+whenever the model updates a centroid of the
+cluster. The callback will pass two items
 within the array: an array containing the class
 number (only) of the cluster updated, and the new
 centroid vector for that class
@@ -497,10 +825,30 @@ func (k *KMeans) OnlineLearn(errors chan error, dataset chan base.Datapoint, onU
 	if errors == nil {
 		errors = make(chan error)
 	}
+	defer close(errors)
+
+	err := k.OnlineLearnContext(context.Background(), dataset, base.OnlineOptions{
+		OnUpdate:       onUpdate,
+		CallbackBuffer: base.DefaultCallbackBuffer,
+		OnError: func(err error) {
+			errors <- err
+		},
+	})
+	if err != nil {
+		errors <- err
+	}
+}
+
+// OnlineLearnContext learns from dataset just like
+// OnlineLearn, but it stops when ctx is done (returning
+// ctx.Err()) as well as when dataset is closed (returning
+// nil), and it takes its callbacks through opts instead
+// of channels. See base.OnlineOptions for how OnUpdate
+// is called; it's passed the same two items as in
+// OnlineLearn, as its own copy.
+func (k *KMeans) OnlineLearnContext(ctx context.Context, dataset <-chan base.Datapoint, opts base.OnlineOptions) error {
 	if dataset == nil {
-		errors <- fmt.Errorf("ERROR: Attempting to learn with a nil data stream!\n")
-		close(errors)
-		return
+		return fmt.Errorf("ERROR: Attempting to learn with a nil data stream!\n")
 	}
 
 	centroids := len(k.Centroids)
@@ -508,41 +856,82 @@ func (k *KMeans) OnlineLearn(errors chan error, dataset chan base.Datapoint, onU
 
 	fmt.Fprintf(k.Output, "Training:\n\tModel: Online K-Means Classification\n\tFeatures: %v\n\tClasses: %v\n...\n\n", features, centroids)
 
-	var point base.Datapoint
-	var more bool
+	err := k.online.CopyOnWrite(opts.CopyOnWrite, k.Centroids[:centroids:centroids], func(latest interface{}) {
+		k.Centroids = latest.([][]float64)
+	}, func() error {
+		return base.LearnOnline(ctx, dataset, opts, &k.online.OnlineCounters, func(point base.Datapoint) ([][]float64, error) {
+			return k.onlineStep(point, opts.CopyOnWrite)
+		})
+	})
 
-	oneMinusAlpha := 1.0 - k.alpha
+	if err != nil {
+		fmt.Fprintf(k.Output, "\nERROR: Error while learning –\n\t%v\n\n", err)
+		return err
+	}
 
-	for {
-		point, more = <-dataset
+	fmt.Fprintf(k.Output, "Training Completed.\n%v\n\n", k)
+	return nil
+}
 
-		if more {
-			if len(point.X) != features {
-				errors <- fmt.Errorf("ERROR: point.X must have the same dimensions as clusters Point: %v", point)
-			}
+// Stats returns how many points the model has seen
+// while learning online, how many times a centroid
+// was updated, and how many points caused an error.
+func (k *KMeans) Stats() base.OnlineStats {
+	return k.online.Stats()
+}
 
-			minDiff := diff(point.X, k.Centroids[0])
-			c := 0
-			for j := 1; j < len(k.Centroids); j++ {
-				difference := diff(point.X, k.Centroids[j])
-				if difference < minDiff {
-					minDiff = difference
-					c = j
-				}
-			}
+// centroids returns the centroids Predict should use:
+// the latest snapshot while learning online with copy
+// on write, and Centroids otherwise.
+func (k *KMeans) centroids() [][]float64 {
+	if centroids := k.online.Load(); centroids != nil {
+		return centroids
+	}
 
-			for i := range k.Centroids[c] {
-				k.Centroids[c][i] = k.alpha*point.X[i] + oneMinusAlpha*k.Centroids[c][i]
-			}
+	return k.Centroids
+}
 
-			go onUpdate([][]float64{[]float64{float64(c)}, k.Centroids[c]})
+// onlineStep moves the centroid closest to point
+// towards it, returning the class number and the
+// new centroid. With copyOnWrite only the moved
+// centroid is copied, and the centroids are stored
+// as a snapshot instead of updated in place.
+func (k *KMeans) onlineStep(point base.Datapoint, copyOnWrite bool) ([][]float64, error) {
+	centroids := k.centroids()
+	if len(point.X) != len(centroids[0]) {
+		return nil, fmt.Errorf("ERROR: point.X must have the same dimensions as clusters Point: %v", point)
+	}
 
-		} else {
-			fmt.Fprintf(k.Output, "Training Completed.\n%v\n\n", k)
-			close(errors)
-			return
+	minDiff := k.distance(point.X, centroids[0])
+	c := 0
+	for j := 1; j < len(centroids); j++ {
+		difference := k.distance(point.X, centroids[j])
+		if difference < minDiff {
+			minDiff = difference
+			c = j
 		}
 	}
+
+	if copyOnWrite {
+		centroids = append([][]float64{}, centroids...)
+		centroids[c] = append([]float64{}, centroids[c]...)
+	}
+
+	if len(k.Counts) != len(centroids) {
+		k.Counts = make([]int64, len(centroids))
+	}
+	k.Counts[c]++
+
+	oneMinusAlpha := 1.0 - k.alpha
+	for i := range centroids[c] {
+		centroids[c][i] = k.alpha*point.X[i] + oneMinusAlpha*centroids[c][i]
+	}
+
+	if copyOnWrite {
+		k.online.Store(centroids)
+	}
+
+	return [][]float64{[]float64{float64(c)}, centroids[c]}, nil
 }
 
 // String implements the fmt interface for clean printing. Here
@@ -567,10 +956,20 @@ func (k *KMeans) Guesses() []int {
 //
 // Distorition() = Σ |x[i] - μ[c[i]]|^2
 // over all training examples
+//
+// (or the sum of the Distance from each point to
+// its centroid if one is given.)
+//
+// A model restored without its training set returns
+// the distortion it was persisted with.
 func (k *KMeans) Distortion() float64 {
+	if len(k.trainingSet) == 0 || len(k.trainingSet) != len(k.guesses) {
+		return k.distortion
+	}
+
 	var sum float64
 	for i := range k.trainingSet {
-		sum += diff(k.trainingSet[i], k.Centroids[int(k.guesses[i])])
+		sum += k.distance(k.trainingSet[i], k.Centroids[int(k.guesses[i])])
 	}
 
 	return sum
@@ -592,35 +991,141 @@ func (k *KMeans) SaveClusteredData(filepath string) error {
 	return base.SaveDataToCSV(filepath, k.trainingSet, floatGuesses, true)
 }
 
-// PersistToFile takes in an absolute filepath and saves the
-// centroid vector to the file, which can be restored later.
-// The function will take paths from the current directory, but
-// functions
-//
-// The data is stored as JSON because it's one of the most
-// efficient storage method (you only need one comma extra
-// per feature + two brackets, total!) And it's extendable.
-func (k *KMeans) PersistToFile(path string) error {
+// kmeansState is everything KMeans and TriangleKMeans
+// persist: the centroids along with the settings and
+// training results Learn and OnlineLearn would need
+// to carry on where they left off.
+type kmeansState struct {
+	K             int     `json:"k"`
+	Features      int     `json:"features"`
+	MaxIterations int     `json:"max_iterations"`
+	Alpha         float64 `json:"alpha,omitempty"`
+
+	Centroids  [][]float64 `json:"centroids"`
+	Counts     []int64     `json:"counts"`
+	Guesses    []int       `json:"guesses,omitempty"`
+	Distortion float64     `json:"distortion"`
+
+	NInit       int       `json:"n_init,omitempty"`
+	Seed        int64     `json:"seed,omitempty"`
+	Inertia     []float64 `json:"inertia,omitempty"`
+	BestRestart int       `json:"best_restart,omitempty"`
+	Metric      bool      `json:"metric,omitempty"`
+
+	Online *base.OnlineStats `json:"online,omitempty"`
+
+	// legacy is set for files holding only the
+	// centroid vector
+	legacy bool
+}
+
+// writeKMeansState saves state to path as JSON.
+func writeKMeansState(path string, state kmeansState) error {
 	if path == "" {
 		return fmt.Errorf("ERROR: you just tried to persist your model to a file with no path!! That's a no-no. Try it with a valid filepath")
 	}
 
-	bytes, err := json.Marshal(k.Centroids)
+	state.K = len(state.Centroids)
+	if state.K != 0 {
+		state.Features = len(state.Centroids[0])
+	}
+
+	bytes, err := json.Marshal(state)
 	if err != nil {
 		return err
 	}
 
-	err = ioutil.WriteFile(path, bytes, os.ModePerm)
+	return ioutil.WriteFile(path, bytes, os.ModePerm)
+}
+
+// readKMeansState reads the state saved at path,
+// checking that it holds together. Files holding
+// just the centroid vector (which is all that used
+// to be persisted) are read as a state with only
+// centroids, and zero counts.
+func readKMeansState(path string) (kmeansState, error) {
+	state := kmeansState{}
+	if path == "" {
+		return state, fmt.Errorf("ERROR: you just tried to restore your model from a file with no path! That's a no-no. Try it with a valid filepath")
+	}
+
+	bytes, err := ioutil.ReadFile(path)
 	if err != nil {
-		return err
+		return state, err
 	}
 
-	return nil
+	trimmed := strings.TrimSpace(string(bytes))
+	if strings.HasPrefix(trimmed, "[") {
+		err = json.Unmarshal(bytes, &state.Centroids)
+		state.K = len(state.Centroids)
+		state.legacy = true
+	} else {
+		err = json.Unmarshal(bytes, &state)
+	}
+	if err != nil {
+		return state, err
+	}
+
+	if len(state.Centroids) == 0 || len(state.Centroids) != state.K {
+		return state, fmt.Errorf("ERROR: %v should hold k (%v) centroids", path, state.K)
+	}
+	for _, centroid := range state.Centroids {
+		if len(centroid) != len(state.Centroids[0]) {
+			return state, fmt.Errorf("ERROR: every centroid in %v should have the same number of features", path)
+		}
+	}
+	if state.Counts == nil {
+		state.Counts = make([]int64, state.K)
+	}
+	if len(state.Counts) != state.K {
+		return state, fmt.Errorf("ERROR: %v should hold a count for each centroid", path)
+	}
+	for _, guess := range state.Guesses {
+		if guess < 0 || guess >= state.K {
+			return state, fmt.Errorf("ERROR: %v holds a guess (%v) for a cluster that doesn't exist", path, guess)
+		}
+	}
+
+	return state, nil
 }
 
-// RestoreFromFile takes in a path to a centroid vector
-// and assigns the model it's operating on's parameter vector
-// to that.
+// PersistToFile takes in an absolute filepath and saves the
+// model to the file, which can be restored later: the
+// centroids, the number of points assigned to each, the
+// training guesses and distortion, the learning rate and
+// the other settings, and the online learning stats.
+// The function will take paths from the current directory, but
+// functions
+//
+// The data is stored as JSON because it's one of the most
+// efficient storage method (you only need one comma extra
+// per feature + two brackets, total!) And it's extendable.
+func (k *KMeans) PersistToFile(path string) error {
+	stats := k.Stats()
+	return writeKMeansState(path, kmeansState{
+		MaxIterations: k.maxIterations,
+		Alpha:         k.alpha,
+
+		Centroids:  k.Centroids,
+		Counts:     k.Counts,
+		Guesses:    k.guesses,
+		Distortion: k.Distortion(),
+
+		NInit:       k.NInit,
+		Seed:        k.Seed,
+		Inertia:     k.Inertia,
+		BestRestart: k.BestRestart,
+
+		Online: &stats,
+	})
+}
+
+// RestoreFromFile takes in a path to a persisted model
+// and restores everything PersistToFile saved, so
+// learning (online or not) picks up right where the
+// persisted model left off. The centroid vectors older
+// versions persisted can still be restored, with the
+// counts starting over at zero.
 //
 // The path must ba an absolute path or a path from the current
 // directory
@@ -629,18 +1134,37 @@ func (k *KMeans) PersistToFile(path string) error {
 // a model on data, or for graphing a dataset with a fit in
 // another framework like Julia/Gadfly.
 func (k *KMeans) RestoreFromFile(path string) error {
-	if path == "" {
-		return fmt.Errorf("ERROR: you just tried to restore your model from a file with no path! That's a no-no. Try it with a valid filepath")
-	}
-
-	bytes, err := ioutil.ReadFile(path)
+	state, err := readKMeansState(path)
 	if err != nil {
 		return err
 	}
 
-	err = json.Unmarshal(bytes, &k.Centroids)
-	if err != nil {
-		return err
+	k.Centroids = state.Centroids
+	k.Counts = state.Counts
+	if state.legacy {
+		return nil
+	}
+
+	if state.MaxIterations != 0 {
+		k.maxIterations = state.MaxIterations
+	}
+	if state.Alpha != 0 {
+		k.alpha = state.Alpha
+	}
+
+	if state.Guesses != nil {
+		k.guesses = state.Guesses
+	}
+	k.distortion = state.Distortion
+
+	k.NInit = state.NInit
+	k.Seed = state.Seed
+	k.Inertia = state.Inertia
+	k.BestRestart = state.BestRestart
+
+	k.online.OnlineCounters = base.OnlineCounters{}
+	if state.Online != nil {
+		k.online.Add(*state.Online)
 	}
 
 	return nil
@@ -1,9 +1,12 @@
 package cluster
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"os"
+	"runtime"
 	"testing"
 	"time"
 
@@ -540,3 +543,299 @@ func TestKMeansPersistToFileShouldPass1(t *testing.T) {
 	// save results to disk
 	assert.Nil(t, model.SaveClusteredData("/tmp/.goml/KMeansResults.csv"), "Save results error should be nil")
 }
+
+// a restored model should hold everything the
+// persisted one did, and carry on learning online
+// the same way
+func TestKMeansPersistToFileShouldPass2(t *testing.T) {
+	model := NewKMeans(4, 30, circles, OnlineParams{Alpha: 0.1})
+	model.NInit = 3
+	model.Seed = 42
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+	var total int64
+	for _, count := range model.Counts {
+		total += count
+	}
+	assert.Len(t, model.Counts, 4, "There should be a count for each centroid")
+	assert.Equal(t, int64(len(circles)), total, "Every training example should be counted")
+
+	assert.Nil(t, model.PersistToFile("/tmp/.goml/KMeansState.json"), "Persist error should be nil")
+
+	restored := NewKMeans(1, 1, nil)
+	assert.Nil(t, restored.RestoreFromFile("/tmp/.goml/KMeansState.json"), "Restore error should be nil")
+
+	assert.Equal(t, model.Centroids, restored.Centroids, "The centroids should be restored")
+	assert.Equal(t, model.Counts, restored.Counts, "The counts should be restored")
+	assert.Equal(t, model.Guesses(), restored.Guesses(), "The guesses should be restored")
+	assert.InDelta(t, model.Distortion(), restored.Distortion(), 1e-9, "The distortion should be restored without the training set")
+	assert.Equal(t, 30, restored.MaxIterations(), "The max iterations should be restored")
+	assert.Equal(t, 0.1, restored.LearningRate(), "The learning rate should be restored")
+	assert.Equal(t, model.Inertia, restored.Inertia, "The restarts should be restored")
+	assert.Equal(t, model.BestRestart, restored.BestRestart, "The best restart should be restored")
+	assert.Equal(t, int64(42), restored.Seed, "The seed should be restored")
+
+	learn := func(model *KMeans, points [][]float64) {
+		stream := make(chan base.Datapoint, len(points))
+		for _, point := range points {
+			stream <- base.Datapoint{X: point}
+		}
+		close(stream)
+
+		err := model.OnlineLearnContext(context.Background(), stream, base.OnlineOptions{})
+		assert.Nil(t, err, "Learning error should be nil")
+	}
+
+	points := [][]float64{{-10, -10}, {10, 10}, {-10, 10}, {11, -9}, {9, 9}}
+	learn(model, points)
+	learn(restored, points)
+	assert.Equal(t, model.Centroids, restored.Centroids, "The restored model should learn online the same way")
+	assert.Equal(t, model.Counts, restored.Counts, "The restored model should keep counting")
+	assert.Equal(t, total+int64(len(points)), restored.Counts[0]+restored.Counts[1]+restored.Counts[2]+restored.Counts[3], "Online points should be counted")
+
+	// and so should one restored after that
+	assert.Nil(t, restored.PersistToFile("/tmp/.goml/KMeansState.json"), "Persist error should be nil")
+	again := NewKMeans(1, 1, nil)
+	assert.Nil(t, again.RestoreFromFile("/tmp/.goml/KMeansState.json"), "Restore error should be nil")
+	assert.Equal(t, restored.Stats(), again.Stats(), "The online stats should be restored")
+	assert.Equal(t, int64(len(points)), again.Stats().Seen, "The online stats should count the points seen")
+}
+
+// files holding just the centroids, or which don't
+// hold together, should still restore (or error)
+// cleanly
+func TestKMeansRestoreFromFileShouldFail1(t *testing.T) {
+	model := NewKMeans(2, 10, double)
+	model.NInit = 4
+
+	err := ioutil.WriteFile("/tmp/.goml/KMeansLegacy.json", []byte("[[-7.5,0],[7.5,0]]"), os.ModePerm)
+	assert.Nil(t, err, "Write error should be nil")
+	assert.Nil(t, model.RestoreFromFile("/tmp/.goml/KMeansLegacy.json"), "A centroid vector should still restore")
+	assert.Equal(t, [][]float64{{-7.5, 0}, {7.5, 0}}, model.Centroids, "The centroids should be restored")
+	assert.Equal(t, []int64{0, 0}, model.Counts, "The counts should start over")
+	assert.Equal(t, 4, model.NInit, "Settings shouldn't be touched by a centroid vector")
+
+	for _, broken := range []string{
+		`{"k":3,"centroids":[[1,2],[3,4]]}`,
+		`{"k":2,"centroids":[[1,2],[3]]}`,
+		`{"k":2,"centroids":[[1,2],[3,4]],"counts":[1]}`,
+		`{"k":2,"centroids":[[1,2],[3,4]],"guesses":[0,2]}`,
+		`{"k":0,"centroids":[]}`,
+	} {
+		err = ioutil.WriteFile("/tmp/.goml/KMeansBroken.json", []byte(broken), os.ModePerm)
+		assert.Nil(t, err, "Write error should be nil")
+		assert.NotNil(t, model.RestoreFromFile("/tmp/.goml/KMeansBroken.json"), "Restoring %v should return an error", broken)
+	}
+
+	assert.NotNil(t, model.RestoreFromFile(""), "Restoring from no path should return an error")
+	assert.NotNil(t, model.PersistToFile(""), "Persisting to no path should return an error")
+}
+
+// Learn seeds centroids from the training set, so
+// make sure updating them doesn't write into it
+func TestKMeansDoesNotMutateTrainingSetShouldPass1(t *testing.T) {
+	data := make([][]float64, len(circles))
+	expected := make([][]float64, len(circles))
+	for i := range circles {
+		data[i] = append([]float64{}, circles[i]...)
+		expected[i] = append([]float64{}, circles[i]...)
+	}
+
+	model := NewKMeans(4, 10, data)
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+	assert.Equal(t, expected, data, "Learning should not modify the training set")
+
+	x := []float64{3, 4}
+	_, err := model.Predict(x, true)
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, []float64{3, 4}, x, "Input to Predict should not be modified when normalizing")
+}
+
+// Predict should be safe to call from other goroutines
+// while learning with copy on write (run with -race)
+func TestOnlineKMeansCopyOnWriteShouldPass1(t *testing.T) {
+	stream := make(chan base.Datapoint, 100)
+
+	model := NewKMeans(2, 0, nil, OnlineParams{
+		Alpha:    0.1,
+		Features: 2,
+	})
+	model.Centroids = [][]float64{{-1, -1}, {1, 1}}
+	old := model.Centroids
+
+	go func() {
+		for i := 0; i < 2000; i++ {
+			stream <- base.Datapoint{X: []float64{rand.Float64() - 20, rand.Float64() - 20}}
+			stream <- base.Datapoint{X: []float64{rand.Float64() + 20, rand.Float64() + 20}}
+		}
+
+		close(stream)
+	}()
+
+	done := make(chan struct{})
+	predictErrors := make(chan error, 4)
+	for g := 0; g < 4; g++ {
+		go func() {
+			for {
+				select {
+				case <-done:
+					predictErrors <- nil
+					return
+				default:
+				}
+
+				_, err := model.Predict([]float64{20, 20})
+				if err != nil {
+					predictErrors <- err
+					return
+				}
+			}
+		}()
+	}
+
+	err := model.OnlineLearnContext(context.Background(), stream, base.OnlineOptions{
+		CopyOnWrite: true,
+	})
+	close(done)
+
+	assert.Nil(t, err, "Learning error should be nil")
+	for g := 0; g < 4; g++ {
+		assert.Nil(t, <-predictErrors, "Prediction error should be nil")
+	}
+
+	assert.Equal(t, [][]float64{{-1, -1}, {1, 1}}, old, "The old centroids should never be written to")
+	assert.Equal(t, int64(4000), model.Stats().Updates, "Every point should update a centroid")
+
+	c1, err := model.Predict([]float64{-20, -20})
+	assert.Nil(t, err, "Prediction error should be nil")
+
+	c2, err := model.Predict([]float64{20, 20})
+	assert.Nil(t, err, "Prediction error should be nil")
+
+	assert.NotEqual(t, c1[0], c2[0], "The two clusters should be told apart after learning")
+}
+
+// any distance can be given to assign points by
+func TestKMeansDistanceShouldPass1(t *testing.T) {
+	var wrong, count int
+	for iter := 0; iter < 10; iter++ {
+		model := NewKMeans(2, 5, double)
+		model.Distance = base.ManhattanDistance
+		model.NInit = 4
+		model.Seed = int64(iter + 1)
+		assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+		c1, err := model.Predict([]float64{-7.5, 0})
+		assert.Nil(t, err, "Prediction error should be nil")
+		c2, err := model.Predict([]float64{7.5, 0})
+		assert.Nil(t, err, "Prediction error should be nil")
+
+		for i, x := range double {
+			expected := c1[0]
+			if x[0] > 0 {
+				expected = c2[0]
+			}
+			if float64(model.Guesses()[i]) != expected {
+				wrong++
+			}
+			count++
+		}
+
+		var distortion float64
+		for i, x := range double {
+			distortion += base.ManhattanDistance(x, model.Centroids[model.Guesses()[i]])
+		}
+		assert.InDelta(t, distortion, model.Distortion(), 1e-6, "Distortion should use the given distance")
+	}
+
+	accuracy := 100 * (1 - float64(wrong)/float64(count))
+	assert.True(t, accuracy > 80, "Accuracy (%v) should be greater than 80 percent", accuracy)
+}
+
+// restarts should keep the best clustering, and a
+// seed should make learning repeatable
+func TestKMeansNInitShouldPass1(t *testing.T) {
+	model := NewKMeans(4, 30, circles)
+	model.NInit = 8
+	model.Seed = 42
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+	assert.Len(t, model.Inertia, 8, "The distortion of every restart should be recorded")
+	for _, inertia := range model.Inertia {
+		assert.True(t, model.Inertia[model.BestRestart] <= inertia, "The best restart should have the lowest distortion")
+	}
+	assert.InDelta(t, model.Inertia[model.BestRestart], model.Distortion(), 1e-6, "The model should keep the best restart")
+
+	again := NewKMeans(4, 30, circles)
+	again.NInit = 8
+	again.Seed = 42
+	assert.Nil(t, again.Learn(), "Learning error should be nil")
+	assert.Equal(t, model.Centroids, again.Centroids, "The same seed should find the same centroids")
+	assert.Equal(t, model.Inertia, again.Inertia, "The same seed should find the same distortions")
+
+	// the best of 8 should find the 4 blocks
+	c1, err := model.Predict([]float64{-10, -10})
+	assert.Nil(t, err, "Prediction error should be nil")
+	for _, corner := range [][]float64{{-10, 10}, {10, -10}, {10, 10}} {
+		guess, err := model.Predict(corner)
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.NotEqual(t, c1, guess, "Each block should be its own cluster")
+	}
+}
+
+// learning in parallel should find the same clustering
+// however many goroutines the chunks run on
+func TestKMeansParallelShouldPass1(t *testing.T) {
+	x, y := blobs(rand.New(rand.NewSource(42)), 5000)
+
+	seen := make([]int, len(x))
+	chunks := eachChunk(len(x), func(chunk, start, end int) {
+		assert.Equal(t, chunk*learnChunk, start, "Chunks should be learnChunk points apart")
+		for i := start; i < end; i++ {
+			seen[i]++
+		}
+	})
+	assert.Equal(t, (len(x)+learnChunk-1)/learnChunk, chunks, "Every point should be in a chunk")
+	for i := range seen {
+		assert.Equal(t, 1, seen[i], "Every point should be in exactly one chunk")
+	}
+
+	totals, counts := centroidSums(x, y, 4)
+	assert.Equal(t, clusterCounts(y, 4), counts, "The counts should match the guesses")
+	for j := range totals {
+		for l := range totals[j] {
+			assert.InDelta(t, blobCenters[j][l], totals[j][l]/float64(counts[j]), 0.2, "The sums should give the mean of each blob")
+		}
+	}
+
+	learn := func() (*KMeans, *TriangleKMeans) {
+		model := NewKMeans(4, 50, x)
+		model.Seed = 7
+		model.Output = ioutil.Discard
+		assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+		triangle := NewTriangleKMeans(4, 50, x)
+		triangle.Seed = 7
+		triangle.Output = ioutil.Discard
+		assert.Nil(t, triangle.Learn(), "Learning error should be nil")
+
+		return model, triangle
+	}
+
+	// the worker pools are as big as GOMAXPROCS, so
+	// this splits the work even on a single CPU
+	procs := runtime.GOMAXPROCS(4)
+	model, triangle := learn()
+	assert.True(t, purity(model.Guesses(), y) > 0.98, "KMeans should find the blobs")
+	assert.True(t, purity(triangle.Guesses(), y) > 0.98, "TriangleKMeans should find the blobs")
+
+	runtime.GOMAXPROCS(1)
+	single, singleTriangle := learn()
+	runtime.GOMAXPROCS(procs)
+
+	assert.Equal(t, model.Centroids, single.Centroids, "KMeans should find the same centroids on one core")
+	assert.Equal(t, model.Guesses(), single.Guesses(), "KMeans should find the same guesses on one core")
+	assert.Equal(t, model.Distortion(), single.Distortion(), "KMeans should find the same distortion on one core")
+	assert.Equal(t, triangle.Centroids, singleTriangle.Centroids, "TriangleKMeans should find the same centroids on one core")
+	assert.Equal(t, triangle.Guesses(), singleTriangle.Guesses(), "TriangleKMeans should find the same guesses on one core")
+}
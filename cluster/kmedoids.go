@@ -0,0 +1,595 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+
+	"github.com/bountylabs/goml/base"
+)
+
+// KMedoidsMethod is the algorithm KMedoids
+// searches for its medoids with.
+type KMedoidsMethod int
+
+const (
+	// AutoMedoids uses PAM for training sets of up
+	// to PAMMaxExamples points, and CLARA above that.
+	AutoMedoids KMedoidsMethod = iota
+
+	// PAM (Partitioning Around Medoids) greedily
+	// picks the medoids which lower the total
+	// distance the most, then swaps medoids with
+	// other points while that lowers it. It finds
+	// very good medoids, but works out the distance
+	// between every pair of points, so it takes
+	// O(n²) time and memory.
+	PAM
+
+	// CLARA (Clustering LARge Applications) runs PAM
+	// on a few random samples of the training set
+	// (each including the best medoids so far) and
+	// keeps the medoids with the lowest total
+	// distance over the whole set.
+	CLARA
+)
+
+const (
+	// PAMMaxExamples is the largest training set
+	// AutoMedoids uses PAM for.
+	PAMMaxExamples = 2000
+
+	// DefaultCLARASamples is the number of samples
+	// CLARA clusters if Samples isn't set.
+	DefaultCLARASamples = 5
+)
+
+// String implements the fmt.Stringer interface.
+func (m KMedoidsMethod) String() string {
+	switch m {
+	case AutoMedoids:
+		return "auto"
+	case PAM:
+		return "PAM"
+	case CLARA:
+		return "CLARA"
+	}
+
+	return fmt.Sprintf("KMedoidsMethod(%v)", int(m))
+}
+
+/*
+KMedoids implements the k-medoids unsupervised
+clustering algorithm. Instead of the mean of the
+points in each cluster (like KMeans), every cluster
+is centered on one of its points, the medoid, which
+has the lowest total distance to the rest of them.
+That makes it work with any base.DistanceMeasure,
+including ones where the mean of the points isn't
+a good center (or isn't even a valid point) like
+the Jaccard or cosine distances, and makes it less
+sensitive to outliers.
+
+https://en.wikipedia.org/wiki/K-medoids
+
+Example KMedoids Model Usage:
+
+	// sessions as sets of the pages visited
+	sessions := [][]float64{
+		{1, 1, 0, 0, 0, 0},
+		{1, 1, 1, 0, 0, 0},
+		{0, 1, 1, 0, 0, 0},
+		{0, 0, 0, 1, 1, 0},
+		{0, 0, 0, 1, 1, 1},
+		{0, 0, 0, 0, 1, 1},
+	}
+
+	model := NewKMedoids(2, 30, sessions, base.JaccardDistance)
+
+	if model.Learn() != nil {
+		panic("Oh NO!!! There was an error learning!!")
+	}
+
+	// the medoids are points of the training set
+	fmt.Println(model.Medoids, model.MedoidIndices)
+
+	// now you can predict like normal!
+	guess, err := model.Predict([]float64{0, 0, 0, 1, 0, 1})
+	if err != nil {
+		panic("prediction error")
+	}
+
+	// or if you want to get the clustering
+	// results from the data
+	results := model.Guesses()
+
+	// you can also persist the model to a
+	// file (the distance isn't persisted, so
+	// give the restored model the same one)
+	err = model.PersistToFile("/tmp/.goml/KMedoids.json")
+	if err != nil {
+		panic("file save error")
+	}
+
+	// and also restore from file (at a
+	// later time if you want)
+	err = model.RestoreFromFile("/tmp/.goml/KMedoids.json")
+	if err != nil {
+		panic("file save error")
+	}
+*/
+type KMedoids struct {
+	// k is the number of medoids
+	k int
+
+	// maxIterations is the number of swaps PAM
+	// makes at most (or no limit if it's 0 or
+	// less.)
+	maxIterations int
+
+	// trainingSet and guesses are the 'x', and
+	// 'y' of the data, just like KMeans'
+	trainingSet [][]float64
+	guesses     []int
+
+	// Medoids are the centers of each cluster, and
+	// MedoidIndices the index of each one within
+	// the training set.
+	Medoids       [][]float64 `json:"medoids"`
+	MedoidIndices []int       `json:"medoid_indices"`
+
+	// Distance is the distance the model clusters
+	// with. It doesn't have to be a metric.
+	Distance base.DistanceMeasure `json:"-"`
+
+	// Method is the algorithm the medoids are
+	// searched with (AutoMedoids by default.)
+	Method KMedoidsMethod `json:"-"`
+
+	// Samples is the number of samples CLARA
+	// clusters (DefaultCLARASamples if it's 0),
+	// and SampleSize the number of points in each
+	// (40 + 2k if it's 0.)
+	Samples    int `json:"-"`
+	SampleSize int `json:"-"`
+
+	// Seed seeds CLARA's random samples, so Learn
+	// always finds the same medoids for the same
+	// Seed, just like KMeans'. If it's 0, a random
+	// seed is used.
+	Seed int64 `json:"-"`
+
+	// Output is the io.Writer to write
+	// logging to. Defaults to os.Stdout
+	// but can be changed to any io.Writer
+	Output io.Writer `json:"-"`
+}
+
+// NewKMedoids returns a pointer to the k-medoids
+// model, which clusters given inputs around k of
+// them by distance (base.EuclideanDistance if it's
+// nil.)
+func NewKMedoids(k, maxIterations int, trainingSet [][]float64, distance base.DistanceMeasure) *KMedoids {
+	if distance == nil {
+		distance = base.EuclideanDistance
+	}
+
+	return &KMedoids{
+		k:             k,
+		maxIterations: maxIterations,
+
+		trainingSet: trainingSet,
+		guesses:     make([]int, len(trainingSet)),
+
+		Distance: distance,
+		Output:   os.Stdout,
+	}
+}
+
+// UpdateTrainingSet takes in a new training set (variable x.)
+//
+// Will reset the hidden 'guesses' param of the KMedoids model.
+func (k *KMedoids) UpdateTrainingSet(trainingSet [][]float64) error {
+	if len(trainingSet) == 0 {
+		return fmt.Errorf("ERROR: length of given training set is 0! Need data!")
+	}
+
+	k.trainingSet = trainingSet
+	k.guesses = make([]int, len(trainingSet))
+
+	return nil
+}
+
+// Examples returns the number of training examples (m)
+// that the model currently is training from.
+func (k *KMedoids) Examples() int {
+	return len(k.trainingSet)
+}
+
+// MaxIterations returns the number of maximum iterations
+// the model will go through
+func (k *KMedoids) MaxIterations() int {
+	return k.maxIterations
+}
+
+// nearest returns the index of the medoid closest
+// to x, and its distance.
+func (k *KMedoids) nearest(x []float64) (int, float64) {
+	guess := 0
+	min := k.Distance(x, k.Medoids[0])
+	for j := 1; j < len(k.Medoids); j++ {
+		if d := k.Distance(x, k.Medoids[j]); d < min {
+			min = d
+			guess = j
+		}
+	}
+
+	return guess, min
+}
+
+// Predict takes in a variable x (an array of floats,) and
+// returns the cluster of the medoid closest to it.
+//
+// if normalize is given as true, then the input will
+// first be normalized to unit length. Only use this if
+// you trained off of normalized inputs and are feeding
+// an un-normalized input
+func (k *KMedoids) Predict(x []float64, normalize ...bool) ([]float64, error) {
+	if len(k.Medoids) == 0 {
+		return nil, fmt.Errorf("ERROR: the model has no medoids! Learn (or restore) the model first")
+	}
+	if len(x) != len(k.Medoids[0]) {
+		return nil, fmt.Errorf("ERROR: Medoid vector should be the same length as input vector!\n\tLength of x given: %v\n\tLength of medoid: %v\n", len(x), len(k.Medoids[0]))
+	}
+
+	if len(normalize) != 0 && normalize[0] {
+		x = base.NormalizedPoint(x)
+	}
+
+	guess, _ := k.nearest(x)
+	return []float64{float64(guess)}, nil
+}
+
+// Learn finds the medoids of the training set with
+// the model's Method, and assigns each point to the
+// closest one.
+func (k *KMedoids) Learn() error {
+	examples := len(k.trainingSet)
+	if examples == 0 || len(k.trainingSet[0]) == 0 {
+		err := fmt.Errorf("ERROR: Attempting to learn with no training examples!\n")
+		fmt.Fprintf(k.Output, err.Error())
+		return err
+	}
+
+	if k.k < 1 || k.k > examples {
+		err := fmt.Errorf("ERROR: need between 1 and %v medoids (the number of training examples), given %v\n", examples, k.k)
+		fmt.Fprintf(k.Output, err.Error())
+		return err
+	}
+
+	if k.Distance == nil {
+		k.Distance = base.EuclideanDistance
+	}
+
+	method := k.Method
+	if method == AutoMedoids {
+		method = PAM
+		if examples > PAMMaxExamples {
+			method = CLARA
+		}
+	}
+
+	fmt.Fprintf(k.Output, "Training:\n\tModel: K-Medoids (%v) Clustering\n\tTraining Examples: %v\n\tFeatures: %v\n\tClasses: %v\n...\n\n", method, examples, len(k.trainingSet[0]), k.k)
+
+	var indices []int
+	var err error
+	switch method {
+	case PAM:
+		all := make([]int, examples)
+		for i := range all {
+			all[i] = i
+		}
+		indices, err = pam(k.trainingSet, all, k.k, k.maxIterations, k.Distance)
+	case CLARA:
+		seed := k.Seed
+		if seed == 0 {
+			seed = rand.Int63()
+		}
+		indices, err = k.clara(rand.New(rand.NewSource(seed)))
+	default:
+		err = fmt.Errorf("ERROR: unknown k-medoids method %v\n", method)
+	}
+	if err != nil {
+		fmt.Fprintf(k.Output, err.Error())
+		return err
+	}
+
+	k.MedoidIndices = indices
+	k.Medoids = make([][]float64, len(indices))
+	for j, i := range indices {
+		k.Medoids[j] = append([]float64{}, k.trainingSet[i]...)
+	}
+
+	for i, x := range k.trainingSet {
+		k.guesses[i], _ = k.nearest(x)
+	}
+
+	fmt.Fprintf(k.Output, "Training Completed.\n%v\n", k)
+
+	return nil
+}
+
+// clara returns the indices of the best medoids PAM
+// finds for a few samples of the training set, drawn
+// from random.
+func (k *KMedoids) clara(random *rand.Rand) ([]int, error) {
+	examples := len(k.trainingSet)
+
+	samples := k.Samples
+	if samples < 1 {
+		samples = DefaultCLARASamples
+	}
+	size := k.SampleSize
+	if size < 1 {
+		size = 40 + 2*k.k
+	}
+	if size > examples {
+		size = examples
+	}
+	if size < k.k {
+		size = k.k
+	}
+
+	var best []int
+	bestCost := math.Inf(1)
+	for s := 0; s < samples; s++ {
+		// every sample after the first includes the
+		// best medoids so far, so it can only improve
+		sample := append([]int{}, best...)
+		chosen := map[int]bool{}
+		for _, i := range sample {
+			chosen[i] = true
+		}
+		for _, i := range random.Perm(examples) {
+			if len(sample) == size {
+				break
+			}
+			if !chosen[i] {
+				sample = append(sample, i)
+			}
+		}
+
+		medoids, err := pam(k.trainingSet, sample, k.k, k.maxIterations, k.Distance)
+		if err != nil {
+			return nil, err
+		}
+
+		var cost float64
+		for _, x := range k.trainingSet {
+			min := math.Inf(1)
+			for _, m := range medoids {
+				min = math.Min(min, k.Distance(x, k.trainingSet[m]))
+			}
+			cost += min
+		}
+
+		if cost < bestCost {
+			best, bestCost = medoids, cost
+		}
+	}
+
+	return best, nil
+}
+
+// pam returns the indices (within x) of the k
+// medoids PAM finds for the points of x at the
+// given indices.
+func pam(x [][]float64, indices []int, k, maxIterations int, distance base.DistanceMeasure) ([]int, error) {
+	n := len(indices)
+
+	// the distance between every pair of points
+	dist := make([][]float64, n)
+	for i := range dist {
+		dist[i] = make([]float64, n)
+		for j := 0; j < i; j++ {
+			dist[i][j] = distance(x[indices[i]], x[indices[j]])
+			dist[j][i] = dist[i][j]
+		}
+	}
+
+	// nearest[i] is the medoid closest to point i, at
+	// a distance of d[i], and e[i] the distance to
+	// the second closest one
+	medoids := make([]int, 0, k)
+	isMedoid := make([]bool, n)
+	nearest := make([]int, n)
+	d := make([]float64, n)
+	e := make([]float64, n)
+
+	assign := func() {
+		for i := range d {
+			d[i], e[i] = math.Inf(1), math.Inf(1)
+			for _, m := range medoids {
+				switch {
+				case dist[i][m] < d[i]:
+					e[i] = d[i]
+					d[i], nearest[i] = dist[i][m], m
+				case dist[i][m] < e[i]:
+					e[i] = dist[i][m]
+				}
+			}
+		}
+	}
+
+	// BUILD: greedily add the medoid which lowers the
+	// total distance the most
+	for i := range d {
+		d[i] = math.Inf(1)
+	}
+	for len(medoids) < k {
+		best, bestCost := -1, math.Inf(1)
+		for h := 0; h < n; h++ {
+			if isMedoid[h] {
+				continue
+			}
+
+			var cost float64
+			for i := range d {
+				cost += math.Min(d[i], dist[i][h])
+			}
+			if cost < bestCost {
+				best, bestCost = h, cost
+			}
+		}
+
+		// every cost is NaN when the distance is
+		if best < 0 {
+			return nil, fmt.Errorf("ERROR: couldn't choose medoid %v: the total distance to every point is NaN\n", len(medoids)+1)
+		}
+
+		medoids = append(medoids, best)
+		isMedoid[best] = true
+		assign()
+	}
+
+	// SWAP: swap a medoid with another point while
+	// that lowers the total distance
+	for iter := 0; maxIterations <= 0 || iter < maxIterations; iter++ {
+		bestM, bestH, bestDelta := -1, -1, 0.0
+		for mi, m := range medoids {
+			for h := 0; h < n; h++ {
+				if isMedoid[h] {
+					continue
+				}
+
+				// the change in total distance from
+				// swapping m for h
+				var delta float64
+				for i := range d {
+					if nearest[i] == m {
+						delta += math.Min(dist[i][h], e[i]) - d[i]
+					} else if dist[i][h] < d[i] {
+						delta += dist[i][h] - d[i]
+					}
+				}
+
+				if delta < bestDelta {
+					bestM, bestH, bestDelta = mi, h, delta
+				}
+			}
+		}
+
+		// stop if no swap is better by more than
+		// rounding error
+		if bestM < 0 || bestDelta > -1e-12 {
+			break
+		}
+
+		isMedoid[medoids[bestM]] = false
+		isMedoid[bestH] = true
+		medoids[bestM] = bestH
+		assign()
+	}
+
+	result := make([]int, len(medoids))
+	for j, m := range medoids {
+		result[j] = indices[m]
+	}
+
+	return result, nil
+}
+
+// String implements the fmt interface for clean printing. Here
+// we're using it to print the model as the equation h(θ)=...
+// where h is the k-medoids hypothesis model
+func (k *KMedoids) String() string {
+	return fmt.Sprintf("h(θ,x) = argmin_j d(x[i], m[j])\n\tm = %v", k.Medoids)
+}
+
+// Guesses returns the hidden parameter for the
+// unsupervised classification assigned during
+// learning.
+//
+//	model.Guesses[i] = E[k.trainingSet[i]]
+func (k *KMedoids) Guesses() []int {
+	return k.guesses
+}
+
+// Cost returns the total distance from each point
+// in the training set to its medoid, which is what
+// the learning algorithm tries to minimize.
+func (k *KMedoids) Cost() float64 {
+	var sum float64
+	for i := range k.trainingSet {
+		sum += k.Distance(k.trainingSet[i], k.Medoids[k.guesses[i]])
+	}
+
+	return sum
+}
+
+// SaveClusteredData concatenates the training set
+// with the assigned class from clustering and saves
+// it to file, just like KMeans'.
+func (k *KMedoids) SaveClusteredData(filepath string) error {
+	floatGuesses := []float64{}
+	for _, val := range k.guesses {
+		floatGuesses = append(floatGuesses, float64(val))
+	}
+
+	return base.SaveDataToCSV(filepath, k.trainingSet, floatGuesses, true)
+}
+
+// PersistToFile takes in an absolute filepath and saves the
+// medoids (and their indices) to the file, which can be
+// restored later. The Distance can't be saved, so set it
+// again on the restored model if it isn't the default.
+func (k *KMedoids) PersistToFile(path string) error {
+	if path == "" {
+		return fmt.Errorf("ERROR: you just tried to persist your model to a file with no path!! That's a no-no. Try it with a valid filepath")
+	}
+
+	bytes, err := json.Marshal(k)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, bytes, os.ModePerm)
+}
+
+// RestoreFromFile takes in a path to a persisted model
+// and restores its medoids.
+//
+// The path must ba an absolute path or a path from the current
+// directory
+func (k *KMedoids) RestoreFromFile(path string) error {
+	if path == "" {
+		return fmt.Errorf("ERROR: you just tried to restore your model from a file with no path! That's a no-no. Try it with a valid filepath")
+	}
+
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	restored := KMedoids{}
+	err = json.Unmarshal(bytes, &restored)
+	if err != nil {
+		return err
+	}
+
+	if len(restored.Medoids) == 0 {
+		return fmt.Errorf("ERROR: no medoids found in %v", path)
+	}
+
+	k.Medoids = restored.Medoids
+	k.MedoidIndices = restored.MedoidIndices
+	if k.Distance == nil {
+		k.Distance = base.EuclideanDistance
+	}
+
+	return nil
+}
@@ -0,0 +1,203 @@
+package cluster
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/bountylabs/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sessions returns n user sessions (as sets of the
+// pages visited) from a few groups of users who each
+// visit their own pages, and sometimes others
+func sessions(random *rand.Rand, n int) ([][]float64, []int) {
+	groups := [][]int{
+		{0, 1, 2, 3, 4},
+		{5, 6, 7, 8, 9},
+		{10, 11, 12, 13, 14},
+	}
+
+	x := make([][]float64, n)
+	y := make([]int, n)
+	for i := range x {
+		y[i] = random.Intn(len(groups))
+		x[i] = make([]float64, 15)
+		for _, page := range groups[y[i]] {
+			if random.Float64() < 0.7 {
+				x[i][page] = 1
+			}
+		}
+		if random.Float64() < 0.3 {
+			x[i][random.Intn(15)] = 1
+		}
+		// every session visits at least one page
+		x[i][groups[y[i]][random.Intn(5)]] = 1
+	}
+
+	return x, y
+}
+
+// purity returns the fraction of points in the
+// most common group of their cluster
+func purity(guesses, groups []int) float64 {
+	counts := map[[2]int]int{}
+	for i := range guesses {
+		counts[[2]int{guesses[i], groups[i]}]++
+	}
+
+	best := map[int]int{}
+	for key, count := range counts {
+		if count > best[key[0]] {
+			best[key[0]] = count
+		}
+	}
+
+	var sum int
+	for _, count := range best {
+		sum += count
+	}
+
+	return float64(sum) / float64(len(guesses))
+}
+
+// PAM should find medoids about as good as the best
+// possible ones
+func TestKMedoidsShouldPass1(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	x := make([][]float64, 12)
+	for i := range x {
+		x[i] = []float64{random.NormFloat64() * 5, random.NormFloat64() * 5}
+	}
+
+	model := NewKMedoids(3, 0, x, base.ManhattanDistance)
+	model.Method = PAM
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+	assert.Len(t, model.Medoids, 3, "There should be k medoids")
+
+	for j, i := range model.MedoidIndices {
+		assert.Equal(t, x[i], model.Medoids[j], "Medoids should be points of the training set")
+	}
+
+	best := math.Inf(1)
+	for a := 0; a < len(x); a++ {
+		for b := a + 1; b < len(x); b++ {
+			for c := b + 1; c < len(x); c++ {
+				var cost float64
+				for _, point := range x {
+					cost += math.Min(base.ManhattanDistance(point, x[a]), math.Min(base.ManhattanDistance(point, x[b]), base.ManhattanDistance(point, x[c])))
+				}
+				best = math.Min(best, cost)
+			}
+		}
+	}
+	assert.True(t, model.Cost() <= best*1.05, "PAM's cost (%v) should be close to the best possible (%v)", model.Cost(), best)
+
+	for i, point := range x {
+		guess, err := model.Predict(point)
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.Equal(t, float64(model.Guesses()[i]), guess[0], "Predictions should match the clustering of the training set")
+	}
+}
+
+// clustering sessions with the Jaccard and cosine
+// distances
+func TestKMedoidsShouldPass2(t *testing.T) {
+	random := rand.New(rand.NewSource(7))
+	x, groups := sessions(random, 300)
+
+	for _, distance := range []base.DistanceMeasure{base.JaccardDistance, base.CosineDistance} {
+		for _, method := range []KMedoidsMethod{PAM, CLARA} {
+			model := NewKMedoids(3, 0, x, distance)
+			model.Method = method
+			assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+			p := purity(model.Guesses(), groups)
+			assert.True(t, p > 0.9, "Clusters (%v) should match the groups of users (purity %v)", method, p)
+		}
+	}
+}
+
+func TestKMedoidsShouldPass3(t *testing.T) {
+	model := NewKMedoids(4, 0, circles, nil)
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+	// each block should be its own cluster
+	for _, corner := range [][]float64{{-10, -10}, {-10, 10}, {10, -10}, {10, 10}} {
+		expected, err := model.Predict(corner)
+		assert.Nil(t, err, "Prediction error should be nil")
+
+		for _, offset := range [][]float64{{-1.5, -1.5}, {1.5, 1.5}, {-1.5, 1.5}, {1.5, -1.5}} {
+			guess, err := model.Predict([]float64{corner[0] + offset[0], corner[1] + offset[1]})
+			assert.Nil(t, err, "Prediction error should be nil")
+			assert.Equal(t, expected, guess, "Points in the same block should be in the same cluster")
+		}
+	}
+
+	err := model.PersistToFile("/tmp/.goml/KMedoids.json")
+	assert.Nil(t, err, "Persistence error should be nil")
+
+	restored := NewKMedoids(4, 0, nil, nil)
+	err = restored.RestoreFromFile("/tmp/.goml/KMedoids.json")
+	assert.Nil(t, err, "Restore error should be nil")
+	assert.Equal(t, model.Medoids, restored.Medoids, "The medoids should be restored")
+	assert.Equal(t, model.MedoidIndices, restored.MedoidIndices, "The medoid indices should be restored")
+
+	for _, point := range circles[:50] {
+		expected, err := model.Predict(point)
+		assert.Nil(t, err, "Prediction error should be nil")
+		guess, err := restored.Predict(point)
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.Equal(t, expected, guess, "The restored model should predict the same")
+	}
+}
+
+// CLARA should draw the same samples for the same
+// Seed
+func TestKMedoidsShouldPass4(t *testing.T) {
+	x, _ := sessions(rand.New(rand.NewSource(9)), 400)
+
+	var expected []int
+	for i := 0; i < 3; i++ {
+		model := NewKMedoids(4, 0, x, base.JaccardDistance)
+		model.Method = CLARA
+		model.SampleSize = 20
+		model.Seed = 42
+		assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+		if expected == nil {
+			expected = model.MedoidIndices
+		}
+		assert.Equal(t, expected, model.MedoidIndices, "Learning with the same Seed should find the same medoids")
+	}
+}
+
+func TestKMedoidsShouldFail1(t *testing.T) {
+	model := NewKMedoids(3, 0, [][]float64{{1}, {2}}, nil)
+	assert.NotNil(t, model.Learn(), "Asking for more medoids than points should return an error")
+
+	_, err := model.Predict([]float64{1})
+	assert.NotNil(t, err, "Predicting before learning should return an error")
+
+	model = NewKMedoids(1, 0, nil, nil)
+	assert.NotNil(t, model.Learn(), "Learning with no data should return an error")
+	assert.NotNil(t, model.UpdateTrainingSet(nil), "Updating to no data should return an error")
+
+	assert.Nil(t, model.UpdateTrainingSet([][]float64{{1, 2}, {3, 4}}), "Updating the training set should not fail")
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+	_, err = model.Predict([]float64{1})
+	assert.NotNil(t, err, "Predicting a point of the wrong dimension should return an error")
+
+	// no medoid can be chosen if every distance is NaN
+	nan := func(u, v []float64) float64 { return math.NaN() }
+	for _, method := range []KMedoidsMethod{PAM, CLARA} {
+		broken := NewKMedoids(2, 0, [][]float64{{1, 2}, {3, 4}, {5, 6}}, nan)
+		broken.Method = method
+		assert.NotNil(t, broken.Learn(), "Learning (%v) with a NaN distance should return an error", method)
+	}
+
+	assert.NotNil(t, model.PersistToFile(""), "Persisting to no path should return an error")
+	assert.NotNil(t, model.RestoreFromFile("/tmp/.goml/does_not_exist.json"), "Restoring from a missing file should return an error")
+}
@@ -2,18 +2,67 @@ package cluster
 
 import (
 	"fmt"
-	"math"
+	"sort"
 
 	"github.com/bountylabs/goml/base"
 )
 
+// KNNMode defines a type enum which (using the
+// constants declared below) lets a user choose
+// whether a KNN model classifies or regresses.
+type KNNMode int
+
+// Constants declare the modes a KNN model can
+// predict in.
+const (
+	// KNNClassification predicts the class most of
+	// the K nearest neighbors are in. It's the
+	// default.
+	KNNClassification KNNMode = iota
+
+	// KNNRegression predicts the mean of the labels
+	// of the K nearest neighbors.
+	KNNRegression
+)
+
+// KNNWeighting defines a type enum which (using the
+// constants declared below) lets a user choose how
+// much each of the K nearest neighbors counts in a
+// KNN prediction.
+type KNNWeighting int
+
+// Constants declare the ways a KNN model can weigh
+// its neighbors.
+const (
+	// UniformWeights counts every neighbor the same,
+	// which is a plain majority vote (or mean.) It's
+	// the default.
+	UniformWeights KNNWeighting = iota
+
+	// DistanceWeights counts every neighbor by the
+	// inverse of its distance to the input, so closer
+	// neighbors count more. Neighbors at a distance of
+	// 0 (exact matches) outweigh everything else.
+	DistanceWeights
+)
+
 /*
 KNN implements the KNN algorithm
 for classification, where an input
 is classified by finding the K
 nearest (by some distance metric)
 data points, and taking a vote
-based on those.
+based on those. With Mode set to
+KNNRegression it predicts the mean
+of their labels instead.
+
+Classification takes a vote of the
+neighbors' classes (weighted by their
+distance to the input if Weighting is
+DistanceWeights), so any labels can be
+used as classes. Ties go to whichever
+of the tied classes has the nearest
+neighbor.
 
 https://en.wikipedia.org/wiki/K-nearest_neighbors_algorithm
 
@@ -49,14 +98,33 @@ Example K-Nearest-Neighbors Model Usage:
 
 	// update the K used (use 10 neighbors now)
 	model.K = 10
+
+	// predict with a distance weighted vote,
+	// and get the neighbors used (with their
+	// index in the training set)
+	model.Weighting = DistanceWeights
+	guess, neighbors, err := model.PredictNeighbors([]float64{-10,1})
+
+	// always search with a ball tree
+	model.Index = BallTreeIndex
 */
 type KNN struct {
-	// Distance holds the distance
+	// distance holds the distance
 	// measure for the KNN algorithm,
 	// which is just a function that
 	// maps 2 float64 vectors to a
-	// float64
-	Distance base.DistanceMeasure
+	// float64. Large training sets are
+	// searched from more than one
+	// goroutine, so it has to be safe to
+	// call concurrently.
+	//
+	// It's only changed with SetDistance,
+	// which rebuilds the index: two closures
+	// from the same constructor (like
+	// base.Minkowski with another p) can't
+	// be told apart, so the model couldn't
+	// notice a new one being assigned.
+	distance base.DistanceMeasure
 
 	// K is the number of nearest
 	// neighbors to classify based
@@ -64,12 +132,54 @@ type KNN struct {
 	// algorithm
 	K int
 
+	// Mode is whether the model classifies
+	// (KNNClassification, the default) or
+	// regresses (KNNRegression)
+	Mode KNNMode
+
+	// Weighting is how much each of the K
+	// nearest neighbors counts when predicting
+	// (UniformWeights by default)
+	Weighting KNNWeighting
+
+	// Index is how the training set is searched
+	// for the nearest neighbors (AutoIndex by
+	// default.) The index is built when the
+	// training set is given, and rebuilt on the
+	// next prediction if Index, the distance (with
+	// SetDistance) or Metric are changed.
+	Index KNNIndex
+
+	// Metric tells the model that its distance is a
+	// true metric (it obeys the triangle
+	// inequality), so a ball tree can be used
+	// with it. The distances defined in base
+	// are recognized without it.
+	Metric bool
+
+	// Graph is the approximate index searched
+	// with HNSWIndex. If it's nil (or doesn't
+	// hold the training set) when the index is
+	// built, the training set is inserted into
+	// a new one with the same parameters (or
+	// NewHNSW's defaults.) Set it to a graph
+	// made with NewHNSW to choose them.
+	Graph *HNSW
+
 	// trainingSet holds all training
 	// examples, while expectedResults
 	// holds the associated class of the
 	// corresponding example.
 	trainingSet     [][]float64
 	expectedResults []float64
+
+	// classes holds the distinct values of
+	// expectedResults, in increasing order
+	classes []float64
+
+	// index is what the training set is
+	// searched with
+	index knnIndex
 }
 
 // nn represents an encapsulation
@@ -77,12 +187,26 @@ type KNN struct {
 // each datapoint to facilitate easy
 // sorting
 type nn struct {
+	Index int
+
 	X []float64
 	Y float64
 
 	Distance float64
 }
 
+// Neighbor is one of the K nearest neighbors of an
+// input. Index is its index in the training set, X
+// and Y its input and label, and Distance its
+// distance to the input.
+type Neighbor struct {
+	Index int       `json:"index"`
+	X     []float64 `json:"x"`
+	Y     float64   `json:"y"`
+
+	Distance float64 `json:"distance"`
+}
+
 // NewKNN returns a pointer to the k-means
 // model, which clusters given inputs in an
 // unsupervised manner. The algorithm only has
@@ -94,12 +218,35 @@ type nn struct {
 // n is an optional parameter which (if given) assigns
 // the length of the input vector.
 func NewKNN(k int, trainingSet [][]float64, expectedResults []float64, distanceMeasure base.DistanceMeasure) *KNN {
-	return &KNN{
-		Distance:        distanceMeasure,
+	model := &KNN{
+		distance:        distanceMeasure,
 		K:               k,
 		trainingSet:     trainingSet,
 		expectedResults: expectedResults,
+		classes:         distinct(expectedResults),
+	}
+
+	if len(trainingSet) != 0 {
+		model.buildIndex()
+	}
+
+	return model
+}
+
+// distinct returns the distinct values of y in
+// increasing order.
+func distinct(y []float64) []float64 {
+	seen := make(map[float64]bool, len(y))
+	classes := []float64{}
+	for _, v := range y {
+		if !seen[v] {
+			seen[v] = true
+			classes = append(classes, v)
+		}
 	}
+
+	sort.Float64s(classes)
+	return classes
 }
 
 // UpdateTrainingSet takes in a new training set (variable x.)
@@ -113,10 +260,114 @@ func (k *KNN) UpdateTrainingSet(trainingSet [][]float64, expectedResults []float
 
 	k.trainingSet = trainingSet
 	k.expectedResults = expectedResults
+	k.classes = distinct(expectedResults)
+
+	// the old graph holds the old training set
+	if k.Graph != nil && k.Graph.Len() != 0 {
+		k.Graph = k.Graph.empty()
+	}
+
+	return k.buildIndex()
+}
+
+// NewKNNFromHNSW returns a pointer to a KNN model
+// searching the given HNSW graph (with HNSWIndex),
+// using the points in it as its training set. This
+// is how to predict with a graph restored from a
+// file.
+func NewKNNFromHNSW(k int, graph *HNSW) *KNN {
+	graph.mu.RLock()
+	trainingSet := make([][]float64, len(graph.nodes))
+	expectedResults := make([]float64, len(graph.nodes))
+	for i := range graph.nodes {
+		trainingSet[i] = graph.nodes[i].X
+		expectedResults[i] = graph.nodes[i].Y
+	}
+	distance := graph.Distance
+	graph.mu.RUnlock()
+
+	model := &KNN{
+		distance:        base.EuclideanDistance,
+		K:               k,
+		Index:           HNSWIndex,
+		Graph:           graph,
+		trainingSet:     trainingSet,
+		expectedResults: expectedResults,
+		classes:         distinct(expectedResults),
+	}
+
+	if distance == HNSWCosine {
+		model.distance = base.CosineDistance
+	}
+
+	if len(trainingSet) != 0 {
+		model.buildIndex()
+	}
+
+	return model
+}
+
+// Insert adds a single example, x labeled y, to the
+// training set. With HNSWIndex it's inserted right
+// into the Graph; other indexes are rebuilt on the
+// next prediction, so insert in batches with
+// UpdateTrainingSet if you can.
+//
+// Insert isn't safe to call while predicting from
+// other goroutines. Insert into an HNSW graph
+// directly if you need that.
+func (k *KNN) Insert(x []float64, y float64) error {
+	if len(x) == 0 {
+		return fmt.Errorf("Error: can't insert an empty example")
+	}
+	if len(k.trainingSet) != 0 && len(x) != len(k.trainingSet[0]) {
+		return fmt.Errorf("Given x (len %v) does not match dimensions of training set", len(x))
+	}
+
+	k.trainingSet = append(k.trainingSet, x)
+	k.expectedResults = append(k.expectedResults, y)
+
+	c := sort.SearchFloat64s(k.classes, y)
+	if c == len(k.classes) || k.classes[c] != y {
+		k.classes = append(k.classes, 0)
+		copy(k.classes[c+1:], k.classes[c:])
+		k.classes[c] = y
+	}
+
+	k.index.Lock()
+	defer k.index.Unlock()
+
+	if k.index.kind == HNSWIndex && k.index.index != nil && k.index.key == k.indexKey() && k.Graph.Len() == len(k.trainingSet)-1 {
+		_, err := k.Graph.Insert(x, y)
+		return err
+	}
+
+	// rebuild on the next prediction
+	k.index.index = nil
 
 	return nil
 }
 
+// Distance returns the distance measure the model
+// searches for neighbors with.
+func (k *KNN) Distance() base.DistanceMeasure {
+	return k.distance
+}
+
+// SetDistance changes the distance measure the model
+// searches for neighbors with, rebuilding the index on
+// the next prediction (even if d is a closure made by
+// the same function as the old one, like
+// base.Minkowski with another p.) It has to be safe to
+// call concurrently.
+func (k *KNN) SetDistance(d base.DistanceMeasure) {
+	k.index.Lock()
+	defer k.index.Unlock()
+
+	k.distance = d
+	k.index.index = nil
+}
+
 // Examples returns the number of training examples (m)
 // that the model currently is holding
 func (k *KNN) Examples() int {
@@ -125,22 +376,26 @@ func (k *KNN) Examples() int {
 
 // insertSorted takes a array v, and inserts u into
 // the list in the position such that the list is
-// sorted inversely. The function will not change the length
-// of v, though, such that if u would appear last
-// in the combined sorted list it would just be omitted.
+// sorted by distance (and then by index, so ties
+// always go to the earlier training example.) The
+// function will not change the length of v, though,
+// such that if u would appear last in the combined
+// sorted list it would just be omitted.
 //
 // if the length of V is less than K, then u is inserted
 // without deleting the last element
 //
-// Assumes v has been sorted. Uses binary search.
+// Assumes v has been sorted. Uses binary search, and
+// shifts v in place, so it only allocates when v has
+// to grow past its capacity.
 func insertSorted(u nn, v []nn, K int) []nn {
 	low := 0
 	high := len(v) - 1
 	for low <= high {
 		mid := (low + high) / 2
-		if u.Distance < v[mid].Distance {
+		if u.Distance < v[mid].Distance || (u.Distance == v[mid].Distance && u.Index < v[mid].Index) {
 			high = mid - 1
-		} else if u.Distance >= v[mid].Distance {
+		} else {
 			low = mid + 1
 		}
 	}
@@ -149,31 +404,186 @@ func insertSorted(u nn, v []nn, K int) []nn {
 		return v
 	}
 
-	sorted := append(v[:low], append([]nn{u}, v[low:]...)...)
-
 	if len(v) < K {
-		return sorted
+		v = append(v, nn{})
 	}
-	return sorted[:len(v)]
+
+	copy(v[low+1:], v[low:len(v)-1])
+	v[low] = u
+
+	return v
 }
 
-// round rounds a float64
-func round(a float64) float64 {
-	if a < 0 {
-		return math.Ceil(a - 0.5)
+// weights returns how much each neighbor (closest
+// first) counts in a prediction.
+func (k *KNN) weights(neighbors []nn) []float64 {
+	w := make([]float64, len(neighbors))
+	if k.Weighting != DistanceWeights {
+		for i := range w {
+			w[i] = 1
+		}
+		return w
+	}
+
+	// exact matches outweigh everything else, and
+	// 1/0 can't be used as a weight
+	exact := false
+	for i := range neighbors {
+		if neighbors[i].Distance == 0 {
+			w[i] = 1
+			exact = true
+		}
+	}
+	if exact {
+		return w
+	}
+
+	for i := range neighbors {
+		w[i] = 1 / neighbors[i].Distance
 	}
-	return math.Floor(a + 0.5)
+
+	return w
+}
+
+// predict makes a prediction off of the K nearest
+// neighbors of an input (closest first) following
+// the model's Mode and Weighting.
+func (k *KNN) predict(neighbors []nn) float64 {
+	w := k.weights(neighbors)
+
+	if k.Mode == KNNRegression {
+		var sum, total float64
+		for i := range neighbors {
+			sum += w[i] * neighbors[i].Y
+			total += w[i]
+		}
+
+		return sum / total
+	}
+
+	// take the (weighted) vote, remembering the
+	// first (nearest) neighbor of each class to
+	// break ties with
+	votes := make(map[float64]float64, len(neighbors))
+	first := make(map[float64]int, len(neighbors))
+	for i := range neighbors {
+		if _, ok := first[neighbors[i].Y]; !ok {
+			first[neighbors[i].Y] = i
+		}
+		votes[neighbors[i].Y] += w[i]
+	}
+
+	best := neighbors[0].Y
+	for class, vote := range votes {
+		if vote > votes[best] || (vote == votes[best] && first[class] < first[best]) {
+			best = class
+		}
+	}
+
+	return best
 }
 
 // Predict takes in a variable x (an array of floats,) and
-// finds the value of the hypothesis function given the
-// current parameter vector θ
+// returns the class most of its K nearest neighbors are
+// in, or the mean of their labels if the model is in
+// regression mode (see Mode and Weighting.)
 //
 // if normalize is given as true, then the input will
 // first be normalized to unit length. Only use this if
 // you trained off of normalized inputs and are feeding
 // an un-normalized input
 func (k *KNN) Predict(x []float64, normalize ...bool) ([]float64, error) {
+	neighbors, err := k.nearest(x, normalize...)
+	if err != nil {
+		return nil, err
+	}
+
+	return []float64{k.predict(neighbors)}, nil
+}
+
+// PredictNeighbors is the same as Predict but also
+// returns the K nearest neighbors the prediction was
+// made from, closest first.
+func (k *KNN) PredictNeighbors(x []float64, normalize ...bool) ([]float64, []Neighbor, error) {
+	neighbors, err := k.nearest(x, normalize...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return []float64{k.predict(neighbors)}, exportNeighbors(neighbors), nil
+}
+
+// Neighbors returns the K nearest neighbors of x in the
+// training set, closest first, without predicting
+// anything.
+func (k *KNN) Neighbors(x []float64, normalize ...bool) ([]Neighbor, error) {
+	neighbors, err := k.nearest(x, normalize...)
+	if err != nil {
+		return nil, err
+	}
+
+	return exportNeighbors(neighbors), nil
+}
+
+// exportNeighbors converts neighbors to the exported
+// Neighbor type.
+func exportNeighbors(neighbors []nn) []Neighbor {
+	exported := make([]Neighbor, len(neighbors))
+	for i := range neighbors {
+		exported[i] = Neighbor{
+			Index:    neighbors[i].Index,
+			X:        neighbors[i].X,
+			Y:        neighbors[i].Y,
+			Distance: neighbors[i].Distance,
+		}
+	}
+
+	return exported
+}
+
+// Classes returns the distinct classes in the
+// training set, in increasing order. This is the
+// order PredictProba returns probabilities in.
+func (k *KNN) Classes() []float64 {
+	return append([]float64{}, k.classes...)
+}
+
+// PredictProba returns the (weighted, if Weighting is
+// DistanceWeights) fraction of the K nearest neighbors
+// of x in each class, in the order Classes returns the
+// classes in. It only makes sense for classification,
+// so it returns an error in regression mode.
+func (k *KNN) PredictProba(x []float64, normalize ...bool) ([]float64, error) {
+	if k.Mode == KNNRegression {
+		return nil, fmt.Errorf("ERROR: PredictProba is only available for classification, but the KNN model is in regression mode")
+	}
+
+	neighbors, err := k.nearest(x, normalize...)
+	if err != nil {
+		return nil, err
+	}
+
+	w := k.weights(neighbors)
+	var total float64
+	for i := range w {
+		total += w[i]
+	}
+
+	proba := make([]float64, len(k.classes))
+	for i := range neighbors {
+		c := sort.SearchFloat64s(k.classes, neighbors[i].Y)
+		proba[c] += w[i] / total
+	}
+
+	return proba, nil
+}
+
+// nearest returns the K nearest neighbors of x in
+// the training set, closest first.
+func (k *KNN) nearest(x []float64, normalize ...bool) ([]nn, error) {
+	if k.K < 1 {
+		return nil, fmt.Errorf("Given K (%v) needs to be at least 1", k.K)
+	}
 	if k.K > len(k.trainingSet) {
 		return nil, fmt.Errorf("Given K (%v) is greater than the length of the training set", k.K)
 	}
@@ -182,31 +592,16 @@ func (k *KNN) Predict(x []float64, normalize ...bool) ([]float64, error) {
 	}
 
 	if len(normalize) != 0 && normalize[0] {
-		base.NormalizePoint(x)
+		x = base.NormalizedPoint(x)
 	}
 
-	// initialize the neighbors as an empty
-	// slice of Neighbors. insertSorted will
-	// take care of capping the neighbors at
-	// K.
-	neighbors := []nn{}
-
-	// calculate nearest neighbors
-	for i := range k.trainingSet {
-		dist := k.Distance(x, k.trainingSet[i])
-		neighbors = insertSorted(nn{
-			X: k.trainingSet[i],
-			Y: k.expectedResults[i],
-
-			Distance: dist,
-		}, neighbors, k.K)
+	index, _, err := k.searcher()
+	if err != nil {
+		return nil, err
 	}
-
-	// take weighted vote
-	sum := 0.0
-	for i := range neighbors {
-		sum += neighbors[i].Y
+	if graph, ok := index.(*hnswIndex); ok {
+		return graph.searchGraph(x, k.K)
 	}
 
-	return []float64{round(sum / float64(k.K))}, nil
+	return index.search(x, k.K), nil
 }
@@ -0,0 +1,776 @@
+package cluster
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/bountylabs/goml/base"
+)
+
+// KNNIndex defines a type enum which (using the
+// constants declared below) lets a user choose how
+// a KNN model searches its training set for the
+// nearest neighbors of an input. Every index finds
+// exactly the same neighbors (ties go to the earlier
+// training example), they just take more or less
+// time doing it.
+type KNNIndex int
+
+// Constants declare the indexes a KNN model can
+// search with.
+const (
+	// AutoIndex picks an index for the model's
+	// Distance and training set: a KD-tree for low
+	// dimensional data with a Minkowski distance, a
+	// ball tree for other metrics, and a brute force
+	// scan otherwise. It's the default.
+	AutoIndex KNNIndex = iota
+
+	// BruteForceIndex compares the input to every
+	// training example, splitting large training
+	// sets between goroutines. It works with any
+	// DistanceMeasure.
+	BruteForceIndex
+
+	// KDTreeIndex splits the training set along one
+	// feature at a time. It can only skip parts of
+	// the tree with a Minkowski distance
+	// (base.EuclideanDistance or
+	// base.ManhattanDistance), and works best with
+	// few features (say, less than 20.)
+	KDTreeIndex
+
+	// BallTreeIndex nests the training set in balls
+	// around their centers. It can skip parts of the
+	// tree with any distance obeying the triangle
+	// inequality, so it needs either a Minkowski
+	// distance or the model's Metric set to true.
+	BallTreeIndex
+
+	// HNSWIndex searches the model's Graph, an
+	// approximate index for inputs with lots of
+	// features (see HNSW.) Unlike the others it can
+	// miss some of the true nearest neighbors, and
+	// it finds and measures them with the graph's
+	// own distance instead of the model's Distance.
+	// AutoIndex never picks it.
+	HNSWIndex
+)
+
+const (
+	// leafSize is the most training examples a leaf of
+	// a KD or ball tree holds. Past a handful, scanning
+	// them is cheaper than splitting further.
+	leafSize = 16
+
+	// autoKDTreeDimensions is the most features
+	// AutoIndex uses a KD-tree for. KD-trees stop
+	// skipping much of anything in high dimensions.
+	autoKDTreeDimensions = 16
+
+	// parallelBruteForceMin is the smallest training
+	// set a brute force search splits between
+	// goroutines.
+	parallelBruteForceMin = 4096
+
+	// boundSlack loosens the ball tree's lower bound on
+	// distances by a relative amount, since rounding can
+	// put it a hair past the distance of a point which
+	// ties with the worst neighbor.
+	boundSlack = 1e-9
+)
+
+// neighborIndex finds the k nearest neighbors of x,
+// closest first.
+type neighborIndex interface {
+	search(x []float64, k int) []nn
+}
+
+// radiusIndex is a neighborIndex which can also find
+// every training example within radius of x (in order
+// of their index.) Every exact index is one.
+type radiusIndex interface {
+	neighborIndex
+	within(x []float64, radius float64) []int
+}
+
+// indexKey is what an index was built for, so it's
+// rebuilt when any of it changes. SetDistance drops
+// the index itself, since closures can't be compared.
+type indexKey struct {
+	index  KNNIndex
+	metric bool
+	graph  *HNSW
+}
+
+// knnIndex holds the index a KNN model is searching
+// with.
+type knnIndex struct {
+	sync.Mutex
+
+	key   indexKey
+	kind  KNNIndex
+	index neighborIndex
+}
+
+// chooseIndex returns the index to use for the
+// requested one, given the distance and the shape
+// of the training set.
+func chooseIndex(requested KNNIndex, d base.DistanceMeasure, metric bool, examples, dimensions int) KNNIndex {
+	// any other function might not be a Minkowski
+	// distance (or a metric at all), so it has to be
+	// searched with a brute force scan or (if it's a
+	// metric) a ball tree
+	minkowski := base.IsMinkowski(d)
+	metric = metric || base.IsMetric(d)
+
+	switch requested {
+	case HNSWIndex:
+		return HNSWIndex
+	case BruteForceIndex:
+		return BruteForceIndex
+	case KDTreeIndex:
+		if minkowski {
+			return KDTreeIndex
+		}
+		if metric {
+			return BallTreeIndex
+		}
+	case BallTreeIndex:
+		if metric {
+			return BallTreeIndex
+		}
+	default:
+		// trees don't pay off for tiny sets
+		if examples <= 2*leafSize {
+			return BruteForceIndex
+		}
+		if minkowski && dimensions <= autoKDTreeDimensions {
+			return KDTreeIndex
+		}
+		if metric {
+			return BallTreeIndex
+		}
+	}
+
+	return BruteForceIndex
+}
+
+// buildIndex builds the index the model should be
+// searching with (following its Index, distance and
+// Metric) from the training set. If it fails (which
+// only inserting into an HNSW graph can), the model
+// is left without an index, and tries again on the
+// next prediction.
+func (k *KNN) buildIndex() error {
+	k.index.Lock()
+	defer k.index.Unlock()
+
+	return k.buildIndexLocked()
+}
+
+// buildIndexLocked is buildIndex for callers already
+// holding the index's lock.
+func (k *KNN) buildIndexLocked() error {
+	dimensions := 0
+	if len(k.trainingSet) != 0 {
+		dimensions = len(k.trainingSet[0])
+	}
+
+	kind := chooseIndex(k.Index, k.distance, k.Metric, len(k.trainingSet), dimensions)
+
+	var index neighborIndex
+	if kind == HNSWIndex {
+		graph, err := k.buildGraph()
+		if err != nil {
+			k.index.index = nil
+			return err
+		}
+		index = graph
+	} else {
+		index = newExactIndex(kind, k.trainingSet, k.expectedResults, k.distance)
+	}
+
+	k.index.key = k.indexKey()
+	k.index.kind = kind
+	k.index.index = index
+
+	return nil
+}
+
+// newExactIndex builds an index of the given kind
+// (anything but HNSWIndex) over x.
+func newExactIndex(kind KNNIndex, x [][]float64, y []float64, distance base.DistanceMeasure) radiusIndex {
+	switch kind {
+	case KDTreeIndex:
+		return newKDTree(x, y, distance)
+	case BallTreeIndex:
+		return newBallTree(x, y, distance)
+	}
+
+	return &bruteForce{
+		x:        x,
+		y:        y,
+		distance: distance,
+	}
+}
+
+// buildGraph returns the model's Graph, first
+// inserting the training set into it if it doesn't
+// hold it yet. A nil Graph is made with NewHNSW's
+// defaults and the Euclidean distance.
+func (k *KNN) buildGraph() (*hnswIndex, error) {
+	if k.Graph == nil {
+		k.Graph = NewHNSW(0, 0, HNSWEuclidean)
+	}
+
+	if k.Graph.Len() != len(k.trainingSet) {
+		if k.Graph.Len() != 0 {
+			k.Graph = k.Graph.empty()
+		}
+
+		for i := range k.trainingSet {
+			_, err := k.Graph.Insert(k.trainingSet[i], k.expectedResults[i])
+			if err != nil {
+				return nil, fmt.Errorf("ERROR: inserting training example %v into the HNSW graph: %v", i, err)
+			}
+		}
+	}
+
+	return &hnswIndex{graph: k.Graph}, nil
+}
+
+// indexKey returns what the model's index should be
+// built for right now.
+func (k *KNN) indexKey() indexKey {
+	return indexKey{
+		index:  k.Index,
+		metric: k.Metric,
+		graph:  k.Graph,
+	}
+}
+
+// searcher returns the model's index, rebuilding it
+// first if Index or Metric changed (or SetDistance
+// was called) since it was built.
+func (k *KNN) searcher() (neighborIndex, KNNIndex, error) {
+	k.index.Lock()
+	defer k.index.Unlock()
+
+	if k.index.index == nil || k.index.key != k.indexKey() {
+		err := k.buildIndexLocked()
+		if err != nil {
+			return nil, HNSWIndex, err
+		}
+	}
+
+	return k.index.index, k.index.kind, nil
+}
+
+// ActiveIndex returns the index the model is actually
+// searching with, which can differ from the Index
+// asked for when it doesn't work with the model's
+// distance (falling back to a ball tree or a brute
+// force scan.)
+func (k *KNN) ActiveIndex() KNNIndex {
+	_, kind, _ := k.searcher()
+	return kind
+}
+
+// hnswIndex searches an HNSW graph.
+type hnswIndex struct {
+	graph *HNSW
+}
+
+// search implements neighborIndex. Unlike the exact
+// indexes, searching a graph can fail (like when the
+// training set couldn't be inserted into it), so KNN
+// searches it with searchGraph instead to get the
+// error.
+func (h *hnswIndex) search(x []float64, k int) []nn {
+	neighbors, _ := h.searchGraph(x, k)
+	return neighbors
+}
+
+// searchGraph returns the (approximately) k nearest
+// neighbors of x in the graph, closest first.
+func (h *hnswIndex) searchGraph(x []float64, k int) ([]nn, error) {
+	h.graph.mu.RLock()
+	defer h.graph.mu.RUnlock()
+
+	found, err := h.graph.search(x, k)
+	if err != nil {
+		return nil, err
+	}
+
+	neighbors := make([]nn, len(found))
+	for i, c := range found {
+		neighbors[i] = nn{
+			Index: c.id,
+
+			X: h.graph.nodes[c.id].X,
+			Y: h.graph.nodes[c.id].Y,
+
+			Distance: c.distance,
+		}
+	}
+
+	return neighbors, nil
+}
+
+// bruteForce compares inputs to every training
+// example.
+type bruteForce struct {
+	x        [][]float64
+	y        []float64
+	distance base.DistanceMeasure
+}
+
+// scan finds the k nearest neighbors of x among the
+// training examples from start up to end.
+func (b *bruteForce) scan(x []float64, k, start, end int) []nn {
+	neighbors := make([]nn, 0, k)
+	for i := start; i < end; i++ {
+		dist := b.distance(x, b.x[i])
+
+		// skip the insert when it can't make the cut
+		if len(neighbors) == k && dist > neighbors[k-1].Distance {
+			continue
+		}
+
+		neighbors = insertSorted(nn{
+			Index: i,
+
+			X: b.x[i],
+			Y: b.y[i],
+
+			Distance: dist,
+		}, neighbors, k)
+	}
+
+	return neighbors
+}
+
+// search implements neighborIndex, scanning large
+// training sets with one goroutine per CPU and
+// merging their neighbors.
+func (b *bruteForce) search(x []float64, k int) []nn {
+	workers := runtime.GOMAXPROCS(0)
+	if len(b.x) < parallelBruteForceMin || workers < 2 {
+		return b.scan(x, k, 0, len(b.x))
+	}
+
+	chunk := (len(b.x) + workers - 1) / workers
+	results := make([][]nn, workers)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		start := w * chunk
+		end := start + chunk
+		if end > len(b.x) {
+			end = len(b.x)
+		}
+		if start >= end {
+			break
+		}
+
+		wg.Add(1)
+		go func(w, start, end int) {
+			defer wg.Done()
+			results[w] = b.scan(x, k, start, end)
+		}(w, start, end)
+	}
+	wg.Wait()
+
+	neighbors := make([]nn, 0, k)
+	for _, result := range results {
+		for _, neighbor := range result {
+			neighbors = insertSorted(neighbor, neighbors, k)
+		}
+	}
+
+	return neighbors
+}
+
+// within implements radiusIndex.
+func (b *bruteForce) within(x []float64, radius float64) []int {
+	found := []int{}
+	for i := range b.x {
+		if b.distance(x, b.x[i]) <= radius {
+			found = append(found, i)
+		}
+	}
+
+	return found
+}
+
+// treeSearch keeps the neighbors found so far while
+// searching a tree.
+type treeSearch struct {
+	x         []float64
+	k         int
+	neighbors []nn
+}
+
+// worse reports whether no point at a distance of at
+// least bound can be one of the k nearest neighbors.
+// Points at exactly the distance of the worst
+// neighbor might still win on index, so they aren't
+// skipped.
+func (s *treeSearch) worse(bound float64) bool {
+	return len(s.neighbors) == s.k && bound > s.neighbors[s.k-1].Distance
+}
+
+// add considers training example i as a neighbor.
+func (s *treeSearch) add(i int, x []float64, y float64, dist float64) {
+	if s.worse(dist) {
+		return
+	}
+
+	s.neighbors = insertSorted(nn{
+		Index: i,
+
+		X: x,
+		Y: y,
+
+		Distance: dist,
+	}, s.neighbors, s.k)
+}
+
+// kdNode is a node of a kdTree. Leaves hold the
+// training examples idx[start:end] of their tree,
+// and other nodes split theirs along feature dim
+// at split: those in left are at most split, and
+// those in right at least split.
+type kdNode struct {
+	start, end int
+
+	dim   int
+	split float64
+
+	left, right *kdNode
+}
+
+// kdTree is a KD-tree over a training set.
+//
+// https://en.wikipedia.org/wiki/K-d_tree
+type kdTree struct {
+	x        [][]float64
+	y        []float64
+	distance base.DistanceMeasure
+
+	idx  []int
+	root *kdNode
+}
+
+// newKDTree builds a kdTree over the training set.
+func newKDTree(x [][]float64, y []float64, distance base.DistanceMeasure) *kdTree {
+	t := &kdTree{
+		x:        x,
+		y:        y,
+		distance: distance,
+		idx:      make([]int, len(x)),
+	}
+	for i := range t.idx {
+		t.idx[i] = i
+	}
+
+	t.root = t.build(0, len(x))
+	return t
+}
+
+// build builds the node holding idx[start:end],
+// splitting along the feature with the widest
+// spread at its median.
+func (t *kdTree) build(start, end int) *kdNode {
+	node := &kdNode{start: start, end: end}
+	if end-start <= leafSize {
+		return node
+	}
+
+	dim, spread := 0, 0.0
+	for d := range t.x[t.idx[start]] {
+		min, max := math.Inf(1), math.Inf(-1)
+		for _, i := range t.idx[start:end] {
+			min = math.Min(min, t.x[i][d])
+			max = math.Max(max, t.x[i][d])
+		}
+
+		if max-min > spread {
+			dim, spread = d, max-min
+		}
+	}
+
+	// every point is the same
+	if spread == 0 {
+		return node
+	}
+
+	points := t.idx[start:end]
+	sort.Slice(points, func(i, j int) bool {
+		return t.x[points[i]][dim] < t.x[points[j]][dim]
+	})
+
+	mid := (start + end) / 2
+	node.dim = dim
+	node.split = t.x[t.idx[mid]][dim]
+	node.left = t.build(start, mid)
+	node.right = t.build(mid, end)
+
+	return node
+}
+
+// search implements neighborIndex.
+func (t *kdTree) search(x []float64, k int) []nn {
+	s := &treeSearch{
+		x:         x,
+		k:         k,
+		neighbors: make([]nn, 0, k),
+	}
+
+	t.searchNode(t.root, s)
+	return s.neighbors
+}
+
+// searchNode searches node, going down the side of
+// each split x is on first. The other side is only
+// searched if it's closer than the worst neighbor,
+// since with a Minkowski distance every point over
+// there is at least as far as the split.
+func (t *kdTree) searchNode(node *kdNode, s *treeSearch) {
+	if node.left == nil {
+		for _, i := range t.idx[node.start:node.end] {
+			s.add(i, t.x[i], t.y[i], t.distance(s.x, t.x[i]))
+		}
+		return
+	}
+
+	diff := s.x[node.dim] - node.split
+	near, far := node.left, node.right
+	if diff >= 0 {
+		near, far = node.right, node.left
+	}
+
+	t.searchNode(near, s)
+	if !s.worse(math.Abs(diff)) {
+		t.searchNode(far, s)
+	}
+}
+
+// within implements radiusIndex, skipping the far
+// side of each split when it's farther than radius.
+func (t *kdTree) within(x []float64, radius float64) []int {
+	found := []int{}
+	t.withinNode(t.root, x, radius, &found)
+
+	sort.Ints(found)
+	return found
+}
+
+// withinNode adds the points of node within radius
+// of x to found.
+func (t *kdTree) withinNode(node *kdNode, x []float64, radius float64, found *[]int) {
+	if node.left == nil {
+		for _, i := range t.idx[node.start:node.end] {
+			if t.distance(x, t.x[i]) <= radius {
+				*found = append(*found, i)
+			}
+		}
+		return
+	}
+
+	diff := x[node.dim] - node.split
+	near, far := node.left, node.right
+	if diff >= 0 {
+		near, far = node.right, node.left
+	}
+
+	t.withinNode(near, x, radius, found)
+	if math.Abs(diff) <= radius {
+		t.withinNode(far, x, radius, found)
+	}
+}
+
+// ballNode is a node of a ballTree. It holds the
+// training examples idx[start:end] of its tree,
+// which are all within radius of center.
+type ballNode struct {
+	start, end int
+
+	center []float64
+	radius float64
+
+	left, right *ballNode
+}
+
+// ballTree is a ball tree over a training set.
+//
+// https://en.wikipedia.org/wiki/Ball_tree
+type ballTree struct {
+	x        [][]float64
+	y        []float64
+	distance base.DistanceMeasure
+
+	idx  []int
+	root *ballNode
+}
+
+// newBallTree builds a ballTree over the training set.
+func newBallTree(x [][]float64, y []float64, distance base.DistanceMeasure) *ballTree {
+	t := &ballTree{
+		x:        x,
+		y:        y,
+		distance: distance,
+		idx:      make([]int, len(x)),
+	}
+	for i := range t.idx {
+		t.idx[i] = i
+	}
+
+	t.root = t.build(0, len(x))
+	return t
+}
+
+// build builds the node holding idx[start:end],
+// splitting its points between the two which are
+// (about) farthest apart.
+func (t *ballTree) build(start, end int) *ballNode {
+	points := t.idx[start:end]
+
+	center := make([]float64, len(t.x[points[0]]))
+	for _, i := range points {
+		for d := range center {
+			center[d] += t.x[i][d]
+		}
+	}
+	for d := range center {
+		center[d] /= float64(len(points))
+	}
+
+	node := &ballNode{
+		start:  start,
+		end:    end,
+		center: center,
+	}
+
+	far, farDistance := points[0], -1.0
+	for _, i := range points {
+		dist := t.distance(center, t.x[i])
+		if dist > farDistance {
+			far, farDistance = i, dist
+		}
+	}
+	node.radius = farDistance
+
+	if end-start <= leafSize || node.radius == 0 {
+		return node
+	}
+
+	// the point farthest from the point farthest from
+	// the center is (about) the farthest pair
+	other, otherDistance := far, -1.0
+	for _, i := range points {
+		dist := t.distance(t.x[far], t.x[i])
+		if dist > otherDistance {
+			other, otherDistance = i, dist
+		}
+	}
+
+	a, b := t.x[far], t.x[other]
+	mid := start
+	for j := start; j < end; j++ {
+		i := t.idx[j]
+		if t.distance(t.x[i], a) <= t.distance(t.x[i], b) {
+			t.idx[mid], t.idx[j] = t.idx[j], t.idx[mid]
+			mid++
+		}
+	}
+
+	// can't split points which are all the same
+	// distance from both sides
+	if mid == start || mid == end {
+		return node
+	}
+
+	node.left = t.build(start, mid)
+	node.right = t.build(mid, end)
+
+	return node
+}
+
+// search implements neighborIndex.
+func (t *ballTree) search(x []float64, k int) []nn {
+	s := &treeSearch{
+		x:         x,
+		k:         k,
+		neighbors: make([]nn, 0, k),
+	}
+
+	t.searchNode(t.root, t.distance(x, t.root.center), s)
+	return s.neighbors
+}
+
+// searchNode searches node, whose center is
+// centerDistance away from x. By the triangle
+// inequality no point in the ball is closer to x
+// than centerDistance - radius, so the whole ball
+// is skipped if that's farther than the worst
+// neighbor.
+func (t *ballTree) searchNode(node *ballNode, centerDistance float64, s *treeSearch) {
+	bound := centerDistance - node.radius - boundSlack*(centerDistance+node.radius)
+	if s.worse(bound) {
+		return
+	}
+
+	if node.left == nil {
+		for _, i := range t.idx[node.start:node.end] {
+			s.add(i, t.x[i], t.y[i], t.distance(s.x, t.x[i]))
+		}
+		return
+	}
+
+	left := t.distance(s.x, node.left.center)
+	right := t.distance(s.x, node.right.center)
+	if left <= right {
+		t.searchNode(node.left, left, s)
+		t.searchNode(node.right, right, s)
+	} else {
+		t.searchNode(node.right, right, s)
+		t.searchNode(node.left, left, s)
+	}
+}
+
+// within implements radiusIndex, skipping every ball
+// which can't hold a point within radius.
+func (t *ballTree) within(x []float64, radius float64) []int {
+	found := []int{}
+	t.withinNode(t.root, t.distance(x, t.root.center), x, radius, &found)
+
+	sort.Ints(found)
+	return found
+}
+
+// withinNode adds the points of node, whose center is
+// centerDistance away from x, within radius of x to
+// found.
+func (t *ballTree) withinNode(node *ballNode, centerDistance float64, x []float64, radius float64, found *[]int) {
+	bound := centerDistance - node.radius - boundSlack*(centerDistance+node.radius)
+	if bound > radius {
+		return
+	}
+
+	if node.left == nil {
+		for _, i := range t.idx[node.start:node.end] {
+			if t.distance(x, t.x[i]) <= radius {
+				*found = append(*found, i)
+			}
+		}
+		return
+	}
+
+	t.withinNode(node.left, t.distance(x, node.left.center), x, radius, found)
+	t.withinNode(node.right, t.distance(x, node.right.center), x, radius, found)
+}
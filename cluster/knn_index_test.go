@@ -0,0 +1,210 @@
+package cluster
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/bountylabs/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// randomSet returns n random points with the given
+// number of features, rounded so there are plenty
+// of ties
+func randomSet(random *rand.Rand, n, features int) ([][]float64, []float64) {
+	x := make([][]float64, n)
+	y := make([]float64, n)
+	for i := range x {
+		x[i] = make([]float64, features)
+		for j := range x[i] {
+			x[i][j] = math.Floor(random.NormFloat64() * 4)
+		}
+		y[i] = float64(random.Intn(3))
+	}
+
+	return x, y
+}
+
+// chebyshev is base.ChebyshevDistance in a function
+// base can't recognize, so it's an unknown metric
+func chebyshev(u, v []float64) float64 {
+	var max float64
+	for i := range u {
+		max = math.Max(max, math.Abs(u[i]-v[i]))
+	}
+	return max
+}
+
+// every index should find exactly the neighbors a
+// brute force scan does, ties included
+func TestKNNIndexShouldPass1(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+
+	minkowski, err := base.Minkowski(3)
+	assert.Nil(t, err, "Minkowski error should be nil")
+
+	for _, features := range []int{1, 3, 20} {
+		x, y := randomSet(random, 1000, features)
+
+		for _, distance := range []base.DistanceMeasure{base.EuclideanDistance, base.ManhattanDistance, minkowski, chebyshev} {
+			brute := NewKNN(7, x, y, distance)
+			brute.Index = BruteForceIndex
+
+			for _, index := range []KNNIndex{AutoIndex, KDTreeIndex, BallTreeIndex} {
+				model := NewKNN(7, x, y, distance)
+				model.Index = index
+				model.Metric = true
+
+				for q := 0; q < 50; q++ {
+					query := make([]float64, features)
+					for j := range query {
+						query[j] = math.Floor(random.NormFloat64() * 4)
+					}
+
+					expected, err := brute.Neighbors(query)
+					assert.Nil(t, err, "Neighbors error should be nil")
+					neighbors, err := model.Neighbors(query)
+					assert.Nil(t, err, "Neighbors error should be nil")
+
+					assert.Equal(t, expected, neighbors, "Index %v should find the same neighbors as brute force with %v features", model.ActiveIndex(), features)
+				}
+			}
+		}
+	}
+}
+
+func TestKNNIndexShouldPass2(t *testing.T) {
+	x, y := randomSet(rand.New(rand.NewSource(1)), 100, 2)
+
+	model := NewKNN(3, x, y, base.EuclideanDistance)
+	assert.Equal(t, KDTreeIndex, model.ActiveIndex(), "Low dimensional Euclidean data should use a KD-tree")
+
+	model.SetDistance(chebyshev)
+	assert.Equal(t, BruteForceIndex, model.ActiveIndex(), "Unknown distances should fall back to brute force")
+
+	model.Metric = true
+	assert.Equal(t, BallTreeIndex, model.ActiveIndex(), "Unknown metrics should use a ball tree")
+
+	model.Index = KDTreeIndex
+	assert.Equal(t, BallTreeIndex, model.ActiveIndex(), "KD-trees should fall back to a ball tree for non Minkowski metrics")
+
+	model.Metric = false
+	model.Index = BallTreeIndex
+	assert.Equal(t, BruteForceIndex, model.ActiveIndex(), "Ball trees should fall back to brute force for unknown distances")
+
+	model.Metric = false
+	model.Index = AutoIndex
+	model.SetDistance(base.ChebyshevDistance)
+	assert.Equal(t, KDTreeIndex, model.ActiveIndex(), "Minkowski distances from base should use a KD-tree")
+	model.SetDistance(base.CanberraDistance)
+	assert.Equal(t, BallTreeIndex, model.ActiveIndex(), "Metrics from base should use a ball tree")
+	model.SetDistance(base.CosineDistance)
+	assert.Equal(t, BruteForceIndex, model.ActiveIndex(), "Cosine distance isn't a metric, so it should be brute forced")
+
+	small := NewKNN(1, x[:10], y[:10], base.EuclideanDistance)
+	assert.Equal(t, BruteForceIndex, small.ActiveIndex(), "Tiny training sets should be brute forced")
+
+	wide, wideY := randomSet(rand.New(rand.NewSource(2)), 100, 50)
+	model = NewKNN(3, wide, wideY, base.EuclideanDistance)
+	assert.Equal(t, BallTreeIndex, model.ActiveIndex(), "High dimensional data should use a ball tree")
+
+	// the index should be rebuilt for a new training set
+	err := model.UpdateTrainingSet(x, y)
+	assert.Nil(t, err, "Updating the training set should not fail")
+	assert.Equal(t, KDTreeIndex, model.ActiveIndex(), "The index should be rebuilt for the new training set")
+	neighbors, err := model.Neighbors(x[5])
+	assert.Nil(t, err, "Neighbors error should be nil")
+	assert.Equal(t, 0.0, neighbors[0].Distance, "A training point should be its own nearest neighbor")
+}
+
+// large training sets are brute forced in parallel
+func TestKNNIndexShouldPass3(t *testing.T) {
+	random := rand.New(rand.NewSource(3))
+	x, y := randomSet(random, 2*parallelBruteForceMin+13, 4)
+
+	model := NewKNN(10, x, y, base.EuclideanDistance)
+	model.Index = BruteForceIndex
+
+	for q := 0; q < 20; q++ {
+		query := []float64{random.NormFloat64() * 4, random.NormFloat64() * 4, random.NormFloat64() * 4, random.NormFloat64() * 4}
+
+		neighbors, err := model.Neighbors(query)
+		assert.Nil(t, err, "Neighbors error should be nil")
+
+		expected := []nn{}
+		for i := range x {
+			expected = insertSorted(nn{Index: i, X: x[i], Y: y[i], Distance: base.EuclideanDistance(query, x[i])}, expected, 10)
+		}
+		assert.Equal(t, exportNeighbors(expected), neighbors, "Parallel brute force should find the same neighbors as a sequential scan")
+	}
+}
+
+// every index should find exactly the points within
+// a radius a brute force scan does, including those
+// right on it
+func TestKNNIndexShouldPass4(t *testing.T) {
+	random := rand.New(rand.NewSource(11))
+	x, y := randomSet(random, 1000, 3)
+
+	for _, distance := range []base.DistanceMeasure{base.EuclideanDistance, base.ManhattanDistance, chebyshev} {
+		brute := newExactIndex(BruteForceIndex, x, y, distance)
+		for _, kind := range []KNNIndex{KDTreeIndex, BallTreeIndex} {
+			index := newExactIndex(kind, x, y, distance)
+
+			for q := 0; q < 50; q++ {
+				query := x[random.Intn(len(x))]
+				radius := float64(random.Intn(5))
+
+				expected := brute.within(query, radius)
+				assert.NotEmpty(t, expected, "A point should be within any radius of itself")
+				assert.Equal(t, expected, index.within(query, radius), "Index %v should find the same points within %v", kind, radius)
+			}
+		}
+	}
+}
+
+// changing p of a Minkowski distance should rebuild
+// the index, even though every p makes a closure of
+// the same function
+func TestKNNIndexShouldPass5(t *testing.T) {
+	random := rand.New(rand.NewSource(5))
+	x, y := randomSet(random, 500, 3)
+
+	for _, index := range []KNNIndex{KDTreeIndex, BallTreeIndex} {
+		model := NewKNN(5, x, y, minkowskiDistance(t, 3))
+		model.Index = index
+
+		for _, p := range []float64{3, 1.5, 8, 1} {
+			distance := minkowskiDistance(t, p)
+			model.SetDistance(distance)
+			assert.Equal(t, base.FuncPointer(distance), base.FuncPointer(model.Distance()), "The distance should be set")
+
+			brute := NewKNN(5, x, y, distance)
+			brute.Index = BruteForceIndex
+
+			for q := 0; q < 20; q++ {
+				query := []float64{random.NormFloat64() * 4, random.NormFloat64() * 4, random.NormFloat64() * 4}
+
+				expected, err := brute.Neighbors(query)
+				assert.Nil(t, err, "Neighbors error should be nil")
+				neighbors, err := model.Neighbors(query)
+				assert.Nil(t, err, "Neighbors error should be nil")
+				assert.Equal(t, expected, neighbors, "Index %v should search with p = %v", index, p)
+			}
+		}
+	}
+}
+
+// minkowskiDistance returns base.Minkowski(p)
+func minkowskiDistance(t *testing.T, p float64) base.DistanceMeasure {
+	distance, err := base.Minkowski(p)
+	assert.Nil(t, err, "Minkowski error should be nil")
+	return distance
+}
+
+func TestInsertSortedShouldPass6(t *testing.T) {
+	sorted := insertSorted(nn{Index: 1, Distance: 2}, []nn{{Index: 0, Distance: 2}, {Index: 2, Distance: 2}}, 2)
+	assert.Equal(t, []nn{{Index: 0, Distance: 2}, {Index: 1, Distance: 2}}, sorted, "Ties should be broken by index")
+}
@@ -352,3 +352,128 @@ func TestKNNShouldPass3(t *testing.T) {
 	assert.True(t, accuracy > 95, "Accuracy (%v) should be greater than 95 percent", accuracy)
 	fmt.Printf("Accuracy: %v percent\n\tPoints Tested: %v\n\tMisclassifications: %v\n\tAverage Prediction Time: %v\n", accuracy, count, wrong, duration/time.Duration(count))
 }
+
+func TestKNNPredictDoesNotMutateShouldPass1(t *testing.T) {
+	model := NewKNN(3, fourClusters, fourClustersY, base.EuclideanDistance)
+
+	x := []float64{-10, -10}
+	_, err := model.Predict(x, true)
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, []float64{-10, -10}, x, "Input to Predict should not be modified when normalizing")
+}
+
+func TestKNNPredictProbaShouldPass1(t *testing.T) {
+	x := [][]float64{{0}, {1}, {2}, {10}, {11}}
+	y := []float64{2, 2, 0, 5, 5}
+
+	model := NewKNN(3, x, y, base.EuclideanDistance)
+	assert.Equal(t, []float64{0, 2, 5}, model.Classes(), "Classes should be the distinct labels in increasing order")
+
+	proba, err := model.PredictProba([]float64{1})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.InDeltaSlice(t, []float64{1.0 / 3, 2.0 / 3, 0}, proba, 1e-12, "Probabilities should be the fraction of neighbors in each class")
+
+	proba, err = model.PredictProba([]float64{12})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.InDeltaSlice(t, []float64{1.0 / 3, 0, 2.0 / 3}, proba, 1e-12, "Probabilities should be the fraction of neighbors in each class")
+
+	_, err = model.PredictProba([]float64{1, 2})
+	assert.NotNil(t, err, "Input of the wrong dimension should return an error")
+}
+
+// the mean of classes 0 and 4 is 2, which neither
+// neighbor is
+func TestKNNClassificationShouldPass1(t *testing.T) {
+	x := [][]float64{{0}, {1}, {2}, {10}}
+	y := []float64{0, 4, 4, 2}
+
+	model := NewKNN(3, x, y, base.EuclideanDistance)
+	guess, err := model.Predict([]float64{0.2})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, []float64{4}, guess, "Classification should be a majority vote")
+
+	// ties go to the class of the nearest neighbor
+	model.K = 2
+	guess, err = model.Predict([]float64{0.2})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, []float64{0}, guess, "Ties should go to the class with the nearest neighbor")
+
+	guess, err = model.Predict([]float64{0.9})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, []float64{4}, guess, "Ties should go to the class with the nearest neighbor")
+
+	// the single very close neighbor outweighs the
+	// two far ones
+	model.K = 3
+	model.Weighting = DistanceWeights
+	guess, err = model.Predict([]float64{0.05})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, []float64{0}, guess, "Distance weighted votes should favor close neighbors")
+
+	proba, err := model.PredictProba([]float64{0.05})
+	assert.Nil(t, err, "Prediction error should be nil")
+	w := []float64{1 / 0.05, 1 / 0.95, 1 / 1.95}
+	total := w[0] + w[1] + w[2]
+	assert.InDeltaSlice(t, []float64{w[0] / total, 0, (w[1] + w[2]) / total}, proba, 1e-12, "Probabilities should be the weighted fraction of neighbors in each class")
+
+	// exact matches outweigh everything else
+	guess, err = model.Predict([]float64{1})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, []float64{4}, guess, "Exact matches should decide the vote")
+}
+
+func TestKNNRegressionShouldPass1(t *testing.T) {
+	x := [][]float64{{0}, {1}, {3}, {10}}
+	y := []float64{1, 2, 6, 100}
+
+	model := NewKNN(3, x, y, base.EuclideanDistance)
+	model.Mode = KNNRegression
+
+	guess, err := model.Predict([]float64{1})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.InDeltaSlice(t, []float64{3}, guess, 1e-12, "Regression should average the neighbors' labels")
+
+	model.Weighting = DistanceWeights
+	guess, err = model.Predict([]float64{0.5})
+	assert.Nil(t, err, "Prediction error should be nil")
+	expected := (1/0.5*1 + 1/0.5*2 + 1/2.5*6) / (1/0.5 + 1/0.5 + 1/2.5)
+	assert.InDeltaSlice(t, []float64{expected}, guess, 1e-12, "Regression should weigh the neighbors' labels by inverse distance")
+
+	guess, err = model.Predict([]float64{3})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, []float64{6}, guess, "Exact matches should give their label")
+
+	_, err = model.PredictProba([]float64{3})
+	assert.NotNil(t, err, "PredictProba should return an error in regression mode")
+}
+
+func TestKNNNeighborsShouldPass1(t *testing.T) {
+	x := [][]float64{{10}, {0}, {3}, {1}}
+	y := []float64{1, 0, 1, 0}
+
+	model := NewKNN(2, x, y, base.EuclideanDistance)
+
+	guess, neighbors, err := model.PredictNeighbors([]float64{0.4})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, []float64{0}, guess, "Prediction should match Predict")
+	assert.Equal(t, []Neighbor{
+		{Index: 1, X: []float64{0}, Y: 0, Distance: 0.4},
+		{Index: 3, X: []float64{1}, Y: 0, Distance: 0.6},
+	}, neighbors, "Neighbors should be returned closest first with their index and distance")
+
+	neighbors, err = model.Neighbors([]float64{4})
+	assert.Nil(t, err, "Neighbors error should be nil")
+	assert.Len(t, neighbors, 2, "There should be K neighbors")
+	assert.Equal(t, 2, neighbors[0].Index, "The nearest neighbor should be first")
+	assert.Equal(t, 3, neighbors[1].Index, "The second nearest neighbor should be second")
+}
+
+func TestKNNShouldFail1(t *testing.T) {
+	model := NewKNN(0, [][]float64{{0}, {1}}, []float64{0, 1}, base.EuclideanDistance)
+	_, err := model.Predict([]float64{0})
+	assert.NotNil(t, err, "K less than 1 should return an error")
+
+	model.K = 3
+	_, _, err = model.PredictNeighbors([]float64{0})
+	assert.NotNil(t, err, "K greater than the training set should return an error")
+}
@@ -0,0 +1,785 @@
+package cluster
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+)
+
+// Clusterer is a clustering model which learns from
+// its training set by assigning each of its points to
+// a cluster. KMeans, TriangleKMeans, MiniBatchKMeans
+// and KMedoids are all Clusterers. DBSCAN and HDBSCAN
+// are too, and the points they label Noise are left
+// out of every score.
+type Clusterer interface {
+	Learn() error
+	Guesses() []int
+}
+
+// ClustererFunc returns a new Clusterer with k
+// clusters for the given training set. SweepK uses it
+// to cluster with each k it tries.
+type ClustererFunc func(k int, trainingSet [][]float64) Clusterer
+
+// KMeansClusterer returns a ClustererFunc making
+// KMeans models which don't log anything, seeded with
+// seed (see KMeans.Seed; 0 picks a random seed for
+// each model.)
+func KMeansClusterer(maxIterations int, seed int64) ClustererFunc {
+	return func(k int, trainingSet [][]float64) Clusterer {
+		model := NewKMeans(k, maxIterations, trainingSet)
+		model.Output = ioutil.Discard
+		model.Seed = seed
+		return model
+	}
+}
+
+// TriangleKMeansClusterer returns a ClustererFunc
+// making TriangleKMeans models which don't log
+// anything, seeded with seed (0 picks a random seed
+// for each model.)
+func TriangleKMeansClusterer(maxIterations int, seed int64) ClustererFunc {
+	return func(k int, trainingSet [][]float64) Clusterer {
+		model := NewTriangleKMeans(k, maxIterations, trainingSet)
+		model.Output = ioutil.Discard
+		model.Seed = seed
+		return model
+	}
+}
+
+// withoutNoise returns the points of x which are in
+// a cluster, and their guesses, leaving out those
+// labeled Noise (or anything else below 0.) x and
+// guesses are returned as is if there are none.
+func withoutNoise(x [][]float64, guesses []int) ([][]float64, []int) {
+	noise := 0
+	for _, guess := range guesses {
+		if guess < 0 {
+			noise++
+		}
+	}
+	if noise == 0 {
+		return x, guesses
+	}
+
+	clustered := make([][]float64, 0, len(x)-noise)
+	clusteredGuesses := make([]int, 0, len(x)-noise)
+	for i, guess := range guesses {
+		if guess >= 0 {
+			clustered = append(clustered, x[i])
+			clusteredGuesses = append(clusteredGuesses, guess)
+		}
+	}
+
+	return clustered, clusteredGuesses
+}
+
+// clusterMeans returns the mean of the points in each
+// cluster given by guesses, and the number of points
+// in each. Noise has to be left out first.
+func clusterMeans(x [][]float64, guesses []int) ([][]float64, []int) {
+	if len(x) == 0 {
+		return nil, nil
+	}
+
+	k := 0
+	for _, guess := range guesses {
+		if guess+1 > k {
+			k = guess + 1
+		}
+	}
+
+	means := make([][]float64, k)
+	counts := make([]int, k)
+	for j := range means {
+		means[j] = make([]float64, len(x[0]))
+	}
+
+	for i, point := range x {
+		counts[guesses[i]]++
+		for l := range point {
+			means[guesses[i]][l] += point[l]
+		}
+	}
+
+	for j := range means {
+		for l := range means[j] {
+			if counts[j] != 0 {
+				means[j][l] /= float64(counts[j])
+			}
+		}
+	}
+
+	return means, counts
+}
+
+// nonEmpty returns the number of clusters with at
+// least one point.
+func nonEmpty(counts []int) int {
+	k := 0
+	for _, count := range counts {
+		if count != 0 {
+			k++
+		}
+	}
+
+	return k
+}
+
+// Inertia returns the sum of the squared Euclidean
+// distances from each point of x to the mean of its
+// cluster (given by guesses.) It's the same as
+// KMeans' Distortion once KMeans has converged, but
+// works for the clusters of any model. Noise is left
+// out.
+func Inertia(x [][]float64, guesses []int) float64 {
+	x, guesses = withoutNoise(x, guesses)
+	means, _ := clusterMeans(x, guesses)
+
+	var sum float64
+	for i, point := range x {
+		sum += diff(point, means[guesses[i]])
+	}
+
+	return sum
+}
+
+// Silhouette returns the mean silhouette coefficient
+// of the clusters of x given by guesses. A point's
+// coefficient is
+//
+//	(b - a) / max(a, b)
+//
+// where a is its mean (Euclidean) distance to the
+// rest of its cluster, and b its mean distance to
+// the points of the closest other cluster. It goes
+// from -1 to 1, and higher is better. Points alone
+// in their cluster count as 0, and so does having
+// fewer than 2 clusters. Noise is left out.
+//
+// It works out the distance between every pair of
+// points, so it takes O(n²) time.
+//
+// https://en.wikipedia.org/wiki/Silhouette_(clustering)
+func Silhouette(x [][]float64, guesses []int) float64 {
+	x, guesses = withoutNoise(x, guesses)
+	_, counts := clusterMeans(x, guesses)
+	if nonEmpty(counts) < 2 {
+		return 0
+	}
+
+	var sum float64
+	sums := make([]float64, len(counts))
+	for i := range x {
+		for j := range sums {
+			sums[j] = 0
+		}
+		for j := range x {
+			if i != j {
+				sums[guesses[j]] += math.Sqrt(diff(x[i], x[j]))
+			}
+		}
+
+		own := guesses[i]
+		if counts[own] == 1 {
+			continue
+		}
+
+		a := sums[own] / float64(counts[own]-1)
+		b := math.Inf(1)
+		for j := range sums {
+			if j != own && counts[j] != 0 {
+				b = math.Min(b, sums[j]/float64(counts[j]))
+			}
+		}
+
+		if max := math.Max(a, b); max > 0 {
+			sum += (b - a) / max
+		}
+	}
+
+	return sum / float64(len(x))
+}
+
+// CalinskiHarabasz returns the Calinski-Harabasz index
+// (or variance ratio) of the clusters of x given by
+// guesses
+//
+//	(B / (k - 1)) / (W / (n - k))
+//
+// where B is the spread of the cluster means around the
+// mean of all points (weighed by the size of each
+// cluster) and W the spread of the points around their
+// cluster's mean. Higher is better. It's 0 for fewer
+// than 2 clusters. Noise is left out.
+//
+// https://en.wikipedia.org/wiki/Calinski%E2%80%93Harabasz_index
+func CalinskiHarabasz(x [][]float64, guesses []int) float64 {
+	x, guesses = withoutNoise(x, guesses)
+	means, counts := clusterMeans(x, guesses)
+	k := nonEmpty(counts)
+	if k < 2 || len(x) <= k {
+		return 0
+	}
+
+	mean := make([]float64, len(x[0]))
+	for _, point := range x {
+		for l := range point {
+			mean[l] += point[l] / float64(len(x))
+		}
+	}
+
+	var between float64
+	for j := range means {
+		if counts[j] != 0 {
+			between += float64(counts[j]) * diff(means[j], mean)
+		}
+	}
+
+	within := Inertia(x, guesses)
+	if within == 0 {
+		return math.Inf(1)
+	}
+
+	return (between / float64(k-1)) / (within / float64(len(x)-k))
+}
+
+// DaviesBouldin returns the Davies-Bouldin index of the
+// clusters of x given by guesses: the mean over each
+// cluster of
+//
+//	max over other clusters j of (s[i] + s[j]) / d(μ[i], μ[j])
+//
+// where s[i] is the mean (Euclidean) distance from the
+// points of cluster i to its mean μ[i]. Lower is better.
+// It's 0 for fewer than 2 clusters. Noise is left out.
+//
+// https://en.wikipedia.org/wiki/Davies%E2%80%93Bouldin_index
+func DaviesBouldin(x [][]float64, guesses []int) float64 {
+	x, guesses = withoutNoise(x, guesses)
+	means, counts := clusterMeans(x, guesses)
+	k := nonEmpty(counts)
+	if k < 2 {
+		return 0
+	}
+
+	scatter := make([]float64, len(means))
+	for i, point := range x {
+		scatter[guesses[i]] += math.Sqrt(diff(point, means[guesses[i]])) / float64(counts[guesses[i]])
+	}
+
+	var sum float64
+	for i := range means {
+		if counts[i] == 0 {
+			continue
+		}
+
+		var worst float64
+		for j := range means {
+			if i == j || counts[j] == 0 {
+				continue
+			}
+
+			distance := math.Sqrt(diff(means[i], means[j]))
+			if distance == 0 {
+				worst = math.Inf(1)
+				continue
+			}
+			worst = math.Max(worst, (scatter[i]+scatter[j])/distance)
+		}
+
+		sum += worst
+	}
+
+	return sum / float64(k)
+}
+
+// SweepOptions are the optional settings of SweepK.
+type SweepOptions struct {
+	// References is the number of uniformly random
+	// reference sets the gap statistic compares each
+	// clustering against. It's only worked out if
+	// References is above 0, since it clusters each
+	// reference set too.
+	References int
+
+	// Seed seeds the reference sets. If it's 0, a
+	// random seed is used.
+	Seed int64
+}
+
+// KScore holds how well the clusters found with k
+// clusters score under each criterion SweepK reports.
+type KScore struct {
+	K int `json:"k"`
+
+	Distortion       float64 `json:"distortion"`
+	Silhouette       float64 `json:"silhouette"`
+	CalinskiHarabasz float64 `json:"calinski_harabasz"`
+	DaviesBouldin    float64 `json:"davies_bouldin"`
+
+	// Gap is the gap statistic, and GapError its
+	// standard error, if they were worked out.
+	Gap      float64 `json:"gap"`
+	GapError float64 `json:"gap_error"`
+}
+
+// KSweep is the result of SweepK: the scores for each
+// k tried, and the k each criterion picks.
+type KSweep struct {
+	Scores []KScore `json:"scores"`
+
+	// ElbowK is the k at the elbow of the distortion
+	// curve: the point farthest from the line between
+	// its ends.
+	ElbowK int `json:"elbow_k"`
+
+	// SilhouetteK and CalinskiHarabaszK are the k with
+	// the highest score, and DaviesBouldinK the k with
+	// the lowest (all of which need at least 2
+	// clusters.)
+	SilhouetteK       int `json:"silhouette_k"`
+	CalinskiHarabaszK int `json:"calinski_harabasz_k"`
+	DaviesBouldinK    int `json:"davies_bouldin_k"`
+
+	// GapK is the smallest k whose gap is within
+	// one standard error of the next k's, or 0 if the
+	// gap statistic wasn't worked out.
+	GapK int `json:"gap_k"`
+}
+
+// SweepK clusters x with every k from minK to maxK
+// (using cluster to make each model), and scores each
+// clustering by its distortion (the elbow method), the
+// silhouette, the Calinski-Harabasz and Davies-Bouldin
+// indices and (if opts.References is above 0) the gap
+// statistic, returning the scores and the k each one
+// picks. Every criterion uses the Euclidean distance.
+//
+// https://en.wikipedia.org/wiki/Determining_the_number_of_clusters_in_a_data_set
+// https://statweb.stanford.edu/~gwalther/gap
+func SweepK(x [][]float64, minK, maxK int, cluster ClustererFunc, opts SweepOptions) (*KSweep, error) {
+	if len(x) == 0 || len(x[0]) == 0 {
+		return nil, fmt.Errorf("ERROR: Attempting to sweep k with no training examples!")
+	}
+	if minK < 1 || maxK < minK || maxK > len(x) {
+		return nil, fmt.Errorf("ERROR: need 1 <= minK (%v) <= maxK (%v) <= the number of training examples (%v)", minK, maxK, len(x))
+	}
+	if cluster == nil {
+		return nil, fmt.Errorf("ERROR: need a ClustererFunc to cluster with")
+	}
+
+	seed := opts.Seed
+	if seed == 0 {
+		seed = rand.Int63()
+	}
+	random := rand.New(rand.NewSource(seed))
+
+	// the reference sets are drawn uniformly from the
+	// bounding box of x, and shared by every k
+	references := make([][][]float64, opts.References)
+	if opts.References > 0 {
+		lower := append([]float64{}, x[0]...)
+		upper := append([]float64{}, x[0]...)
+		for _, point := range x {
+			for l := range point {
+				lower[l] = math.Min(lower[l], point[l])
+				upper[l] = math.Max(upper[l], point[l])
+			}
+		}
+
+		for b := range references {
+			references[b] = make([][]float64, len(x))
+			for i := range references[b] {
+				references[b][i] = make([]float64, len(lower))
+				for l := range lower {
+					references[b][i][l] = lower[l] + random.Float64()*(upper[l]-lower[l])
+				}
+			}
+		}
+	}
+
+	sweep := &KSweep{}
+	for k := minK; k <= maxK; k++ {
+		model := cluster(k, x)
+		err := model.Learn()
+		if err != nil {
+			return nil, err
+		}
+		guesses := model.Guesses()
+
+		score := KScore{
+			K:                k,
+			Distortion:       Inertia(x, guesses),
+			Silhouette:       Silhouette(x, guesses),
+			CalinskiHarabasz: CalinskiHarabasz(x, guesses),
+			DaviesBouldin:    DaviesBouldin(x, guesses),
+		}
+
+		if opts.References > 0 {
+			logs := make([]float64, len(references))
+			var mean float64
+			for b, reference := range references {
+				model := cluster(k, reference)
+				err := model.Learn()
+				if err != nil {
+					return nil, err
+				}
+
+				logs[b] = logInertia(reference, model.Guesses())
+				mean += logs[b] / float64(len(logs))
+			}
+
+			var variance float64
+			for _, l := range logs {
+				variance += (l - mean) * (l - mean) / float64(len(logs))
+			}
+
+			score.Gap = mean - logInertia(x, guesses)
+			score.GapError = math.Sqrt(variance) * math.Sqrt(1+1/float64(len(logs)))
+		}
+
+		sweep.Scores = append(sweep.Scores, score)
+	}
+
+	sweep.choose(opts.References > 0)
+
+	return sweep, nil
+}
+
+// logInertia returns the log of the Inertia of the
+// clusters, which is as low as a float64 goes (instead
+// of -Inf) when every point sits on its mean.
+func logInertia(x [][]float64, guesses []int) float64 {
+	return math.Log(math.Max(Inertia(x, guesses), math.SmallestNonzeroFloat64))
+}
+
+// choose picks the k for each criterion.
+func (s *KSweep) choose(gap bool) {
+	scores := s.Scores
+	s.ElbowK = elbow(scores)
+
+	for _, score := range scores {
+		if score.K < 2 {
+			continue
+		}
+
+		if s.SilhouetteK == 0 || score.Silhouette > scores[s.SilhouetteK-scores[0].K].Silhouette {
+			s.SilhouetteK = score.K
+		}
+		if s.CalinskiHarabaszK == 0 || score.CalinskiHarabasz > scores[s.CalinskiHarabaszK-scores[0].K].CalinskiHarabasz {
+			s.CalinskiHarabaszK = score.K
+		}
+		if s.DaviesBouldinK == 0 || score.DaviesBouldin < scores[s.DaviesBouldinK-scores[0].K].DaviesBouldin {
+			s.DaviesBouldinK = score.K
+		}
+	}
+
+	if !gap {
+		return
+	}
+
+	// the smallest k with Gap(k) >= Gap(k+1) - s(k+1),
+	// or the highest gap if there's none
+	best := 0
+	for i := range scores {
+		if i+1 < len(scores) && scores[i].Gap >= scores[i+1].Gap-scores[i+1].GapError {
+			s.GapK = scores[i].K
+			return
+		}
+		if scores[i].Gap > scores[best].Gap {
+			best = i
+		}
+	}
+	s.GapK = scores[best].K
+}
+
+// elbow returns the k of the point of the distortion
+// curve farthest below the line between its ends (with
+// both axes scaled to [0, 1].)
+func elbow(scores []KScore) int {
+	first, last := scores[0], scores[len(scores)-1]
+	if len(scores) < 3 || first.Distortion == last.Distortion {
+		return first.K
+	}
+
+	best, farthest := first.K, 0.0
+	for _, score := range scores {
+		along := float64(score.K-first.K) / float64(last.K-first.K)
+		height := (score.Distortion - last.Distortion) / (first.Distortion - last.Distortion)
+
+		// the line goes from (0, 1) to (1, 0)
+		if below := (1 - along) - height; below > farthest {
+			best, farthest = score.K, below
+		}
+	}
+
+	return best
+}
+
+// minSplitPoints is the fewest points a cluster needs
+// for XMeans or GMeans to try splitting it.
+const minSplitPoints = 8
+
+// andersonDarlingCritical is the critical value of the
+// (corrected) Anderson-Darling statistic GMeans splits
+// clusters above, for a significance of 0.0001 as in
+// the paper.
+const andersonDarlingCritical = 1.8692
+
+// splitFunc decides whether points, clustered around
+// the parent centroid, should be split into the two
+// child clusters (given by guesses.)
+type splitFunc func(points [][]float64, parent []float64, children [][]float64, guesses []int) bool
+
+// SplitOptions are the optional settings of XMeans
+// and GMeans.
+type SplitOptions struct {
+	// Seed seeds every KMeans model learned along
+	// the way, so the same seed always settles on
+	// the same clusters. If it's 0, a random seed
+	// is used.
+	Seed int64
+}
+
+/*
+XMeans clusters x with KMeans, starting with minK
+clusters and splitting clusters in two while that
+improves the Bayesian information criterion (BIC) of
+a spherical Gaussian model of the points (and there
+are fewer than maxK clusters.) It returns the KMeans
+model with the k it settles on, learned on x.
+
+Each split is judged on the parent's points alone, so
+when splitting a cluster in two still leaves each half
+a mix of clusters (like halving a square of four blobs)
+the spherical model won't take it. Starting from a
+larger minK (or using GMeans) gets around that.
+
+http://www.cs.cmu.edu/~dpelleg/download/xmeans.pdf
+
+Example X-Means Usage:
+
+	model, err := XMeans(data, 1, 20, 100, SplitOptions{})
+	if err != nil {
+		panic("Oh NO!!! There was an error learning!!")
+	}
+
+	fmt.Println(len(model.Centroids), "clusters")
+	guess, err := model.Predict([]float64{-3, 6})
+*/
+func XMeans(x [][]float64, minK, maxK, maxIterations int, opts SplitOptions) (*KMeans, error) {
+	return splitKMeans(x, minK, maxK, maxIterations, opts.Seed, func(points [][]float64, parent []float64, children [][]float64, guesses []int) bool {
+		return bic(points, children, guesses) > bic(points, [][]float64{parent}, make([]int, len(points)))
+	})
+}
+
+// bic returns the Bayesian information criterion of
+// points clustered around centroids by guesses under
+// the spherical Gaussian model of X-means (higher is
+// better.)
+func bic(points [][]float64, centroids [][]float64, guesses []int) float64 {
+	r := float64(len(points))
+	m := float64(len(points[0]))
+	k := float64(len(centroids))
+	if r <= k {
+		return math.Inf(-1)
+	}
+
+	counts := make([]float64, len(centroids))
+	var ss float64
+	for i, point := range points {
+		counts[guesses[i]]++
+		ss += diff(point, centroids[guesses[i]])
+	}
+
+	// the (per feature) variance, which is 0 if every
+	// point sits on its centroid
+	variance := ss / (m * (r - k))
+	if variance == 0 {
+		return math.Inf(1)
+	}
+
+	likelihood := -r*m/2*math.Log(2*math.Pi*variance) - m*(r-k)/2
+	for _, n := range counts {
+		if n != 0 {
+			likelihood += n * math.Log(n/r)
+		}
+	}
+
+	parameters := (k - 1) + m*k + 1
+	return likelihood - parameters/2*math.Log(r)
+}
+
+/*
+GMeans clusters x with KMeans, starting with minK
+clusters and splitting clusters in two while their
+points don't look normally distributed (by an
+Anderson-Darling test along the line between the two
+halves) and there are fewer than maxK clusters. It
+returns the KMeans model with the k it settles on,
+learned on x.
+
+http://papers.nips.cc/paper/2526-learning-the-k-in-k-means.pdf
+
+Example G-Means Usage:
+
+	model, err := GMeans(data, 1, 20, 100, SplitOptions{})
+	if err != nil {
+		panic("Oh NO!!! There was an error learning!!")
+	}
+
+	fmt.Println(len(model.Centroids), "clusters")
+*/
+func GMeans(x [][]float64, minK, maxK, maxIterations int, opts SplitOptions) (*KMeans, error) {
+	return splitKMeans(x, minK, maxK, maxIterations, opts.Seed, func(points [][]float64, parent []float64, children [][]float64, guesses []int) bool {
+		// project the points onto the line between
+		// the two children
+		v := make([]float64, len(parent))
+		var norm float64
+		for l := range v {
+			v[l] = children[0][l] - children[1][l]
+			norm += v[l] * v[l]
+		}
+		if norm == 0 {
+			return false
+		}
+
+		projected := make([]float64, len(points))
+		for i, point := range points {
+			for l := range point {
+				projected[i] += point[l] * v[l] / norm
+			}
+		}
+
+		return andersonDarling(projected) > andersonDarlingCritical
+	})
+}
+
+// andersonDarling returns the Anderson-Darling statistic
+// (corrected for estimating the mean and variance) of
+// the values being normally distributed, which is 0 if
+// they're all the same.
+//
+// https://en.wikipedia.org/wiki/Anderson%E2%80%93Darling_test
+func andersonDarling(values []float64) float64 {
+	n := float64(len(values))
+
+	var mean float64
+	for _, value := range values {
+		mean += value / n
+	}
+	var variance float64
+	for _, value := range values {
+		variance += (value - mean) * (value - mean) / (n - 1)
+	}
+	if variance == 0 {
+		return 0
+	}
+
+	z := make([]float64, len(values))
+	for i, value := range values {
+		z[i] = (value - mean) / math.Sqrt(variance)
+	}
+	sort.Float64s(z)
+
+	// the normal CDF, kept off of 0 and 1 so the logs
+	// are finite
+	cdf := func(x float64) float64 {
+		return math.Min(math.Max(0.5*(1+math.Erf(x/math.Sqrt2)), 1e-300), 1-1e-16)
+	}
+
+	var sum float64
+	for i := range z {
+		sum += float64(2*i+1) * (math.Log(cdf(z[i])) + math.Log(1-cdf(z[len(z)-1-i])))
+	}
+
+	a := -n - sum/n
+	return a * (1 + 4/n - 25/(n*n))
+}
+
+// splitKMeans runs the X-means/G-means loop: it learns
+// KMeans with minK clusters, then tries splitting each
+// cluster with 2-means, keeps the splits split says to,
+// and refines every centroid together, until no cluster
+// splits or there are maxK of them. Every model learned
+// along the way is seeded from seed (or a random seed
+// if it's 0.)
+func splitKMeans(x [][]float64, minK, maxK, maxIterations int, seed int64, split splitFunc) (*KMeans, error) {
+	if len(x) == 0 || len(x[0]) == 0 {
+		return nil, fmt.Errorf("ERROR: Attempting to learn with no training examples!")
+	}
+	if minK < 1 || maxK < minK || maxK > len(x) {
+		return nil, fmt.Errorf("ERROR: need 1 <= minK (%v) <= maxK (%v) <= the number of training examples (%v)", minK, maxK, len(x))
+	}
+
+	if seed == 0 {
+		seed = rand.Int63()
+	}
+	random := rand.New(rand.NewSource(seed))
+
+	model := NewKMeans(minK, maxIterations, x)
+	model.Output = ioutil.Discard
+	model.Seed = random.Int63()
+	err := model.Learn()
+	if err != nil {
+		return nil, err
+	}
+	centroids, guesses := model.Centroids, model.guesses
+
+	for len(centroids) < maxK {
+		groups := make([][][]float64, len(centroids))
+		for i, guess := range guesses {
+			groups[guess] = append(groups[guess], x[i])
+		}
+
+		next := [][]float64{}
+		splits := 0
+		for j, centroid := range centroids {
+			// splitting needs room for one more cluster
+			// on top of the ones left to look at
+			if len(groups[j]) < minSplitPoints || len(next)+len(centroids)-j+1 > maxK {
+				next = append(next, centroid)
+				continue
+			}
+
+			children := NewKMeans(2, maxIterations, groups[j])
+			children.Output = ioutil.Discard
+			children.Seed = random.Int63()
+			err := children.Learn()
+			if err != nil {
+				return nil, err
+			}
+
+			if split(groups[j], centroid, children.Centroids, children.guesses) {
+				next = append(next, children.Centroids...)
+				splits++
+			} else {
+				next = append(next, centroid)
+			}
+		}
+
+		if splits == 0 {
+			break
+		}
+
+		// refine every centroid together
+		refined := NewKMeans(len(next), maxIterations, x)
+		run := refined.iterate(next, random)
+		centroids, guesses = run.centroids, run.guesses
+	}
+
+	model = NewKMeans(len(centroids), maxIterations, x)
+	model.Centroids = centroids
+	model.guesses = guesses
+	model.Counts = clusterCounts(guesses, len(centroids))
+	model.distortion = model.Distortion()
+	model.Inertia = []float64{model.distortion}
+	model.Output = os.Stdout
+
+	return model, nil
+}
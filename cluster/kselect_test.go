@@ -0,0 +1,191 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClusterScoresShouldPass1(t *testing.T) {
+	x := [][]float64{{0}, {2}, {10}, {12}}
+	guesses := []int{0, 0, 1, 1}
+
+	assert.InDelta(t, 4, Inertia(x, guesses), 1e-12, "Inertia should be the squared distance to each mean")
+	assert.InDelta(t, 50, CalinskiHarabasz(x, guesses), 1e-12, "Calinski-Harabasz should match")
+	assert.InDelta(t, 0.2, DaviesBouldin(x, guesses), 1e-12, "Davies-Bouldin should match")
+	assert.InDelta(t, (9.0/11+7.0/9)/2, Silhouette(x, guesses), 1e-12, "Silhouette should match")
+
+	// a single cluster can't be scored
+	one := []int{0, 0, 0, 0}
+	assert.Equal(t, 0.0, Silhouette(x, one), "A single cluster should have a silhouette of 0")
+	assert.Equal(t, 0.0, CalinskiHarabasz(x, one), "A single cluster should have a Calinski-Harabasz index of 0")
+	assert.Equal(t, 0.0, DaviesBouldin(x, one), "A single cluster should have a Davies-Bouldin index of 0")
+
+	// worse clusters should score worse
+	bad := []int{0, 1, 0, 1}
+	assert.True(t, Silhouette(x, bad) < Silhouette(x, guesses), "Worse clusters should have a lower silhouette")
+	assert.True(t, CalinskiHarabasz(x, bad) < CalinskiHarabasz(x, guesses), "Worse clusters should have a lower Calinski-Harabasz index")
+	assert.True(t, DaviesBouldin(x, bad) > DaviesBouldin(x, guesses), "Worse clusters should have a higher Davies-Bouldin index")
+}
+
+// DBSCAN's noise should be left out of the scores
+func TestClusterScoresShouldPass2(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	x, _ := moons(random, 300)
+	x = append(x, outliers(random, 20)...)
+
+	dbscan := func(k int, x [][]float64) Clusterer {
+		model := NewDBSCAN(1.5, 5, x, nil)
+		model.Output = ioutil.Discard
+		return model
+	}
+
+	model := dbscan(2, x)
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+	guesses := model.Guesses()
+
+	clustered, clusteredGuesses := [][]float64{}, []int{}
+	for i, guess := range guesses {
+		if guess != Noise {
+			clustered = append(clustered, x[i])
+			clusteredGuesses = append(clusteredGuesses, guess)
+		}
+	}
+	assert.True(t, len(clustered) < len(x), "Some points should be noise")
+
+	assert.Equal(t, Inertia(clustered, clusteredGuesses), Inertia(x, guesses), "Noise should be left out of the inertia")
+	assert.Equal(t, Silhouette(clustered, clusteredGuesses), Silhouette(x, guesses), "Noise should be left out of the silhouette")
+	assert.Equal(t, CalinskiHarabasz(clustered, clusteredGuesses), CalinskiHarabasz(x, guesses), "Noise should be left out of the Calinski-Harabasz index")
+	assert.Equal(t, DaviesBouldin(clustered, clusteredGuesses), DaviesBouldin(x, guesses), "Noise should be left out of the Davies-Bouldin index")
+
+	sweep, err := SweepK(x, 2, 3, dbscan, SweepOptions{})
+	assert.Nil(t, err, "Sweep error should be nil")
+	assert.Equal(t, Silhouette(x, guesses), sweep.Scores[0].Silhouette, "DBSCAN should be swept like any Clusterer")
+
+	// nothing but noise scores 0
+	noise := []int{Noise, Noise, Noise}
+	assert.Equal(t, 0.0, Inertia(x[:3], noise), "Noise alone should have an inertia of 0")
+	assert.Equal(t, 0.0, Silhouette(x[:3], noise), "Noise alone should have a silhouette of 0")
+	assert.Equal(t, 0.0, CalinskiHarabasz(x[:3], noise), "Noise alone should have a Calinski-Harabasz index of 0")
+	assert.Equal(t, 0.0, DaviesBouldin(x[:3], noise), "Noise alone should have a Davies-Bouldin index of 0")
+}
+
+func TestSweepKShouldPass1(t *testing.T) {
+	x, _ := blobs(rand.New(rand.NewSource(42)), 400)
+
+	for _, cluster := range []ClustererFunc{KMeansClusterer(100, 1), TriangleKMeansClusterer(100, 1)} {
+		sweep, err := SweepK(x, 1, 8, func(k int, x [][]float64) Clusterer {
+			// a few restarts so each k finds its
+			// best clustering
+			model := cluster(k, x)
+			switch m := model.(type) {
+			case *KMeans:
+				assert.Equal(t, int64(1), m.Seed, "The clusterer should seed its models")
+				m.NInit = 5
+			case *TriangleKMeans:
+				assert.Equal(t, int64(1), m.Seed, "The clusterer should seed its models")
+				m.NInit = 5
+			}
+			return model
+		}, SweepOptions{References: 5, Seed: 7})
+		assert.Nil(t, err, "Sweep error should be nil")
+		assert.Len(t, sweep.Scores, 8, "Every k should be scored")
+
+		for i := 1; i < len(sweep.Scores); i++ {
+			assert.Equal(t, i+1, sweep.Scores[i].K, "Scores should be in order of k")
+		}
+
+		assert.Equal(t, 4, sweep.ElbowK, "The elbow should be at the number of blobs")
+		assert.Equal(t, 4, sweep.SilhouetteK, "The silhouette should pick the number of blobs")
+		assert.Equal(t, 4, sweep.CalinskiHarabaszK, "Calinski-Harabasz should pick the number of blobs")
+		assert.Equal(t, 4, sweep.DaviesBouldinK, "Davies-Bouldin should pick the number of blobs")
+		assert.Equal(t, 4, sweep.GapK, "The gap statistic should pick the number of blobs")
+	}
+
+	sweep, err := SweepK(x, 2, 5, KMeansClusterer(100, 0), SweepOptions{})
+	assert.Nil(t, err, "Sweep error should be nil")
+	assert.Equal(t, 0, sweep.GapK, "The gap statistic should be skipped without references")
+	assert.Equal(t, 0.0, sweep.Scores[0].Gap, "The gap statistic should be skipped without references")
+}
+
+func TestXMeansShouldPass1(t *testing.T) {
+	x, groups := blobs(rand.New(rand.NewSource(3)), 800)
+
+	// X-means' spherical model can't tell that half of
+	// the square of blobs is any better than all of it,
+	// so it starts from 2 clusters
+	for name, split := range map[string]func([][]float64, int, int, int) (*KMeans, error){
+		"X-means": func(x [][]float64, _, maxK, maxIterations int) (*KMeans, error) {
+			return XMeans(x, 2, maxK, maxIterations, SplitOptions{Seed: 1})
+		},
+		"G-means": func(x [][]float64, minK, maxK, maxIterations int) (*KMeans, error) {
+			return GMeans(x, minK, maxK, maxIterations, SplitOptions{Seed: 1})
+		},
+	} {
+		model, err := split(x, 1, 12, 100)
+		assert.Nil(t, err, "Learning error should be nil")
+		assert.Len(t, model.Centroids, 4, "%v should find the number of blobs", name)
+		assert.True(t, purity(model.Guesses(), groups) > 0.98, "%v's clusters should match the blobs", name)
+		assert.InDelta(t, Inertia(x, model.Guesses()), model.Distortion(), 1e-6, "%v should return a converged model", name)
+
+		for i := 0; i < 50; i++ {
+			guess, err := model.Predict(x[i])
+			assert.Nil(t, err, "Prediction error should be nil")
+			assert.Equal(t, float64(model.Guesses()[i]), guess[0], "Predictions should match the clustering of the training set")
+		}
+
+		// the same seed settles on the same clusters
+		again, err := split(x, 1, 12, 100)
+		assert.Nil(t, err, "Learning error should be nil")
+		assert.Equal(t, model.Centroids, again.Centroids, "%v should be reproducible with a seed", name)
+
+		// maxK caps the splitting
+		model, err = split(x, 1, 3, 100)
+		assert.Nil(t, err, "Learning error should be nil")
+		assert.Len(t, model.Centroids, 3, "%v shouldn't go past maxK", name)
+	}
+}
+
+func TestAndersonDarlingShouldPass1(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	normal := make([]float64, 500)
+	bimodal := make([]float64, 500)
+	for i := range normal {
+		normal[i] = random.NormFloat64()
+		bimodal[i] = random.NormFloat64() + 6*float64(i%2)
+	}
+
+	assert.True(t, andersonDarling(normal) < andersonDarlingCritical, "Normal data should pass the test")
+	assert.True(t, andersonDarling(bimodal) > andersonDarlingCritical, "Two clusters should fail the test")
+	assert.Equal(t, 0.0, andersonDarling([]float64{1, 1, 1}), "Constant data should have a statistic of 0")
+	assert.False(t, math.IsNaN(andersonDarling([]float64{1, 2, 100})), "The statistic should be a number")
+}
+
+func TestSweepKShouldFail1(t *testing.T) {
+	x := [][]float64{{1}, {2}, {3}}
+
+	_, err := SweepK(nil, 1, 2, KMeansClusterer(10, 0), SweepOptions{})
+	assert.NotNil(t, err, "Sweeping with no data should return an error")
+
+	_, err = SweepK(x, 0, 2, KMeansClusterer(10, 0), SweepOptions{})
+	assert.NotNil(t, err, "A minK below 1 should return an error")
+
+	_, err = SweepK(x, 2, 1, KMeansClusterer(10, 0), SweepOptions{})
+	assert.NotNil(t, err, "A maxK below minK should return an error")
+
+	_, err = SweepK(x, 1, 4, KMeansClusterer(10, 0), SweepOptions{})
+	assert.NotNil(t, err, "A maxK above the number of points should return an error")
+
+	_, err = SweepK(x, 1, 2, nil, SweepOptions{})
+	assert.NotNil(t, err, "A nil ClustererFunc should return an error")
+
+	_, err = XMeans(x, 2, 1, 10, SplitOptions{})
+	assert.NotNil(t, err, "A maxK below minK should return an error")
+
+	_, err = GMeans(nil, 1, 1, 10, SplitOptions{})
+	assert.NotNil(t, err, "Learning with no data should return an error")
+}
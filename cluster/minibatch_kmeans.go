@@ -0,0 +1,541 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+
+	"github.com/bountylabs/goml/base"
+)
+
+// DefaultBatchSize is the number of points in each
+// mini-batch if none is given.
+const DefaultBatchSize = 1024
+
+/*
+MiniBatchKMeans implements the mini-batch k-means
+unsupervised clustering algorithm from Sculley's
+"Web-Scale K-Means Clustering". Instead of going over
+the whole training set every iteration, each one
+takes a small random batch of points and moves each
+point's closest centroid towards it, with a learning
+rate of 1/(the number of points the centroid has
+seen.) The learning rate decays for each centroid as
+it settles down, so unlike KMeans' online learning
+the centroids converge instead of jumping around.
+
+It's orders of magnitude faster than KMeans on large
+training sets, for a slightly worse clustering, and
+can learn from a stream of points (OnlineLearnContext)
+while only holding one batch of them in memory, so
+the data never has to fit in memory at all.
+
+https://www.eecs.tufts.edu/~dsculley/papers/fastkmeans.pdf
+
+Example MiniBatchKMeans Model Usage:
+
+	// 4 clusters, 100 batches of 256 points
+	model := NewMiniBatchKMeans(4, 100, 256, data)
+
+	if model.Learn() != nil {
+		panic("Oh NO!!! There was an error learning!!")
+	}
+
+	// now you can predict like normal!
+	guess, err := model.Predict([]float64{-3, 6})
+	if err != nil {
+		panic("prediction error")
+	}
+
+	// or learn from a stream (of any length) one
+	// batch at a time
+	stream := make(chan base.Datapoint, 100)
+	go func() {
+		for point := range readPoints() {
+			stream <- base.Datapoint{X: point}
+		}
+		close(stream)
+	}()
+
+	model = NewMiniBatchKMeans(4, 0, 256, nil)
+	err = model.OnlineLearnContext(context.Background(), stream, base.OnlineOptions{})
+	if err != nil {
+		panic("learning error")
+	}
+*/
+type MiniBatchKMeans struct {
+	// maxIterations is the number of batches Learn
+	// learns from.
+	maxIterations int
+
+	// trainingSet and guesses are the 'x', and
+	// 'y' of the data, just like KMeans'
+	trainingSet [][]float64
+	guesses     []int
+
+	// BatchSize is the number of points in each
+	// mini-batch.
+	BatchSize int `json:"batch_size"`
+
+	// Centroids are the centers of each cluster,
+	// and Counts the number of points each one has
+	// learned from (so its learning rate is
+	// 1/Counts[j].) They're persisted together, so
+	// a restored model carries on learning exactly
+	// where it left off.
+	Centroids [][]float64 `json:"centroids"`
+	Counts    []int64     `json:"counts"`
+
+	// Distance is what points are assigned to
+	// their nearest centroid by. It defaults (when
+	// nil) to the squared Euclidean distance, just
+	// like KMeans'.
+	Distance base.DistanceMeasure `json:"-"`
+
+	// Seed seeds the instantiation and the batches
+	// drawn by Learn. If it's 0, a random seed is
+	// used.
+	Seed int64 `json:"-"`
+
+	// Output is the io.Writer to write
+	// logging to. Defaults to os.Stdout
+	// but can be changed to any io.Writer
+	Output io.Writer `json:"-"`
+
+	// batch holds the points streamed in since
+	// the last update
+	batch [][]float64
+
+	// online counts the points seen while
+	// learning online, and holds the centroids while
+	// learning with copy on write, so Predict
+	// can be called from other goroutines
+	online base.OnlineState
+}
+
+// NewMiniBatchKMeans returns a pointer to a mini-batch
+// k-means model with k clusters, which learns from
+// maxIterations batches of batchSize points (or
+// DefaultBatchSize if it's 0) of the training set.
+// The training set can be nil when learning from a
+// stream.
+func NewMiniBatchKMeans(k, maxIterations, batchSize int, trainingSet [][]float64) *MiniBatchKMeans {
+	if batchSize < 1 {
+		batchSize = DefaultBatchSize
+	}
+
+	return &MiniBatchKMeans{
+		maxIterations: maxIterations,
+
+		trainingSet: trainingSet,
+		guesses:     make([]int, len(trainingSet)),
+
+		BatchSize: batchSize,
+		Centroids: make([][]float64, k),
+		Counts:    make([]int64, k),
+
+		Output: os.Stdout,
+	}
+}
+
+// UpdateTrainingSet takes in a new training set (variable x.)
+//
+// Will reset the hidden 'guesses' param of the model.
+func (k *MiniBatchKMeans) UpdateTrainingSet(trainingSet [][]float64) error {
+	if len(trainingSet) == 0 {
+		return fmt.Errorf("ERROR: length of given training set is 0! Need data!")
+	}
+
+	k.trainingSet = trainingSet
+	k.guesses = make([]int, len(trainingSet))
+
+	return nil
+}
+
+// Examples returns the number of training examples (m)
+// that the model currently is training from.
+func (k *MiniBatchKMeans) Examples() int {
+	return len(k.trainingSet)
+}
+
+// MaxIterations returns the number of batches Learn
+// learns from.
+func (k *MiniBatchKMeans) MaxIterations() int {
+	return k.maxIterations
+}
+
+// distance returns the distance between u and v
+// under the model's Distance.
+func (k *MiniBatchKMeans) distance(u, v []float64) float64 {
+	if k.Distance == nil {
+		return diff(u, v)
+	}
+
+	return k.Distance(u, v)
+}
+
+// nearest returns the index of the centroid closest
+// to x.
+func (k *MiniBatchKMeans) nearest(centroids [][]float64, x []float64) int {
+	guess := 0
+	minDiff := k.distance(x, centroids[0])
+	for j := 1; j < len(centroids); j++ {
+		if difference := k.distance(x, centroids[j]); difference < minDiff {
+			minDiff = difference
+			guess = j
+		}
+	}
+
+	return guess
+}
+
+// centroids returns the centroids Predict should use:
+// the latest snapshot while learning online with copy
+// on write, and Centroids otherwise.
+func (k *MiniBatchKMeans) centroids() [][]float64 {
+	if centroids := k.online.Load(); centroids != nil {
+		return centroids
+	}
+
+	return k.Centroids
+}
+
+// seeded reports whether the centroids have been
+// instantiated (or restored.)
+func (k *MiniBatchKMeans) seeded() bool {
+	for _, count := range k.Counts {
+		if count > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Predict takes in a variable x (an array of floats,) and
+// returns the cluster of the centroid closest to it.
+//
+// if normalize is given as true, then the input will
+// first be normalized to unit length. Only use this if
+// you trained off of normalized inputs and are feeding
+// an un-normalized input
+func (k *MiniBatchKMeans) Predict(x []float64, normalize ...bool) ([]float64, error) {
+	centroids := k.centroids()
+	if len(centroids) == 0 || len(centroids[0]) == 0 {
+		return nil, fmt.Errorf("ERROR: the model has no centroids! Learn (or restore) the model first")
+	}
+	if len(x) != len(centroids[0]) {
+		return nil, fmt.Errorf("ERROR: Centroid vector should be the same length as input vector!\n\tLength of x given: %v\n\tLength of centroid: %v\n", len(x), len(centroids[0]))
+	}
+
+	if len(normalize) != 0 && normalize[0] {
+		x = base.NormalizedPoint(x)
+	}
+
+	return []float64{float64(k.nearest(centroids, x))}, nil
+}
+
+// seed returns centroids instantiated from points
+// with k-means++, counting each one as a single point.
+func (k *MiniBatchKMeans) seed(points [][]float64, random *rand.Rand) [][]float64 {
+	k.Counts = make([]int64, len(k.Centroids))
+	for j := range k.Counts {
+		k.Counts[j] = 1
+	}
+
+	return kmeansPlusPlus(points, len(k.Centroids), k.distance, random)
+}
+
+// update moves the closest centroid of each point in
+// batch towards it, returning the updated centroids.
+// With copyOnWrite the centroids are copied and stored
+// as a snapshot instead of updated in place.
+func (k *MiniBatchKMeans) update(batch [][]float64, copyOnWrite bool) [][]float64 {
+	centroids := k.centroids()
+	if copyOnWrite {
+		copied := make([][]float64, len(centroids))
+		for j := range centroids {
+			copied[j] = append([]float64{}, centroids[j]...)
+		}
+		centroids = copied
+	}
+
+	// assign the whole batch before moving any
+	// centroid, as in the paper
+	closest := make([]int, len(batch))
+	for i, x := range batch {
+		closest[i] = k.nearest(centroids, x)
+	}
+
+	for i, x := range batch {
+		c := closest[i]
+		k.Counts[c]++
+
+		eta := 1 / float64(k.Counts[c])
+		for l := range centroids[c] {
+			centroids[c][l] = (1-eta)*centroids[c][l] + eta*x[l]
+		}
+	}
+
+	if copyOnWrite {
+		k.online.Store(centroids)
+	} else {
+		k.Centroids = centroids
+	}
+
+	return centroids
+}
+
+// Learn instantiates the centroids with k-means++ on a
+// sample of 3 batches of the training set, then learns
+// from maxIterations random batches of it. Each point
+// is then assigned to its closest centroid.
+func (k *MiniBatchKMeans) Learn() error {
+	examples := len(k.trainingSet)
+	if examples == 0 || len(k.trainingSet[0]) == 0 {
+		err := fmt.Errorf("ERROR: Attempting to learn with no training examples!\n")
+		fmt.Fprintf(k.Output, err.Error())
+		return err
+	}
+
+	if len(k.Centroids) < 1 || len(k.Centroids) > examples {
+		err := fmt.Errorf("ERROR: need between 1 and %v clusters (the number of training examples), given %v\n", examples, len(k.Centroids))
+		fmt.Fprintf(k.Output, err.Error())
+		return err
+	}
+
+	fmt.Fprintf(k.Output, "Training:\n\tModel: Mini-Batch K-Means++ Classification\n\tTraining Examples: %v\n\tFeatures: %v\n\tClasses: %v\n\tBatch Size: %v\n...\n\n", examples, len(k.trainingSet[0]), len(k.Centroids), k.BatchSize)
+
+	seed := k.Seed
+	if seed == 0 {
+		seed = rand.Int63()
+	}
+	random := rand.New(rand.NewSource(seed))
+
+	sample := k.trainingSet
+	if size := 3 * k.BatchSize; size < examples {
+		sample = make([][]float64, size)
+		for i, j := range random.Perm(examples)[:size] {
+			sample[i] = k.trainingSet[j]
+		}
+	}
+	k.Centroids = k.seed(sample, random)
+
+	batch := make([][]float64, k.BatchSize)
+	for iter := 0; iter < k.maxIterations; iter++ {
+		for i := range batch {
+			batch[i] = k.trainingSet[random.Intn(examples)]
+		}
+		k.update(batch, false)
+	}
+
+	for i, x := range k.trainingSet {
+		k.guesses[i] = k.nearest(k.Centroids, x)
+	}
+
+	fmt.Fprintf(k.Output, "Training Completed in %v iterations.\n%v\n", k.maxIterations, k)
+
+	return nil
+}
+
+// OnlineLearn learns from a stream of points one batch
+// at a time, just like OnlineLearnContext, but with
+// channels like KMeans' OnlineLearn. The onUpdate
+// callback is passed every centroid after each batch.
+func (k *MiniBatchKMeans) OnlineLearn(errors chan error, dataset chan base.Datapoint, onUpdate func([][]float64), normalize ...bool) {
+	if errors == nil {
+		errors = make(chan error)
+	}
+	defer close(errors)
+
+	err := k.OnlineLearnContext(context.Background(), dataset, base.OnlineOptions{
+		OnUpdate:       onUpdate,
+		CallbackBuffer: base.DefaultCallbackBuffer,
+		Normalize:      len(normalize) != 0 && normalize[0],
+		OnError: func(err error) {
+			errors <- err
+		},
+	})
+	if err != nil {
+		errors <- err
+	}
+}
+
+// OnlineLearnContext learns from dataset until it's
+// closed (returning nil) or ctx is done (returning
+// ctx.Err()), holding only BatchSize points in memory
+// at a time. The first batch instantiates the centroids
+// with k-means++ (unless the model was learned or
+// restored already), and every batch after that updates
+// them. A partial batch left when dataset is closed is
+// learned from too. See base.OnlineOptions for how
+// OnUpdate is called; it's passed every centroid after
+// each batch.
+func (k *MiniBatchKMeans) OnlineLearnContext(ctx context.Context, dataset <-chan base.Datapoint, opts base.OnlineOptions) error {
+	if dataset == nil {
+		return fmt.Errorf("ERROR: Attempting to learn with a nil data stream!\n")
+	}
+
+	fmt.Fprintf(k.Output, "Training:\n\tModel: Online Mini-Batch K-Means Classification\n\tClasses: %v\n\tBatch Size: %v\n...\n\n", len(k.Centroids), k.BatchSize)
+
+	seed := k.Seed
+	if seed == 0 {
+		seed = rand.Int63()
+	}
+	random := rand.New(rand.NewSource(seed))
+
+	err := k.online.CopyOnWrite(opts.CopyOnWrite, k.Centroids[:len(k.Centroids):len(k.Centroids)], func(latest interface{}) {
+		if centroids, _ := latest.([][]float64); centroids != nil {
+			k.Centroids = centroids
+		}
+	}, func() error {
+		k.batch = make([][]float64, 0, k.BatchSize)
+		defer func() { k.batch = nil }()
+
+		err := base.LearnOnline(ctx, dataset, opts, &k.online.OnlineCounters, func(point base.Datapoint) ([][]float64, error) {
+			if len(k.batch) != 0 && len(point.X) != len(k.batch[0]) {
+				return nil, fmt.Errorf("ERROR: point.X must have the same dimensions as the rest of the batch Point: %v", point)
+			}
+			// with copy on write, the centroids seeded
+			// from the first batch are only in the snapshot
+			if k.seeded() && len(point.X) != len(k.centroids()[0]) {
+				return nil, fmt.Errorf("ERROR: point.X must have the same dimensions as clusters Point: %v", point)
+			}
+
+			k.batch = append(k.batch, append([]float64{}, point.X...))
+			if len(k.batch) < k.BatchSize {
+				return nil, nil
+			}
+
+			return k.learnBatch(random, opts.CopyOnWrite)
+		})
+
+		// learn from whatever's left of the last batch
+		if err == nil && len(k.batch) != 0 {
+			_, err = k.learnBatch(random, opts.CopyOnWrite)
+		}
+
+		return err
+	})
+
+	if err != nil {
+		fmt.Fprintf(k.Output, "\nERROR: Error while learning –\n\t%v\n\n", err)
+		return err
+	}
+
+	fmt.Fprintf(k.Output, "Training Completed.\n%v\n\n", k)
+	return nil
+}
+
+// learnBatch learns from the streamed batch, first
+// instantiating the centroids from it if they haven't
+// been, and empties it.
+func (k *MiniBatchKMeans) learnBatch(random *rand.Rand, copyOnWrite bool) ([][]float64, error) {
+	batch := k.batch
+	k.batch = k.batch[:0]
+
+	if !k.seeded() {
+		if len(batch) < len(k.Centroids) {
+			return nil, fmt.Errorf("ERROR: need at least %v points to instantiate the centroids, only got %v", len(k.Centroids), len(batch))
+		}
+
+		centroids := k.seed(batch, random)
+		if copyOnWrite {
+			k.online.Store(centroids)
+		} else {
+			k.Centroids = centroids
+		}
+	}
+
+	return k.update(batch, copyOnWrite), nil
+}
+
+// Stats returns how many points the model has seen
+// while learning online, how many batches it learned
+// from, and how many points caused an error.
+func (k *MiniBatchKMeans) Stats() base.OnlineStats {
+	return k.online.Stats()
+}
+
+// String implements the fmt interface for clean printing. Here
+// we're using it to print the model as the equation h(θ)=...
+// where h is the k-means hypothesis model
+func (k *MiniBatchKMeans) String() string {
+	return fmt.Sprintf("h(θ,x) = argmin_j | x[i] - μ[j] |^2\n\tμ = %v", k.Centroids)
+}
+
+// Guesses returns the hidden parameter for the
+// unsupervised classification assigned during
+// learning.
+//
+//	model.Guesses[i] = E[k.trainingSet[i]]
+func (k *MiniBatchKMeans) Guesses() []int {
+	return k.guesses
+}
+
+// Distortion returns the sum of the distances from
+// each point in the training set to its centroid,
+// just like KMeans'.
+func (k *MiniBatchKMeans) Distortion() float64 {
+	var sum float64
+	for i := range k.trainingSet {
+		sum += k.distance(k.trainingSet[i], k.Centroids[k.guesses[i]])
+	}
+
+	return sum
+}
+
+// PersistToFile takes in an absolute filepath and saves the
+// centroids, with the number of points each one has learned
+// from and the batch size, to the file. The restored model
+// carries on learning (online or not) from there.
+func (k *MiniBatchKMeans) PersistToFile(path string) error {
+	if path == "" {
+		return fmt.Errorf("ERROR: you just tried to persist your model to a file with no path!! That's a no-no. Try it with a valid filepath")
+	}
+
+	bytes, err := json.Marshal(k)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, bytes, os.ModePerm)
+}
+
+// RestoreFromFile takes in a path to a persisted model
+// and restores its centroids, counts and batch size.
+//
+// The path must ba an absolute path or a path from the current
+// directory
+func (k *MiniBatchKMeans) RestoreFromFile(path string) error {
+	if path == "" {
+		return fmt.Errorf("ERROR: you just tried to restore your model from a file with no path! That's a no-no. Try it with a valid filepath")
+	}
+
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	restored := MiniBatchKMeans{}
+	err = json.Unmarshal(bytes, &restored)
+	if err != nil {
+		return err
+	}
+
+	if len(restored.Centroids) == 0 || len(restored.Counts) != len(restored.Centroids) {
+		return fmt.Errorf("ERROR: %v should hold a count for each centroid", path)
+	}
+
+	k.Centroids = restored.Centroids
+	k.Counts = restored.Counts
+	if restored.BatchSize > 0 {
+		k.BatchSize = restored.BatchSize
+	}
+
+	return nil
+}
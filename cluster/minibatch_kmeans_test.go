@@ -0,0 +1,197 @@
+package cluster
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/bountylabs/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var blobCenters = [][]float64{{-10, -10}, {-10, 10}, {10, -10}, {10, 10}}
+
+// blobs returns n points around blobCenters, and
+// the blob each came from
+func blobs(random *rand.Rand, n int) ([][]float64, []int) {
+	x := make([][]float64, n)
+	y := make([]int, n)
+	for i := range x {
+		y[i] = random.Intn(len(blobCenters))
+		x[i] = []float64{blobCenters[y[i]][0] + random.NormFloat64()*2, blobCenters[y[i]][1] + random.NormFloat64()*2}
+	}
+
+	return x, y
+}
+
+// closestCenters asserts every blob has a centroid
+// close to its center
+func closestCenters(t *testing.T, centroids [][]float64) {
+	for _, center := range blobCenters {
+		min := math.Inf(1)
+		for _, centroid := range centroids {
+			min = math.Min(min, base.EuclideanDistance(center, centroid))
+		}
+		assert.True(t, min < 0.5, "Every blob (%v) should have a centroid close to its center (%v away)", center, min)
+	}
+}
+
+func TestMiniBatchKMeansShouldPass1(t *testing.T) {
+	x, y := blobs(rand.New(rand.NewSource(42)), 20000)
+
+	model := NewMiniBatchKMeans(4, 100, 256, x)
+	model.Seed = 42
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+	closestCenters(t, model.Centroids)
+	assert.True(t, purity(model.Guesses(), y) > 0.98, "Clusters should match the blobs")
+
+	var total int64
+	for _, count := range model.Counts {
+		total += count
+	}
+	assert.Equal(t, int64(100*256+4), total, "Every point of every batch should be counted")
+
+	for i := 0; i < 100; i++ {
+		guess, err := model.Predict(x[i])
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.Equal(t, float64(model.Guesses()[i]), guess[0], "Predictions should match the clustering of the training set")
+	}
+
+	again := NewMiniBatchKMeans(4, 100, 256, x)
+	again.Seed = 42
+	assert.Nil(t, again.Learn(), "Learning error should be nil")
+	assert.Equal(t, model.Centroids, again.Centroids, "The same seed should find the same centroids")
+}
+
+// streamPoints sends x down a new channel
+func streamPoints(x [][]float64) chan base.Datapoint {
+	stream := make(chan base.Datapoint, 100)
+	go func() {
+		for i := range x {
+			stream <- base.Datapoint{X: x[i]}
+		}
+		close(stream)
+	}()
+
+	return stream
+}
+
+// learning from a stream, and resuming after a restore
+func TestMiniBatchKMeansShouldPass2(t *testing.T) {
+	x, _ := blobs(rand.New(rand.NewSource(7)), 50000)
+
+	model := NewMiniBatchKMeans(4, 0, 500, nil)
+	model.Seed = 7
+	updates := 0
+	err := model.OnlineLearnContext(context.Background(), streamPoints(x), base.OnlineOptions{
+		OnUpdate: func(centroids [][]float64) {
+			assert.Len(t, centroids, 4, "Updates should hold every centroid")
+			updates++
+		},
+	})
+	assert.Nil(t, err, "Learning error should be nil")
+
+	closestCenters(t, model.Centroids)
+	assert.Equal(t, int64(50000), model.Stats().Seen, "Every point should be seen")
+	assert.Equal(t, int64(100), model.Stats().Updates, "Each batch should be one update")
+	assert.Equal(t, 100, updates, "OnUpdate should be called for each batch")
+
+	// learn half, persist, restore and learn the
+	// other half
+	first := NewMiniBatchKMeans(4, 0, 500, nil)
+	first.Seed = 7
+	err = first.OnlineLearnContext(context.Background(), streamPoints(x[:25000]), base.OnlineOptions{})
+	assert.Nil(t, err, "Learning error should be nil")
+
+	err = first.PersistToFile("/tmp/.goml/MiniBatchKMeans.json")
+	assert.Nil(t, err, "Persistence error should be nil")
+
+	resumed := NewMiniBatchKMeans(4, 0, 0, nil)
+	err = resumed.RestoreFromFile("/tmp/.goml/MiniBatchKMeans.json")
+	assert.Nil(t, err, "Restore error should be nil")
+	assert.Equal(t, 500, resumed.BatchSize, "The batch size should be restored")
+	assert.Equal(t, first.Counts, resumed.Counts, "The counts should be restored")
+
+	err = resumed.OnlineLearnContext(context.Background(), streamPoints(x[25000:]), base.OnlineOptions{})
+	assert.Nil(t, err, "Learning error should be nil")
+	assert.Equal(t, model.Counts, resumed.Counts, "A restored model should carry on where it left off")
+	for j := range model.Centroids {
+		for l := range model.Centroids[j] {
+			assert.InDelta(t, model.Centroids[j][l], resumed.Centroids[j][l], 1e-9, "A restored model should carry on where it left off")
+		}
+	}
+}
+
+func TestMiniBatchKMeansCopyOnWriteShouldPass1(t *testing.T) {
+	x, _ := blobs(rand.New(rand.NewSource(3)), 20000)
+
+	model := NewMiniBatchKMeans(4, 0, 500, nil)
+	model.Seed = 3
+
+	started := make(chan struct{})
+	done := make(chan struct{})
+	once := sync.Once{}
+	go func() {
+		defer close(done)
+		err := model.OnlineLearnContext(context.Background(), streamPoints(x), base.OnlineOptions{
+			CopyOnWrite: true,
+			OnUpdate: func([][]float64) {
+				once.Do(func() { close(started) })
+			},
+		})
+		assert.Nil(t, err, "Learning error should be nil")
+	}()
+
+	// predicting while learning shouldn't race
+	<-started
+	for predicting := true; predicting; {
+		select {
+		case <-done:
+			predicting = false
+		default:
+			_, err := model.Predict(x[0])
+			assert.Nil(t, err, "Prediction error should be nil")
+		}
+	}
+
+	closestCenters(t, model.Centroids)
+	assert.Equal(t, base.OnlineStats{Seen: 20000, Updates: 40}, model.Stats(), "Every point should be learned from")
+
+	// copy on write should learn just the same
+	inPlace := NewMiniBatchKMeans(4, 0, 500, nil)
+	inPlace.Seed = 3
+	err := inPlace.OnlineLearnContext(context.Background(), streamPoints(x), base.OnlineOptions{})
+	assert.Nil(t, err, "Learning error should be nil")
+	assert.Equal(t, inPlace.Counts, model.Counts, "Copy on write should learn from every point")
+	assert.Equal(t, inPlace.Centroids, model.Centroids, "Copy on write should find the same centroids")
+}
+
+func TestMiniBatchKMeansShouldFail1(t *testing.T) {
+	model := NewMiniBatchKMeans(3, 10, 10, nil)
+	assert.NotNil(t, model.Learn(), "Learning with no data should return an error")
+
+	_, err := model.Predict([]float64{1, 2})
+	assert.NotNil(t, err, "Predicting before learning should return an error")
+
+	model = NewMiniBatchKMeans(3, 10, 10, [][]float64{{1}, {2}})
+	assert.NotNil(t, model.Learn(), "Asking for more clusters than points should return an error")
+
+	assert.NotNil(t, model.OnlineLearnContext(context.Background(), nil, base.OnlineOptions{}), "Learning from a nil stream should return an error")
+
+	errors := 0
+	err = model.OnlineLearnContext(context.Background(), streamPoints([][]float64{{1, 2}, {3, 4}, {5}, {6, 7}}), base.OnlineOptions{
+		OnError: func(error) { errors++ },
+	})
+	assert.Nil(t, err, "Learning error should be nil")
+	assert.Equal(t, 1, errors, "Points of the wrong dimension should be skipped")
+
+	model = NewMiniBatchKMeans(3, 10, 10, nil)
+	err = model.OnlineLearnContext(context.Background(), streamPoints([][]float64{{1, 2}}), base.OnlineOptions{})
+	assert.NotNil(t, err, "Streams too short to instantiate the centroids should return an error")
+
+	assert.NotNil(t, model.RestoreFromFile("/tmp/.goml/does_not_exist.json"), "Restoring from a missing file should return an error")
+}
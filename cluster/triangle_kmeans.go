@@ -1,10 +1,8 @@
 package cluster
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"math/rand"
 	"os"
 	"time"
@@ -135,6 +133,11 @@ type TriangleKMeans struct {
 
 	Centroids [][]float64 `json:"centroids"`
 
+	// Counts and distortion work just like
+	// KMeans'.
+	Counts     []int64 `json:"counts"`
+	distortion float64
+
 	// centroidDist is a K x K matrix of
 	// the distances such that centroidDist[i][j]
 	// is the distance from centroid i to centroid
@@ -148,6 +151,27 @@ type TriangleKMeans struct {
 	centroidDist    [][]float64
 	minCentroidDist []float64
 
+	// Distance is what points are assigned to
+	// their nearest centroid by. It defaults (when
+	// nil) to the squared Euclidean distance. The
+	// bounds only hold for a metric (one which obeys
+	// the triangle inequality), so Learn returns an
+	// error for distances which aren't one of the
+	// metrics defined in base unless Metric is set.
+	// Use KMeans (or KMedoids) for any other distance.
+	Distance base.DistanceMeasure `json:"-"`
+
+	// Metric tells the model that Distance is a
+	// true metric, just like KNN's Metric.
+	Metric bool `json:"-"`
+
+	// NInit, Seed, Inertia and BestRestart work
+	// just like KMeans'.
+	NInit       int       `json:"-"`
+	Seed        int64     `json:"-"`
+	Inertia     []float64 `json:"-"`
+	BestRestart int       `json:"-"`
+
 	// Output is the io.Writer to write logs
 	// and output from training to
 	Output io.Writer
@@ -200,7 +224,7 @@ func NewTriangleKMeans(k, maxIterations int, trainingSet [][]float64) *TriangleK
 		}
 	}
 
-	rand.Seed(time.Now().UTC().Unix())
+	rand.Seed(time.Now().UTC().UnixNano())
 	centroids := make([][]float64, k)
 	centroidDist := make([][]float64, k)
 	minCentroidDist := make([]float64, k)
@@ -250,6 +274,16 @@ func (k *TriangleKMeans) MaxIterations() int {
 	return k.maxIterations
 }
 
+// distance returns the distance between u and v
+// under the model's Distance.
+func (k *TriangleKMeans) distance(u, v []float64) float64 {
+	if k.Distance == nil {
+		return diff(u, v)
+	}
+
+	return k.Distance(u, v)
+}
+
 // Predict takes in a variable x (an array of floats,) and
 // finds the value of the hypothesis function given the
 // current parameter vector θ
@@ -264,13 +298,13 @@ func (k *TriangleKMeans) Predict(x []float64, normalize ...bool) ([]float64, err
 	}
 
 	if len(normalize) != 0 && normalize[0] {
-		base.NormalizePoint(x)
+		x = base.NormalizedPoint(x)
 	}
 
 	var guess int
-	minDiff := diff(x, k.Centroids[0])
+	minDiff := k.distance(x, k.Centroids[0])
 	for j := 1; j < len(k.Centroids); j++ {
-		difference := diff(x, k.Centroids[j])
+		difference := k.distance(x, k.Centroids[j])
 		if difference < minDiff {
 			minDiff = difference
 			guess = j
@@ -292,7 +326,7 @@ func (k *TriangleKMeans) computeCentroidDistanceMatrix() {
 	// and then copy values over to maintain functionality
 	for i := range k.Centroids {
 		for j := 0; j < i; j++ {
-			k.centroidDist[i][j] = 0.5 * diff(k.Centroids[i], k.Centroids[j])
+			k.centroidDist[i][j] = 0.5 * k.distance(k.Centroids[i], k.Centroids[j])
 		}
 	}
 
@@ -337,33 +371,23 @@ func (k *TriangleKMeans) computeCentroidDistanceMatrix() {
 // assigned points is harder to embed.
 //
 // The method returns the new centers instead of
-// modifying the model's centroids.
-func (k *TriangleKMeans) recalculateCentroids() [][]float64 {
-	classTotal := make([][]float64, len(k.Centroids))
-	classCount := make([]int64, len(k.Centroids))
-
-	for j := range k.Centroids {
-		classTotal[j] = make([]float64, len(k.trainingSet[0]))
-	}
-
-	for i, x := range k.trainingSet {
-		classCount[k.guesses[i]]++
-		for j := range x {
-			classTotal[k.guesses[i]][j] += x[j]
-		}
-	}
-
-	centroids := append([][]float64{}, k.Centroids...)
+// modifying the model's centroids. Centroids with
+// no points are restarted from a random point.
+func (k *TriangleKMeans) recalculateCentroids(random *rand.Rand) [][]float64 {
+	classTotal, classCount := centroidSums(k.trainingSet, k.guesses, len(k.Centroids))
+
+	// the old centroids are still needed to work
+	// out how far each one moved
+	centroids := make([][]float64, len(k.Centroids))
 	for j := range centroids {
 		// if no objects are in the same class,
-		// reinitialize it to a random vector
+		// restart it from a random point
 		if classCount[j] == 0 {
-			for l := range centroids[j] {
-				centroids[j][l] = 10 * (rand.Float64() - 0.5)
-			}
+			centroids[j] = append([]float64{}, k.trainingSet[random.Intn(len(k.trainingSet))]...)
 			continue
 		}
 
+		centroids[j] = make([]float64, len(k.Centroids[j]))
 		for l := range centroids[j] {
 			centroids[j][l] = classTotal[j][l] / float64(classCount[j])
 		}
@@ -401,66 +425,118 @@ func (k *TriangleKMeans) Learn() error {
 		return err
 	}
 
+	if k.Distance != nil && !k.Metric && !base.IsMetric(k.Distance) {
+		err := fmt.Errorf("ERROR: TriangleKMeans needs a metric distance (one which obeys the triangle inequality.) Set Metric if yours is one, or use KMeans or KMedoids\n")
+		fmt.Fprintf(k.Output, err.Error())
+		return err
+	}
+
 	centroids := len(k.Centroids)
 	features := len(k.trainingSet[0])
 
-	fmt.Fprintf(k.Output, "Training:\n\tModel: Triangle Inequality Accelerated K-Means++ Classification\n\tTraining Examples: %v\n\tFeatures: %v\n\tClasses: %v\n...\n\n", examples, features, centroids)
+	fmt.Fprintf(k.Output, "Training:\n\tModel: Triangle Inequality Accelerated K-Means++ Classification\n\tTraining Examples: %v\n\tFeatures: %v\n\tClasses: %v\n\tRestarts: %v\n...\n\n", examples, features, centroids, nInit(k.NInit))
 
-	/* Step 0 */
+	runs := make([]*TriangleKMeans, nInit(k.NInit))
+	iterations := make([]int, len(runs))
+	restarts(k.Seed, len(runs), func(restart int, random *rand.Rand) {
+		runs[restart] = k.restart()
+		iterations[restart] = runs[restart].run(random)
+	})
 
-	// instantiate the centroids using k-means++
-	k.Centroids[0] = k.trainingSet[rand.Intn(len(k.trainingSet))]
-
-	distances := make([]float64, len(k.trainingSet))
-	for i := 1; i < len(k.Centroids); i++ {
-		var sum float64
-		for j, x := range k.trainingSet {
-			minDiff := diff(x, k.Centroids[0])
-			for l := 1; l < i; l++ {
-				difference := diff(x, k.Centroids[l])
-				if difference < minDiff {
-					minDiff = difference
-				}
-			}
+	best := bestRestart(len(runs), func(restart int) float64 {
+		return runs[restart].Distortion()
+	})
 
-			distances[j] = minDiff * minDiff
-			sum += distances[j]
-		}
+	k.Centroids = runs[best].Centroids
+	k.guesses = runs[best].guesses
+	k.info = runs[best].info
+	k.centroidDist = runs[best].centroidDist
+	k.minCentroidDist = runs[best].minCentroidDist
+	k.Counts = clusterCounts(k.guesses, len(k.Centroids))
+	k.distortion = runs[best].Distortion()
+	k.BestRestart = best
+	k.Inertia = make([]float64, len(runs))
+	for restart := range runs {
+		k.Inertia[restart] = runs[restart].Distortion()
+	}
 
-		target := rand.Float64() * sum
-		j := 0
-		for sum = distances[0]; sum < target; sum += distances[j] {
-			j++
+	fmt.Fprintf(k.Output, "Training Completed in %v iterations.\n%v\n", iterations[best], k)
+
+	return nil
+}
+
+// restart returns a copy of the model with fresh
+// centroids and bounds to learn one k-means++
+// instantiation with.
+func (k *TriangleKMeans) restart() *TriangleKMeans {
+	centroids := len(k.Centroids)
+
+	run := &TriangleKMeans{
+		maxIterations: k.maxIterations,
+
+		trainingSet: k.trainingSet,
+		guesses:     make([]int, len(k.trainingSet)),
+		info:        make([]pointInfo, len(k.trainingSet)),
+
+		Centroids:       make([][]float64, centroids),
+		centroidDist:    make([][]float64, centroids),
+		minCentroidDist: make([]float64, centroids),
+
+		Distance: k.Distance,
+		Metric:   k.Metric,
+	}
+
+	for i := range run.info {
+		run.info[i] = pointInfo{
+			lower:     make([]float64, centroids),
+			recompute: true,
 		}
-		k.Centroids[i] = k.trainingSet[j]
 	}
+	for i := range run.centroidDist {
+		run.centroidDist[i] = make([]float64, centroids)
+	}
+
+	return run
+}
+
+// run learns from one k-means++ instantiation drawn
+// from random, returning the number of iterations.
+func (k *TriangleKMeans) run(random *rand.Rand) int {
+	/* Step 0 */
+
+	// instantiate the centroids using k-means++
+	k.Centroids = kmeansPlusPlus(k.trainingSet, len(k.Centroids), k.distance, random)
 
 	/* Step 0.5 */
 
 	// loop over dataset and assign each point to
-	// the closest cluster
-	for i, x := range k.trainingSet {
-		k.guesses[i] = 0
-		minDiff := diff(x, k.Centroids[0])
-		k.info[i].lower[0] = minDiff
-		for j := 1; j < len(k.Centroids); j++ {
-			// avoid redundant distance computations
-			if k.minCentroidDist[j] >= minDiff {
-				continue
-			}
+	// the closest cluster (each chunk of points in
+	// parallel, like every per point step below)
+	eachChunk(len(k.trainingSet), func(chunk, start, end int) {
+		for i := start; i < end; i++ {
+			x := k.trainingSet[i]
+			k.guesses[i] = 0
+			minDiff := k.distance(x, k.Centroids[0])
+			k.info[i].lower[0] = minDiff
+			for j := 1; j < len(k.Centroids); j++ {
+				// avoid redundant distance computations
+				if k.minCentroidDist[j] >= minDiff {
+					continue
+				}
 
-			difference := diff(x, k.Centroids[j])
-			k.info[i].lower[j] = difference
-			if difference < minDiff {
-				minDiff = difference
-				k.guesses[i] = j
+				difference := k.distance(x, k.Centroids[j])
+				k.info[i].lower[j] = difference
+				if difference < minDiff {
+					minDiff = difference
+					k.guesses[i] = j
+				}
 			}
-		}
 
-		// assign upper bound to the distance
-		// to the nearest centroid.
-		k.info[i].upper = minDiff
-	}
+			// assign upper bound to the distance
+			// to the nearest centroid.
+			k.info[i].upper = minDiff
+		}
+	})
 
 	iter := 0
 	for ; iter < k.maxIterations; iter++ {
@@ -471,80 +547,105 @@ func (k *TriangleKMeans) Learn() error {
 		// centroids
 		k.computeCentroidDistanceMatrix()
 
-		var upper float64
-		for i, x := range k.trainingSet {
-			upper = k.info[i].upper
-			/* Step 2 */
-			if upper <= k.minCentroidDist[k.guesses[i]] {
-				continue
-			}
-
-			/* Step 3 */
-			for j := range k.Centroids {
-				if j == k.guesses[i] && //                        (i)
-					upper <= k.info[i].lower[j] && //             (ii)
-					upper <= k.centroidDist[k.guesses[i]][j] { // (iii)
+		eachChunk(len(k.trainingSet), func(chunk, start, end int) {
+			var upper float64
+			for i := start; i < end; i++ {
+				x := k.trainingSet[i]
+				upper = k.info[i].upper
+				/* Step 2 */
+				if upper <= k.minCentroidDist[k.guesses[i]] {
 					continue
 				}
-				guess := k.guesses[i]
-
-				/* Step 3.a */
-				// proactively use the otherwise case
-				distToCentroid := upper
-				if k.info[i].recompute {
-					// then recompute the distance to the assigned
-					// centroid
-					distToCentroid = diff(x, k.Centroids[guess])
-					k.info[i].lower[guess] = distToCentroid
-					k.info[i].upper = distToCentroid
-					k.info[i].recompute = false
-				}
 
-				/* Step 3.b */
-				if distToCentroid > k.info[i].lower[j] ||
-					distToCentroid > k.centroidDist[guess][j] {
-					// only now compute the distance to the
-					// centroid
-					dist := diff(x, k.Centroids[j])
-					k.info[i].lower[j] = dist
-					if dist < distToCentroid {
-						k.guesses[i] = j
+				/* Step 3 */
+				for j := range k.Centroids {
+					if j == k.guesses[i] && //                        (i)
+						upper <= k.info[i].lower[j] && //             (ii)
+						upper <= k.centroidDist[k.guesses[i]][j] { // (iii)
+						continue
+					}
+					guess := k.guesses[i]
+
+					/* Step 3.a */
+					// proactively use the otherwise case
+					distToCentroid := upper
+					if k.info[i].recompute {
+						// then recompute the distance to the assigned
+						// centroid
+						distToCentroid = k.distance(x, k.Centroids[guess])
+						k.info[i].lower[guess] = distToCentroid
+						k.info[i].upper = distToCentroid
+						k.info[i].recompute = false
+					}
 
+					/* Step 3.b */
+					if distToCentroid > k.info[i].lower[j] ||
+						distToCentroid > k.centroidDist[guess][j] {
+						// only now compute the distance to the
+						// centroid
+						dist := k.distance(x, k.Centroids[j])
+						k.info[i].lower[j] = dist
+						if dist < distToCentroid {
+							k.guesses[i] = j
+
+						}
 					}
 				}
 			}
-		}
+		})
 
 		/* Step 4 */
-		newCentroids := k.recalculateCentroids()
-		for i := range k.trainingSet {
-			/* Step 5 */
-			for j := range k.Centroids {
-				// calculate the shift to the new centroid
-				shift := k.info[i].lower[j] - diff(k.Centroids[j], newCentroids[j])
-
-				// bound the shift at 0 and assign it
-				// as the new lower bound
-				if shift < 0 {
-					shift = 0
-				}
-				k.info[i].lower[j] = shift
-			}
+		newCentroids := k.recalculateCentroids(random)
 
-			/* Step 6 */
-			// reassign the upper bound to account
-			// for the centroid shift
-			k.info[i].upper += diff(newCentroids[k.guesses[i]], k.Centroids[k.guesses[i]])
-			k.info[i].recompute = true
+		// how far each centroid moved
+		moved := make([]float64, len(k.Centroids))
+		for j := range k.Centroids {
+			moved[j] = k.distance(k.Centroids[j], newCentroids[j])
 		}
 
+		eachChunk(len(k.trainingSet), func(chunk, start, end int) {
+			for i := start; i < end; i++ {
+				/* Step 5 */
+				for j := range k.Centroids {
+					// calculate the shift to the new centroid
+					shift := k.info[i].lower[j] - moved[j]
+
+					// bound the shift at 0 and assign it
+					// as the new lower bound
+					if shift < 0 {
+						shift = 0
+					}
+					k.info[i].lower[j] = shift
+				}
+
+				/* Step 6 */
+				// reassign the upper bound to account
+				// for the centroid shift
+				k.info[i].upper += moved[k.guesses[i]]
+				k.info[i].recompute = true
+			}
+		})
+
 		/* Step 7 */
 		k.Centroids = newCentroids
 	}
 
-	fmt.Fprintf(k.Output, "Training Completed in %v iterations.\n%v\n", iter, k)
+	// the guesses should match the final
+	// centroids
+	eachChunk(len(k.trainingSet), func(chunk, start, end int) {
+		for i := start; i < end; i++ {
+			k.guesses[i] = 0
+			minDiff := k.distance(k.trainingSet[i], k.Centroids[0])
+			for j := 1; j < len(k.Centroids); j++ {
+				if difference := k.distance(k.trainingSet[i], k.Centroids[j]); difference < minDiff {
+					minDiff = difference
+					k.guesses[i] = j
+				}
+			}
+		}
+	})
 
-	return nil
+	return iter
 }
 
 // String implements the fmt interface for clean printing. Here
@@ -569,10 +670,20 @@ func (k *TriangleKMeans) Guesses() []int {
 //
 // Distorition() = Σ |x[i] - μ[c[i]]|^2
 // over all training examples
+//
+// (or the sum of the Distance from each point to
+// its centroid if one is given.)
+//
+// A model restored without its training set returns
+// the distortion it was persisted with.
 func (k *TriangleKMeans) Distortion() float64 {
+	if len(k.trainingSet) == 0 || len(k.trainingSet) != len(k.guesses) {
+		return k.distortion
+	}
+
 	var sum float64
 	for i := range k.trainingSet {
-		sum += diff(k.trainingSet[i], k.Centroids[int(k.guesses[i])])
+		sum += k.distance(k.trainingSet[i], k.Centroids[int(k.guesses[i])])
 	}
 
 	return sum
@@ -595,7 +706,9 @@ func (k *TriangleKMeans) SaveClusteredData(filepath string) error {
 }
 
 // PersistToFile takes in an absolute filepath and saves the
-// centroid vector to the file, which can be restored later.
+// model to the file, which can be restored later: the
+// centroids, the number of points assigned to each, the
+// training guesses and distortion, and the other settings.
 // The function will take paths from the current directory, but
 // functions
 //
@@ -603,26 +716,26 @@ func (k *TriangleKMeans) SaveClusteredData(filepath string) error {
 // efficient storage method (you only need one comma extra
 // per feature + two brackets, total!) And it's extendable.
 func (k *TriangleKMeans) PersistToFile(path string) error {
-	if path == "" {
-		return fmt.Errorf("ERROR: you just tried to persist your model to a file with no path!! That's a no-no. Try it with a valid filepath")
-	}
-
-	bytes, err := json.Marshal(k.Centroids)
-	if err != nil {
-		return err
-	}
-
-	err = ioutil.WriteFile(path, bytes, os.ModePerm)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return writeKMeansState(path, kmeansState{
+		MaxIterations: k.maxIterations,
+
+		Centroids:  k.Centroids,
+		Counts:     k.Counts,
+		Guesses:    k.guesses,
+		Distortion: k.Distortion(),
+
+		NInit:       k.NInit,
+		Seed:        k.Seed,
+		Inertia:     k.Inertia,
+		BestRestart: k.BestRestart,
+		Metric:      k.Metric,
+	})
 }
 
-// RestoreFromFile takes in a path to a centroid vector
-// and assigns the model it's operating on's parameter vector
-// to that.
+// RestoreFromFile takes in a path to a persisted model
+// and restores everything PersistToFile saved. The
+// centroid vectors older versions persisted can still
+// be restored, with the counts starting over at zero.
 //
 // The path must ba an absolute path or a path from the current
 // directory
@@ -631,19 +744,30 @@ func (k *TriangleKMeans) PersistToFile(path string) error {
 // a model on data, or for graphing a dataset with a fit in
 // another framework like Julia/Gadfly.
 func (k *TriangleKMeans) RestoreFromFile(path string) error {
-	if path == "" {
-		return fmt.Errorf("ERROR: you just tried to restore your model from a file with no path! That's a no-no. Try it with a valid filepath")
-	}
-
-	bytes, err := ioutil.ReadFile(path)
+	state, err := readKMeansState(path)
 	if err != nil {
 		return err
 	}
 
-	err = json.Unmarshal(bytes, &k.Centroids)
-	if err != nil {
-		return err
+	k.Centroids = state.Centroids
+	k.Counts = state.Counts
+	if state.legacy {
+		return nil
+	}
+
+	if state.MaxIterations != 0 {
+		k.maxIterations = state.MaxIterations
+	}
+	if state.Guesses != nil {
+		k.guesses = state.Guesses
 	}
+	k.distortion = state.Distortion
+
+	k.NInit = state.NInit
+	k.Seed = state.Seed
+	k.Inertia = state.Inertia
+	k.BestRestart = state.BestRestart
+	k.Metric = state.Metric
 
 	return nil
 }
@@ -489,3 +489,114 @@ func TestTriangleKMeansPersistToFileShouldPass1(t *testing.T) {
 	// save results to disk
 	assert.Nil(t, model.SaveClusteredData("/tmp/.goml/TriangleKMeansResults.csv"), "Save results error should be nil")
 }
+
+// a restored model should hold everything the
+// persisted one did
+func TestTriangleKMeansPersistToFileShouldPass2(t *testing.T) {
+	model := NewTriangleKMeans(4, 30, circles)
+	model.NInit = 3
+	model.Seed = 42
+	model.Metric = true
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+	var total int64
+	for _, count := range model.Counts {
+		total += count
+	}
+	assert.Len(t, model.Counts, 4, "There should be a count for each centroid")
+	assert.Equal(t, int64(len(circles)), total, "Every training example should be counted")
+
+	assert.Nil(t, model.PersistToFile("/tmp/.goml/TriangleKMeansState.json"), "Persist error should be nil")
+
+	restored := NewTriangleKMeans(1, 1, nil)
+	assert.Nil(t, restored.RestoreFromFile("/tmp/.goml/TriangleKMeansState.json"), "Restore error should be nil")
+
+	assert.Equal(t, model.Centroids, restored.Centroids, "The centroids should be restored")
+	assert.Equal(t, model.Counts, restored.Counts, "The counts should be restored")
+	assert.Equal(t, model.Guesses(), restored.Guesses(), "The guesses should be restored")
+	assert.InDelta(t, model.Distortion(), restored.Distortion(), 1e-9, "The distortion should be restored without the training set")
+	assert.Equal(t, 30, restored.MaxIterations(), "The max iterations should be restored")
+	assert.Equal(t, model.Inertia, restored.Inertia, "The restarts should be restored")
+	assert.True(t, restored.Metric, "Metric should be restored")
+
+	// it should learn again from a new training set
+	assert.Nil(t, restored.UpdateTrainingSet(circles), "Update error should be nil")
+	restored.Output = model.Output
+	assert.Nil(t, restored.Learn(), "Learning error should be nil")
+	assert.Equal(t, model.Centroids, restored.Centroids, "The restored model should learn the same way")
+}
+
+// Learn seeds centroids from the training set, so
+// make sure updating them doesn't write into it
+func TestTriangleKMeansDoesNotMutateTrainingSetShouldPass1(t *testing.T) {
+	data := make([][]float64, len(circles))
+	expected := make([][]float64, len(circles))
+	for i := range circles {
+		data[i] = append([]float64{}, circles[i]...)
+		expected[i] = append([]float64{}, circles[i]...)
+	}
+
+	model := NewTriangleKMeans(4, 10, data)
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+	assert.Equal(t, expected, data, "Learning should not modify the training set")
+}
+
+// any metric can be given to assign points by
+func TestTriangleKMeansDistanceShouldPass1(t *testing.T) {
+	var wrong, count int
+	for iter := 0; iter < 10; iter++ {
+		model := NewTriangleKMeans(2, 5, double)
+		model.Distance = base.ManhattanDistance
+		assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+		c1, err := model.Predict([]float64{-7.5, 0})
+		assert.Nil(t, err, "Prediction error should be nil")
+		c2, err := model.Predict([]float64{7.5, 0})
+		assert.Nil(t, err, "Prediction error should be nil")
+
+		for i, x := range double {
+			expected := c1[0]
+			if x[0] > 0 {
+				expected = c2[0]
+			}
+			if float64(model.Guesses()[i]) != expected {
+				wrong++
+			}
+			count++
+		}
+	}
+
+	accuracy := 100 * (1 - float64(wrong)/float64(count))
+	assert.True(t, accuracy > 80, "Accuracy (%v) should be greater than 80 percent", accuracy)
+}
+
+func TestTriangleKMeansDistanceShouldFail1(t *testing.T) {
+	model := NewTriangleKMeans(2, 5, double)
+	model.Distance = base.CosineDistance
+	assert.NotNil(t, model.Learn(), "Distances which aren't metrics should return an error")
+
+	model.Metric = true
+	assert.Nil(t, model.Learn(), "Distances the user says are metrics should be used")
+}
+
+// restarts should keep the best clustering, and a
+// seed should make learning repeatable
+func TestTriangleKMeansNInitShouldPass1(t *testing.T) {
+	model := NewTriangleKMeans(4, 30, circles)
+	model.NInit = 8
+	model.Seed = 42
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+	assert.Len(t, model.Inertia, 8, "The distortion of every restart should be recorded")
+	for _, inertia := range model.Inertia {
+		assert.True(t, model.Inertia[model.BestRestart] <= inertia, "The best restart should have the lowest distortion")
+	}
+	assert.InDelta(t, model.Inertia[model.BestRestart], model.Distortion(), 1e-6, "The model should keep the best restart")
+
+	again := NewTriangleKMeans(4, 30, circles)
+	again.NInit = 8
+	again.Seed = 42
+	assert.Nil(t, again.Learn(), "Learning error should be nil")
+	assert.Equal(t, model.Centroids, again.Centroids, "The same seed should find the same centroids")
+	assert.Equal(t, model.Inertia, again.Inertia, "The same seed should find the same distortions")
+}
@@ -51,6 +51,7 @@ package linear
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -100,6 +101,12 @@ type LeastSquares struct {
 	// Output is the io.Writer used for logging
 	// and printing. Defaults to os.Stdout.
 	Output io.Writer
+
+	// online counts the points seen while
+	// learning online, and holds theta while
+	// learning with copy on write, so Predict
+	// can be called from other goroutines
+	online base.OnlineState
 }
 
 // NewLeastSquares returns a pointer to the linear model
@@ -248,19 +255,20 @@ func (l *LeastSquares) MaxIterations() int {
 // you trained off of normalized inputs and are feeding
 // an un-normalized input
 func (l *LeastSquares) Predict(x []float64, normalize ...bool) ([]float64, error) {
-	if len(x)+1 != len(l.Parameters) {
-		return nil, fmt.Errorf("Error: Parameter vector should be 1 longer than input vector!\n\tLength of x given: %v\n\tLength of parameters: %v\n", len(x), len(l.Parameters))
+	theta := l.theta()
+	if len(x)+1 != len(theta) {
+		return nil, fmt.Errorf("Error: Parameter vector should be 1 longer than input vector!\n\tLength of x given: %v\n\tLength of parameters: %v\n", len(x), len(theta))
 	}
 
 	if len(normalize) != 0 && normalize[0] {
-		base.NormalizePoint(x)
+		x = base.NormalizedPoint(x)
 	}
 
 	// include constant term in sum
-	sum := l.Parameters[0]
+	sum := theta[0]
 
 	for i := range x {
-		sum += x[i] * l.Parameters[i+1]
+		sum += x[i] * theta[i+1]
 	}
 
 	if l.logistic {
@@ -270,12 +278,31 @@ func (l *LeastSquares) Predict(x []float64, normalize ...bool) ([]float64, error
 	return []float64{sum}, nil
 }
 
+// PredictProba returns the probabilities of x being in
+// each class, as []float64{P(y = 0), P(y = 1)}. It only
+// works for logistic models (made with NewLogistic), because
+// the output of a regular Least Squares model isn't a
+// probability.
+func (l *LeastSquares) PredictProba(x []float64, normalize ...bool) ([]float64, error) {
+	if !l.logistic {
+		return nil, fmt.Errorf("ERROR: PredictProba only works for logistic models, not Least Squares regression")
+	}
+
+	guess, err := l.Predict(x, normalize...)
+	if err != nil {
+		return nil, err
+	}
+
+	return []float64{1 - guess[0], guess[0]}, nil
+}
+
 func (l *LeastSquares) PredictCheap(x []float64) float64 {
+	theta := l.theta()
 
 	// include constant term in sum
-	sum := l.Parameters[0]
+	sum := theta[0]
 	for i := range x {
-		sum += x[i] * l.Parameters[i+1]
+		sum += x[i] * theta[i+1]
 	}
 
 	if l.logistic {
@@ -339,8 +366,10 @@ func (l *LeastSquares) Learn() error {
 // vector theta is changed, so you are able to persist the
 // model with the most up to date vector at all times (you
 // could persist to a database within the callback, for
-// example.) Don't worry about it taking too long and blocking,
-// because the callback is spawned into another goroutine.
+// example.) The callback gets its own copy of theta, and
+// is called from a single goroutine one update at a time,
+// so a slow callback won't pile up goroutines. If it falls
+// too far behind, learning waits for it to catch up.
 //
 // NOTE that this function is suggested to run in it's own
 // goroutine, or at least is designed as such.
@@ -424,89 +453,155 @@ func (l *LeastSquares) OnlineLearn(errors chan error, dataset chan base.Datapoin
 	if errors == nil {
 		errors = make(chan error)
 	}
+	defer close(errors)
+
+	err := l.OnlineLearnContext(context.Background(), dataset, base.OnlineOptions{
+		OnUpdate:       onUpdate,
+		CallbackBuffer: base.DefaultCallbackBuffer,
+		OnError: func(err error) {
+			errors <- err
+		},
+	})
+	if err != nil {
+		errors <- err
+	}
+}
+
+// OnlineLearnContext learns from dataset just like
+// OnlineLearn, but it stops when ctx is done (returning
+// ctx.Err()) as well as when dataset is closed (returning
+// nil), and it takes its callbacks through opts instead of
+// channels. See base.OnlineOptions for how OnUpdate is
+// called; every call gets its own copy of theta, so it can
+// hold on to it while the model keeps learning.
+//
+// Unlike OnlineLearn, opts.Normalize is respected, so if
+// you set it remember to pass normalize to Predict too.
+//
+// Stats reports how many points the model has seen so
+// far, and how many of them caused an error.
+//
+// Example Online Least Squares With A Timeout:
+//
+//     ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+//     defer cancel()
+//
+//     model := NewLeastSquares(base.StochasticGD, .0001, 0, 0, nil, nil, 4)
+//
+//     err := model.OnlineLearnContext(ctx, stream, base.OnlineOptions{
+//         OnUpdate: func(theta [][]float64) {
+//             // persist theta[0] somewhere
+//         },
+//         CallbackBuffer: 100,
+//         DropUpdates:    true,
+//         OnError: func(err error) {
+//             log.Printf("skipped a point: %v", err)
+//         },
+//     })
+//     if err != nil {
+//         // the context timed out before stream
+//         // was closed
+//     }
+//
+//     fmt.Printf("learned from %v points\n", model.Stats().Seen)
+func (l *LeastSquares) OnlineLearnContext(ctx context.Context, dataset <-chan base.Datapoint, opts base.OnlineOptions) error {
 	if dataset == nil {
-		errors <- fmt.Errorf("ERROR: Attempting to learn with a nil data stream!\n")
-		close(errors)
-		return
+		return fmt.Errorf("ERROR: Attempting to learn with a nil data stream!\n")
 	}
 
 	fmt.Fprintf(l.Output, "Training:\n\tModel: Ordinary Least Squares Regression\n\tOptimization Method: Online Stochastic Gradient Descent\n\tFeatures: %v\n\tLearning Rate α: %v\n...\n\n", len(l.Parameters), l.alpha)
 
-	var point base.Datapoint
-	var more bool
+	err := l.online.CopyOnWrite(opts.CopyOnWrite, [][]float64{append([]float64{}, l.Parameters...)}, func(latest interface{}) {
+		l.Parameters = latest.([][]float64)[0]
+	}, func() error {
+		return base.LearnOnline(ctx, dataset, opts, &l.online.OnlineCounters, func(point base.Datapoint) ([][]float64, error) {
+			return l.onlineStep(point, opts.CopyOnWrite)
+		})
+	})
 
-	for {
-		point, more = <-dataset
+	if err != nil {
+		fmt.Fprintf(l.Output, "\nERROR: Error while learning –\n\t%v\n\n", err)
+		return err
+	}
 
-		if more {
-			if len(point.Y) != 1 {
-				errors <- fmt.Errorf("ERROR: point.Y must have a length of 1. Point: %v", point)
-			}
+	fmt.Fprintf(l.Output, "Training Completed.\n%v\n\n", l)
+	return nil
+}
 
-			newTheta := make([]float64, len(l.Parameters))
-			for j := range l.Parameters {
-
-				// find the gradient using the point
-				// from the channel (different than
-				// calling from the dataset so we need
-				// to have a new function instead of calling
-				// Dij(i, j))
-				dj, err := func(point base.Datapoint, j int) (float64, error) {
-
-					prediction, err := l.Predict(point.X)
-					if err != nil {
-						return 0, err
-					}
-
-					// account for constant term
-					// x is x[i][j] via Andrew Ng's terminology
-					var x float64
-					if j == 0 {
-						x = 1
-					} else {
-						x = point.X[j-1]
-					}
-
-					var gradient float64
-					gradient = (point.Y[0]-prediction[0]) * x
-
-					// add in the regularization term
-					// λ*θ[j]
-					//
-					// notice that we don't count the
-					// constant term
-					if j != 0 {
-						gradient += l.regularization * l.Parameters[j]
-					}
-
-					return gradient, nil
-				}(point, j)
-				if err != nil {
-					errors <- err
-					continue
-				}
-
-				newTheta[j] = l.Parameters[j] + (l.alpha*dj)
-			}
+// Stats returns how many points the model has seen
+// while learning online, how many times theta was
+// updated, and how many points caused an error.
+func (l *LeastSquares) Stats() base.OnlineStats {
+	return l.online.Stats()
+}
 
-			// now simultaneously update Theta
-			for j := range l.Parameters {
-				newθ := newTheta[j]
-				if math.IsInf(newθ, 0) || math.IsNaN(newθ) {
-					errors <- fmt.Errorf("Sorry! Learning diverged. Some value of the parameter vector theta is ±Inf or NaN")
-					continue
-				}
-				l.Parameters[j] = newθ
-			}
+// theta returns the parameter vector Predict should
+// use: the latest snapshot while learning online with
+// copy on write, and Parameters otherwise.
+func (l *LeastSquares) theta() []float64 {
+	if params := l.online.Load(); params != nil {
+		return params[0]
+	}
 
-			go onUpdate([][]float64{l.Parameters})
+	return l.Parameters
+}
 
+// onlineStep takes a single step of Stochastic Gradient
+// Descent using point, returning the new theta. With
+// copyOnWrite the new theta is stored as a snapshot
+// instead of being copied into Parameters.
+func (l *LeastSquares) onlineStep(point base.Datapoint, copyOnWrite bool) ([][]float64, error) {
+	if len(point.Y) != 1 {
+		return nil, fmt.Errorf("ERROR: point.Y must have a length of 1. Point: %v", point)
+	}
+
+	// find the gradient using the point
+	// from the channel (different than
+	// calling from the dataset so we need
+	// to have a new function instead of calling
+	// Dij(i, j))
+	prediction, err := l.Predict(point.X)
+	if err != nil {
+		return nil, err
+	}
+
+	theta := l.theta()
+	newTheta := make([]float64, len(theta))
+	for j := range theta {
+		// account for constant term
+		// x is x[i][j] via Andrew Ng's terminology
+		var x float64
+		if j == 0 {
+			x = 1
 		} else {
-			fmt.Fprintf(l.Output, "Training Completed.\n%v\n\n", l)
-			close(errors)
-			return
+			x = point.X[j-1]
+		}
+
+		gradient := (point.Y[0] - prediction[0]) * x
+
+		// add in the regularization term
+		// λ*θ[j]
+		//
+		// notice that we don't count the
+		// constant term
+		if j != 0 {
+			gradient += l.regularization * theta[j]
 		}
+
+		newTheta[j] = theta[j] + l.alpha*gradient
+		if math.IsInf(newTheta[j], 0) || math.IsNaN(newTheta[j]) {
+			return nil, fmt.Errorf("Sorry! Learning diverged. Some value of the parameter vector theta is ±Inf or NaN")
+		}
+	}
+
+	// now simultaneously update Theta
+	if copyOnWrite {
+		l.online.Store([][]float64{newTheta})
+	} else {
+		copy(l.Parameters, newTheta)
 	}
+
+	return [][]float64{newTheta}, nil
 }
 
 // String implements the fmt interface for clean printing. Here
@@ -1,6 +1,7 @@
 package linear
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"os"
@@ -495,6 +496,140 @@ func TestOnlineLinearOneDXShouldFail3(t *testing.T) {
 	assert.NotNil(t, err, "Learning error should not be nil")
 }
 
+func TestOnlineLinearContextShouldPass1(t *testing.T) {
+	stream := make(chan base.Datapoint, 100)
+
+	model := NewLeastSquares(base.StochasticGD, .0001, 0, 0, nil, nil, 1)
+
+	go func() {
+		for iter := 0; iter < 100; iter++ {
+			for i := -40.0; i < 40; i += 0.5 {
+				stream <- base.Datapoint{
+					X: []float64{i},
+					Y: []float64{i/10 + 20},
+				}
+			}
+		}
+
+		// one point of the wrong dimension
+		stream <- base.Datapoint{
+			X: []float64{1, 2},
+			Y: []float64{3},
+		}
+
+		close(stream)
+	}()
+
+	var snapshots [][][]float64
+	var errs []error
+	err := model.OnlineLearnContext(context.Background(), stream, base.OnlineOptions{
+		OnUpdate: func(theta [][]float64) {
+			snapshots = append(snapshots, theta)
+		},
+		OnError: func(err error) {
+			errs = append(errs, err)
+		},
+	})
+	assert.Nil(t, err, "Learning error should be nil")
+
+	stats := model.Stats()
+	assert.Equal(t, int64(16001), stats.Seen, "Every point should be counted")
+	assert.Equal(t, int64(16000), stats.Updates, "Every valid point should update theta")
+	assert.Equal(t, int64(1), stats.Errors, "The bad point should be counted")
+	assert.Len(t, errs, 1, "The bad point should be reported")
+
+	assert.Len(t, snapshots, 16000, "The callback should be called for every update")
+	assert.NotEqual(t, snapshots[0], snapshots[len(snapshots)-1], "Each update should get its own copy of theta")
+	assert.Equal(t, model.Parameters, snapshots[len(snapshots)-1][0], "The last update should match the final theta")
+}
+
+func TestOnlineLinearContextShouldFail1(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := make(chan base.Datapoint)
+
+	model := NewLeastSquares(base.StochasticGD, .0001, 0, 0, nil, nil, 1)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- model.OnlineLearnContext(ctx, stream, base.OnlineOptions{})
+	}()
+
+	stream <- base.Datapoint{X: []float64{1}, Y: []float64{2}}
+	cancel()
+
+	// the stream is never closed
+	err := <-done
+	assert.Equal(t, context.Canceled, err, "Learning should stop when the context is cancelled")
+	assert.Equal(t, int64(1), model.Stats().Seen, "The point before cancelling should be counted")
+
+	err = model.OnlineLearnContext(context.Background(), nil, base.OnlineOptions{})
+	assert.NotNil(t, err, "Learning with a nil stream should return an error")
+}
+
+// Predict should be safe to call from other goroutines
+// while learning with copy on write (run with -race)
+func TestOnlineLinearCopyOnWriteShouldPass1(t *testing.T) {
+	stream := make(chan base.Datapoint, 100)
+
+	model := NewLeastSquares(base.StochasticGD, .0001, 0, 0, nil, nil, 1)
+	initial := model.Parameters
+
+	go func() {
+		for iter := 0; iter < 50; iter++ {
+			for i := -40.0; i < 40; i += 0.5 {
+				stream <- base.Datapoint{
+					X: []float64{i},
+					Y: []float64{i/10 + 20},
+				}
+			}
+		}
+
+		close(stream)
+	}()
+
+	done := make(chan struct{})
+	predictErrors := make(chan error, 4)
+	for g := 0; g < 4; g++ {
+		go func() {
+			for {
+				select {
+				case <-done:
+					predictErrors <- nil
+					return
+				default:
+				}
+
+				_, err := model.Predict([]float64{10})
+				if err != nil {
+					predictErrors <- err
+					return
+				}
+			}
+		}()
+	}
+
+	var last [][]float64
+	err := model.OnlineLearnContext(context.Background(), stream, base.OnlineOptions{
+		OnUpdate: func(theta [][]float64) {
+			last = theta
+		},
+		CopyOnWrite: true,
+	})
+	close(done)
+
+	assert.Nil(t, err, "Learning error should be nil")
+	for g := 0; g < 4; g++ {
+		assert.Nil(t, <-predictErrors, "Prediction error should be nil")
+	}
+
+	assert.Equal(t, []float64{0, 0}, initial, "The old theta should never be written to")
+	assert.Equal(t, last[0], model.Parameters, "Parameters should hold the final theta after learning")
+
+	guess, err := model.Predict([]float64{1})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.InDelta(t, model.Parameters[0]+model.Parameters[1], guess[0], 1e-12, "Predict should use Parameters after learning")
+}
+
 func TestOnlineLinearFourDXShouldPass1(t *testing.T) {
 	// create the channel of data and errors
 	stream := make(chan base.Datapoint, 100)
@@ -610,3 +745,18 @@ func TestPersistLeastSquaresShouldPass1(t *testing.T) {
 		assert.Nil(t, err, "Prediction error should be nil")
 	}
 }
+
+// Predict with normalize=true shouldn't touch
+// the caller's input
+func TestPredictNormalizedDoesNotMutateShouldPass1(t *testing.T) {
+	model := NewLeastSquares(base.BatchGD, .01, 0, 800, flatX, flatY)
+
+	err := model.Learn()
+	assert.Nil(t, err, "Learning error should be nil")
+
+	x := []float64{3, 4, 12}
+	guess, err := model.Predict(x, true)
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Len(t, guess, 1, "Length of a LeastSquares model output from the hypothesis should always be a 1 dimensional vector. Never multidimensional.")
+	assert.Equal(t, []float64{3, 4, 12}, x, "Input to Predict should not be modified when normalizing")
+}
@@ -229,7 +229,7 @@ func (l *LocalLinear) Predict(x []float64, normalize ...bool) ([]float64, error)
 
 	norm := len(normalize) != 0 && normalize[0]
 	if norm {
-		base.NormalizePoint(x)
+		x = base.NormalizedPoint(x)
 	}
 
 	if l.trainingSet == nil || l.expectedResults == nil {
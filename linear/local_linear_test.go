@@ -110,3 +110,23 @@ func TestLocalLinearShouldPass2(t *testing.T) {
 	assert.True(t, avgError < 0.4, "Average error should be less than 0.4 from the expected value of the linear data (currently %v)", avgError)
 	fmt.Printf("Average Error: %v\n\tPoints Tested: %v\n\tTotal Error: %v\n", avgError, count, err)
 }
+
+// Predict with normalize=true shouldn't touch
+// the caller's input
+func TestLocalLinearDoesNotMutateShouldPass1(t *testing.T) {
+	x := [][]float64{}
+	y := []float64{}
+	for i := -5.0; i < 5; i++ {
+		for j := -5.0; j < 5; j++ {
+			x = append(x, []float64{i, j})
+			y = append(y, i-j)
+		}
+	}
+
+	model := NewLocalLinear(base.BatchGD, 1e-4, 0, 0.75, 50, x, y)
+
+	point := []float64{3, 4}
+	_, err := model.Predict(point, true)
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, []float64{3, 4}, point, "Input to Predict should not be modified when normalizing")
+}
@@ -340,6 +340,25 @@ func TestTwoDimensionalPlaneShouldPass1(t *testing.T) {
 	}
 }
 
+func TestLogisticPredictProbaShouldPass1(t *testing.T) {
+	model := NewLogistic(base.BatchGD, .1, 0, 4000, twoDX, twoDY)
+	err := model.Learn()
+	assert.Nil(t, err, "Learning error should be nil")
+
+	for i := -40; i < 20; i += 3 {
+		guess, err := model.Predict([]float64{float64(i)})
+		assert.Nil(t, err, "Prediction error should be nil")
+
+		proba, err := model.PredictProba([]float64{float64(i)})
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.InDeltaSlice(t, []float64{1 - guess[0], guess[0]}, proba, 1e-12, "Probabilities should be P(y=0) and P(y=1)")
+	}
+
+	regression := NewLeastSquares(base.BatchGD, .1, 0, 4000, twoDX, twoDY)
+	_, err = regression.PredictProba([]float64{1})
+	assert.NotNil(t, err, "PredictProba on a regression model should return an error")
+}
+
 // same as above but with StochasticGD
 func TestTwoDimensionalPlaneShouldPass2(t *testing.T) {
 	var err error
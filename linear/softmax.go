@@ -2,6 +2,7 @@ package linear
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -60,6 +61,12 @@ type Softmax struct {
 	// Output is the io.Writer used for logging
 	// and printing. Defaults to os.Stdout.
 	Output io.Writer
+
+	// online counts the points seen while
+	// learning online, and holds theta while
+	// learning with copy on write, so Predict
+	// can be called from other goroutines
+	online base.OnlineState
 }
 
 func abs(x float64) float64 {
@@ -162,12 +169,13 @@ func (s *Softmax) MaxIterations() int {
 // finds the value of the hypothesis function given the
 // current parameter vector θ
 func (s *Softmax) Predict(x []float64, normalize ...bool) ([]float64, error) {
-	if len(s.Parameters) != 0 && len(x)+1 != len(s.Parameters[0]) {
-		return nil, fmt.Errorf("Error: Parameter vector should be 1 longer than input vector!\n\tLength of x given: %v\n\tLength of parameters: %v (len(theta[0]) = %v)\n", len(x), len(s.Parameters), len(s.Parameters[0]))
+	theta := s.theta()
+	if len(theta) != 0 && len(x)+1 != len(theta[0]) {
+		return nil, fmt.Errorf("Error: Parameter vector should be 1 longer than input vector!\n\tLength of x given: %v\n\tLength of parameters: %v (len(theta[0]) = %v)\n", len(x), len(theta), len(theta[0]))
 	}
 
 	if len(normalize) != 0 && normalize[0] {
-		base.NormalizePoint(x)
+		x = base.NormalizedPoint(x)
 	}
 
 	result := make([]float64, s.k)
@@ -175,10 +183,10 @@ func (s *Softmax) Predict(x []float64, normalize ...bool) ([]float64, error) {
 
 	for i := 0; i < s.k; i++ {
 		// include constant term in sum
-		sum := s.Parameters[i][0]
+		sum := theta[i][0]
 
 		for j := range x {
-			sum += x[j] * s.Parameters[i][j+1]
+			sum += x[j] * theta[i][j+1]
 		}
 
 		result[i] = math.Exp(sum)
@@ -192,6 +200,14 @@ func (s *Softmax) Predict(x []float64, normalize ...bool) ([]float64, error) {
 	return result, nil
 }
 
+// PredictProba returns the probabilities of x being in
+// each of the k classes, which is exactly what Predict
+// returns. It's here so Softmax can be used wherever
+// any other classifier's probabilities are.
+func (s *Softmax) PredictProba(x []float64, normalize ...bool) ([]float64, error) {
+	return s.Predict(x, normalize...)
+}
+
 // Learn takes the struct's dataset and expected results and runs
 // gradient descent on them, optimizing theta so you can
 // predict accurately based on those results
@@ -323,8 +339,10 @@ func (s *Softmax) Learn() error {
 // vector theta is changed, so you are able to persist the
 // model with the most up to date vector at all times (you
 // could persist to a database within the callback, for
-// example.) Don't worry about it taking too long and blocking,
-// because the callback is spawned into another goroutine.
+// example.) The callback gets its own copy of theta, and
+// is called from a single goroutine one update at a time,
+// so a slow callback won't pile up goroutines. If it falls
+// too far behind, learning waits for it to catch up.
 //
 // NOTE that this function is suggested to run in it's own
 // goroutine, or at least is designed as such.
@@ -423,102 +441,159 @@ func (s *Softmax) OnlineLearn(errors chan error, dataset chan base.Datapoint, on
 	if errors == nil {
 		errors = make(chan error)
 	}
+	defer close(errors)
+
+	err := s.OnlineLearnContext(context.Background(), dataset, base.OnlineOptions{
+		Normalize:      len(normalize) != 0 && normalize[0],
+		OnUpdate:       onUpdate,
+		CallbackBuffer: base.DefaultCallbackBuffer,
+		OnError: func(err error) {
+			errors <- err
+		},
+	})
+	if err != nil {
+		errors <- err
+	}
+}
+
+// OnlineLearnContext learns from dataset just like
+// OnlineLearn, but it stops when ctx is done (returning
+// ctx.Err()) as well as when dataset is closed (returning
+// nil), and it takes its callbacks through opts instead of
+// channels. See base.OnlineOptions for how OnUpdate is
+// called; every call gets its own copy of theta.
+//
+// A point which makes learning diverge is reported to
+// opts.OnError and skipped.
+func (s *Softmax) OnlineLearnContext(ctx context.Context, dataset <-chan base.Datapoint, opts base.OnlineOptions) error {
 	if dataset == nil {
-		errors <- fmt.Errorf("ERROR: Attempting to learn with a nil data stream!\n")
-		close(errors)
-		return
+		return fmt.Errorf("ERROR: Attempting to learn with a nil data stream!\n")
 	}
 
 	fmt.Fprintf(s.Output, "Training:\n\tModel: Softmax Classifier (%v classes)\n\tOptimization Method: Online Stochastic Gradient Descent\n\tFeatures: %v\n\tLearning Rate α: %v\n...\n\n", s.k, len(s.Parameters), s.alpha)
 
-	norm := len(normalize) != 0 && normalize[0]
-	var point base.Datapoint
-	var more bool
+	err := s.online.CopyOnWrite(opts.CopyOnWrite, copyTheta(s.Parameters), func(latest interface{}) {
+		s.Parameters = latest.([][]float64)
+	}, func() error {
+		return base.LearnOnline(ctx, dataset, opts, &s.online.OnlineCounters, func(point base.Datapoint) ([][]float64, error) {
+			return s.onlineStep(point, opts.CopyOnWrite)
+		})
+	})
 
-	for {
-		point, more = <-dataset
+	if err != nil {
+		fmt.Fprintf(s.Output, "\nERROR: Error while learning –\n\t%v\n\n", err)
+		return err
+	}
 
-		if more {
-			if len(point.Y) != 1 {
-				errors <- fmt.Errorf("ERROR: point.Y must have a length of 1. Point: %v", point)
-				continue
-			}
+	fmt.Fprintf(s.Output, "Training Completed.\n%v\n\n", s)
+	return nil
+}
 
-			if norm {
-				base.NormalizePoint(point.X)
-			}
+// Stats returns how many points the model has seen
+// while learning online, how many times theta was
+// updated, and how many points caused an error.
+func (s *Softmax) Stats() base.OnlineStats {
+	return s.online.Stats()
+}
 
-			// go over each parameter vector for each
-			// classification value
-			for k, theta := range s.Parameters {
-				dj, err := func(point base.Datapoint, j int) ([]float64, error) {
-					grad := make([]float64, len(s.Parameters[0]))
+// theta returns the parameter vectors Predict should
+// use: the latest snapshot while learning online with
+// copy on write, and Parameters otherwise.
+func (s *Softmax) theta() [][]float64 {
+	if params := s.online.Load(); params != nil {
+		return params
+	}
 
-					// account for constant term
-					x := append([]float64{1}, point.X...)
+	return s.Parameters
+}
 
-					var ident float64
-					if abs(point.Y[0]-float64(k)) < 1e-3 {
-						ident = 1
-					}
+// copyTheta returns a deep copy of theta.
+func copyTheta(theta [][]float64) [][]float64 {
+	copied := make([][]float64, len(theta))
+	for i := range theta {
+		copied[i] = append([]float64{}, theta[i]...)
+	}
 
-					var numerator float64
-					var denom float64
-					for a := 0; a < s.k; a++ {
-						var inside float64
+	return copied
+}
 
-						// calculate theta * x
-						for l, val := range s.Parameters[int(k)] {
-							inside += val * x[l]
-						}
+// onlineStep takes a single step of Stochastic Gradient
+// Descent using point, returning the new theta. With
+// copyOnWrite a copy of theta is updated and stored as
+// a snapshot instead of updating Parameters in place.
+func (s *Softmax) onlineStep(point base.Datapoint, copyOnWrite bool) ([][]float64, error) {
+	if len(point.Y) != 1 {
+		return nil, fmt.Errorf("ERROR: point.Y must have a length of 1. Point: %v", point)
+	}
 
-						if a == k {
-							numerator = math.Exp(inside)
-						}
+	parameters := s.theta()
+	if copyOnWrite {
+		parameters = copyTheta(parameters)
+	}
 
-						denom += math.Exp(inside)
-					}
+	if len(point.X)+1 != len(parameters[0]) {
+		return nil, fmt.Errorf("ERROR: Given point doesn't have the same dimension as the model! Point: %v", point)
+	}
 
-					for a := range grad {
-						grad[a] += x[a] * (ident - numerator/denom)
-					}
+	// account for constant term
+	x := append([]float64{1}, point.X...)
 
-					// add in the regularization term
-					// λ*θ[j]
-					//
-					// notice that we don't count the
-					// constant term
-					for j := range grad {
-						grad[j] += s.regularization * s.Parameters[k][j]
-					}
+	// go over each parameter vector for each
+	// classification value
+	for k, theta := range parameters {
+		grad := make([]float64, len(theta))
 
-					return grad, nil
-				}(point, k)
-				if err != nil {
-					errors <- err
-					return
-				}
+		var ident float64
+		if abs(point.Y[0]-float64(k)) < 1e-3 {
+			ident = 1
+		}
 
-				// now simultaneously update theta
-				for j := range theta {
-					newθ := theta[j] + s.alpha*dj[j]
-					if math.IsInf(newθ, 0) || math.IsNaN(newθ) {
-						errors <- fmt.Errorf("Sorry dude! Learning diverged. Some value of the parameter vector theta is ±Inf or NaN")
-						close(errors)
-						return
-					}
-					s.Parameters[k][j] = newθ
-				}
+		var numerator float64
+		var denom float64
+		for a := 0; a < s.k; a++ {
+			var inside float64
+
+			// calculate theta * x
+			for l, val := range parameters[int(k)] {
+				inside += val * x[l]
+			}
+
+			if a == k {
+				numerator = math.Exp(inside)
 			}
 
-			go onUpdate(s.Parameters)
+			denom += math.Exp(inside)
+		}
 
-		} else {
-			fmt.Fprintf(s.Output, "Training Completed.\n%v\n\n", s)
-			close(errors)
-			return
+		for a := range grad {
+			grad[a] += x[a] * (ident - numerator/denom)
 		}
+
+		// add in the regularization term
+		// λ*θ[j]
+		//
+		// notice that we don't count the
+		// constant term
+		for j := range grad {
+			grad[j] += s.regularization * theta[j]
+		}
+
+		// now simultaneously update theta
+		newTheta := make([]float64, len(theta))
+		for j := range theta {
+			newTheta[j] = theta[j] + s.alpha*grad[j]
+			if math.IsInf(newTheta[j], 0) || math.IsNaN(newTheta[j]) {
+				return nil, fmt.Errorf("Sorry dude! Learning diverged. Some value of the parameter vector theta is ±Inf or NaN")
+			}
+		}
+		copy(parameters[k], newTheta)
 	}
+
+	if copyOnWrite {
+		s.online.Store(parameters)
+	}
+
+	return parameters, nil
 }
 
 // String implements the fmt interface for clean printing. Here
@@ -440,6 +440,28 @@ func TestTwoDimensionalSoftmaxShouldPass1(t *testing.T) {
 	assert.True(t, float64(incorrect)/float64(count) < 0.35, "Accuracy should be greater than 65% (this is a more challenging model)")
 }
 
+func TestSoftmaxPredictProbaShouldPass1(t *testing.T) {
+	model := NewSoftmax(base.BatchGD, .0001, 0, 5, 10, bdx, bdy)
+	err := model.Learn()
+	assert.Nil(t, err, "Learning error should be nil")
+
+	var classifier base.ProbabilisticClassifier = model
+
+	proba, err := classifier.PredictProba([]float64{0.5})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Len(t, proba, 5, "There should be a probability for each class")
+
+	guess, err := model.Predict([]float64{0.5})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, guess, proba, "PredictProba should be the same as Predict")
+
+	var sum float64
+	for i := range proba {
+		sum += proba[i]
+	}
+	assert.InDelta(t, 1, sum, 1e-9, "Probabilities should add up to 1")
+}
+
 // same as above but with StochasticGD
 func TestTwoDimensionalSoftmaxShouldPass2(t *testing.T) {
 	var err error
@@ -989,3 +1011,32 @@ func TestPersistSoftmaxShouldPass1(t *testing.T) {
 	fmt.Printf("Predictions: %v\n\tIncorrect: %v\n\tAccuracy Rate: %v percent\n", count, incorrect, 100*(1.0-float64(incorrect)/float64(count)))
 	assert.True(t, float64(incorrect)/float64(count) < 0.14, "Accuracy should be greater than 86%")
 }
+
+// normalizing while learning online or predicting
+// shouldn't touch the caller's slices
+func TestSoftmaxDoesNotMutateShouldPass1(t *testing.T) {
+	stream := make(chan base.Datapoint, 10)
+	errors := make(chan error)
+
+	model := NewSoftmax(base.StochasticGD, 1e-3, 0, 3, 0, nil, nil, 2)
+
+	x := []float64{3, 4}
+	stream <- base.Datapoint{X: x, Y: []float64{2}}
+	close(stream)
+
+	go model.OnlineLearn(errors, stream, func(theta [][]float64) {}, true)
+
+	for {
+		err, more := <-errors
+		if !more {
+			break
+		}
+		assert.Nil(t, err, "Learning error should be nil")
+	}
+	assert.Equal(t, []float64{3, 4}, x, "Input datapoint should not be modified when normalizing")
+
+	y := []float64{6, 8}
+	_, err := model.Predict(y, true)
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, []float64{6, 8}, y, "Input to Predict should not be modified when normalizing")
+}
@@ -557,3 +557,21 @@ func TestSparsePersistLeastSquaresShouldPass1(t *testing.T) {
 		assert.Nil(t, err, "Prediction error should be nil")
 	}
 }
+
+// Predict and PredictSparse with normalize=true
+// shouldn't touch the caller's input
+func TestSparseLeastSquaresDoesNotMutateShouldPass1(t *testing.T) {
+	model := NewSparseLeastSquares(base.BatchGD, .01, 0.1, 0, base.L2, 800, sparseFlatX, flatY, len(sparseFlatX[0]))
+
+	err := model.Learn("")
+	assert.Nil(t, err, "Learning error should be nil")
+
+	x := []float64{3, 4, 12}
+	_, err = model.Predict(x, true)
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, []float64{3, 4, 12}, x, "Input to Predict should not be modified when normalizing")
+
+	sparse := map[int]float64{0: 3, 1: 4, 2: 12}
+	model.PredictSparse(sparse, true)
+	assert.Equal(t, map[int]float64{0: 3, 1: 4, 2: 12}, sparse, "Input to PredictSparse should not be modified when normalizing")
+}
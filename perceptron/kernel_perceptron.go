@@ -1,6 +1,7 @@
 package perceptron
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -54,9 +55,22 @@ type KernelPerceptron struct {
 
 	Kernel func([]float64, []float64) float64
 
+	// Platt turns the decision value into the
+	// probability PredictProba returns. It's set by
+	// Calibrate, and if it's nil the probability is
+	// just the sigmoid of the decision value, which
+	// isn't calibrated.
+	Platt *base.Platt `json:"platt,omitempty"`
+
 	// Output is the io.Writer used for logging
 	// and printing. Defaults to os.Stdout.
 	Output io.Writer
+
+	// online counts the points seen while
+	// learning online, and holds the support vectors while
+	// learning with copy on write, so Predict
+	// can be called from other goroutines
+	online base.OnlineState
 }
 
 // NewKernelPerceptron takes in a learning rate alpha, the
@@ -87,13 +101,9 @@ func NewKernelPerceptron(kernel func([]float64, []float64) float64) *KernelPerce
 // finds the value of the hypothesis function given the
 // current parameter vector θ
 func (p *KernelPerceptron) Predict(x []float64, normalize ...bool) ([]float64, error) {
-	if len(normalize) != 0 && normalize[0] {
-		base.NormalizePoint(x)
-	}
-
-	var sum float64
-	for i := range p.SV {
-		sum += p.SV[i].Y[0] * p.Kernel(p.SV[i].X, x)
+	sum, err := p.Decision(x, normalize...)
+	if err != nil {
+		return nil, err
 	}
 
 	result := -1.0
@@ -104,6 +114,74 @@ func (p *KernelPerceptron) Predict(x []float64, normalize ...bool) ([]float64, e
 	return []float64{result}, nil
 }
 
+// Decision returns the raw decision value
+// Σ y[i]*K(x[i], x) of the input x. Predict guesses 1
+// when it's positive, and the further it is from 0
+// the more confident the model is.
+func (p *KernelPerceptron) Decision(x []float64, normalize ...bool) (float64, error) {
+	if len(normalize) != 0 && normalize[0] {
+		x = base.NormalizedPoint(x)
+	}
+
+	sv := p.supportVectors()
+
+	var sum float64
+	for i := range sv {
+		sum += sv[i].Y[0] * p.Kernel(sv[i].X, x)
+	}
+
+	return sum, nil
+}
+
+// PredictProba returns the probabilities of x being in
+// each class, as []float64{P(y = -1), P(y = 1)}.
+//
+// Call Calibrate first with data the model didn't
+// learn from, or the probabilities are just the
+// sigmoid of the decision value, which says which way
+// the model leans but not how likely it is to be right.
+func (p *KernelPerceptron) PredictProba(x []float64, normalize ...bool) ([]float64, error) {
+	sum, err := p.Decision(x, normalize...)
+	if err != nil {
+		return nil, err
+	}
+
+	platt := p.Platt
+	if platt == nil {
+		platt = base.NewPlatt()
+	}
+
+	positive := platt.Probability(sum)
+	return []float64{1 - positive, positive}, nil
+}
+
+// Calibrate fits the Platt scaling PredictProba uses
+// to the model's decision values on x, a held out
+// dataset with labels y (where labels greater than 0
+// are the positive class.)
+func (p *KernelPerceptron) Calibrate(x [][]float64, y []float64, normalize ...bool) error {
+	if len(x) == 0 || len(x) != len(y) {
+		return fmt.Errorf("ERROR: calibration set (either x or y or both) has no examples or the lengths of the dataset don't match\n\tlength of x: %v\n\tlength of y: %v\n", len(x), len(y))
+	}
+
+	decisions := make([]float64, len(x))
+	for i := range x {
+		sum, err := p.Decision(x[i], normalize...)
+		if err != nil {
+			return err
+		}
+		decisions[i] = sum
+	}
+
+	platt, err := base.FitPlatt(decisions, y)
+	if err != nil {
+		return err
+	}
+
+	p.Platt = platt
+	return nil
+}
+
 // OnlineLearn runs off of the datastream within the Perceptron
 // structure. Whenever the model makes a wrong prediction
 // the parameter vector theta is updated to reflect that,
@@ -130,9 +208,10 @@ func (p *KernelPerceptron) Predict(x []float64, normalize ...bool) ([]float64, e
 // your choosing and you'd like to update it
 // constantly.
 //
-// This will be spawned into a new goroutine, so
-// don't worry about the function taking a long
-// time, or blocking.
+// It's passed its own copy, and called from a
+// single goroutine one update at a time, so a
+// slow callback won't pile up goroutines. If it
+// falls too far behind, learning waits for it.
 //
 // If you want to monitor errors happening within
 // this function, just have a channel of errors
@@ -214,65 +293,114 @@ func (p *KernelPerceptron) Predict(x []float64, normalize ...bool) ([]float64, e
 //         panic("AAAARGGGH! SHIVER ME TIMBERS! THESE ROTTEN SCOUNDRELS FOUND AN ERROR!!!")
 //     }
 func (p *KernelPerceptron) OnlineLearn(errors chan error, dataset chan base.Datapoint, onUpdate func([][]float64), normalize ...bool) {
-	if dataset == nil {
-		errors <- fmt.Errorf("ERROR: Attempting to learn with a nil data stream!\n")
-		close(errors)
-		return
-	}
-
 	if errors == nil {
 		errors = make(chan error)
 	}
+	defer close(errors)
+
+	err := p.OnlineLearnContext(context.Background(), dataset, base.OnlineOptions{
+		Normalize:      len(normalize) != 0 && normalize[0],
+		OnUpdate:       onUpdate,
+		CallbackBuffer: base.DefaultCallbackBuffer,
+		OnError: func(err error) {
+			errors <- err
+		},
+	})
+	if err != nil {
+		errors <- err
+	}
+}
+
+// OnlineLearnContext learns from dataset just like
+// OnlineLearn, but it stops when ctx is done (returning
+// ctx.Err()) as well as when dataset is closed (returning
+// nil), and it takes its callbacks through opts instead of
+// channels. See base.OnlineOptions for how OnUpdate is
+// called. OnUpdate is passed each new support vector
+// (with its label appended), as its own copy.
+func (p *KernelPerceptron) OnlineLearnContext(ctx context.Context, dataset <-chan base.Datapoint, opts base.OnlineOptions) error {
+	if dataset == nil {
+		return fmt.Errorf("ERROR: Attempting to learn with a nil data stream!\n")
+	}
 
 	fmt.Fprintf(p.Output, "Training:\n\tModel: Kernel Perceptron Classifier\n\tOptimization Method: Online Kernel Perceptron\n...\n\n")
 
-	norm := len(normalize) != 0 && normalize[0]
-
-	var point base.Datapoint
-	var more bool
-
-	for {
-		point, more = <-dataset
-
-		if more {
-			// have a datapoint, predict and update!
-			//
-			// Predict also checks if the point is of the
-			// correct dimensions
-			if norm {
-				base.NormalizePoint(point.X)
-			}
-
-			guess, err := p.Predict(point.X)
-			if err != nil {
-				// send the error channel some info and
-				// skip this datapoint
-				errors <- err
-				continue
-			}
-
-			if len(point.Y) != 1 {
-				errors <- fmt.Errorf("The binary perceptron model requires that the data results (y) have length 1 - given %v", len(point.Y))
-				continue
-			}
-
-			// update the parameters if the guess
-			// is wrong
-			if guess[0] != point.Y[0] {
-				p.SV = append(p.SV, point)
-
-				// call the OnUpdate callback with the new vector
-				// appended to a blank slice so the vector is
-				// passed by value and not by reference
-				go onUpdate([][]float64{append(point.X, point.Y...)})
-			}
-
-		} else {
-			fmt.Fprintf(p.Output, "Training Completed.\n%v\n\n", p)
-			close(errors)
-			return
-		}
+	err := p.online.CopyOnWrite(opts.CopyOnWrite, p.SV[:len(p.SV):len(p.SV)], func(latest interface{}) {
+		p.SV = latest.([]base.Datapoint)
+	}, func() error {
+		return base.LearnOnline(ctx, dataset, opts, &p.online.OnlineCounters, func(point base.Datapoint) ([][]float64, error) {
+			return p.onlineStep(point, opts.CopyOnWrite)
+		})
+	})
+
+	if err != nil {
+		fmt.Fprintf(p.Output, "\nERROR: Error while learning –\n\t%v\n\n", err)
+		return err
 	}
+
+	fmt.Fprintf(p.Output, "Training Completed.\n%v\n\n", p)
+	return nil
+}
+
+// Stats returns how many points the model has seen
+// while learning online, how many support vectors
+// it added, and how many points caused an error.
+func (p *KernelPerceptron) Stats() base.OnlineStats {
+	return p.online.Stats()
+}
+
+// supportVectors returns the support vectors Predict
+// should use: the latest snapshot while learning online
+// with copy on write, and SV otherwise.
+func (p *KernelPerceptron) supportVectors() []base.Datapoint {
+	if sv, _ := p.online.LoadValue().([]base.Datapoint); sv != nil {
+		return sv
+	}
+
+	return p.SV
+}
+
+// onlineStep predicts point, adding it as a support
+// vector (and returning it) only if the guess is wrong.
+// With copyOnWrite the support vectors are copied and
+// stored as a snapshot instead of appended to SV.
+func (p *KernelPerceptron) onlineStep(point base.Datapoint, copyOnWrite bool) ([][]float64, error) {
+	// Predict also checks if the point is of the
+	// correct dimensions
+	guess, err := p.Predict(point.X)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(point.Y) != 1 {
+		return nil, fmt.Errorf("The binary perceptron model requires that the data results (y) have length 1 - given %v", len(point.Y))
+	}
+
+	if guess[0] == point.Y[0] {
+		return nil, nil
+	}
+
+	// store a copy of the point so the caller
+	// reusing their slices can't change the
+	// support vectors out from under the model
+	sv := base.Datapoint{
+		X: append([]float64{}, point.X...),
+		Y: append([]float64{}, point.Y...),
+	}
+	if copyOnWrite {
+		// the full slice expression makes append copy
+		// instead of writing into an array Predict
+		// might be reading
+		current := p.supportVectors()
+		p.online.StoreValue(append(current[:len(current):len(current)], sv))
+	} else {
+		p.SV = append(p.SV, sv)
+	}
+
+	update := make([]float64, 0, len(sv.X)+len(sv.Y))
+	update = append(append(update, sv.X...), sv.Y...)
+
+	return [][]float64{update}, nil
 }
 
 // String implements the fmt interface for clean printing. Here
@@ -288,6 +416,8 @@ func (p *KernelPerceptron) String() string {
 
 // PersistToFile takes in an absolute filepath and saves the
 // parameter vector θ to the file, which can be restored later.
+// The Platt scaling Calibrate fit is saved along with it, so
+// a restored model predicts the same probabilities.
 // The function will take paths from the current directory, but
 // functions
 //
@@ -299,7 +429,10 @@ func (p *KernelPerceptron) PersistToFile(path string) error {
 		return fmt.Errorf("ERROR: you just tried to persist your model to a file with no path!! That's a no-no. Try it with a valid filepath")
 	}
 
-	bytes, err := json.Marshal(p.SV)
+	bytes, err := json.Marshal(persistedKernelPerceptron{
+		SV:    p.SV,
+		Platt: p.Platt,
+	})
 	if err != nil {
 		return err
 	}
@@ -315,6 +448,8 @@ func (p *KernelPerceptron) PersistToFile(path string) error {
 // RestoreFromFile takes in a path to a parameter vector theta
 // and assigns the model it's operating on's parameter vector
 // to that.
+// Files holding just the support vectors (which is all that
+// used to be saved) still restore, with no Platt scaling.
 //
 // The path must ba an absolute path or a path from the current
 // directory
@@ -332,10 +467,26 @@ func (p *KernelPerceptron) RestoreFromFile(path string) error {
 		return err
 	}
 
-	err = json.Unmarshal(bytes, &p.SV)
+	persisted := persistedKernelPerceptron{}
+	if isBareArray(bytes) {
+		err = json.Unmarshal(bytes, &persisted.SV)
+	} else {
+		err = json.Unmarshal(bytes, &persisted)
+	}
 	if err != nil {
 		return err
 	}
 
+	p.SV = persisted.SV
+	p.Platt = persisted.Platt
+
 	return nil
 }
+
+// persistedKernelPerceptron is what PersistToFile
+// saves: the support vectors, and the Platt scaling
+// Calibrate fit (if it was called.)
+type persistedKernelPerceptron struct {
+	SV    []base.Datapoint `json:"support_vectors"`
+	Platt *base.Platt      `json:"platt,omitempty"`
+}
@@ -2,6 +2,8 @@ package perceptron
 
 import (
 	"fmt"
+	"io/ioutil"
+	"math/rand"
 	"os"
 	"testing"
 
@@ -780,3 +782,109 @@ func TestGaussianKernelPersistPerceptronShouldPass1(t *testing.T) {
 	assert.True(t, accuracy > 95, "There should be greater than 95 percent accuracy (currently %v)", accuracy)
 	fmt.Printf("Accuracy: %v\n\tPoints Tested: %v\n\tMisclassifications: %v\n", accuracy, count, wrong)
 }
+
+// the support vectors shouldn't share memory
+// with the datapoints passed on the stream, and
+// normalizing shouldn't touch them either
+func TestKernelPerceptronDoesNotAliasInputShouldPass1(t *testing.T) {
+	stream := make(chan base.Datapoint, 10)
+	errors := make(chan error)
+
+	model := NewKernelPerceptron(base.LinearKernel())
+
+	x := []float64{3, 4}
+	stream <- base.Datapoint{X: x, Y: []float64{1.0}}
+	close(stream)
+
+	go model.OnlineLearn(errors, stream, func(supportVector [][]float64) {}, true)
+
+	for {
+		err, more := <-errors
+		if !more {
+			break
+		}
+		assert.Nil(t, err, "Learning error should be nil")
+	}
+
+	assert.Equal(t, []float64{3, 4}, x, "Input datapoint should not be modified when normalizing")
+	assert.Len(t, model.SV, 1, "Model should have one support vector")
+
+	sv := append([]float64{}, model.SV[0].X...)
+	x[0], x[1] = 100, -100
+	assert.Equal(t, sv, model.SV[0].X, "Support vector should not change when the caller reuses their slice")
+
+	y := []float64{6, 8}
+	_, err := model.Predict(y, true)
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, []float64{6, 8}, y, "Input to Predict should not be modified when normalizing")
+}
+
+func TestKernelPredictProbaShouldPass1(t *testing.T) {
+	model := NewKernelPerceptron(base.LinearKernel())
+	model.SV = []base.Datapoint{{X: []float64{1}, Y: []float64{1}}}
+
+	// uncalibrated probabilities are the sigmoid of the decision value
+	proba, err := model.PredictProba([]float64{0})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.InDeltaSlice(t, []float64{0.5, 0.5}, proba, 1e-12, "A decision value of 0 should be a coin flip")
+
+	for _, x := range []float64{-3, -0.5, 0.5, 3} {
+		proba, err := model.PredictProba([]float64{x})
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.InDelta(t, 1, proba[0]+proba[1], 1e-12, "Probabilities should add up to 1")
+
+		guess, _ := model.Predict([]float64{x})
+		assert.Equal(t, guess[0] == 1, proba[1] > 0.5, "The more likely class should match Predict for x=%v", x)
+	}
+
+	// calibrate on points whose labels are noisy
+	// near the boundary
+	random := rand.New(rand.NewSource(7))
+	x := [][]float64{}
+	y := []float64{}
+	for i := 0; i < 2000; i++ {
+		v := 10 * (random.Float64() - 0.5)
+		x = append(x, []float64{v})
+		if v+random.NormFloat64() > 0 {
+			y = append(y, 1)
+		} else {
+			y = append(y, -1)
+		}
+	}
+
+	err = model.Calibrate(x, y)
+	assert.Nil(t, err, "Calibration error should be nil")
+	assert.NotNil(t, model.Platt, "Calibrating should set the Platt scaling")
+
+	proba, _ = model.PredictProba([]float64{4})
+	assert.True(t, proba[1] > 0.95, "Points far on the positive side should almost surely be positive - Given %v", proba[1])
+
+	proba, _ = model.PredictProba([]float64{0.5})
+	assert.True(t, proba[1] > 0.55 && proba[1] < 0.8, "Points near the boundary should only lean positive - Given %v", proba[1])
+
+	err = model.Calibrate(x, y[1:])
+	assert.NotNil(t, err, "Mismatched calibration data should return an error")
+
+	// the Platt scaling should be persisted with the model
+	err = model.PersistToFile("/tmp/.goml/CalibratedKernelPerceptron.json")
+	assert.Nil(t, err, "Persistence error should be nil")
+
+	restored := NewKernelPerceptron(base.LinearKernel())
+	err = restored.RestoreFromFile("/tmp/.goml/CalibratedKernelPerceptron.json")
+	assert.Nil(t, err, "Restore error should be nil")
+	assert.Equal(t, model.Platt, restored.Platt, "The Platt scaling should be restored")
+	for _, v := range []float64{-4, -0.5, 0.5, 4} {
+		expected, _ := model.PredictProba([]float64{v})
+		proba, err := restored.PredictProba([]float64{v})
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.Equal(t, expected, proba, "The restored model should predict calibrated probabilities")
+	}
+
+	// files from before the Platt scaling was saved
+	// still restore, uncalibrated
+	err = ioutil.WriteFile("/tmp/.goml/CalibratedKernelPerceptron.json", []byte(`[{"x":[1],"y":[1]}]`), os.ModePerm)
+	assert.Nil(t, err, "Write error should be nil")
+	err = restored.RestoreFromFile("/tmp/.goml/CalibratedKernelPerceptron.json")
+	assert.Nil(t, err, "Restoring a bare array should not fail")
+	assert.Nil(t, restored.Platt, "A bare array holds no Platt scaling")
+}
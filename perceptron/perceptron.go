@@ -15,8 +15,9 @@
 // You are given an OnUpdate callback with the
 // Perceptron struct, which is called whenever
 // the model updates it parameter vector. It passes
-// a copy of the new parameter vector as a copy
-// and runs the callback in a new goroutine.
+// a copy of the new parameter vector, and runs
+// the callbacks one at a time in a goroutine of
+// their own.
 // This would let the user persist the model to
 // a database of their choosing in realtime,
 // calling update to a table consistantly within
@@ -92,11 +93,13 @@ package perceptron
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/bountylabs/goml/base"
 )
@@ -144,9 +147,21 @@ type Perceptron struct {
 
 	Parameters []float64 `json:"theta"`
 
+	// Platt turns the decision value θx into the
+	// probability PredictProba returns. It's set by
+	// Calibrate, and if it's nil the probability is
+	// just the sigmoid of θx, which isn't calibrated.
+	Platt *base.Platt `json:"platt,omitempty"`
+
 	// Output is the io.Writer used for logging
 	// and printing. Defaults to os.Stdout.
 	Output io.Writer
+
+	// online counts the points seen while
+	// learning online, and holds theta while
+	// learning with copy on write, so Predict
+	// can be called from other goroutines
+	online base.OnlineState
 }
 
 // NewPerceptron takes in a learning rate alpha, the
@@ -187,27 +202,90 @@ func (p *Perceptron) UpdateLearningRate(a float64) {
 // finds the value of the hypothesis function given the
 // current parameter vector θ
 func (p *Perceptron) Predict(x []float64, normalize ...bool) ([]float64, error) {
-	if len(x)+1 != len(p.Parameters) {
-		return nil, fmt.Errorf("Error: Parameter vector should be 1 longer than input vector!\n\tLength of x given: %v\n\tLength of parameters: %v\n", len(x), len(p.Parameters))
+	sum, err := p.Decision(x, normalize...)
+	if err != nil {
+		return nil, err
+	}
+
+	result := -1.0
+	if sum > 0 {
+		result = 1
+	}
+
+	return []float64{result}, nil
+}
+
+// Decision returns the raw decision value θx of the
+// input x. Predict guesses 1 when it's positive, and
+// the further it is from 0 the more confident the
+// model is.
+func (p *Perceptron) Decision(x []float64, normalize ...bool) (float64, error) {
+	theta := p.theta()
+	if len(x)+1 != len(theta) {
+		return 0, fmt.Errorf("Error: Parameter vector should be 1 longer than input vector!\n\tLength of x given: %v\n\tLength of parameters: %v\n", len(x), len(theta))
 	}
 
 	if len(normalize) != 0 && normalize[0] {
-		base.NormalizePoint(x)
+		x = base.NormalizedPoint(x)
 	}
 
 	// include constant term in sum
-	sum := p.Parameters[0]
+	sum := theta[0]
 
 	for i := range x {
-		sum += x[i] * p.Parameters[i+1]
+		sum += x[i] * theta[i+1]
 	}
 
-	result := -1.0
-	if sum > 0 {
-		result = 1
+	return sum, nil
+}
+
+// PredictProba returns the probabilities of x being in
+// each class, as []float64{P(y = -1), P(y = 1)}.
+//
+// Call Calibrate first with data the model didn't
+// learn from, or the probabilities are just the
+// sigmoid of the decision value, which says which way
+// the model leans but not how likely it is to be right.
+func (p *Perceptron) PredictProba(x []float64, normalize ...bool) ([]float64, error) {
+	sum, err := p.Decision(x, normalize...)
+	if err != nil {
+		return nil, err
 	}
 
-	return []float64{result}, nil
+	platt := p.Platt
+	if platt == nil {
+		platt = base.NewPlatt()
+	}
+
+	positive := platt.Probability(sum)
+	return []float64{1 - positive, positive}, nil
+}
+
+// Calibrate fits the Platt scaling PredictProba uses
+// to the model's decision values on x, a held out
+// dataset with labels y (where labels greater than 0
+// are the positive class.)
+func (p *Perceptron) Calibrate(x [][]float64, y []float64, normalize ...bool) error {
+	if len(x) == 0 || len(x) != len(y) {
+		return fmt.Errorf("ERROR: calibration set (either x or y or both) has no examples or the lengths of the dataset don't match\n\tlength of x: %v\n\tlength of y: %v\n", len(x), len(y))
+	}
+
+	decisions := make([]float64, len(x))
+	for i := range x {
+		sum, err := p.Decision(x[i], normalize...)
+		if err != nil {
+			return err
+		}
+		decisions[i] = sum
+	}
+
+	platt, err := base.FitPlatt(decisions, y)
+	if err != nil {
+		return err
+	}
+
+	p.Platt = platt
+	return nil
 }
 
 // OnlineLearn runs off of the datastream within the Perceptron
@@ -236,9 +314,10 @@ func (p *Perceptron) Predict(x []float64, normalize ...bool) ([]float64, error)
 // your choosing and you'd like to update it
 // constantly.
 //
-// This will be spawned into a new goroutine, so
-// don't worry about the function taking a long
-// time, or blocking.
+// It's passed its own copy, and called from a
+// single goroutine one update at a time, so a
+// slow callback won't pile up goroutines. If it
+// falls too far behind, learning waits for it.
 //
 // If you want to monitor errors happening within
 // this function, just have a channel of errors
@@ -312,70 +391,132 @@ func (p *Perceptron) OnlineLearn(errors chan error, dataset chan base.Datapoint,
 	if errors == nil {
 		errors = make(chan error)
 	}
+	defer close(errors)
+
+	err := p.OnlineLearnContext(context.Background(), dataset, base.OnlineOptions{
+		Normalize:      len(normalize) != 0 && normalize[0],
+		OnUpdate:       onUpdate,
+		CallbackBuffer: base.DefaultCallbackBuffer,
+		OnError: func(err error) {
+			errors <- err
+		},
+	})
+	if err != nil {
+		errors <- err
+	}
+}
+
+// OnlineLearnContext learns from dataset just like
+// OnlineLearn, but it stops when ctx is done (returning
+// ctx.Err()) as well as when dataset is closed (returning
+// nil), and it takes its callbacks through opts instead of
+// channels. See base.OnlineOptions for how OnUpdate is
+// called; every call gets its own copy of theta.
+//
+// Example Online Perceptron Until Cancelled:
+//
+//      ctx, cancel := context.WithCancel(context.Background())
+//
+//      model := NewPerceptron(0.1, 1)
+//      go func() {
+//          err := model.OnlineLearnContext(ctx, stream, base.OnlineOptions{
+//              OnUpdate:       func(theta [][]float64) {},
+//              CallbackBuffer: 10,
+//          })
+//          if err == context.Canceled {
+//              fmt.Printf("stopped after %v points\n", model.Stats().Seen)
+//          }
+//      }()
+//
+//      // ... later, stop learning even though
+//      // stream is still open
+//      cancel()
+func (p *Perceptron) OnlineLearnContext(ctx context.Context, dataset <-chan base.Datapoint, opts base.OnlineOptions) error {
 	if dataset == nil {
-		errors <- fmt.Errorf("ERROR: Attempting to learn with a nil data stream!\n")
-		close(errors)
-		return
+		return fmt.Errorf("ERROR: Attempting to learn with a nil data stream!\n")
 	}
 
 	fmt.Fprintf(p.Output, "Training:\n\tModel: Perceptron Classifier\n\tOptimization Method: Online Perceptron\n\tFeatures: %v\n\tLearning Rate α: %v\n...\n\n", len(p.Parameters), p.alpha)
 
-	norm := len(normalize) != 0 && normalize[0]
-
-	var point base.Datapoint
-	var more bool
-
-	for {
-		point, more = <-dataset
-
-		if more {
-			// have a datapoint, predict and update!
-			//
-			// Predict also checks if the point is of the
-			// correct dimensions
-			if norm {
-				base.NormalizePoint(point.X)
-			}
-
-			guess, err := p.Predict(point.X)
-			if err != nil {
-				// send the error channel some info and
-				// skip this datapoint
-				errors <- err
-				continue
-			}
-
-			if len(point.Y) != 1 {
-				errors <- fmt.Errorf("The binary perceptron model requires that the data results (y) have length 1 - given %v", len(point.Y))
-				continue
-			}
-
-			if len(point.X) != len(p.Parameters)-1 {
-				errors <- fmt.Errorf("The binary perceptron model requires that the length of input data (currently %v) be one less than the length of the parameter vector (%v)", len(point.X), len(p.Parameters))
-				continue
-			}
-
-			// update the parameters if the guess
-			// is wrong
-			if guess[0] != point.Y[0] {
-				p.Parameters[0] += p.alpha * (point.Y[0] - guess[0])
-
-				for i := 1; i < len(p.Parameters); i++ {
-					p.Parameters[i] += p.alpha * (point.Y[0] - guess[0]) * point.X[i-1]
-				}
-
-				// call the OnUpdate callback with the new theta
-				// appended to a blank slice so the vector is
-				// passed by value and not by reference
-				go onUpdate([][]float64{p.Parameters})
-			}
-
-		} else {
-			fmt.Fprintf(p.Output, "Training Completed.\n%v\n\n", p)
-			close(errors)
-			return
-		}
+	err := p.online.CopyOnWrite(opts.CopyOnWrite, [][]float64{append([]float64{}, p.Parameters...)}, func(latest interface{}) {
+		p.Parameters = latest.([][]float64)[0]
+	}, func() error {
+		return base.LearnOnline(ctx, dataset, opts, &p.online.OnlineCounters, func(point base.Datapoint) ([][]float64, error) {
+			return p.onlineStep(point, opts.CopyOnWrite)
+		})
+	})
+
+	if err != nil {
+		fmt.Fprintf(p.Output, "\nERROR: Error while learning –\n\t%v\n\n", err)
+		return err
+	}
+
+	fmt.Fprintf(p.Output, "Training Completed.\n%v\n\n", p)
+	return nil
+}
+
+// Stats returns how many points the model has seen
+// while learning online, how many times it guessed
+// wrong (and updated theta), and how many points
+// caused an error.
+func (p *Perceptron) Stats() base.OnlineStats {
+	return p.online.Stats()
+}
+
+// theta returns the parameter vector Predict should
+// use: the latest snapshot while learning online with
+// copy on write, and Parameters otherwise.
+func (p *Perceptron) theta() []float64 {
+	if params := p.online.Load(); params != nil {
+		return params[0]
 	}
+
+	return p.Parameters
+}
+
+// onlineStep predicts point, updating theta (and
+// returning it) only if the guess is wrong. With
+// copyOnWrite a copy of theta is updated and stored
+// as a snapshot instead of updating Parameters in
+// place.
+func (p *Perceptron) onlineStep(point base.Datapoint, copyOnWrite bool) ([][]float64, error) {
+	// Predict also checks if the point is of the
+	// correct dimensions
+	guess, err := p.Predict(point.X)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(point.Y) != 1 {
+		return nil, fmt.Errorf("The binary perceptron model requires that the data results (y) have length 1 - given %v", len(point.Y))
+	}
+
+	theta := p.theta()
+	if len(point.X) != len(theta)-1 {
+		return nil, fmt.Errorf("The binary perceptron model requires that the length of input data (currently %v) be one less than the length of the parameter vector (%v)", len(point.X), len(theta))
+	}
+
+	if guess[0] == point.Y[0] {
+		return nil, nil
+	}
+
+	if copyOnWrite {
+		theta = append([]float64{}, theta...)
+	}
+
+	// update the parameters since the guess
+	// is wrong
+	theta[0] += p.alpha * (point.Y[0] - guess[0])
+
+	for i := 1; i < len(theta); i++ {
+		theta[i] += p.alpha * (point.Y[0] - guess[0]) * point.X[i-1]
+	}
+
+	if copyOnWrite {
+		p.online.Store([][]float64{theta})
+	}
+
+	return [][]float64{theta}, nil
 }
 
 // String implements the fmt interface for clean printing. Here
@@ -408,6 +549,8 @@ func (p *Perceptron) String() string {
 
 // PersistToFile takes in an absolute filepath and saves the
 // parameter vector θ to the file, which can be restored later.
+// The Platt scaling Calibrate fit is saved along with it, so
+// a restored model predicts the same probabilities.
 // The function will take paths from the current directory, but
 // functions
 //
@@ -419,7 +562,10 @@ func (p *Perceptron) PersistToFile(path string) error {
 		return fmt.Errorf("ERROR: you just tried to persist your model to a file with no path!! That's a no-no. Try it with a valid filepath")
 	}
 
-	bytes, err := json.Marshal(p.Parameters)
+	bytes, err := json.Marshal(persistedPerceptron{
+		Parameters: p.Parameters,
+		Platt:      p.Platt,
+	})
 	if err != nil {
 		return err
 	}
@@ -435,6 +581,8 @@ func (p *Perceptron) PersistToFile(path string) error {
 // RestoreFromFile takes in a path to a parameter vector theta
 // and assigns the model it's operating on's parameter vector
 // to that.
+// Files holding just θ (which is all that
+// used to be saved) still restore, with no Platt scaling.
 //
 // The path must ba an absolute path or a path from the current
 // directory
@@ -452,10 +600,34 @@ func (p *Perceptron) RestoreFromFile(path string) error {
 		return err
 	}
 
-	err = json.Unmarshal(bytes, &p.Parameters)
+	persisted := persistedPerceptron{}
+	if isBareArray(bytes) {
+		err = json.Unmarshal(bytes, &persisted.Parameters)
+	} else {
+		err = json.Unmarshal(bytes, &persisted)
+	}
 	if err != nil {
 		return err
 	}
 
+	p.Parameters = persisted.Parameters
+	p.Platt = persisted.Platt
+
 	return nil
 }
+
+// persistedPerceptron is what PersistToFile saves: the
+// parameter vector θ, and the Platt scaling Calibrate
+// fit (if it was called.)
+type persistedPerceptron struct {
+	Parameters []float64   `json:"theta"`
+	Platt      *base.Platt `json:"platt,omitempty"`
+}
+
+// isBareArray reports whether the persisted model is
+// a bare JSON array, which is all the perceptrons used
+// to save (θ, or the support vectors), so those files
+// still restore.
+func isBareArray(persisted []byte) bool {
+	return strings.HasPrefix(strings.TrimSpace(string(persisted)), "[")
+}
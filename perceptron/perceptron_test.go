@@ -1,7 +1,10 @@
 package perceptron
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
+	"math/rand"
 	"os"
 	"testing"
 
@@ -174,6 +177,108 @@ func TestOneDXShouldFail3(t *testing.T) {
 	}
 }
 
+func TestOneDXContextShouldPass1(t *testing.T) {
+	stream := make(chan base.Datapoint, 100)
+
+	model := NewPerceptron(0.1, 1)
+
+	go func() {
+		for i := -500.0; abs(i) > 1; i *= -0.997 {
+			if 10+(i-20)/2 > 0 {
+				stream <- base.Datapoint{
+					X: []float64{i - 20},
+					Y: []float64{1.0},
+				}
+			} else {
+				stream <- base.Datapoint{
+					X: []float64{i - 20},
+					Y: []float64{0},
+				}
+			}
+		}
+
+		close(stream)
+	}()
+
+	var updates int64
+	err := model.OnlineLearnContext(context.Background(), stream, base.OnlineOptions{
+		OnUpdate: func(theta [][]float64) {
+			updates++
+		},
+		CallbackBuffer: 2,
+	})
+	assert.Nil(t, err, "Learning error should be nil")
+
+	stats := model.Stats()
+	assert.True(t, stats.Seen > 0, "Points should be counted")
+	assert.True(t, stats.Updates > 0, "Wrong guesses should update theta")
+	assert.True(t, stats.Updates < stats.Seen, "Right guesses should not update theta")
+	assert.Equal(t, int64(0), stats.Errors, "There should be no errors")
+	assert.Equal(t, stats.Updates, updates, "The callback should be called for every update")
+}
+
+// Predict should be safe to call from other goroutines
+// while learning with copy on write (run with -race)
+func TestOneDXCopyOnWriteShouldPass1(t *testing.T) {
+	stream := make(chan base.Datapoint, 100)
+
+	model := NewPerceptron(0.1, 1)
+	initial := model.Parameters
+
+	go func() {
+		for i := -500.0; abs(i) > 1; i *= -0.997 {
+			if 10+(i-20)/2 > 0 {
+				stream <- base.Datapoint{
+					X: []float64{i - 20},
+					Y: []float64{1.0},
+				}
+			} else {
+				stream <- base.Datapoint{
+					X: []float64{i - 20},
+					Y: []float64{-1.0},
+				}
+			}
+		}
+
+		close(stream)
+	}()
+
+	done := make(chan struct{})
+	predictErrors := make(chan error, 4)
+	for g := 0; g < 4; g++ {
+		go func() {
+			for {
+				select {
+				case <-done:
+					predictErrors <- nil
+					return
+				default:
+				}
+
+				_, err := model.Predict([]float64{10})
+				if err != nil {
+					predictErrors <- err
+					return
+				}
+			}
+		}()
+	}
+
+	err := model.OnlineLearnContext(context.Background(), stream, base.OnlineOptions{
+		CopyOnWrite: true,
+	})
+	close(done)
+
+	assert.Nil(t, err, "Learning error should be nil")
+	for g := 0; g < 4; g++ {
+		assert.Nil(t, <-predictErrors, "Prediction error should be nil")
+	}
+
+	assert.True(t, model.Stats().Updates > 0, "Wrong guesses should update theta")
+	assert.Equal(t, []float64{0, 0}, initial, "The old theta should never be written to")
+	assert.NotEqual(t, initial, model.Parameters, "Parameters should hold the final theta after learning")
+}
+
 func TestFourDXShouldPass1(t *testing.T) {
 	// create the channel of data and errors
 	stream := make(chan base.Datapoint, 100)
@@ -394,3 +499,107 @@ func TestPersistPerceptronShouldPass1(t *testing.T) {
 		}
 	}
 }
+
+func TestPredictProbaShouldPass1(t *testing.T) {
+	model := NewPerceptron(0.1, 1)
+	model.Parameters = []float64{0, 1}
+
+	// uncalibrated probabilities are the sigmoid of θx
+	proba, err := model.PredictProba([]float64{0})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.InDeltaSlice(t, []float64{0.5, 0.5}, proba, 1e-12, "A decision value of 0 should be a coin flip")
+
+	for _, x := range []float64{-3, -0.5, 0.5, 3} {
+		proba, err := model.PredictProba([]float64{x})
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.InDelta(t, 1, proba[0]+proba[1], 1e-12, "Probabilities should add up to 1")
+
+		guess, _ := model.Predict([]float64{x})
+		assert.Equal(t, guess[0] == 1, proba[1] > 0.5, "The more likely class should match Predict for x=%v", x)
+	}
+
+	// calibrate on points whose labels are noisy
+	// near the boundary
+	random := rand.New(rand.NewSource(7))
+	x := [][]float64{}
+	y := []float64{}
+	for i := 0; i < 2000; i++ {
+		v := 10 * (random.Float64() - 0.5)
+		x = append(x, []float64{v})
+		if v+random.NormFloat64() > 0 {
+			y = append(y, 1)
+		} else {
+			y = append(y, -1)
+		}
+	}
+
+	err = model.Calibrate(x, y)
+	assert.Nil(t, err, "Calibration error should be nil")
+	assert.NotNil(t, model.Platt, "Calibrating should set the Platt scaling")
+
+	proba, _ = model.PredictProba([]float64{4})
+	assert.True(t, proba[1] > 0.95, "Points far on the positive side should almost surely be positive - Given %v", proba[1])
+
+	proba, _ = model.PredictProba([]float64{0.5})
+	assert.True(t, proba[1] > 0.55 && proba[1] < 0.8, "Points near the boundary should only lean positive - Given %v", proba[1])
+
+	err = model.Calibrate(x, y[1:])
+	assert.NotNil(t, err, "Mismatched calibration data should return an error")
+
+	// the Platt scaling should be persisted with the model
+	err = model.PersistToFile("/tmp/.goml/CalibratedPerceptron.json")
+	assert.Nil(t, err, "Persistence error should be nil")
+
+	restored := NewPerceptron(0.1, 1)
+	err = restored.RestoreFromFile("/tmp/.goml/CalibratedPerceptron.json")
+	assert.Nil(t, err, "Restore error should be nil")
+	assert.Equal(t, model.Platt, restored.Platt, "The Platt scaling should be restored")
+	for _, v := range []float64{-4, -0.5, 0.5, 4} {
+		expected, _ := model.PredictProba([]float64{v})
+		proba, err := restored.PredictProba([]float64{v})
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.Equal(t, expected, proba, "The restored model should predict calibrated probabilities")
+	}
+
+	// files from before the Platt scaling was saved
+	// still restore, uncalibrated
+	err = ioutil.WriteFile("/tmp/.goml/CalibratedPerceptron.json", []byte(`[0,1]`), os.ModePerm)
+	assert.Nil(t, err, "Write error should be nil")
+	err = restored.RestoreFromFile("/tmp/.goml/CalibratedPerceptron.json")
+	assert.Nil(t, err, "Restoring a bare array should not fail")
+	assert.Nil(t, restored.Platt, "A bare array holds no Platt scaling")
+
+	_, err = model.PredictProba([]float64{1, 2})
+	assert.NotNil(t, err, "Input of the wrong dimension should return an error")
+}
+
+// normalizing while learning online or predicting
+// shouldn't touch the caller's slices
+func TestPerceptronDoesNotMutateShouldPass1(t *testing.T) {
+	stream := make(chan base.Datapoint, 10)
+	errors := make(chan error)
+
+	model := NewPerceptron(0.1, 2)
+
+	x := []float64{3, 4}
+	stream <- base.Datapoint{X: x, Y: []float64{1.0}}
+	close(stream)
+
+	go model.OnlineLearn(errors, stream, func(theta [][]float64) {}, true)
+
+	for {
+		err, more := <-errors
+		if !more {
+			break
+		}
+		assert.Nil(t, err, "Learning error should be nil")
+	}
+	assert.Equal(t, []float64{3, 4}, x, "Input datapoint should not be modified when normalizing")
+
+	y := []float64{6, 8}
+	_, err := model.Predict(y, true)
+	assert.Nil(t, err, "Prediction error should be nil")
+	_, err = model.PredictProba(y, true)
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, []float64{6, 8}, y, "Input to Predict should not be modified when normalizing")
+}
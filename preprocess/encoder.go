@@ -0,0 +1,288 @@
+package preprocess
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// fitCategories returns the sorted, distinct
+// categories found in each column of x.
+func fitCategories(x [][]string) ([][]string, error) {
+	if len(x) == 0 || len(x[0]) == 0 {
+		return nil, fmt.Errorf("ERROR: Attempting to fit with no training examples!")
+	}
+
+	features := len(x[0])
+	seen := make([]map[string]bool, features)
+	for j := range seen {
+		seen[j] = make(map[string]bool)
+	}
+
+	for i := range x {
+		if len(x[i]) != features {
+			return nil, fmt.Errorf("ERROR: row %v has %v features but row 0 has %v features", i, len(x[i]), features)
+		}
+
+		for j, v := range x[i] {
+			seen[j][v] = true
+		}
+	}
+
+	categories := make([][]string, features)
+	for j := range seen {
+		for v := range seen[j] {
+			categories[j] = append(categories[j], v)
+		}
+		sort.Strings(categories[j])
+	}
+
+	return categories, nil
+}
+
+// categoryIndex returns the position of v within
+// the sorted categories, or -1 if it's unknown.
+func categoryIndex(categories []string, v string) int {
+	i := sort.SearchStrings(categories, v)
+	if i < len(categories) && categories[i] == v {
+		return i
+	}
+
+	return -1
+}
+
+// OneHotEncoder turns each categorical feature
+// into a block of binary indicator features, one
+// per category seen during Fit. Categories are
+// stored (and indexed) in sorted order so that
+// the encoding is deterministic.
+//
+// Example (one feature, categories "blue", "green", "red"):
+//
+//	"green" -> [0, 1, 0]
+//
+// If IgnoreUnknown is true, categories that weren't
+// seen during Fit encode as an all-zero block.
+// Otherwise Transform returns an error.
+type OneHotEncoder struct {
+	Categories    [][]string `json:"categories"`
+	IgnoreUnknown bool       `json:"ignore_unknown"`
+}
+
+// NewOneHotEncoder returns a pointer to an unfit
+// OneHotEncoder.
+func NewOneHotEncoder(ignoreUnknown bool) *OneHotEncoder {
+	return &OneHotEncoder{
+		IgnoreUnknown: ignoreUnknown,
+	}
+}
+
+// Fit learns the categories of each feature of x.
+func (e *OneHotEncoder) Fit(x [][]string) error {
+	categories, err := fitCategories(x)
+	if err != nil {
+		return err
+	}
+
+	e.Categories = categories
+	return nil
+}
+
+// Features returns the number of output features
+// produced by Transform.
+func (e *OneHotEncoder) Features() int {
+	var n int
+	for j := range e.Categories {
+		n += len(e.Categories[j])
+	}
+
+	return n
+}
+
+// Transform returns the one-hot encoding of x.
+func (e *OneHotEncoder) Transform(x [][]string) ([][]float64, error) {
+	if e.Categories == nil {
+		return nil, fmt.Errorf("ERROR: OneHotEncoder must be fit before transforming data")
+	}
+
+	features := e.Features()
+	result := make([][]float64, len(x))
+	for i := range x {
+		if len(x[i]) != len(e.Categories) {
+			return nil, fmt.Errorf("ERROR: row %v has %v features but the encoder was fit on %v features", i, len(x[i]), len(e.Categories))
+		}
+
+		result[i] = make([]float64, features)
+		offset := 0
+		for j, v := range x[i] {
+			c := categoryIndex(e.Categories[j], v)
+			if c < 0 && !e.IgnoreUnknown {
+				return nil, fmt.Errorf("ERROR: unknown category %q for feature %v in row %v", v, j, i)
+			}
+			if c >= 0 {
+				result[i][offset+c] = 1
+			}
+
+			offset += len(e.Categories[j])
+		}
+	}
+
+	return result, nil
+}
+
+// InverseTransform maps one-hot encoded rows back
+// to their categories by picking the largest
+// indicator within each block. An all-zero block
+// (an unknown category) maps back to "".
+func (e *OneHotEncoder) InverseTransform(x [][]float64) ([][]string, error) {
+	if e.Categories == nil {
+		return nil, fmt.Errorf("ERROR: OneHotEncoder must be fit before transforming data")
+	}
+
+	features := e.Features()
+	result := make([][]string, len(x))
+	for i := range x {
+		if len(x[i]) != features {
+			return nil, fmt.Errorf("ERROR: row %v has %v features but the encoder produces %v features", i, len(x[i]), features)
+		}
+
+		result[i] = make([]string, len(e.Categories))
+		offset := 0
+		for j := range e.Categories {
+			best := -1
+			for c := range e.Categories[j] {
+				if x[i][offset+c] > 0 && (best < 0 || x[i][offset+c] > x[i][offset+best]) {
+					best = c
+				}
+			}
+
+			if best >= 0 {
+				result[i][j] = e.Categories[j][best]
+			}
+
+			offset += len(e.Categories[j])
+		}
+	}
+
+	return result, nil
+}
+
+// PersistToFile takes in an absolute filepath and saves the
+// learned categories to the file, which can be restored
+// later with RestoreFromFile.
+func (e *OneHotEncoder) PersistToFile(path string) error {
+	return persistToFile(path, e)
+}
+
+// RestoreFromFile takes in a path to a persisted encoder
+// and assigns its learned categories to the encoder it's
+// operating on.
+func (e *OneHotEncoder) RestoreFromFile(path string) error {
+	return restoreFromFile(path, e)
+}
+
+// OrdinalEncoder maps each categorical feature to
+// the integer index (stored as a float64) of its
+// category, in sorted order. This is the format
+// Softmax expects for its labels, for example.
+//
+// If IgnoreUnknown is true, categories that weren't
+// seen during Fit encode as -1. Otherwise Transform
+// returns an error.
+type OrdinalEncoder struct {
+	Categories    [][]string `json:"categories"`
+	IgnoreUnknown bool       `json:"ignore_unknown"`
+}
+
+// NewOrdinalEncoder returns a pointer to an unfit
+// OrdinalEncoder.
+func NewOrdinalEncoder(ignoreUnknown bool) *OrdinalEncoder {
+	return &OrdinalEncoder{
+		IgnoreUnknown: ignoreUnknown,
+	}
+}
+
+// Fit learns the categories of each feature of x.
+func (e *OrdinalEncoder) Fit(x [][]string) error {
+	categories, err := fitCategories(x)
+	if err != nil {
+		return err
+	}
+
+	e.Categories = categories
+	return nil
+}
+
+// Transform returns the ordinal encoding of x.
+func (e *OrdinalEncoder) Transform(x [][]string) ([][]float64, error) {
+	if e.Categories == nil {
+		return nil, fmt.Errorf("ERROR: OrdinalEncoder must be fit before transforming data")
+	}
+
+	result := make([][]float64, len(x))
+	for i := range x {
+		if len(x[i]) != len(e.Categories) {
+			return nil, fmt.Errorf("ERROR: row %v has %v features but the encoder was fit on %v features", i, len(x[i]), len(e.Categories))
+		}
+
+		result[i] = make([]float64, len(x[i]))
+		for j, v := range x[i] {
+			c := categoryIndex(e.Categories[j], v)
+			if c < 0 && !e.IgnoreUnknown {
+				return nil, fmt.Errorf("ERROR: unknown category %q for feature %v in row %v", v, j, i)
+			}
+			result[i][j] = float64(c)
+		}
+	}
+
+	return result, nil
+}
+
+// InverseTransform maps ordinal encoded rows back
+// to their categories. Indices are rounded to the
+// nearest integer; anything out of range (like the
+// -1 used for unknown categories) maps back to "".
+// NaN and ±Inf aren't indices at all, so they return
+// an error.
+func (e *OrdinalEncoder) InverseTransform(x [][]float64) ([][]string, error) {
+	if e.Categories == nil {
+		return nil, fmt.Errorf("ERROR: OrdinalEncoder must be fit before transforming data")
+	}
+
+	result := make([][]string, len(x))
+	for i := range x {
+		if len(x[i]) != len(e.Categories) {
+			return nil, fmt.Errorf("ERROR: row %v has %v features but the encoder was fit on %v features", i, len(x[i]), len(e.Categories))
+		}
+
+		result[i] = make([]string, len(x[i]))
+		for j, v := range x[i] {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return nil, fmt.Errorf("ERROR: row %v has a non-finite index (%v) for feature %v", i, v, j)
+			}
+
+			// compare before converting, since huge
+			// values overflow int
+			if v < 0 || v+0.5 >= float64(len(e.Categories[j])) {
+				continue
+			}
+			result[i][j] = e.Categories[j][int(v+0.5)]
+		}
+	}
+
+	return result, nil
+}
+
+// PersistToFile takes in an absolute filepath and saves the
+// learned categories to the file, which can be restored
+// later with RestoreFromFile.
+func (e *OrdinalEncoder) PersistToFile(path string) error {
+	return persistToFile(path, e)
+}
+
+// RestoreFromFile takes in a path to a persisted encoder
+// and assigns its learned categories to the encoder it's
+// operating on.
+func (e *OrdinalEncoder) RestoreFromFile(path string) error {
+	return restoreFromFile(path, e)
+}
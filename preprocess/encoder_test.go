@@ -0,0 +1,119 @@
+package preprocess
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var colors = [][]string{
+	{"red", "small"},
+	{"green", "large"},
+	{"blue", "small"},
+	{"green", "medium"},
+}
+
+func TestOneHotEncoderShouldPass1(t *testing.T) {
+	encoder := NewOneHotEncoder(false)
+	assert.Nil(t, encoder.Fit(colors), "Fit error should be nil")
+
+	assert.Equal(t, []string{"blue", "green", "red"}, encoder.Categories[0], "Categories should be sorted")
+	assert.Equal(t, 6, encoder.Features(), "There should be one output feature per category")
+
+	encoded, err := encoder.Transform(colors)
+	assert.Nil(t, err, "Transform error should be nil")
+	assert.Equal(t, []float64{0, 0, 1, 0, 0, 1}, encoded[0], "Encoding should match")
+	assert.Equal(t, []float64{0, 1, 0, 1, 0, 0}, encoded[1], "Encoding should match")
+
+	decoded, err := encoder.InverseTransform(encoded)
+	assert.Nil(t, err, "InverseTransform error should be nil")
+	assert.Equal(t, colors, decoded, "InverseTransform should recover the input")
+}
+
+func TestOneHotEncoderShouldPass2(t *testing.T) {
+	encoder := NewOneHotEncoder(true)
+	assert.Nil(t, encoder.Fit(colors), "Fit error should be nil")
+
+	encoded, err := encoder.Transform([][]string{{"purple", "large"}})
+	assert.Nil(t, err, "Unknown categories should be ignored")
+	assert.Equal(t, []float64{0, 0, 0, 1, 0, 0}, encoded[0], "Unknown category should encode to zeros")
+
+	decoded, err := encoder.InverseTransform(encoded)
+	assert.Nil(t, err, "InverseTransform error should be nil")
+	assert.Equal(t, []string{"", "large"}, decoded[0], "Unknown category should decode to the empty string")
+}
+
+func TestOneHotEncoderShouldFail1(t *testing.T) {
+	encoder := NewOneHotEncoder(false)
+
+	_, err := encoder.Transform(colors)
+	assert.NotNil(t, err, "Transforming before fitting should return an error")
+
+	assert.Nil(t, encoder.Fit(colors), "Fit error should be nil")
+
+	_, err = encoder.Transform([][]string{{"purple", "large"}})
+	assert.NotNil(t, err, "Unknown categories should return an error")
+
+	_, err = encoder.Transform([][]string{{"red"}})
+	assert.NotNil(t, err, "Rows of the wrong dimension should return an error")
+}
+
+func TestOrdinalEncoderShouldPass1(t *testing.T) {
+	encoder := NewOrdinalEncoder(false)
+	assert.Nil(t, encoder.Fit(colors), "Fit error should be nil")
+
+	encoded, err := encoder.Transform(colors)
+	assert.Nil(t, err, "Transform error should be nil")
+	assert.Equal(t, [][]float64{{2, 2}, {1, 0}, {0, 2}, {1, 1}}, encoded, "Encoding should match")
+
+	decoded, err := encoder.InverseTransform(encoded)
+	assert.Nil(t, err, "InverseTransform error should be nil")
+	assert.Equal(t, colors, decoded, "InverseTransform should recover the input")
+}
+
+func TestOrdinalEncoderShouldPass2(t *testing.T) {
+	encoder := NewOrdinalEncoder(true)
+	assert.Nil(t, encoder.Fit(colors), "Fit error should be nil")
+
+	encoded, err := encoder.Transform([][]string{{"purple", "large"}})
+	assert.Nil(t, err, "Unknown categories should be ignored")
+	assert.Equal(t, []float64{-1, 0}, encoded[0], "Unknown category should encode to -1")
+}
+
+func TestOrdinalEncoderShouldFail1(t *testing.T) {
+	encoder := NewOrdinalEncoder(false)
+
+	_, err := encoder.InverseTransform([][]float64{{0, 0}})
+	assert.NotNil(t, err, "Inverse transforming before fitting should return an error")
+
+	assert.Nil(t, encoder.Fit(colors), "Fit error should be nil")
+
+	for _, v := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		_, err = encoder.InverseTransform([][]float64{{0, v}})
+		assert.NotNil(t, err, "Inverse transforming %v should return an error", v)
+	}
+
+	// huge indices are just out of range
+	decoded, err := encoder.InverseTransform([][]float64{{1e300, 0}})
+	assert.Nil(t, err, "InverseTransform error should be nil")
+	assert.Equal(t, []string{"", "large"}, decoded[0], "Out of range indices should decode to the empty string")
+}
+
+func TestEncoderPersistToFileShouldPass1(t *testing.T) {
+	oneHot := NewOneHotEncoder(true)
+	assert.Nil(t, oneHot.Fit(colors), "Fit error should be nil")
+	assert.Nil(t, oneHot.PersistToFile("/tmp/.goml/OneHotEncoder.json"), "Persist error should be nil")
+
+	restoredOneHot := NewOneHotEncoder(false)
+	assert.Nil(t, restoredOneHot.RestoreFromFile("/tmp/.goml/OneHotEncoder.json"), "Restore error should be nil")
+	assert.Equal(t, oneHot, restoredOneHot, "Restored encoder should match the original")
+
+	ordinal := NewOrdinalEncoder(false)
+	assert.Nil(t, ordinal.Fit(colors), "Fit error should be nil")
+	assert.Nil(t, ordinal.PersistToFile("/tmp/.goml/OrdinalEncoder.json"), "Persist error should be nil")
+
+	restoredOrdinal := NewOrdinalEncoder(true)
+	assert.Nil(t, restoredOrdinal.RestoreFromFile("/tmp/.goml/OrdinalEncoder.json"), "Restore error should be nil")
+	assert.Equal(t, ordinal, restoredOrdinal, "Restored encoder should match the original")
+}
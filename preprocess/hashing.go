@@ -0,0 +1,284 @@
+package preprocess
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+
+	"github.com/bountylabs/goml/text"
+)
+
+/*
+HashingVectorizer turns named features and text
+into sparse vectors (map[int]float64) without
+keeping a vocabulary around. Every feature name
+(or token) is hashed with 32 bit MurmurHash3 into
+one of 2^Bits buckets, so the vectors can be fed
+straight into linear.NewSparseLogistic (or
+linear.NewSparseLeastSquares) with Size() as the
+number of features.
+
+Because nothing is learned there is no Fit, and
+the same vectorizer (with the same Bits) will map
+a feature to the same index every time, at
+training and serving time alike.
+
+If AlternateSign is true (the default) the sign
+of each value is flipped by another bit of the
+hash, so collisions tend to cancel out instead of
+always adding up, which keeps the inner products
+the model sees unbiased.
+
+https://en.wikipedia.org/wiki/Feature_hashing
+
+Example Hashing Vectorizer Usage:
+
+	// 2^18 buckets
+	vectorizer := NewHashingVectorizer(18)
+
+	trainX, err := vectorizer.HashAllText(sentences)
+	if err != nil {
+		panic("couldn't hash the training set!")
+	}
+
+	model := linear.NewSparseLogistic(base.StochasticGD, 1e-3, 1e-1, 0, base.L2, 200, trainX, trainY, vectorizer.Size())
+
+	err = model.Learn("")
+	if err != nil {
+		panic("couldn't train the model!")
+	}
+
+	x, err := vectorizer.HashText("my cat loves tuna")
+	if err != nil {
+		panic("couldn't hash the input!")
+	}
+
+	guess := model.PredictSparse(x)
+*/
+type HashingVectorizer struct {
+	// Bits is the base 2 log of the number of
+	// buckets features are hashed into. It must
+	// be between 1 and 31.
+	Bits uint `json:"bits"`
+
+	// AlternateSign flips the sign of hashed
+	// values based on the hash so collisions
+	// cancel out on average.
+	AlternateSign bool `json:"alternate_sign"`
+
+	// Tokenizer breaks text into the tokens that
+	// are hashed by HashText. It isn't persisted,
+	// so set it again after restoring if you
+	// aren't using the default.
+	Tokenizer text.Tokenizer `json:"-"`
+}
+
+// NewHashingVectorizer returns a pointer to a
+// HashingVectorizer which hashes features into
+// 2^bits buckets, using signed hashing and
+// splitting text on spaces (after lower casing
+// it) like the default NaiveBayes tokenizer.
+func NewHashingVectorizer(bits uint) *HashingVectorizer {
+	return &HashingVectorizer{
+		Bits:          bits,
+		AlternateSign: true,
+		Tokenizer:     &text.SimpleTokenizer{SplitOn: " "},
+	}
+}
+
+// Size returns the number of buckets features are
+// hashed into, which is what you should give the
+// sparse linear models as their number of features.
+func (h *HashingVectorizer) Size() int {
+	return 1 << h.Bits
+}
+
+// check makes sure the vectorizer can be used.
+func (h *HashingVectorizer) check() error {
+	if h.Bits < 1 || h.Bits > 31 {
+		return fmt.Errorf("ERROR: hashing vectorizer needs between 1 and 31 bits, given %v", h.Bits)
+	}
+
+	return nil
+}
+
+// add hashes the feature name into the vector x,
+// adding value (or subtracting it, depending on
+// the sign bit) to its bucket.
+func (h *HashingVectorizer) add(x map[int]float64, name string, value float64) {
+	sum := murmur3([]byte(name))
+
+	// the bucket uses the low bits and the sign uses
+	// the top bit, so they never overlap with at
+	// most 31 bits of buckets
+	index := int(sum & (1<<h.Bits - 1))
+	if h.AlternateSign && sum>>31 == 1 {
+		value = -value
+	}
+
+	x[index] += value
+	if x[index] == 0 {
+		delete(x, index)
+	}
+}
+
+// murmur3 is the 32 bit MurmurHash3 of data with a
+// seed of 0.
+//
+// https://en.wikipedia.org/wiki/MurmurHash
+func murmur3(data []byte) uint32 {
+	const (
+		c1 = 0xcc9e2d51
+		c2 = 0x1b873593
+	)
+
+	var h uint32
+	n := len(data) / 4 * 4
+	for i := 0; i < n; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+
+	// mix in the last (up to 3) bytes
+	var k uint32
+	tail := data[n:]
+	switch len(tail) {
+	case 3:
+		k ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(tail[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+
+	h ^= uint32(len(data))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+
+	return h
+}
+
+// Hash turns a set of named numeric features into
+// a sparse vector. Features with a value of 0 are
+// skipped.
+func (h *HashingVectorizer) Hash(features map[string]float64) (map[int]float64, error) {
+	if err := h.check(); err != nil {
+		return nil, err
+	}
+
+	x := make(map[int]float64, len(features))
+	for name, value := range features {
+		if value == 0 {
+			continue
+		}
+		h.add(x, name, value)
+	}
+
+	return x, nil
+}
+
+// HashCategorical turns a set of named categorical
+// features into a sparse vector, where each feature
+// becomes an indicator for "name=value" (the same
+// thing one hot encoding would give you, without
+// knowing the categories ahead of time.)
+func (h *HashingVectorizer) HashCategorical(features map[string]string) (map[int]float64, error) {
+	if err := h.check(); err != nil {
+		return nil, err
+	}
+
+	x := make(map[int]float64, len(features))
+	for name, value := range features {
+		h.add(x, name+"="+value, 1)
+	}
+
+	return x, nil
+}
+
+// HashText tokenizes the sentence with the
+// vectorizer's Tokenizer and turns it into a sparse
+// vector of token counts. Empty tokens are skipped.
+func (h *HashingVectorizer) HashText(sentence string) (map[int]float64, error) {
+	if err := h.check(); err != nil {
+		return nil, err
+	}
+	if h.Tokenizer == nil {
+		return nil, fmt.Errorf("ERROR: Attempting to hash text without a tokenizer!")
+	}
+
+	x := make(map[int]float64)
+	for _, token := range h.Tokenizer.Tokenize(sentence) {
+		if token == "" {
+			continue
+		}
+		h.add(x, token, 1)
+	}
+
+	return x, nil
+}
+
+// HashAllText runs HashText over each sentence,
+// returning a training set ready for the sparse
+// linear models.
+func (h *HashingVectorizer) HashAllText(sentences []string) ([]map[int]float64, error) {
+	result := make([]map[int]float64, len(sentences))
+	for i := range sentences {
+		x, err := h.HashText(sentences[i])
+		if err != nil {
+			return nil, err
+		}
+		result[i] = x
+	}
+
+	return result, nil
+}
+
+// FitText only checks the vectorizer's settings,
+// since hashing doesn't learn anything. It's there
+// so the vectorizer can start a SparsePipeline.
+func (h *HashingVectorizer) FitText(sentences []string) error {
+	if err := h.check(); err != nil {
+		return err
+	}
+	if h.Tokenizer == nil {
+		return fmt.Errorf("ERROR: Attempting to hash text without a tokenizer!")
+	}
+
+	return nil
+}
+
+// TransformText is HashAllText, so the vectorizer
+// can start a SparsePipeline.
+func (h *HashingVectorizer) TransformText(sentences []string) ([]map[int]float64, error) {
+	return h.HashAllText(sentences)
+}
+
+// PersistToFile takes in an absolute filepath and saves
+// the vectorizer's settings to the file, which can be
+// restored later with RestoreFromFile. The tokenizer is
+// not saved.
+func (h *HashingVectorizer) PersistToFile(path string) error {
+	return persistToFile(path, h)
+}
+
+// RestoreFromFile takes in a path to a persisted
+// vectorizer and assigns its settings to the
+// vectorizer it's operating on.
+func (h *HashingVectorizer) RestoreFromFile(path string) error {
+	return restoreFromFile(path, h)
+}
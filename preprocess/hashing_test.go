@@ -0,0 +1,146 @@
+package preprocess
+
+import (
+	"io/ioutil"
+	"math"
+	"testing"
+
+	"github.com/bountylabs/goml/base"
+	"github.com/bountylabs/goml/linear"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashingVectorizerShouldPass1(t *testing.T) {
+	vectorizer := NewHashingVectorizer(10)
+	assert.Equal(t, 1024, vectorizer.Size(), "Size should be 2^bits")
+
+	x, err := vectorizer.HashText("The cat sat on the mat")
+	assert.Nil(t, err, "Hashing error should be nil")
+
+	// "the" shows up twice (after lower casing) so
+	// its bucket should have magnitude 2 unless it
+	// collided with another token
+	total := 0.0
+	for i, v := range x {
+		assert.True(t, i >= 0 && i < vectorizer.Size(), "Index (%v) should be within the buckets", i)
+		total += math.Abs(v)
+	}
+	assert.True(t, total <= 6, "Total magnitude (%v) should be at most the number of tokens", total)
+
+	again, err := vectorizer.HashText("the CAT sat on the mat")
+	assert.Nil(t, err, "Hashing error should be nil")
+	assert.Equal(t, x, again, "Hashing should be deterministic")
+}
+
+func TestHashingVectorizerShouldPass2(t *testing.T) {
+	vectorizer := NewHashingVectorizer(4)
+	vectorizer.AlternateSign = false
+
+	x, err := vectorizer.Hash(map[string]float64{
+		"age":    31,
+		"height": 1.8,
+		"zero":   0,
+	})
+	assert.Nil(t, err, "Hashing error should be nil")
+
+	total := 0.0
+	for _, v := range x {
+		assert.True(t, v > 0, "Values should all be positive without signed hashing")
+		total += v
+	}
+	assert.InDelta(t, 32.8, total, 1e-9, "Unsigned hashing should keep the total")
+
+	c1, err := vectorizer.HashCategorical(map[string]string{"color": "red"})
+	assert.Nil(t, err, "Hashing error should be nil")
+	c2, err := vectorizer.HashCategorical(map[string]string{"color": "red"})
+	assert.Nil(t, err, "Hashing error should be nil")
+	assert.Equal(t, c1, c2, "The same category should always hash to the same bucket")
+	assert.Len(t, c1, 1, "A single category should set a single bucket")
+}
+
+// signed hashing should make some values negative
+func TestHashingVectorizerShouldPass3(t *testing.T) {
+	vectorizer := NewHashingVectorizer(20)
+
+	features := map[string]float64{}
+	for i := 0; i < 200; i++ {
+		features[string(rune('a'+i%26))+string(rune('a'+i/26))] = 1
+	}
+
+	x, err := vectorizer.Hash(features)
+	assert.Nil(t, err, "Hashing error should be nil")
+
+	var negative, positive int
+	for _, v := range x {
+		if v < 0 {
+			negative++
+		} else {
+			positive++
+		}
+	}
+	assert.True(t, negative > 50, "Some values (%v) should be negative with signed hashing", negative)
+	assert.True(t, positive > 50, "Some values (%v) should be positive with signed hashing", positive)
+}
+
+func TestHashingVectorizerShouldFail1(t *testing.T) {
+	vectorizer := NewHashingVectorizer(0)
+	_, err := vectorizer.HashText("some words")
+	assert.NotNil(t, err, "Zero bits should return an error")
+
+	vectorizer = NewHashingVectorizer(32)
+	_, err = vectorizer.Hash(map[string]float64{"a": 1})
+	assert.NotNil(t, err, "More than 31 bits should return an error")
+
+	vectorizer = NewHashingVectorizer(8)
+	vectorizer.Tokenizer = nil
+	_, err = vectorizer.HashText("some words")
+	assert.NotNil(t, err, "Hashing text without a tokenizer should return an error")
+}
+
+func TestHashingVectorizerSparseLogisticShouldPass1(t *testing.T) {
+	vectorizer := NewHashingVectorizer(12)
+
+	sentences := []string{}
+	y := []float64{}
+	for i := 0; i < 20; i++ {
+		sentences = append(sentences, "i love this great movie", "what a terrible awful film")
+		y = append(y, 1, 0)
+	}
+
+	trainX, err := vectorizer.HashAllText(sentences)
+	assert.Nil(t, err, "Hashing error should be nil")
+
+	model := linear.NewSparseLogistic(base.BatchGD, 1e-1, 0, 0, base.L2, 500, trainX, y, vectorizer.Size())
+	model.Output = ioutil.Discard
+	assert.Nil(t, model.Learn(""), "Learning error should be nil")
+
+	x, err := vectorizer.HashText("great movie")
+	assert.Nil(t, err, "Hashing error should be nil")
+	assert.True(t, model.PredictSparse(x) > 0.5, "Positive sentence should be classified as positive")
+
+	x, err = vectorizer.HashText("terrible film")
+	assert.Nil(t, err, "Hashing error should be nil")
+	assert.True(t, model.PredictSparse(x) < 0.5, "Negative sentence should be classified as negative")
+}
+
+func TestHashingVectorizerPersistToFileShouldPass1(t *testing.T) {
+	vectorizer := NewHashingVectorizer(7)
+	vectorizer.AlternateSign = false
+
+	assert.Nil(t, vectorizer.PersistToFile("/tmp/.goml/hashing.json"), "Persistance error should be nil")
+
+	restored := NewHashingVectorizer(20)
+	assert.Nil(t, restored.RestoreFromFile("/tmp/.goml/hashing.json"), "Restoring error should be nil")
+	assert.Equal(t, uint(7), restored.Bits, "Bits should be restored")
+	assert.False(t, restored.AlternateSign, "AlternateSign should be restored")
+	assert.NotNil(t, restored.Tokenizer, "Tokenizer should be left alone when restoring")
+}
+
+// check against known MurmurHash3 (x86, 32 bit)
+// values
+func TestMurmur3ShouldPass1(t *testing.T) {
+	assert.Equal(t, uint32(0), murmur3([]byte("")), "Hash should match the reference")
+	assert.Equal(t, uint32(0x248bfa47), murmur3([]byte("hello")), "Hash should match the reference")
+	assert.Equal(t, uint32(0x2e4ff723), murmur3([]byte("The quick brown fox jumps over the lazy dog")), "Hash should match the reference")
+}
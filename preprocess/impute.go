@@ -0,0 +1,130 @@
+package preprocess
+
+import (
+	"fmt"
+)
+
+// ImputeStrategy defines a type enum which
+// (using constants declared below) lets a user
+// choose how an Imputer fills in missing values
+type ImputeStrategy string
+
+// Constants declare the strategies an Imputer
+// can use.
+const (
+	ImputeMean     ImputeStrategy = "mean"
+	ImputeMedian   ImputeStrategy = "median"
+	ImputeConstant ImputeStrategy = "constant"
+)
+
+// Imputer replaces missing values (NaN) with a
+// per-feature statistic learned in Fit: either
+// the mean or median of the observed values of
+// that feature, or a constant FillValue.
+//
+// A feature with no observed values at all is
+// filled with FillValue regardless of strategy.
+type Imputer struct {
+	Strategy  ImputeStrategy `json:"strategy"`
+	FillValue float64        `json:"fill_value"`
+
+	// Statistics holds the value used to fill
+	// in missing entries of each feature.
+	Statistics []float64 `json:"statistics"`
+}
+
+// NewImputer returns a pointer to an unfit Imputer
+// with the given strategy. fillValue is used by
+// ImputeConstant, and as the fallback for features
+// which were never observed.
+func NewImputer(strategy ImputeStrategy, fillValue float64) *Imputer {
+	return &Imputer{
+		Strategy:  strategy,
+		FillValue: fillValue,
+	}
+}
+
+// Fit learns the fill value of each feature of x.
+func (m *Imputer) Fit(x [][]float64) error {
+	if m.Strategy != ImputeMean && m.Strategy != ImputeMedian && m.Strategy != ImputeConstant {
+		return fmt.Errorf("ERROR: unknown imputation strategy %q", m.Strategy)
+	}
+
+	cols, err := columns(x)
+	if err != nil {
+		return err
+	}
+
+	m.Statistics = make([]float64, len(cols))
+	for j, col := range cols {
+		if len(col) == 0 || m.Strategy == ImputeConstant {
+			m.Statistics[j] = m.FillValue
+			continue
+		}
+
+		switch m.Strategy {
+		case ImputeMean:
+			var sum float64
+			for _, v := range col {
+				sum += v
+			}
+			m.Statistics[j] = sum / float64(len(col))
+		case ImputeMedian:
+			m.Statistics[j] = quantile(sortedCopy(col), 0.5)
+		}
+	}
+
+	return nil
+}
+
+// Transform returns a copy of x with all missing
+// values filled in.
+func (m *Imputer) Transform(x [][]float64) ([][]float64, error) {
+	if m.Statistics == nil {
+		return nil, fmt.Errorf("ERROR: Imputer must be fit before transforming data")
+	}
+	if err := checkDims(x, len(m.Statistics)); err != nil {
+		return nil, err
+	}
+
+	result := make([][]float64, len(x))
+	for i := range x {
+		result[i] = make([]float64, len(x[i]))
+		for j, v := range x[i] {
+			if isMissing(v) {
+				v = m.Statistics[j]
+			}
+			result[i][j] = v
+		}
+	}
+
+	return result, nil
+}
+
+// InverseTransform returns a copy of x. Imputation
+// throws away which values were missing, so it
+// can't be undone; the method exists so the Imputer
+// can be used anywhere a Transformer can.
+func (m *Imputer) InverseTransform(x [][]float64) ([][]float64, error) {
+	if m.Statistics == nil {
+		return nil, fmt.Errorf("ERROR: Imputer must be fit before transforming data")
+	}
+
+	return apply(x, len(m.Statistics), func(j int, v float64) float64 {
+		return v
+	})
+}
+
+// PersistToFile takes in an absolute filepath and saves the
+// strategy and learned fill values to the file, which can
+// be restored later with RestoreFromFile.
+func (m *Imputer) PersistToFile(path string) error {
+	return persistToFile(path, m)
+}
+
+// RestoreFromFile takes in a path to a persisted imputer
+// and assigns its learned statistics to the imputer it's
+// operating on.
+func (m *Imputer) RestoreFromFile(path string) error {
+	return restoreFromFile(path, m)
+}
@@ -0,0 +1,69 @@
+package preprocess
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var missing = [][]float64{
+	{1, math.NaN(), 5},
+	{2, 10, math.NaN()},
+	{math.NaN(), 20, math.NaN()},
+	{9, 60, math.NaN()},
+}
+
+func TestImputerShouldPass1(t *testing.T) {
+	imputer := NewImputer(ImputeMean, -1)
+	assert.Nil(t, imputer.Fit(missing), "Fit error should be nil")
+	assert.Equal(t, []float64{4, 30, 5}, imputer.Statistics, "Statistics should be the means of observed values")
+
+	filled, err := imputer.Transform(missing)
+	assert.Nil(t, err, "Transform error should be nil")
+	assert.Equal(t, []float64{1, 30, 5}, filled[0], "Missing values should be filled")
+	assert.Equal(t, []float64{4, 20, 5}, filled[2], "Missing values should be filled")
+	assert.True(t, math.IsNaN(missing[0][1]), "Transform should not modify its input")
+}
+
+func TestImputerShouldPass2(t *testing.T) {
+	imputer := NewImputer(ImputeMedian, -1)
+	assert.Nil(t, imputer.Fit(missing), "Fit error should be nil")
+	assert.Equal(t, []float64{2, 20, 5}, imputer.Statistics, "Statistics should be the medians of observed values")
+}
+
+func TestImputerShouldPass3(t *testing.T) {
+	imputer := NewImputer(ImputeConstant, -1)
+	assert.Nil(t, imputer.Fit(missing), "Fit error should be nil")
+
+	filled, err := imputer.Transform(missing)
+	assert.Nil(t, err, "Transform error should be nil")
+	assert.Equal(t, []float64{-1, 20, -1}, filled[2], "Missing values should be filled with the constant")
+}
+
+func TestImputerShouldPass4(t *testing.T) {
+	// features that are never observed fall
+	// back to the fill value
+	imputer := NewImputer(ImputeMean, 7)
+	assert.Nil(t, imputer.Fit([][]float64{{1, math.NaN()}, {3, math.NaN()}}), "Fit error should be nil")
+	assert.Equal(t, []float64{2, 7}, imputer.Statistics, "Unobserved features should use the fill value")
+}
+
+func TestImputerShouldFail1(t *testing.T) {
+	imputer := NewImputer(ImputeStrategy("mode"), 0)
+	assert.NotNil(t, imputer.Fit(missing), "Unknown strategies should return an error")
+
+	imputer = NewImputer(ImputeMean, 0)
+	_, err := imputer.Transform(missing)
+	assert.NotNil(t, err, "Transforming before fitting should return an error")
+}
+
+func TestImputerPersistToFileShouldPass1(t *testing.T) {
+	imputer := NewImputer(ImputeMedian, 3)
+	assert.Nil(t, imputer.Fit(missing), "Fit error should be nil")
+	assert.Nil(t, imputer.PersistToFile("/tmp/.goml/Imputer.json"), "Persist error should be nil")
+
+	restored := NewImputer(ImputeMean, 0)
+	assert.Nil(t, restored.RestoreFromFile("/tmp/.goml/Imputer.json"), "Restore error should be nil")
+	assert.Equal(t, imputer, restored, "Restored imputer should match the original")
+}
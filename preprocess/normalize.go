@@ -0,0 +1,50 @@
+package preprocess
+
+import (
+	"fmt"
+
+	"github.com/bountylabs/goml/base"
+)
+
+// Normalizer scales each row (not each feature!)
+// to unit length, exactly like base.Normalize,
+// but without touching the data you pass in.
+// It has no state, so Fit only checks the input,
+// but it lets a Pipeline normalize inputs the
+// same way at training and serving time.
+type Normalizer struct{}
+
+// NewNormalizer returns a pointer to a Normalizer.
+func NewNormalizer() *Normalizer {
+	return &Normalizer{}
+}
+
+// Fit does nothing other than check that there is
+// data to fit on. It's here so Normalizer can be
+// used anywhere a Transformer can.
+func (n *Normalizer) Fit(x [][]float64) error {
+	if len(x) == 0 {
+		return fmt.Errorf("ERROR: Attempting to fit with no training examples!")
+	}
+
+	return nil
+}
+
+// Transform returns a copy of x with each row
+// normalized to unit length.
+func (n *Normalizer) Transform(x [][]float64) ([][]float64, error) {
+	result := make([][]float64, len(x))
+	for i := range x {
+		result[i] = append([]float64{}, x[i]...)
+		base.NormalizePoint(result[i])
+	}
+
+	return result, nil
+}
+
+// InverseTransform always returns an error because
+// the length of each row is thrown away when it's
+// normalized.
+func (n *Normalizer) InverseTransform(x [][]float64) ([][]float64, error) {
+	return nil, fmt.Errorf("ERROR: normalizing rows to unit length can't be inverted")
+}
@@ -0,0 +1,422 @@
+package preprocess
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/bountylabs/goml/base"
+)
+
+// Predictor is any goml model which can make a
+// prediction off of a dense input vector. All of
+// the linear, perceptron and cluster models are
+// Predictors.
+type Predictor interface {
+	Predict([]float64, ...bool) ([]float64, error)
+}
+
+// trainable is a model which takes a labeled
+// training set (like LeastSquares, Softmax or
+// KNN.)
+type trainable interface {
+	UpdateTrainingSet([][]float64, []float64) error
+}
+
+// learner is a model which needs to be told to
+// learn after its training set is given (like
+// LeastSquares or Softmax.)
+type learner interface {
+	Learn() error
+}
+
+/*
+Pipeline chains any number of Transformers with a
+final goml model so the whole thing can be fit,
+used for prediction, and persisted as one unit.
+
+Fit fits each step on the output of the step
+before it, then trains the model on the output of
+the last step. Predict runs an input through every
+step, in order, before handing it to the model.
+
+PersistToFile writes the learned state of every
+step and the model into a single JSON file, so the
+exact transform you trained with is the one you
+serve with. Restore into a Pipeline built with the
+same step and model types (the types are checked.)
+Steps are persisted by encoding them as JSON, so
+they need to keep their learned state in exported
+fields like all of the transformers in this
+package do.
+
+Example Pipeline Usage:
+
+	pipeline := NewPipeline(
+		linear.NewLeastSquares(base.BatchGD, 1e-2, 0, 800, nil, nil),
+		NewImputer(ImputeMean, 0),
+		NewStandardScaler(),
+	)
+
+	err := pipeline.Fit(trainX, trainY)
+	if err != nil {
+		panic("couldn't fit the pipeline!")
+	}
+
+	err = pipeline.PersistToFile("/tmp/.goml/pipeline.json")
+	if err != nil {
+		panic("couldn't persist the pipeline!")
+	}
+
+	// ...later, at serving time
+	served := NewPipeline(
+		linear.NewLeastSquares(base.BatchGD, 0, 0, 0, nil, nil),
+		NewImputer(ImputeMean, 0),
+		NewStandardScaler(),
+	)
+
+	err = served.RestoreFromFile("/tmp/.goml/pipeline.json")
+	if err != nil {
+		panic("couldn't restore the pipeline!")
+	}
+
+	guess, err := served.Predict([]float64{1.2, math.NaN(), 4})
+*/
+type Pipeline struct {
+	Steps []Transformer
+	Model Predictor
+}
+
+// persistedComponent is how a single step (or the
+// model) of a Pipeline is stored on disk.
+type persistedComponent struct {
+	Type  string          `json:"type"`
+	State json.RawMessage `json:"state"`
+}
+
+// persistedPipeline is how a Pipeline (or a
+// SparsePipeline) is stored on disk.
+type persistedPipeline struct {
+	Vectorizer *persistedComponent  `json:"vectorizer,omitempty"`
+	Steps      []persistedComponent `json:"steps"`
+	Model      persistedComponent   `json:"model"`
+}
+
+// NewPipeline returns a pointer to a Pipeline which
+// runs inputs through the given steps, in order,
+// before predicting with model.
+func NewPipeline(model Predictor, steps ...Transformer) *Pipeline {
+	return &Pipeline{
+		Steps: steps,
+		Model: model,
+	}
+}
+
+// Fit fits every step of the pipeline, each on the
+// output of the step before it, and then gives the
+// fully transformed training set to the model and
+// (if the model needs it) tells it to learn.
+//
+// Models that don't take a training set through
+// UpdateTrainingSet (like the online Perceptron)
+// can't be fit by the pipeline, but you can still
+// train them separately and use them here for
+// prediction.
+func (p *Pipeline) Fit(x [][]float64, y []float64) error {
+	if p.Model == nil {
+		return fmt.Errorf("ERROR: Attempting to fit a pipeline with no model!")
+	}
+
+	model, ok := p.Model.(trainable)
+	if !ok {
+		return fmt.Errorf("ERROR: the pipeline's model (%T) can't be given a training set", p.Model)
+	}
+
+	var err error
+	for i, step := range p.Steps {
+		err = step.Fit(x)
+		if err != nil {
+			return fmt.Errorf("ERROR: fitting step %v (%T) of the pipeline: %v", i, step, err)
+		}
+
+		x, err = step.Transform(x)
+		if err != nil {
+			return fmt.Errorf("ERROR: transforming with step %v (%T) of the pipeline: %v", i, step, err)
+		}
+	}
+
+	err = model.UpdateTrainingSet(x, y)
+	if err != nil {
+		return err
+	}
+
+	if l, ok := p.Model.(learner); ok {
+		return l.Learn()
+	}
+
+	return nil
+}
+
+// Transform runs x through every step of the
+// pipeline, returning the input the model would
+// see. x is not modified.
+func (p *Pipeline) Transform(x [][]float64) ([][]float64, error) {
+	var err error
+	for i, step := range p.Steps {
+		x, err = step.Transform(x)
+		if err != nil {
+			return nil, fmt.Errorf("ERROR: transforming with step %v (%T) of the pipeline: %v", i, step, err)
+		}
+	}
+
+	return x, nil
+}
+
+// Predict runs x through every step of the pipeline
+// and returns the model's prediction. x is not
+// modified.
+func (p *Pipeline) Predict(x []float64) ([]float64, error) {
+	if p.Model == nil {
+		return nil, fmt.Errorf("ERROR: Attempting to predict with a pipeline with no model!")
+	}
+
+	transformed, err := p.Transform([][]float64{x})
+	if err != nil {
+		return nil, err
+	}
+
+	return p.Model.Predict(transformed[0])
+}
+
+// PersistToFile takes in an absolute filepath and saves
+// every step of the pipeline along with the model to
+// a single file, which can be restored later with
+// RestoreFromFile.
+//
+// The file is written to a temporary file in the same
+// directory first and then renamed over path, so a
+// reader will never see a half written pipeline.
+func (p *Pipeline) PersistToFile(path string) error {
+	if path == "" {
+		return fmt.Errorf("ERROR: you just tried to persist your pipeline to a file with no path!! That's a no-no. Try it with a valid filepath")
+	}
+
+	persisted := persistedPipeline{
+		Steps: make([]persistedComponent, len(p.Steps)),
+	}
+
+	var err error
+	for i, step := range p.Steps {
+		persisted.Steps[i], err = persistComponent(step)
+		if err != nil {
+			return err
+		}
+	}
+
+	persisted.Model, err = persistModel(p.Model)
+	if err != nil {
+		return err
+	}
+
+	bytes, err := json.Marshal(persisted)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, bytes)
+}
+
+// RestoreFromFile takes in a path to a persisted
+// pipeline and restores the state of every step and
+// the model of the pipeline it's operating on. The
+// pipeline must have been built with the same types
+// of steps, in the same order, and the same type of
+// model as the one that was persisted.
+//
+// The steps are decoded before anything is touched
+// and only swapped in once the model has been
+// restored, so a bad file won't leave you with new
+// steps in front of an old model. Fields of a step
+// which aren't persisted (tagged `json:"-"`) are kept
+// from the step the pipeline was built with.
+func (p *Pipeline) RestoreFromFile(path string) error {
+	if path == "" {
+		return fmt.Errorf("ERROR: you just tried to restore your pipeline from a file with no path! That's a no-no. Try it with a valid filepath")
+	}
+
+	persisted, err := readPipeline(path)
+	if err != nil {
+		return err
+	}
+
+	if persisted.Vectorizer != nil {
+		return fmt.Errorf("ERROR: the persisted pipeline has a vectorizer, restore it into a SparsePipeline")
+	}
+	if len(persisted.Steps) != len(p.Steps) {
+		return fmt.Errorf("ERROR: persisted pipeline has %v steps but this pipeline has %v", len(persisted.Steps), len(p.Steps))
+	}
+
+	// decode every step into a fresh value first so
+	// a bad file can't leave the pipeline half restored
+	steps := make([]Transformer, len(p.Steps))
+	for i, step := range p.Steps {
+		fresh, err := restoreComponent(fmt.Sprintf("step %v", i), persisted.Steps[i], step)
+		if err != nil {
+			return err
+		}
+
+		steps[i] = fresh.(Transformer)
+	}
+
+	err = restoreModel(p.Model, persisted.Model)
+	if err != nil {
+		return err
+	}
+
+	p.Steps = steps
+	return nil
+}
+
+// readPipeline reads a persisted pipeline (dense
+// or sparse) from path.
+func readPipeline(path string) (persistedPipeline, error) {
+	var persisted persistedPipeline
+
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return persisted, err
+	}
+
+	err = json.Unmarshal(bytes, &persisted)
+	return persisted, err
+}
+
+// persistComponent encodes a step of a pipeline
+// (or its vectorizer) as JSON, along with its type.
+func persistComponent(component interface{}) (persistedComponent, error) {
+	state, err := json.Marshal(component)
+	if err != nil {
+		return persistedComponent{}, err
+	}
+
+	return persistedComponent{
+		Type:  fmt.Sprintf("%T", component),
+		State: state,
+	}, nil
+}
+
+// persistModel encodes the model of a pipeline
+// with its own PersistToFile.
+func persistModel(model interface{}) (persistedComponent, error) {
+	p, ok := model.(base.Persister)
+	if !ok {
+		return persistedComponent{}, fmt.Errorf("ERROR: the pipeline's model (%T) can't be persisted", model)
+	}
+
+	state, err := base.PersistToBytes(p)
+	if err != nil {
+		return persistedComponent{}, err
+	}
+
+	return persistedComponent{
+		Type:  fmt.Sprintf("%T", model),
+		State: state,
+	}, nil
+}
+
+// restoreComponent checks that the persisted
+// component (called name in errors) has the same
+// type as component, and decodes it into a fresh
+// copy of component, leaving component itself alone.
+func restoreComponent(name string, persisted persistedComponent, component interface{}) (interface{}, error) {
+	if persisted.Type != fmt.Sprintf("%T", component) {
+		return nil, fmt.Errorf("ERROR: %v of the persisted pipeline is a %v but this pipeline has a %T", name, persisted.Type, component)
+	}
+
+	fresh, err := freshCopy(component)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(persisted.State, fresh)
+	if err != nil {
+		return nil, fmt.Errorf("ERROR: restoring %v (%T) of the pipeline: %v", name, component, err)
+	}
+
+	return fresh, nil
+}
+
+// restoreModel checks that the persisted model has
+// the same type as model, and restores it with the
+// model's own RestoreFromFile (into a copy of it,
+// which is only swapped in if that succeeds, so model
+// is left alone on errors.)
+func restoreModel(model interface{}, persisted persistedComponent) error {
+	p, ok := model.(base.Persister)
+	if !ok {
+		return fmt.Errorf("ERROR: the pipeline's model (%T) can't be restored", model)
+	}
+	if persisted.Type != fmt.Sprintf("%T", model) {
+		return fmt.Errorf("ERROR: the persisted pipeline's model is a %v but this pipeline has a %T", persisted.Type, model)
+	}
+
+	return base.RestoreFromBytes(p, persisted.State)
+}
+
+// freshCopy returns a new pointer of the same
+// concrete type as component so it can be decoded
+// into without touching component itself. Exported
+// fields which aren't persisted (tagged `json:"-"`,
+// like a vectorizer's Tokenizer) are copied over
+// from component, since the file can't hold them.
+func freshCopy(component interface{}) (interface{}, error) {
+	t := reflect.TypeOf(component)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return nil, fmt.Errorf("ERROR: pipeline steps must be pointers to be restored, got a %T", component)
+	}
+
+	fresh := reflect.New(t.Elem())
+	if t.Elem().Kind() == reflect.Struct {
+		from := reflect.ValueOf(component).Elem()
+		for i := 0; i < t.Elem().NumField(); i++ {
+			field := t.Elem().Field(i)
+			if field.PkgPath == "" && field.Tag.Get("json") == "-" {
+				fresh.Elem().Field(i).Set(from.Field(i))
+			}
+		}
+	}
+
+	return fresh.Interface(), nil
+}
+
+// writeFileAtomic writes data to a temporary file
+// next to path and then renames it over path.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	err = os.Chmod(tmp.Name(), os.ModePerm)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,152 @@
+package preprocess
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"testing"
+
+	"github.com/bountylabs/goml/base"
+	"github.com/bountylabs/goml/cluster"
+	"github.com/bountylabs/goml/linear"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	// the plane y = 3 + 2x[0] - x[1]/100 where
+	// the second feature is on a much larger
+	// scale than the first
+	planeX [][]float64
+	planeY []float64
+)
+
+func init() {
+	planeX = [][]float64{}
+	planeY = []float64{}
+	for i := -10.0; i < 10; i++ {
+		for j := -1000.0; j < 1000; j += 100 {
+			planeX = append(planeX, []float64{i, j})
+			planeY = append(planeY, 3+2*i-j/100)
+		}
+	}
+}
+
+func newPlanePipeline() *Pipeline {
+	model := linear.NewLeastSquares(base.BatchGD, 0.1, 0, 1000, nil, nil, 2)
+	model.Output = ioutil.Discard
+
+	return NewPipeline(model, NewImputer(ImputeMean, 0), NewStandardScaler())
+}
+
+func TestPipelineShouldPass1(t *testing.T) {
+	pipeline := newPlanePipeline()
+
+	before := copyOf(planeX)
+	assert.Nil(t, pipeline.Fit(planeX, planeY), "Fit error should be nil")
+	assert.Equal(t, before, planeX, "Fit should not modify its input")
+
+	for i := -10.0; i < 10; i += 3 {
+		for j := -1000.0; j < 1000; j += 300 {
+			x := []float64{i, j}
+			guess, err := pipeline.Predict(x)
+			assert.Nil(t, err, "Prediction error should be nil")
+			assert.Len(t, guess, 1, "Guess should have length 1")
+			assert.InDelta(t, 3+2*i-j/100, guess[0], 1e-2, "Guess should be close to the plane")
+			assert.Equal(t, []float64{i, j}, x, "Predict should not modify its input")
+		}
+	}
+
+	// the imputer fills in the missing value with
+	// the mean of the feature (-50)
+	guess, err := pipeline.Predict([]float64{1, math.NaN()})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.InDelta(t, 5.5, guess[0], 1e-2, "Missing values should be imputed")
+}
+
+func TestPipelineShouldPass2(t *testing.T) {
+	// KNN takes a training set but doesn't learn
+	knn := cluster.NewKNN(1, nil, nil, base.EuclideanDistance)
+	pipeline := NewPipeline(knn, NewMinMaxScaler())
+
+	x := [][]float64{{0, 0}, {0, 1000}, {10, 0}, {10, 1000}}
+	y := []float64{0, 1, 2, 3}
+	assert.Nil(t, pipeline.Fit(x, y), "Fit error should be nil")
+
+	guess, err := pipeline.Predict([]float64{9, 100})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, 2.0, guess[0], "Nearest neighbor should be found on the scaled features")
+}
+
+func TestPipelineShouldFail1(t *testing.T) {
+	pipeline := NewPipeline(nil, NewStandardScaler())
+	assert.NotNil(t, pipeline.Fit(planeX, planeY), "Fitting without a model should return an error")
+
+	_, err := pipeline.Predict([]float64{1, 2})
+	assert.NotNil(t, err, "Predicting without a model should return an error")
+
+	pipeline = newPlanePipeline()
+	_, err = pipeline.Predict([]float64{1, 2})
+	assert.NotNil(t, err, "Predicting before fitting should return an error")
+}
+
+func TestPipelinePersistToFileShouldPass1(t *testing.T) {
+	pipeline := newPlanePipeline()
+	assert.Nil(t, pipeline.Fit(planeX, planeY), "Fit error should be nil")
+	assert.Nil(t, pipeline.PersistToFile("/tmp/.goml/Pipeline.json"), "Persist error should be nil")
+
+	restored := newPlanePipeline()
+	assert.Nil(t, restored.RestoreFromFile("/tmp/.goml/Pipeline.json"), "Restore error should be nil")
+
+	for i := -10.0; i < 10; i += 3 {
+		for j := -1000.0; j < 1000; j += 300 {
+			expected, err := pipeline.Predict([]float64{i, j})
+			assert.Nil(t, err, "Prediction error should be nil")
+
+			actual, err := restored.Predict([]float64{i, j})
+			assert.Nil(t, err, "Prediction error should be nil")
+
+			assert.Equal(t, expected, actual, "Restored pipeline should predict exactly like the original")
+		}
+	}
+}
+
+func TestPipelinePersistToFileShouldFail1(t *testing.T) {
+	pipeline := newPlanePipeline()
+	assert.Nil(t, pipeline.Fit(planeX, planeY), "Fit error should be nil")
+	assert.Nil(t, pipeline.PersistToFile("/tmp/.goml/Pipeline.json"), "Persist error should be nil")
+
+	// steps in a different order
+	model := linear.NewLeastSquares(base.BatchGD, 0, 0, 0, nil, nil, 2)
+	restored := NewPipeline(model, NewStandardScaler(), NewImputer(ImputeMean, 0))
+	assert.NotNil(t, restored.RestoreFromFile("/tmp/.goml/Pipeline.json"), "Restoring into mismatched steps should return an error")
+
+	// a different model
+	restored = NewPipeline(linear.NewSoftmax(base.BatchGD, 0, 0, 2, 0, nil, nil, 2), NewImputer(ImputeMean, 0), NewStandardScaler())
+	assert.NotNil(t, restored.RestoreFromFile("/tmp/.goml/Pipeline.json"), "Restoring into a mismatched model should return an error")
+
+	// KNN can't be persisted
+	knn := NewPipeline(cluster.NewKNN(1, nil, nil, base.EuclideanDistance))
+	assert.NotNil(t, knn.PersistToFile("/tmp/.goml/PipelineKNN.json"), "Persisting a model without persistence should return an error")
+
+	// a model state which only fails part way
+	// through decoding
+	persisted := map[string]interface{}{}
+	bytes, err := ioutil.ReadFile("/tmp/.goml/Pipeline.json")
+	assert.Nil(t, err, "Read error should be nil")
+	assert.Nil(t, json.Unmarshal(bytes, &persisted), "Unmarshal error should be nil")
+	persisted["model"].(map[string]interface{})["state"] = []interface{}{1, 2, "three"}
+	bytes, err = json.Marshal(persisted)
+	assert.Nil(t, err, "Marshal error should be nil")
+	assert.Nil(t, ioutil.WriteFile("/tmp/.goml/PipelineBroken.json", bytes, 0775), "Write error should be nil")
+
+	expected, err := pipeline.Predict([]float64{3, 500})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.NotNil(t, pipeline.RestoreFromFile("/tmp/.goml/PipelineBroken.json"), "Restoring a broken model state should return an error")
+	actual, err := pipeline.Predict([]float64{3, 500})
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.Equal(t, expected, actual, "A failed restore shouldn't change the pipeline")
+
+	assert.NotNil(t, pipeline.PersistToFile(""), "Persisting to an empty path should return an error")
+	assert.NotNil(t, pipeline.RestoreFromFile(""), "Restoring from an empty path should return an error")
+}
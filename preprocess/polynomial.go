@@ -0,0 +1,347 @@
+package preprocess
+
+import (
+	"fmt"
+	"sort"
+)
+
+/*
+PolynomialFeatures expands every input into all of
+the products of its features up to Degree, which
+lets the linear models fit curves (and curved
+surfaces) instead of only hyperplanes. With two
+features [a, b] and a degree of 2 the output is
+
+	[a, b, a², ab, b²]
+
+or, if InteractionOnly is true (so no feature is
+multiplied by itself)
+
+	[a, b, ab]
+
+IncludeBias adds a leading constant 1 feature. The
+goml linear models already learn their own constant
+term, so you usually want to leave it off.
+
+The output order is always the same: the bias (if
+any), then the degree 1 terms, then the degree 2
+terms, and so on, with the terms of each degree in
+lexicographic order of the features they multiply.
+TransformSparse uses the same order, so a sparse
+input gives the same features (at the same indices)
+as its dense equivalent, without ever building the
+zero products.
+
+Example Polynomial Regression:
+
+	// fit y = 2 + x - 3x² + x³
+	poly := NewPolynomialFeatures(3, false, false)
+
+	err := poly.Fit(trainX)
+	if err != nil {
+		panic("couldn't fit the polynomial features!")
+	}
+
+	expanded, err := poly.Transform(trainX)
+	if err != nil {
+		panic("couldn't expand the training set!")
+	}
+
+	model := linear.NewLeastSquares(base.BatchGD, 1e-4, 0, 1500, expanded, trainY)
+*/
+type PolynomialFeatures struct {
+	// Degree is the highest degree of the
+	// products in the output.
+	Degree int `json:"degree"`
+
+	// InteractionOnly keeps only products of
+	// distinct features (ab, but not a² or a²b.)
+	InteractionOnly bool `json:"interaction_only"`
+
+	// IncludeBias adds a constant 1 as the
+	// first output feature.
+	IncludeBias bool `json:"include_bias"`
+
+	// Features is the number of input features,
+	// learned in Fit (or given to FitSparse.)
+	Features int `json:"features"`
+}
+
+// NewPolynomialFeatures returns a pointer to a
+// PolynomialFeatures transformer which generates
+// products of features up to the given degree.
+func NewPolynomialFeatures(degree int, interactionOnly, includeBias bool) *PolynomialFeatures {
+	return &PolynomialFeatures{
+		Degree:          degree,
+		InteractionOnly: interactionOnly,
+		IncludeBias:     includeBias,
+	}
+}
+
+// Fit learns the number of input features.
+func (p *PolynomialFeatures) Fit(x [][]float64) error {
+	if len(x) == 0 || len(x[0]) == 0 {
+		return fmt.Errorf("ERROR: Attempting to fit with no training examples!")
+	}
+	if err := checkDims(x, len(x[0])); err != nil {
+		return err
+	}
+
+	return p.FitSparse(nil, len(x[0]))
+}
+
+// FitSparse sets the number of input features for
+// sparse inputs (which don't know their own width)
+// and checks that every index in x is within it. x
+// can be nil if you only want to set the width.
+func (p *PolynomialFeatures) FitSparse(x []map[int]float64, features int) error {
+	if p.Degree < 1 {
+		return fmt.Errorf("ERROR: polynomial features need a degree of at least 1, given %v", p.Degree)
+	}
+	if features < 1 {
+		return fmt.Errorf("ERROR: Attempting to fit polynomial features with %v input features!", features)
+	}
+
+	for i := range x {
+		for j := range x[i] {
+			if j < 0 || j >= features {
+				return fmt.Errorf("ERROR: row %v has feature index %v which is outside of the %v features given", i, j, features)
+			}
+		}
+	}
+
+	p.Features = features
+	return nil
+}
+
+// check makes sure the transformer has been fit.
+func (p *PolynomialFeatures) check() error {
+	if p.Features == 0 {
+		return fmt.Errorf("ERROR: Attempting to transform with polynomial features that haven't been fit!")
+	}
+
+	return nil
+}
+
+// terms returns the number of distinct products of
+// exactly d features (out of n.)
+func (p *PolynomialFeatures) terms(n, d int) int {
+	if p.InteractionOnly {
+		return binomial(n, d)
+	}
+	return binomial(n+d-1, d)
+}
+
+// OutputFeatures returns the number of features
+// Transform produces, which is what you should
+// give the linear models as their number of
+// features.
+func (p *PolynomialFeatures) OutputFeatures() int {
+	total := 0
+	if p.IncludeBias {
+		total++
+	}
+
+	for d := 1; d <= p.Degree; d++ {
+		total += p.terms(p.Features, d)
+	}
+
+	return total
+}
+
+// index returns the output index of the product of
+// the features in combo, which must be sorted (and,
+// for InteractionOnly, distinct.)
+func (p *PolynomialFeatures) index(combo []int) int {
+	n := p.Features
+	d := len(combo)
+
+	index := 0
+	if p.IncludeBias {
+		index++
+	}
+	for e := 1; e < d; e++ {
+		index += p.terms(n, e)
+	}
+
+	// count the products of degree d which come
+	// before combo lexicographically
+	prev := 0
+	for i, feature := range combo {
+		left := d - i - 1
+		for v := prev; v < feature; v++ {
+			if p.InteractionOnly {
+				index += binomial(n-v-1, left)
+			} else {
+				index += binomial(n-v+left-1, left)
+			}
+		}
+
+		prev = feature
+		if p.InteractionOnly {
+			prev++
+		}
+	}
+
+	return index
+}
+
+// expand calls f with every product of up to Degree
+// of the given (sorted) features, in output order.
+func (p *PolynomialFeatures) expand(features []int, values []float64, f func(combo []int, product float64)) {
+	combo := make([]int, 0, p.Degree)
+
+	var recurse func(start, left int, product float64)
+	recurse = func(start, left int, product float64) {
+		if left == 0 {
+			f(combo, product)
+			return
+		}
+
+		for i := start; i < len(features); i++ {
+			combo = append(combo, features[i])
+
+			next := i
+			if p.InteractionOnly {
+				next++
+			}
+			recurse(next, left-1, product*values[i])
+
+			combo = combo[:len(combo)-1]
+		}
+	}
+
+	for d := 1; d <= p.Degree; d++ {
+		recurse(0, d, 1)
+	}
+}
+
+// Transform returns the polynomial expansion of
+// every row of x.
+func (p *PolynomialFeatures) Transform(x [][]float64) ([][]float64, error) {
+	if err := p.check(); err != nil {
+		return nil, err
+	}
+	if err := checkDims(x, p.Features); err != nil {
+		return nil, err
+	}
+
+	features := make([]int, p.Features)
+	for i := range features {
+		features[i] = i
+	}
+
+	result := make([][]float64, len(x))
+	for i := range x {
+		row := make([]float64, 0, p.OutputFeatures())
+		if p.IncludeBias {
+			row = append(row, 1)
+		}
+
+		p.expand(features, x[i], func(combo []int, product float64) {
+			row = append(row, product)
+		})
+
+		result[i] = row
+	}
+
+	return result, nil
+}
+
+// TransformSparse returns the polynomial expansion of
+// every sparse row of x, only computing the products
+// of non-zero features. Indices match the output of
+// Transform on the same (dense) input.
+func (p *PolynomialFeatures) TransformSparse(x []map[int]float64) ([]map[int]float64, error) {
+	if err := p.check(); err != nil {
+		return nil, err
+	}
+
+	result := make([]map[int]float64, len(x))
+	for i := range x {
+		features := make([]int, 0, len(x[i]))
+		for j, v := range x[i] {
+			if j < 0 || j >= p.Features {
+				return nil, fmt.Errorf("ERROR: row %v has feature index %v but the transformer was fit on %v features", i, j, p.Features)
+			}
+			if v != 0 {
+				features = append(features, j)
+			}
+		}
+		sort.Ints(features)
+
+		values := make([]float64, len(features))
+		for k, j := range features {
+			values[k] = x[i][j]
+		}
+
+		row := make(map[int]float64)
+		if p.IncludeBias {
+			row[0] = 1
+		}
+
+		p.expand(features, values, func(combo []int, product float64) {
+			row[p.index(combo)] = product
+		})
+
+		result[i] = row
+	}
+
+	return result, nil
+}
+
+// InverseTransform recovers the original features
+// from the degree 1 terms of the expansion.
+func (p *PolynomialFeatures) InverseTransform(x [][]float64) ([][]float64, error) {
+	if err := p.check(); err != nil {
+		return nil, err
+	}
+	if err := checkDims(x, p.OutputFeatures()); err != nil {
+		return nil, err
+	}
+
+	offset := 0
+	if p.IncludeBias {
+		offset = 1
+	}
+
+	result := make([][]float64, len(x))
+	for i := range x {
+		result[i] = append([]float64{}, x[i][offset:offset+p.Features]...)
+	}
+
+	return result, nil
+}
+
+// PersistToFile takes in an absolute filepath and saves
+// the degree, options and number of input features to
+// the file, which can be restored later with
+// RestoreFromFile.
+func (p *PolynomialFeatures) PersistToFile(path string) error {
+	return persistToFile(path, p)
+}
+
+// RestoreFromFile takes in a path to persisted polynomial
+// features and assigns its settings to the transformer
+// it's operating on.
+func (p *PolynomialFeatures) RestoreFromFile(path string) error {
+	return restoreFromFile(path, p)
+}
+
+// binomial returns n choose k, or 0 if k is out of
+// range.
+func binomial(n, k int) int {
+	if k < 0 || k > n {
+		return 0
+	}
+	if k > n-k {
+		k = n - k
+	}
+
+	result := 1
+	for i := 1; i <= k; i++ {
+		result = result * (n - k + i) / i
+	}
+
+	return result
+}
@@ -0,0 +1,131 @@
+package preprocess
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/bountylabs/goml/base"
+	"github.com/bountylabs/goml/linear"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolynomialFeaturesShouldPass1(t *testing.T) {
+	poly := NewPolynomialFeatures(2, false, true)
+	assert.Nil(t, poly.Fit([][]float64{{2, 3}}), "Fit error should be nil")
+	assert.Equal(t, 6, poly.OutputFeatures(), "There should be 6 output features")
+
+	expanded, err := poly.Transform([][]float64{{2, 3}})
+	assert.Nil(t, err, "Transform error should be nil")
+	assert.Equal(t, []float64{1, 2, 3, 4, 6, 9}, expanded[0], "Expansion should be [1, a, b, a², ab, b²]")
+
+	original, err := poly.InverseTransform(expanded)
+	assert.Nil(t, err, "InverseTransform error should be nil")
+	assert.Equal(t, [][]float64{{2, 3}}, original, "InverseTransform should recover the input")
+}
+
+func TestPolynomialFeaturesShouldPass2(t *testing.T) {
+	poly := NewPolynomialFeatures(3, true, false)
+	assert.Nil(t, poly.Fit([][]float64{{2, 3, 5}}), "Fit error should be nil")
+	assert.Equal(t, 7, poly.OutputFeatures(), "There should be 7 output features")
+
+	expanded, err := poly.Transform([][]float64{{2, 3, 5}})
+	assert.Nil(t, err, "Transform error should be nil")
+	assert.Equal(t, []float64{2, 3, 5, 6, 10, 15, 30}, expanded[0], "Expansion should be [a, b, c, ab, ac, bc, abc]")
+}
+
+// sparse expansion should match the dense one
+func TestPolynomialFeaturesSparseShouldPass1(t *testing.T) {
+	dense := [][]float64{
+		{0, 2, 0, 3},
+		{1, 0, 0, 0},
+		{0, 0, 0, 0},
+		{4, 5, 6, 7},
+	}
+
+	for _, interactionOnly := range []bool{false, true} {
+		for _, bias := range []bool{false, true} {
+			poly := NewPolynomialFeatures(3, interactionOnly, bias)
+			assert.Nil(t, poly.Fit(dense), "Fit error should be nil")
+
+			expected, err := poly.Transform(dense)
+			assert.Nil(t, err, "Transform error should be nil")
+
+			sparse := make([]map[int]float64, len(dense))
+			for i := range dense {
+				sparse[i] = map[int]float64{}
+				for j, v := range dense[i] {
+					if v != 0 {
+						sparse[i][j] = v
+					}
+				}
+			}
+
+			expanded, err := poly.TransformSparse(sparse)
+			assert.Nil(t, err, "TransformSparse error should be nil")
+
+			for i := range expected {
+				for j, v := range expected[i] {
+					assert.Equal(t, v, expanded[i][j], "Sparse feature %v of row %v should match the dense expansion (interaction only: %v, bias: %v)", j, i, interactionOnly, bias)
+				}
+				for j := range expanded[i] {
+					assert.True(t, j < poly.OutputFeatures(), "Sparse index %v should be within the output features", j)
+				}
+			}
+		}
+	}
+}
+
+func TestPolynomialFeaturesShouldFail1(t *testing.T) {
+	poly := NewPolynomialFeatures(2, false, false)
+	_, err := poly.Transform([][]float64{{1, 2}})
+	assert.NotNil(t, err, "Transforming before fitting should return an error")
+
+	assert.NotNil(t, NewPolynomialFeatures(0, false, false).Fit([][]float64{{1}}), "A degree of 0 should return an error")
+
+	assert.Nil(t, poly.FitSparse(nil, 2), "FitSparse error should be nil")
+	_, err = poly.TransformSparse([]map[int]float64{{5: 1}})
+	assert.NotNil(t, err, "Out of range sparse indices should return an error")
+
+	_, err = poly.Transform([][]float64{{1, 2, 3}})
+	assert.NotNil(t, err, "Transforming the wrong number of features should return an error")
+}
+
+// fit y = 2 + x - 3x² + x³ with least squares
+func TestPolynomialRegressionShouldPass1(t *testing.T) {
+	x := [][]float64{}
+	y := []float64{}
+	for i := -2.0; i < 3; i += 0.1 {
+		x = append(x, []float64{i})
+		y = append(y, 2+i-3*i*i+i*i*i)
+	}
+
+	poly := NewPolynomialFeatures(3, false, false)
+	assert.Nil(t, poly.Fit(x), "Fit error should be nil")
+
+	expanded, err := poly.Transform(x)
+	assert.Nil(t, err, "Transform error should be nil")
+
+	model := linear.NewLeastSquares(base.BatchGD, 1e-3, 0, 20000, expanded, y)
+	model.Output = ioutil.Discard
+	assert.Nil(t, model.Learn(), "Learning error should be nil")
+
+	for i := -1.5; i < 2.5; i += 0.5 {
+		input, err := poly.Transform([][]float64{{i}})
+		assert.Nil(t, err, "Transform error should be nil")
+
+		guess, err := model.Predict(input[0])
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.InDelta(t, 2+i-3*i*i+i*i*i, guess[0], 0.5, "Guess should be close to the cubic at %v", i)
+	}
+}
+
+func TestPolynomialFeaturesPersistToFileShouldPass1(t *testing.T) {
+	poly := NewPolynomialFeatures(4, true, true)
+	assert.Nil(t, poly.FitSparse(nil, 10), "FitSparse error should be nil")
+	assert.Nil(t, poly.PersistToFile("/tmp/.goml/polynomial.json"), "Persistance error should be nil")
+
+	restored := NewPolynomialFeatures(1, false, false)
+	assert.Nil(t, restored.RestoreFromFile("/tmp/.goml/polynomial.json"), "Restoring error should be nil")
+	assert.Equal(t, poly, restored, "Restored transformer should match")
+}
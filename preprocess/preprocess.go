@@ -0,0 +1,162 @@
+/*
+Package preprocess holds feature transformations
+which are fit on a training set and then applied,
+exactly the same way, to every input the model
+sees afterwards. Scalers, encoders and imputers
+all learn their statistics in Fit, apply them in
+Transform, and can undo them (where that makes
+sense) in InverseTransform.
+
+Every transformer persists its learned state as
+JSON with PersistToFile and RestoreFromFile so
+the transform you trained with is the same one
+you serve with.
+
+None of the transformers modify the data you
+pass to them. Transform always returns new
+slices.
+
+Example Standard Scaler Usage:
+
+	scaler := NewStandardScaler()
+
+	err := scaler.Fit(trainX)
+	if err != nil {
+		panic("couldn't fit the scaler!")
+	}
+
+	scaled, err := scaler.Transform(trainX)
+	if err != nil {
+		panic("couldn't scale the training set!")
+	}
+
+	model := linear.NewLeastSquares(base.BatchGD, 1e-4, 0, 800, scaled, trainY)
+
+	// ...later, at serving time
+	err = scaler.PersistToFile("/tmp/.goml/scaler.json")
+*/
+package preprocess
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+)
+
+// Transformer is anything that can learn a
+// transformation of a dense dataset and then
+// apply it (or undo it) to new data of the
+// same shape.
+type Transformer interface {
+	// Fit learns whatever statistics the
+	// transformation needs from the given
+	// dataset.
+	Fit([][]float64) error
+
+	// Transform applies the learned
+	// transformation, returning new slices
+	// and leaving the input untouched.
+	Transform([][]float64) ([][]float64, error)
+
+	// InverseTransform maps transformed data
+	// back into the original feature space.
+	InverseTransform([][]float64) ([][]float64, error)
+}
+
+// isMissing reports whether a value should be
+// treated as missing. NaN is used as the missing
+// value marker throughout the package.
+func isMissing(v float64) bool {
+	return math.IsNaN(v)
+}
+
+// checkDims makes sure that every row of x has
+// exactly n features.
+func checkDims(x [][]float64, n int) error {
+	for i := range x {
+		if len(x[i]) != n {
+			return fmt.Errorf("ERROR: row %v has %v features but the transformer was fit on %v features", i, len(x[i]), n)
+		}
+	}
+
+	return nil
+}
+
+// columns returns the non-missing values of each
+// feature in x, one slice per feature.
+func columns(x [][]float64) ([][]float64, error) {
+	if len(x) == 0 || len(x[0]) == 0 {
+		return nil, fmt.Errorf("ERROR: Attempting to fit with no training examples!")
+	}
+
+	features := len(x[0])
+	if err := checkDims(x, features); err != nil {
+		return nil, err
+	}
+
+	cols := make([][]float64, features)
+	for i := range x {
+		for j, v := range x[i] {
+			if isMissing(v) {
+				continue
+			}
+			cols[j] = append(cols[j], v)
+		}
+	}
+
+	return cols, nil
+}
+
+// apply runs f over every non-missing value of
+// x, returning a new dataset.
+func apply(x [][]float64, features int, f func(j int, v float64) float64) ([][]float64, error) {
+	if err := checkDims(x, features); err != nil {
+		return nil, err
+	}
+
+	result := make([][]float64, len(x))
+	for i := range x {
+		result[i] = make([]float64, len(x[i]))
+		for j, v := range x[i] {
+			if isMissing(v) {
+				result[i][j] = v
+				continue
+			}
+			result[i][j] = f(j, v)
+		}
+	}
+
+	return result, nil
+}
+
+// persistToFile saves the JSON encoding of v
+// to path.
+func persistToFile(path string, v interface{}) error {
+	if path == "" {
+		return fmt.Errorf("ERROR: you just tried to persist your transformer to a file with no path!! That's a no-no. Try it with a valid filepath")
+	}
+
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, bytes, os.ModePerm)
+}
+
+// restoreFromFile reads the JSON encoded
+// state at path into v.
+func restoreFromFile(path string, v interface{}) error {
+	if path == "" {
+		return fmt.Errorf("ERROR: you just tried to restore your transformer from a file with no path! That's a no-no. Try it with a valid filepath")
+	}
+
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(bytes, v)
+}
@@ -0,0 +1,316 @@
+package preprocess
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// StandardScaler scales each feature to have
+// zero mean and unit variance:
+//
+//	x'[j] = (x[j] - μ[j]) / σ[j]
+//
+// Features with zero variance are only centered
+// (σ is taken to be 1) so constant columns don't
+// blow up into NaN's. Missing values (NaN) are
+// ignored while fitting and passed through
+// untouched while transforming.
+type StandardScaler struct {
+	Mean  []float64 `json:"mean"`
+	Scale []float64 `json:"scale"`
+}
+
+// NewStandardScaler returns a pointer to an
+// unfit StandardScaler.
+func NewStandardScaler() *StandardScaler {
+	return &StandardScaler{}
+}
+
+// Fit computes the per-feature mean and standard
+// deviation of x.
+func (s *StandardScaler) Fit(x [][]float64) error {
+	cols, err := columns(x)
+	if err != nil {
+		return err
+	}
+
+	s.Mean = make([]float64, len(cols))
+	s.Scale = make([]float64, len(cols))
+	for j, col := range cols {
+		s.Scale[j] = 1
+		if len(col) == 0 {
+			continue
+		}
+
+		var sum float64
+		for _, v := range col {
+			sum += v
+		}
+		mean := sum / float64(len(col))
+
+		var variance float64
+		for _, v := range col {
+			variance += (v - mean) * (v - mean)
+		}
+		variance /= float64(len(col))
+
+		s.Mean[j] = mean
+		if variance > 0 {
+			s.Scale[j] = math.Sqrt(variance)
+		}
+	}
+
+	return nil
+}
+
+// Transform returns a standardized copy of x.
+func (s *StandardScaler) Transform(x [][]float64) ([][]float64, error) {
+	if s.Mean == nil {
+		return nil, fmt.Errorf("ERROR: StandardScaler must be fit before transforming data")
+	}
+
+	return apply(x, len(s.Mean), func(j int, v float64) float64 {
+		return (v - s.Mean[j]) / s.Scale[j]
+	})
+}
+
+// InverseTransform maps standardized data back
+// to the original scale of the features.
+func (s *StandardScaler) InverseTransform(x [][]float64) ([][]float64, error) {
+	if s.Mean == nil {
+		return nil, fmt.Errorf("ERROR: StandardScaler must be fit before transforming data")
+	}
+
+	return apply(x, len(s.Mean), func(j int, v float64) float64 {
+		return v*s.Scale[j] + s.Mean[j]
+	})
+}
+
+// PersistToFile takes in an absolute filepath and saves the
+// learned means and scales to the file, which can be
+// restored later with RestoreFromFile.
+func (s *StandardScaler) PersistToFile(path string) error {
+	return persistToFile(path, s)
+}
+
+// RestoreFromFile takes in a path to a persisted scaler
+// and assigns its learned statistics to the scaler it's
+// operating on.
+func (s *StandardScaler) RestoreFromFile(path string) error {
+	return restoreFromFile(path, s)
+}
+
+// MinMaxScaler scales each feature linearly so
+// that the smallest value seen during Fit maps
+// to RangeMin and the largest maps to RangeMax:
+//
+//	x'[j] = RangeMin + (x[j] - min[j]) * (RangeMax - RangeMin) / (max[j] - min[j])
+//
+// Constant features are mapped to RangeMin.
+// Values outside of the fit range are not
+// clipped.
+type MinMaxScaler struct {
+	RangeMin float64 `json:"range_min"`
+	RangeMax float64 `json:"range_max"`
+
+	Min []float64 `json:"min"`
+	Max []float64 `json:"max"`
+}
+
+// NewMinMaxScaler returns a pointer to an unfit
+// MinMaxScaler which maps features onto
+// [rangeMin, rangeMax]. If no range is given
+// (or the range is empty) [0, 1] is used.
+func NewMinMaxScaler(featureRange ...float64) *MinMaxScaler {
+	rangeMin, rangeMax := 0.0, 1.0
+	if len(featureRange) == 2 && featureRange[0] < featureRange[1] {
+		rangeMin, rangeMax = featureRange[0], featureRange[1]
+	}
+
+	return &MinMaxScaler{
+		RangeMin: rangeMin,
+		RangeMax: rangeMax,
+	}
+}
+
+// Fit finds the per-feature minimum and maximum
+// of x.
+func (s *MinMaxScaler) Fit(x [][]float64) error {
+	cols, err := columns(x)
+	if err != nil {
+		return err
+	}
+
+	s.Min = make([]float64, len(cols))
+	s.Max = make([]float64, len(cols))
+	for j, col := range cols {
+		if len(col) == 0 {
+			continue
+		}
+
+		s.Min[j], s.Max[j] = col[0], col[0]
+		for _, v := range col[1:] {
+			s.Min[j] = math.Min(s.Min[j], v)
+			s.Max[j] = math.Max(s.Max[j], v)
+		}
+	}
+
+	return nil
+}
+
+// scale returns the multiplier used for the j-th
+// feature, which is 0 for constant features.
+func (s *MinMaxScaler) scale(j int) float64 {
+	width := s.Max[j] - s.Min[j]
+	if width == 0 {
+		return 0
+	}
+
+	return (s.RangeMax - s.RangeMin) / width
+}
+
+// Transform returns a copy of x with each feature
+// mapped onto [RangeMin, RangeMax].
+func (s *MinMaxScaler) Transform(x [][]float64) ([][]float64, error) {
+	if s.Min == nil {
+		return nil, fmt.Errorf("ERROR: MinMaxScaler must be fit before transforming data")
+	}
+
+	return apply(x, len(s.Min), func(j int, v float64) float64 {
+		return s.RangeMin + (v-s.Min[j])*s.scale(j)
+	})
+}
+
+// InverseTransform maps scaled data back to the
+// original range of the features. Constant features
+// map back to their only value.
+func (s *MinMaxScaler) InverseTransform(x [][]float64) ([][]float64, error) {
+	if s.Min == nil {
+		return nil, fmt.Errorf("ERROR: MinMaxScaler must be fit before transforming data")
+	}
+
+	return apply(x, len(s.Min), func(j int, v float64) float64 {
+		scale := s.scale(j)
+		if scale == 0 {
+			return s.Min[j]
+		}
+		return s.Min[j] + (v-s.RangeMin)/scale
+	})
+}
+
+// PersistToFile takes in an absolute filepath and saves the
+// learned ranges to the file, which can be restored later
+// with RestoreFromFile.
+func (s *MinMaxScaler) PersistToFile(path string) error {
+	return persistToFile(path, s)
+}
+
+// RestoreFromFile takes in a path to a persisted scaler
+// and assigns its learned statistics to the scaler it's
+// operating on.
+func (s *MinMaxScaler) RestoreFromFile(path string) error {
+	return restoreFromFile(path, s)
+}
+
+// RobustScaler centers each feature on its median
+// and scales it by its interquartile range:
+//
+//	x'[j] = (x[j] - median[j]) / (Q3[j] - Q1[j])
+//
+// Because the median and IQR ignore the tails of
+// the distribution this is much less sensitive to
+// outliers than the StandardScaler. Features with
+// an IQR of 0 are only centered.
+type RobustScaler struct {
+	Center []float64 `json:"center"`
+	Scale  []float64 `json:"scale"`
+}
+
+// NewRobustScaler returns a pointer to an unfit
+// RobustScaler.
+func NewRobustScaler() *RobustScaler {
+	return &RobustScaler{}
+}
+
+// quantile returns the q-th quantile (q on [0,1])
+// of sorted, linearly interpolating between the
+// closest ranks.
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	pos := q * float64(len(sorted)-1)
+	low := int(math.Floor(pos))
+	high := int(math.Ceil(pos))
+
+	return sorted[low] + (pos-float64(low))*(sorted[high]-sorted[low])
+}
+
+// sortedCopy returns a sorted copy of v.
+func sortedCopy(v []float64) []float64 {
+	sorted := append([]float64{}, v...)
+	sort.Float64s(sorted)
+	return sorted
+}
+
+// Fit finds the per-feature median and
+// interquartile range of x.
+func (s *RobustScaler) Fit(x [][]float64) error {
+	cols, err := columns(x)
+	if err != nil {
+		return err
+	}
+
+	s.Center = make([]float64, len(cols))
+	s.Scale = make([]float64, len(cols))
+	for j, col := range cols {
+		sorted := sortedCopy(col)
+
+		s.Center[j] = quantile(sorted, 0.5)
+		s.Scale[j] = quantile(sorted, 0.75) - quantile(sorted, 0.25)
+		if s.Scale[j] == 0 {
+			s.Scale[j] = 1
+		}
+	}
+
+	return nil
+}
+
+// Transform returns a centered and scaled copy of x.
+func (s *RobustScaler) Transform(x [][]float64) ([][]float64, error) {
+	if s.Center == nil {
+		return nil, fmt.Errorf("ERROR: RobustScaler must be fit before transforming data")
+	}
+
+	return apply(x, len(s.Center), func(j int, v float64) float64 {
+		return (v - s.Center[j]) / s.Scale[j]
+	})
+}
+
+// InverseTransform maps scaled data back to the
+// original scale of the features.
+func (s *RobustScaler) InverseTransform(x [][]float64) ([][]float64, error) {
+	if s.Center == nil {
+		return nil, fmt.Errorf("ERROR: RobustScaler must be fit before transforming data")
+	}
+
+	return apply(x, len(s.Center), func(j int, v float64) float64 {
+		return v*s.Scale[j] + s.Center[j]
+	})
+}
+
+// PersistToFile takes in an absolute filepath and saves the
+// learned medians and IQRs to the file, which can be
+// restored later with RestoreFromFile.
+func (s *RobustScaler) PersistToFile(path string) error {
+	return persistToFile(path, s)
+}
+
+// RestoreFromFile takes in a path to a persisted scaler
+// and assigns its learned statistics to the scaler it's
+// operating on.
+func (s *RobustScaler) RestoreFromFile(path string) error {
+	return restoreFromFile(path, s)
+}
@@ -0,0 +1,212 @@
+package preprocess
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	dense   [][]float64
+	outlier [][]float64
+)
+
+func init() {
+	dense = [][]float64{}
+	for i := -50.0; i < 50; i++ {
+		dense = append(dense, []float64{i, 3*i + 7, 2})
+	}
+
+	outlier = [][]float64{}
+	for i := 0.0; i < 99; i++ {
+		outlier = append(outlier, []float64{i})
+	}
+	outlier = append(outlier, []float64{1e6})
+
+	// create the /tmp/.goml/ dir for persistance testing
+	// if it doesn't already exist!
+	err := os.MkdirAll("/tmp/.goml", os.ModePerm)
+	if err != nil {
+		panic(fmt.Sprintf("You should be able to create the directory for goml model persistance testing.\n\tError returned: %v\n", err.Error()))
+	}
+}
+
+// persistable is a Transformer which can be
+// saved to and restored from a file
+type persistable interface {
+	Transformer
+	PersistToFile(string) error
+	RestoreFromFile(string) error
+}
+
+// copyOf returns a deep copy of x so tests can
+// check that inputs aren't mutated
+func copyOf(x [][]float64) [][]float64 {
+	c := make([][]float64, len(x))
+	for i := range x {
+		c[i] = append([]float64{}, x[i]...)
+	}
+	return c
+}
+
+func TestStandardScalerShouldPass1(t *testing.T) {
+	scaler := NewStandardScaler()
+	assert.Nil(t, scaler.Fit(dense), "Fit error should be nil")
+
+	before := copyOf(dense)
+	scaled, err := scaler.Transform(dense)
+	assert.Nil(t, err, "Transform error should be nil")
+	assert.Equal(t, before, dense, "Transform should not modify its input")
+
+	for j := 0; j < 2; j++ {
+		var mean, variance float64
+		for i := range scaled {
+			mean += scaled[i][j]
+		}
+		mean /= float64(len(scaled))
+		for i := range scaled {
+			variance += (scaled[i][j] - mean) * (scaled[i][j] - mean)
+		}
+		variance /= float64(len(scaled))
+
+		assert.InDelta(t, 0, mean, 1e-9, "Scaled feature should have zero mean")
+		assert.InDelta(t, 1, variance, 1e-9, "Scaled feature should have unit variance")
+	}
+
+	// constant feature is only centered
+	for i := range scaled {
+		assert.Equal(t, 0.0, scaled[i][2], "Constant feature should be centered to 0")
+	}
+
+	original, err := scaler.InverseTransform(scaled)
+	assert.Nil(t, err, "InverseTransform error should be nil")
+	for i := range original {
+		for j := range original[i] {
+			assert.InDelta(t, dense[i][j], original[i][j], 1e-9, "InverseTransform should recover the input")
+		}
+	}
+}
+
+func TestStandardScalerShouldPass2(t *testing.T) {
+	// missing values are ignored in fit and
+	// passed through transform
+	x := [][]float64{{1}, {math.NaN()}, {3}}
+
+	scaler := NewStandardScaler()
+	assert.Nil(t, scaler.Fit(x), "Fit error should be nil")
+	assert.Equal(t, 2.0, scaler.Mean[0], "Mean should ignore missing values")
+
+	scaled, err := scaler.Transform(x)
+	assert.Nil(t, err, "Transform error should be nil")
+	assert.Equal(t, -1.0, scaled[0][0], "Scaled value should match")
+	assert.True(t, math.IsNaN(scaled[1][0]), "Missing value should stay missing")
+	assert.Equal(t, 1.0, scaled[2][0], "Scaled value should match")
+}
+
+func TestStandardScalerShouldFail1(t *testing.T) {
+	scaler := NewStandardScaler()
+
+	_, err := scaler.Transform(dense)
+	assert.NotNil(t, err, "Transforming before fitting should return an error")
+
+	assert.NotNil(t, scaler.Fit([][]float64{}), "Fitting with no data should return an error")
+	assert.NotNil(t, scaler.Fit([][]float64{{1, 2}, {1}}), "Fitting ragged data should return an error")
+
+	assert.Nil(t, scaler.Fit(dense), "Fit error should be nil")
+	_, err = scaler.Transform([][]float64{{1, 2}})
+	assert.NotNil(t, err, "Transforming data of the wrong dimension should return an error")
+}
+
+func TestMinMaxScalerShouldPass1(t *testing.T) {
+	scaler := NewMinMaxScaler()
+	assert.Nil(t, scaler.Fit(dense), "Fit error should be nil")
+
+	scaled, err := scaler.Transform(dense)
+	assert.Nil(t, err, "Transform error should be nil")
+
+	assert.InDelta(t, 0.0, scaled[0][0], 1e-9, "Min should map to 0")
+	assert.InDelta(t, 1.0, scaled[len(scaled)-1][0], 1e-9, "Max should map to 1")
+	assert.InDelta(t, 0.0, scaled[0][1], 1e-9, "Min should map to 0")
+	assert.InDelta(t, 1.0, scaled[len(scaled)-1][1], 1e-9, "Max should map to 1")
+	for i := range scaled {
+		assert.Equal(t, 0.0, scaled[i][2], "Constant feature should map to the bottom of the range")
+	}
+
+	original, err := scaler.InverseTransform(scaled)
+	assert.Nil(t, err, "InverseTransform error should be nil")
+	for i := range original {
+		for j := range original[i] {
+			assert.InDelta(t, dense[i][j], original[i][j], 1e-9, "InverseTransform should recover the input")
+		}
+	}
+}
+
+func TestMinMaxScalerShouldPass2(t *testing.T) {
+	scaler := NewMinMaxScaler(-1, 1)
+	assert.Nil(t, scaler.Fit(dense), "Fit error should be nil")
+
+	scaled, err := scaler.Transform([][]float64{{-50, -143, 2}, {49, 154, 2}, {148, 451, 2}})
+	assert.Nil(t, err, "Transform error should be nil")
+
+	assert.InDelta(t, -1.0, scaled[0][0], 1e-9, "Min should map to -1")
+	assert.InDelta(t, 1.0, scaled[1][0], 1e-9, "Max should map to 1")
+	assert.InDelta(t, 3.0, scaled[2][0], 1e-9, "Values outside of the fit range should not be clipped")
+}
+
+func TestRobustScalerShouldPass1(t *testing.T) {
+	scaler := NewRobustScaler()
+	assert.Nil(t, scaler.Fit(outlier), "Fit error should be nil")
+
+	// median of 0..98 and 1e6 is 49.5, the
+	// IQR is unaffected by the outlier
+	assert.InDelta(t, 49.5, scaler.Center[0], 1e-9, "Center should be the median")
+	assert.InDelta(t, 49.5, scaler.Scale[0], 1e-9, "Scale should be the IQR")
+
+	scaled, err := scaler.Transform(outlier)
+	assert.Nil(t, err, "Transform error should be nil")
+	assert.InDelta(t, -1.0, scaled[0][0], 1e-9, "Scaled value should match")
+
+	original, err := scaler.InverseTransform(scaled)
+	assert.Nil(t, err, "InverseTransform error should be nil")
+	for i := range original {
+		assert.InDelta(t, outlier[i][0], original[i][0], 1e-6, "InverseTransform should recover the input")
+	}
+}
+
+func TestScalerPersistToFileShouldPass1(t *testing.T) {
+	scalers := []struct {
+		path     string
+		fit      persistable
+		restored persistable
+	}{
+		{"/tmp/.goml/StandardScaler.json", NewStandardScaler(), NewStandardScaler()},
+		{"/tmp/.goml/MinMaxScaler.json", NewMinMaxScaler(-2, 2), NewMinMaxScaler()},
+		{"/tmp/.goml/RobustScaler.json", NewRobustScaler(), NewRobustScaler()},
+	}
+
+	for _, s := range scalers {
+		assert.Nil(t, s.fit.Fit(dense), "Fit error should be nil")
+		assert.Nil(t, s.fit.PersistToFile(s.path), "Persist error should be nil")
+		assert.Nil(t, s.restored.RestoreFromFile(s.path), "Restore error should be nil")
+
+		expected, err := s.fit.Transform(dense)
+		assert.Nil(t, err, "Transform error should be nil")
+
+		actual, err := s.restored.Transform(dense)
+		assert.Nil(t, err, "Transform error should be nil")
+
+		assert.Equal(t, expected, actual, "Restored scaler should transform exactly like the original")
+	}
+}
+
+func TestScalerPersistToFileShouldFail1(t *testing.T) {
+	scaler := NewStandardScaler()
+	assert.Nil(t, scaler.Fit(dense), "Fit error should be nil")
+
+	assert.NotNil(t, scaler.PersistToFile(""), "Persisting to an empty path should return an error")
+	assert.NotNil(t, scaler.RestoreFromFile(""), "Restoring from an empty path should return an error")
+	assert.NotNil(t, scaler.RestoreFromFile("/tmp/.goml/DOES/NOT/EXIST.json"), "Restoring from a missing file should return an error")
+}
@@ -0,0 +1,363 @@
+package preprocess
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// TextVectorizer is anything that turns raw text
+// into sparse vectors (like HashingVectorizer) so
+// it can start a SparsePipeline.
+type TextVectorizer interface {
+	// FitText learns whatever the vectorizer
+	// needs from the given documents.
+	FitText([]string) error
+
+	// TransformText turns every document into
+	// a sparse vector.
+	TransformText([]string) ([]map[int]float64, error)
+
+	// Size is the number of features of the
+	// vectors TransformText returns.
+	Size() int
+}
+
+// SparseTransformer is anything that can learn a
+// transformation of a sparse dataset (like
+// PolynomialFeatures) and then apply it to new
+// data of the same shape.
+type SparseTransformer interface {
+	// FitSparse learns the transformation from
+	// the given dataset, which has the given
+	// number of features.
+	FitSparse([]map[int]float64, int) error
+
+	// TransformSparse applies the learned
+	// transformation, returning new maps and
+	// leaving the input untouched.
+	TransformSparse([]map[int]float64) ([]map[int]float64, error)
+
+	// OutputFeatures is the number of features
+	// of the transformed data.
+	OutputFeatures() int
+}
+
+// SparsePredictor is any goml model which can make
+// a prediction off of a sparse input vector, like
+// SparseLeastSquares (and so the sparse logistic
+// model.)
+type SparsePredictor interface {
+	PredictSparse(map[int]float64, ...bool) float64
+}
+
+// sparseTrainable is a model which takes a labeled
+// sparse training set.
+type sparseTrainable interface {
+	UpdateTrainingSet([]map[int]float64, []float64) error
+}
+
+// sparseLearner is a sparse model which needs to
+// be told to learn after its training set is given
+// (like SparseLeastSquares, which takes a file to
+// log its cost to.)
+type sparseLearner interface {
+	Learn(string) error
+}
+
+/*
+SparsePipeline is the Pipeline for models which
+take sparse inputs (map[int]float64.) It chains an
+optional TextVectorizer, which turns raw text into
+sparse vectors, and any number of
+SparseTransformers with a final sparse goml model,
+so the whole thing can be fit, used for prediction,
+and persisted as one unit.
+
+FitText and PredictText start from text and need
+a Vectorizer; Fit and Predict start from sparse
+vectors and skip it.
+
+PersistToFile writes the vectorizer, every step
+and the model into a single JSON file, just like
+Pipeline. Restore into a SparsePipeline built with
+the same vectorizer, step and model types. Fields
+which aren't persisted, like the Tokenizer of a
+HashingVectorizer, are kept from the pipeline you
+restore into.
+
+Example SparsePipeline Usage:
+
+	vectorizer := NewHashingVectorizer(16)
+	model := linear.NewSparseLogistic(base.BatchGD, 1e-1, 0, 0, base.L2, 500, nil, nil, vectorizer.Size())
+
+	pipeline := NewSparsePipeline(model, vectorizer)
+
+	err := pipeline.FitText(reviews, sentiment)
+	if err != nil {
+		panic("couldn't fit the pipeline!")
+	}
+
+	err = pipeline.PersistToFile("/tmp/.goml/SparsePipeline.json")
+	if err != nil {
+		panic("couldn't persist the pipeline!")
+	}
+
+	// ...later, at serving time
+	served := NewSparsePipeline(
+		linear.NewSparseLogistic(base.BatchGD, 0, 0, 0, base.L2, 0, nil, nil, 0),
+		NewHashingVectorizer(16),
+	)
+
+	err = served.RestoreFromFile("/tmp/.goml/SparsePipeline.json")
+	if err != nil {
+		panic("couldn't restore the pipeline!")
+	}
+
+	guess, err := served.PredictText("what a great movie")
+*/
+type SparsePipeline struct {
+	Vectorizer TextVectorizer
+	Steps      []SparseTransformer
+	Model      SparsePredictor
+}
+
+// NewSparsePipeline returns a pointer to a
+// SparsePipeline which turns text into sparse
+// vectors with vectorizer (which can be nil if you
+// only have sparse inputs) and runs them through
+// the given steps, in order, before predicting with
+// model.
+func NewSparsePipeline(model SparsePredictor, vectorizer TextVectorizer, steps ...SparseTransformer) *SparsePipeline {
+	return &SparsePipeline{
+		Vectorizer: vectorizer,
+		Steps:      steps,
+		Model:      model,
+	}
+}
+
+// FitText fits the vectorizer on the documents,
+// and then fits the rest of the pipeline on the
+// vectors it gives, just like Fit.
+func (p *SparsePipeline) FitText(x []string, y []float64) error {
+	if p.Vectorizer == nil {
+		return fmt.Errorf("ERROR: Attempting to fit a sparse pipeline on text with no vectorizer!")
+	}
+
+	err := p.Vectorizer.FitText(x)
+	if err != nil {
+		return fmt.Errorf("ERROR: fitting the vectorizer (%T) of the pipeline: %v", p.Vectorizer, err)
+	}
+
+	vectors, err := p.Vectorizer.TransformText(x)
+	if err != nil {
+		return fmt.Errorf("ERROR: transforming with the vectorizer (%T) of the pipeline: %v", p.Vectorizer, err)
+	}
+
+	return p.Fit(vectors, p.Vectorizer.Size(), y)
+}
+
+// Fit fits every step of the pipeline, each on the
+// output of the step before it (the first one on
+// x, which has the given number of features), and
+// then gives the fully transformed training set to
+// the model and (if the model needs it) tells it to
+// learn.
+//
+// The model has to have been built for as many
+// features as the last step outputs.
+func (p *SparsePipeline) Fit(x []map[int]float64, features int, y []float64) error {
+	if p.Model == nil {
+		return fmt.Errorf("ERROR: Attempting to fit a pipeline with no model!")
+	}
+
+	model, ok := p.Model.(sparseTrainable)
+	if !ok {
+		return fmt.Errorf("ERROR: the pipeline's model (%T) can't be given a sparse training set", p.Model)
+	}
+
+	var err error
+	for i, step := range p.Steps {
+		err = step.FitSparse(x, features)
+		if err != nil {
+			return fmt.Errorf("ERROR: fitting step %v (%T) of the pipeline: %v", i, step, err)
+		}
+
+		x, err = step.TransformSparse(x)
+		if err != nil {
+			return fmt.Errorf("ERROR: transforming with step %v (%T) of the pipeline: %v", i, step, err)
+		}
+		features = step.OutputFeatures()
+	}
+
+	err = model.UpdateTrainingSet(x, y)
+	if err != nil {
+		return err
+	}
+
+	if l, ok := p.Model.(sparseLearner); ok {
+		return l.Learn("")
+	}
+
+	return nil
+}
+
+// TransformText runs the documents through the
+// vectorizer and every step of the pipeline,
+// returning the input the model would see.
+func (p *SparsePipeline) TransformText(x []string) ([]map[int]float64, error) {
+	if p.Vectorizer == nil {
+		return nil, fmt.Errorf("ERROR: Attempting to transform text with a sparse pipeline with no vectorizer!")
+	}
+
+	vectors, err := p.Vectorizer.TransformText(x)
+	if err != nil {
+		return nil, fmt.Errorf("ERROR: transforming with the vectorizer (%T) of the pipeline: %v", p.Vectorizer, err)
+	}
+
+	return p.Transform(vectors)
+}
+
+// Transform runs x through every step of the
+// pipeline, returning the input the model would
+// see. x is not modified.
+func (p *SparsePipeline) Transform(x []map[int]float64) ([]map[int]float64, error) {
+	var err error
+	for i, step := range p.Steps {
+		x, err = step.TransformSparse(x)
+		if err != nil {
+			return nil, fmt.Errorf("ERROR: transforming with step %v (%T) of the pipeline: %v", i, step, err)
+		}
+	}
+
+	return x, nil
+}
+
+// PredictText runs the document through the
+// vectorizer and every step of the pipeline and
+// returns the model's prediction.
+func (p *SparsePipeline) PredictText(x string) (float64, error) {
+	if p.Model == nil {
+		return 0, fmt.Errorf("ERROR: Attempting to predict with a pipeline with no model!")
+	}
+
+	transformed, err := p.TransformText([]string{x})
+	if err != nil {
+		return 0, err
+	}
+
+	return p.Model.PredictSparse(transformed[0]), nil
+}
+
+// Predict runs x through every step of the pipeline
+// and returns the model's prediction. x is not
+// modified.
+func (p *SparsePipeline) Predict(x map[int]float64) (float64, error) {
+	if p.Model == nil {
+		return 0, fmt.Errorf("ERROR: Attempting to predict with a pipeline with no model!")
+	}
+
+	transformed, err := p.Transform([]map[int]float64{x})
+	if err != nil {
+		return 0, err
+	}
+
+	return p.Model.PredictSparse(transformed[0]), nil
+}
+
+// PersistToFile takes in an absolute filepath and saves
+// the vectorizer and every step of the pipeline along
+// with the model to a single file (written atomically,
+// like Pipeline's), which can be restored later with
+// RestoreFromFile.
+func (p *SparsePipeline) PersistToFile(path string) error {
+	if path == "" {
+		return fmt.Errorf("ERROR: you just tried to persist your pipeline to a file with no path!! That's a no-no. Try it with a valid filepath")
+	}
+
+	persisted := persistedPipeline{
+		Steps: make([]persistedComponent, len(p.Steps)),
+	}
+
+	var err error
+	if p.Vectorizer != nil {
+		vectorizer, err := persistComponent(p.Vectorizer)
+		if err != nil {
+			return err
+		}
+		persisted.Vectorizer = &vectorizer
+	}
+
+	for i, step := range p.Steps {
+		persisted.Steps[i], err = persistComponent(step)
+		if err != nil {
+			return err
+		}
+	}
+
+	persisted.Model, err = persistModel(p.Model)
+	if err != nil {
+		return err
+	}
+
+	bytes, err := json.Marshal(persisted)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, bytes)
+}
+
+// RestoreFromFile takes in a path to a persisted
+// sparse pipeline and restores the state of the
+// vectorizer, every step and the model of the
+// pipeline it's operating on. The pipeline must have
+// been built with the same types of vectorizer, steps
+// (in the same order) and model as the one that was
+// persisted. Like Pipeline's, nothing is swapped in
+// until the whole file has been restored.
+func (p *SparsePipeline) RestoreFromFile(path string) error {
+	if path == "" {
+		return fmt.Errorf("ERROR: you just tried to restore your pipeline from a file with no path! That's a no-no. Try it with a valid filepath")
+	}
+
+	persisted, err := readPipeline(path)
+	if err != nil {
+		return err
+	}
+
+	if (persisted.Vectorizer == nil) != (p.Vectorizer == nil) {
+		return fmt.Errorf("ERROR: only one of the persisted pipeline and this pipeline has a vectorizer")
+	}
+	if len(persisted.Steps) != len(p.Steps) {
+		return fmt.Errorf("ERROR: persisted pipeline has %v steps but this pipeline has %v", len(persisted.Steps), len(p.Steps))
+	}
+
+	var vectorizer TextVectorizer
+	if p.Vectorizer != nil {
+		fresh, err := restoreComponent("the vectorizer", *persisted.Vectorizer, p.Vectorizer)
+		if err != nil {
+			return err
+		}
+
+		vectorizer = fresh.(TextVectorizer)
+	}
+
+	steps := make([]SparseTransformer, len(p.Steps))
+	for i, step := range p.Steps {
+		fresh, err := restoreComponent(fmt.Sprintf("step %v", i), persisted.Steps[i], step)
+		if err != nil {
+			return err
+		}
+
+		steps[i] = fresh.(SparseTransformer)
+	}
+
+	err = restoreModel(p.Model, persisted.Model)
+	if err != nil {
+		return err
+	}
+
+	p.Vectorizer = vectorizer
+	p.Steps = steps
+	return nil
+}
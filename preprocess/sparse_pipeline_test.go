@@ -0,0 +1,159 @@
+package preprocess
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/bountylabs/goml/base"
+	"github.com/bountylabs/goml/linear"
+	"github.com/bountylabs/goml/text"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	reviews   []string
+	sentiment []float64
+)
+
+func init() {
+	for i := 0; i < 20; i++ {
+		reviews = append(reviews, "i love this great movie", "what a terrible awful film", "great acting and a lovely story", "awful plot and terrible acting")
+		sentiment = append(sentiment, 1, 0, 1, 0)
+	}
+}
+
+func newReviewPipeline() *SparsePipeline {
+	vectorizer := NewHashingVectorizer(12)
+	model := linear.NewSparseLogistic(base.BatchGD, 1e-1, 0, 0, base.L2, 500, nil, nil, vectorizer.Size())
+	model.Output = ioutil.Discard
+
+	return NewSparsePipeline(model, vectorizer)
+}
+
+func TestSparsePipelineShouldPass1(t *testing.T) {
+	pipeline := newReviewPipeline()
+	assert.Nil(t, pipeline.FitText(reviews, sentiment), "Fit error should be nil")
+
+	guess, err := pipeline.PredictText("great movie")
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.True(t, guess > 0.5, "Positive review should be classified as positive")
+
+	guess, err = pipeline.PredictText("terrible film")
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.True(t, guess < 0.5, "Negative review should be classified as negative")
+
+	// the same as hashing by hand
+	x, err := pipeline.Vectorizer.(*HashingVectorizer).HashText("great movie")
+	assert.Nil(t, err, "Hashing error should be nil")
+	expected, err := pipeline.Predict(x)
+	assert.Nil(t, err, "Prediction error should be nil")
+	guess, err = pipeline.PredictText("great movie")
+	assert.Nil(t, err, "Prediction error should be nil")
+	// sparse models sum over maps, in any order
+	assert.InDelta(t, expected, guess, 1e-12, "Predicting text should hash it like the vectorizer")
+}
+
+// sparse steps fit on the width of the step
+// before them
+func TestSparsePipelineShouldPass2(t *testing.T) {
+	// y = 1 + 2*x[0]*x[1], which is only linear
+	// in the interaction
+	x := []map[int]float64{}
+	y := []float64{}
+	for i := -1.0; i <= 1; i += 0.5 {
+		for j := -1.0; j <= 1; j += 0.5 {
+			x = append(x, map[int]float64{0: i, 1: j})
+			y = append(y, 1+2*i*j)
+		}
+	}
+
+	polynomial := NewPolynomialFeatures(2, true, false)
+	model := linear.NewSparseLeastSquares(base.BatchGD, 1e-1, 0, 0, base.L2, 2000, nil, nil, 3)
+	model.Output = ioutil.Discard
+
+	pipeline := NewSparsePipeline(model, nil, polynomial)
+	assert.Nil(t, pipeline.Fit(x, 2, y), "Fit error should be nil")
+	assert.Equal(t, 2, polynomial.Features, "The step should be fit on the width of the input")
+
+	input := map[int]float64{0: 0.5, 1: -1}
+	guess, err := pipeline.Predict(input)
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.InDelta(t, 0, guess, 1e-2, "Guess should be close to 1 + 2*x[0]*x[1]")
+	assert.Equal(t, map[int]float64{0: 0.5, 1: -1}, input, "Predict should not modify its input")
+}
+
+func TestSparsePipelineShouldFail1(t *testing.T) {
+	pipeline := NewSparsePipeline(nil, NewHashingVectorizer(8))
+	assert.NotNil(t, pipeline.FitText(reviews, sentiment), "Fitting without a model should return an error")
+	_, err := pipeline.PredictText("great movie")
+	assert.NotNil(t, err, "Predicting without a model should return an error")
+
+	model := linear.NewSparseLogistic(base.BatchGD, 1e-1, 0, 0, base.L2, 500, nil, nil, 256)
+	model.Output = ioutil.Discard
+	pipeline = NewSparsePipeline(model, nil)
+	assert.NotNil(t, pipeline.FitText(reviews, sentiment), "Fitting on text without a vectorizer should return an error")
+	_, err = pipeline.PredictText("great movie")
+	assert.NotNil(t, err, "Predicting text without a vectorizer should return an error")
+
+	pipeline = NewSparsePipeline(model, NewHashingVectorizer(40))
+	assert.NotNil(t, pipeline.FitText(reviews, sentiment), "Fitting with a broken vectorizer should return an error")
+}
+
+// a hashing -> sparse logistic pipeline should go
+// through a file and predict just the same
+func TestSparsePipelinePersistToFileShouldPass1(t *testing.T) {
+	pipeline := newReviewPipeline()
+	pipeline.Vectorizer.(*HashingVectorizer).AlternateSign = false
+	assert.Nil(t, pipeline.FitText(reviews, sentiment), "Fit error should be nil")
+	assert.Nil(t, pipeline.PersistToFile("/tmp/.goml/SparsePipeline.json"), "Persist error should be nil")
+
+	restored := NewSparsePipeline(
+		linear.NewSparseLogistic(base.BatchGD, 0, 0, 0, base.L2, 0, nil, nil, 0),
+		NewHashingVectorizer(4),
+	)
+	assert.Nil(t, restored.RestoreFromFile("/tmp/.goml/SparsePipeline.json"), "Restore error should be nil")
+
+	vectorizer := restored.Vectorizer.(*HashingVectorizer)
+	assert.Equal(t, uint(12), vectorizer.Bits, "The vectorizer's settings should be restored")
+	assert.False(t, vectorizer.AlternateSign, "The vectorizer's settings should be restored")
+	assert.Equal(t, &text.SimpleTokenizer{SplitOn: " "}, vectorizer.Tokenizer, "The tokenizer should be kept from the pipeline restored into")
+
+	for _, review := range append(reviews[:4:4], "great movie", "terrible film", "never heard these words") {
+		expected, err := pipeline.PredictText(review)
+		assert.Nil(t, err, "Prediction error should be nil")
+
+		actual, err := restored.PredictText(review)
+		assert.Nil(t, err, "Prediction error should be nil")
+
+		assert.InDelta(t, expected, actual, 1e-12, "Restored pipeline should predict just like the original")
+	}
+}
+
+func TestSparsePipelinePersistToFileShouldFail1(t *testing.T) {
+	pipeline := newReviewPipeline()
+	assert.Nil(t, pipeline.FitText(reviews, sentiment), "Fit error should be nil")
+	assert.Nil(t, pipeline.PersistToFile("/tmp/.goml/SparsePipeline.json"), "Persist error should be nil")
+
+	model := linear.NewSparseLogistic(base.BatchGD, 0, 0, 0, base.L2, 0, nil, nil, 0)
+
+	// no vectorizer
+	restored := NewSparsePipeline(model, nil)
+	assert.NotNil(t, restored.RestoreFromFile("/tmp/.goml/SparsePipeline.json"), "Restoring into a pipeline without a vectorizer should return an error")
+
+	// an extra step
+	restored = NewSparsePipeline(model, NewHashingVectorizer(12), NewPolynomialFeatures(2, true, false))
+	assert.NotNil(t, restored.RestoreFromFile("/tmp/.goml/SparsePipeline.json"), "Restoring into mismatched steps should return an error")
+
+	// a dense pipeline
+	dense := newPlanePipeline()
+	assert.NotNil(t, dense.RestoreFromFile("/tmp/.goml/SparsePipeline.json"), "Restoring a sparse pipeline into a dense one should return an error")
+
+	assert.Nil(t, dense.Fit(planeX, planeY), "Fit error should be nil")
+	assert.Nil(t, dense.PersistToFile("/tmp/.goml/Pipeline.json"), "Persist error should be nil")
+	restored = NewSparsePipeline(model, nil)
+	assert.NotNil(t, restored.RestoreFromFile("/tmp/.goml/Pipeline.json"), "Restoring a dense pipeline into a sparse one should return an error")
+
+	assert.NotNil(t, pipeline.PersistToFile(""), "Persisting to an empty path should return an error")
+	assert.NotNil(t, pipeline.RestoreFromFile(""), "Restoring from an empty path should return an error")
+}
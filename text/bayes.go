@@ -73,6 +73,7 @@ package text
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -158,6 +159,10 @@ type NaiveBayes struct {
 	// stream holds the datastream
 	stream <-chan base.TextDatapoint
 
+	// stats counts the documents seen while
+	// learning online
+	stats base.OnlineCounters
+
 	// tokenizer is used by a model
 	// to split the input into tokens
 	Tokenizer Tokenizer `json:"tokenizer"`
@@ -275,6 +280,23 @@ func NewNaiveBayes(stream <-chan base.TextDatapoint, classes uint8, sanitize fun
 // data passed so far, and returns the class
 // estimated for the document.
 func (b *NaiveBayes) Predict(sentence string) uint8 {
+	sums := b.logPosterior(sentence)
+
+	// find best class
+	var maxI int
+	for i := range sums {
+		if sums[i] > sums[maxI] {
+			maxI = i
+		}
+	}
+
+	return uint8(maxI)
+}
+
+// logPosterior returns the log of the (unnormalized)
+// posterior probability of the document being in
+// each class.
+func (b *NaiveBayes) logPosterior(sentence string) []float64 {
 	sums := make([]float64, len(b.Count))
 
 	sentence, _, _ = transform.String(b.sanitize, sentence)
@@ -294,68 +316,76 @@ func (b *NaiveBayes) Predict(sentence string) uint8 {
 		sums[i] += math.Log(b.Probabilities[i])
 	}
 
-	// find best class
-	var maxI int
-	for i := range sums {
-		if sums[i] > sums[maxI] {
-			maxI = i
-		}
-	}
-
-	return uint8(maxI)
+	return sums
 }
 
-// Probability takes in a small document, returns the
-// estimated class of the document based on the model
-// as well as the probability that the model is part
-// of that class
+// PredictProba takes in a document and returns the
+// probability of it being in each class (indexed by
+// class.)
 //
-// NOTE: you should only use this for small documents
-// because, as discussed in the docs for the model, the
-// probability will often times underflow because you
-// are multiplying together a bunch of probabilities
-// which range on [0,1]. As such, the returned float
-// could be NaN, and the predicted class could be
-// 0 always.
-//
-// Basically, use Predict to be robust for larger
-// documents. Use Probability only on relatively small
-// (MAX of maybe a dozen words - basically just
-// sentences and words) documents.
-func (b *NaiveBayes) Probability(sentence string) (uint8, float64) {
-	sums := make([]float64, len(b.Count))
-	for i := range sums {
-		sums[i] = 1
+// The probabilities are found from the log posterior
+// Predict uses with the log-sum-exp trick, so unlike
+// multiplying the raw probabilities together they
+// don't underflow on long documents.
+func (b *NaiveBayes) PredictProba(sentence string) []float64 {
+	sums := b.logPosterior(sentence)
+	proba := make([]float64, len(sums))
+	if len(sums) == 0 {
+		return proba
 	}
 
-	sentence, _, _ = transform.String(b.sanitize, sentence)
-	words := b.Tokenizer.Tokenize(sentence)
-	for _, word := range words {
-		w, ok := b.Words.Get(word)
-		if !ok {
-			continue
+	max := math.Inf(-1)
+	for i := range sums {
+		if sums[i] > max {
+			max = sums[i]
 		}
+	}
 
-		for i := range sums {
-			sums[i] *= float64(w.Count[i]+1) / float64(w.Seen+b.DictCount)
+	// no class has been seen yet, so they're all
+	// equally likely
+	if math.IsInf(max, -1) {
+		for i := range proba {
+			proba[i] = 1 / float64(len(proba))
 		}
+		return proba
 	}
 
+	// log Σ exp(sums[i]) = max + log Σ exp(sums[i] - max)
+	var total float64
 	for i := range sums {
-		sums[i] *= b.Probabilities[i]
+		total += math.Exp(sums[i] - max)
 	}
+	logTotal := max + math.Log(total)
 
-	var denom float64
-	var maxI int
 	for i := range sums {
-		if sums[i] > sums[maxI] {
+		proba[i] = math.Exp(sums[i] - logTotal)
+	}
+
+	return proba
+}
+
+// Probability takes in a document, returns the
+// estimated class of the document based on the model
+// as well as the probability that the model is part
+// of that class
+//
+// This is the most likely class from PredictProba
+// along with its probability, so it's safe to use on
+// documents of any length.
+func (b *NaiveBayes) Probability(sentence string) (uint8, float64) {
+	proba := b.PredictProba(sentence)
+	if len(proba) == 0 {
+		return 0, 0
+	}
+
+	var maxI int
+	for i := range proba {
+		if proba[i] > proba[maxI] {
 			maxI = i
 		}
-
-		denom += sums[i]
 	}
 
-	return uint8(maxI), sums[maxI] / denom
+	return uint8(maxI), proba[maxI]
 }
 
 // OnlineLearn lets the NaiveBayes model learn
@@ -365,79 +395,122 @@ func (b *NaiveBayes) OnlineLearn(errors chan<- error) {
 	if errors == nil {
 		errors = make(chan error)
 	}
+	defer close(errors)
+
+	err := b.OnlineLearnContext(context.Background(), func(err error) {
+		errors <- err
+	})
+	if err != nil {
+		errors <- err
+	}
+}
+
+// OnlineLearnContext learns from the datastream just
+// like OnlineLearn, but it stops when ctx is done
+// (returning ctx.Err()) as well as when the stream is
+// closed (returning nil.) Documents which can't be
+// learned from are passed to onError (if it's not nil)
+// and skipped, instead of being sent on a channel you
+// have to drain.
+func (b *NaiveBayes) OnlineLearnContext(ctx context.Context, onError func(error)) error {
 	if b.stream == nil {
-		errors <- fmt.Errorf("ERROR: attempting to learn with nil data stream!\n")
-		close(errors)
-		return
+		return fmt.Errorf("ERROR: attempting to learn with nil data stream!\n")
 	}
 
 	fmt.Fprintf(b.Output, "Training:\n\tModel: Multinomial Naïve Bayes\n\tClasses: %v\n", len(b.Count))
 
-	var point base.TextDatapoint
-	var more bool
-
 	for {
-		point, more = <-b.stream
-
-		if more {
-			// sanitize and break up document
-			sanitized, _, _ := transform.String(b.sanitize, point.X)
-			words := b.Tokenizer.Tokenize(sanitized)
+		var point base.TextDatapoint
+		var more bool
+
+		select {
+		case <-ctx.Done():
+			fmt.Fprintf(b.Output, "\nERROR: Error while learning –\n\t%v\n\n", ctx.Err())
+			return ctx.Err()
+		case point, more = <-b.stream:
+		}
 
-			C := int(point.Y)
+		if !more {
+			fmt.Fprintf(b.Output, "Training Completed.\n%v\n\n", b)
+			return nil
+		}
 
-			if C > len(b.Count)-1 {
-				errors <- fmt.Errorf("ERROR: given document class is greater than the number of classes in the model!\n")
-				continue
+		err := b.learnDocument(point)
+		if err != nil {
+			b.stats.Add(base.OnlineStats{Seen: 1, Errors: 1})
+			if onError != nil {
+				onError(err)
 			}
+			continue
+		}
 
-			// update global class probabilities
-			b.Count[C]++
-			b.DocumentCount++
-			for i := range b.Probabilities {
-				b.Probabilities[i] = float64(b.Count[i]) / float64(b.DocumentCount)
-			}
+		b.stats.Add(base.OnlineStats{Seen: 1, Updates: 1})
+	}
+}
 
-			// store words seen in document (to add to DocsSeen)
-			seenCount := make(map[string]int)
+// Stats returns how many documents the model has
+// seen while learning online, and how many of them
+// caused an error.
+func (b *NaiveBayes) Stats() base.OnlineStats {
+	return b.stats.Stats()
+}
 
-			// update probabilities for words
-			for _, word := range words {
-				if len(word) < 3 {
-					continue
-				}
+// learnDocument updates the model's counts with a
+// single document.
+func (b *NaiveBayes) learnDocument(point base.TextDatapoint) error {
+	// sanitize and break up document
+	sanitized, _, _ := transform.String(b.sanitize, point.X)
+	words := b.Tokenizer.Tokenize(sanitized)
 
-				w, ok := b.Words.Get(word)
+	C := int(point.Y)
 
-				if !ok {
-					w = Word{
-						Count: make([]uint64, len(b.Count)),
-						Seen:  uint64(0),
-					}
+	if C > len(b.Count)-1 {
+		return fmt.Errorf("ERROR: given document class is greater than the number of classes in the model!\n")
+	}
 
-					b.DictCount++
-				}
+	// update global class probabilities
+	b.Count[C]++
+	b.DocumentCount++
+	for i := range b.Probabilities {
+		b.Probabilities[i] = float64(b.Count[i]) / float64(b.DocumentCount)
+	}
 
-				w.Count[C]++
-				w.Seen++
+	// store words seen in document (to add to DocsSeen)
+	seenCount := make(map[string]int)
 
-				b.Words.Set(word, w)
+	// update probabilities for words
+	for _, word := range words {
+		if len(word) < 3 {
+			continue
+		}
 
-				seenCount[word] = 1
-			}
+		w, ok := b.Words.Get(word)
 
-			// add to DocsSeen
-			for term := range seenCount {
-				tmp, _ := b.Words.Get(term)
-				tmp.DocsSeen++
-				b.Words.Set(term, tmp)
+		if !ok {
+			w = Word{
+				Count: make([]uint64, len(b.Count)),
+				Seen:  uint64(0),
 			}
-		} else {
-			fmt.Fprintf(b.Output, "Training Completed.\n%v\n\n", b)
-			close(errors)
-			return
+
+			b.DictCount++
 		}
+
+		w.Count[C]++
+		w.Seen++
+
+		b.Words.Set(word, w)
+
+		seenCount[word] = 1
+	}
+
+	// add to DocsSeen
+	for term := range seenCount {
+		tmp, _ := b.Words.Get(term)
+		tmp.DocsSeen++
+		b.Words.Set(term, tmp)
 	}
+
+	return nil
 }
 
 // UpdateStream updates the NaiveBayes model's
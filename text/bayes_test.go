@@ -3,6 +3,7 @@ package text
 import (
 	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
 	"strings"
 	"sync"
@@ -401,3 +402,49 @@ func equalStringSlices(a, b []string) bool {
 	}
 	return true
 }
+
+func TestPredictProbaShouldPass1(t *testing.T) {
+	stream := make(chan base.TextDatapoint, 100)
+	errors := make(chan error)
+
+	model := NewNaiveBayes(stream, 2, base.OnlyWordsAndNumbers)
+	go model.OnlineLearn(errors)
+
+	stream <- base.TextDatapoint{X: "I love the city", Y: 1}
+	stream <- base.TextDatapoint{X: "I hate Los Angeles", Y: 0}
+	stream <- base.TextDatapoint{X: "My mother is not a nice lady", Y: 0}
+	stream <- base.TextDatapoint{X: "The city is lovely", Y: 1}
+	close(stream)
+
+	for range errors {
+	}
+
+	proba := model.PredictProba("Mother Los Angeles")
+	assert.Len(t, proba, 2, "There should be a probability for each class")
+	assert.InDelta(t, 1, proba[0]+proba[1], 1e-9, "Probabilities should add up to 1")
+	assert.True(t, proba[0] > proba[1], "The document should more likely be negative")
+
+	// multiplying raw probabilities over this many
+	// words would underflow to 0/0
+	long := strings.Repeat("hate Los Angeles mother lovely ", 2000)
+
+	proba = model.PredictProba(long)
+	assert.InDelta(t, 1, proba[0]+proba[1], 1e-9, "Probabilities should add up to 1 for long documents")
+	var best uint8
+	if proba[1] > proba[0] {
+		best = 1
+	}
+	assert.Equal(t, model.Predict(long), best, "The most likely class should match Predict")
+
+	class, p := model.Probability(long)
+	assert.EqualValues(t, model.Predict(long), class, "Probability should return the same class as Predict")
+	assert.False(t, math.IsNaN(p), "Probability should not be NaN for long documents")
+	assert.True(t, p >= 0.5 && p <= 1, "Probability of the best class should be between 0.5 and 1 - Given %v", p)
+}
+
+func TestPredictProbaShouldPass2(t *testing.T) {
+	model := NewNaiveBayes(nil, 4, base.OnlyWordsAndNumbers)
+
+	proba := model.PredictProba("nothing learned yet")
+	assert.Equal(t, []float64{0.25, 0.25, 0.25, 0.25}, proba, "An untrained model should find every class equally likely")
+}
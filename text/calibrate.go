@@ -0,0 +1,229 @@
+package text
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/bountylabs/goml/base"
+)
+
+/*
+CalibratedNaiveBayes wraps a trained NaiveBayes model
+so the probabilities it gives are calibrated. Naive
+Bayes assumes every word is independent of the others
+given the class, which is never quite true, so it's
+usually far too sure of itself (probabilities very
+close to 0 and 1.) Fit learns a base.Calibration on
+held out documents which corrects that, with either
+Platt scaling or isotonic regression.
+
+PersistToFile saves the calibration along with the
+model. The model's sanitizer and tokenizer aren't
+saved (just like with NaiveBayes itself), so restore
+into a CalibratedNaiveBayes wrapping a NaiveBayes made
+with the same ones.
+
+Example Calibrating Naive Bayes:
+
+	model := NewNaiveBayes(stream, 2, base.OnlyWordsAndNumbers)
+	// ...learn
+
+	calibrated := NewCalibratedNaiveBayes(model, base.PlattCalibration)
+	err := calibrated.Fit(heldOut)
+	if err != nil {
+		panic("couldn't calibrate the model!")
+	}
+
+	// [P(y = 0), P(y = 1)]
+	proba, err := calibrated.PredictProba("I love the city")
+*/
+type CalibratedNaiveBayes struct {
+	Model       *NaiveBayes
+	Method      base.CalibrationMethod
+	Calibration *base.Calibration
+}
+
+// persistedCalibratedNaiveBayes is how a
+// CalibratedNaiveBayes is stored on disk.
+type persistedCalibratedNaiveBayes struct {
+	Calibration *base.Calibration `json:"calibration"`
+	Model       json.RawMessage   `json:"model"`
+}
+
+// NewCalibratedNaiveBayes returns a pointer to a
+// CalibratedNaiveBayes wrapping the (already trained)
+// model, which will be calibrated with method once
+// Fit is called.
+func NewCalibratedNaiveBayes(model *NaiveBayes, method base.CalibrationMethod) *CalibratedNaiveBayes {
+	return &CalibratedNaiveBayes{
+		Model:  model,
+		Method: method,
+	}
+}
+
+// Fit fits the calibration to the model's probabilities
+// on held out documents the model never learned from.
+func (c *CalibratedNaiveBayes) Fit(documents []base.TextDatapoint) error {
+	if len(documents) == 0 {
+		return fmt.Errorf("ERROR: need at least one document to calibrate a model")
+	}
+
+	probabilities := make([][]float64, len(documents))
+	classes := make([]int, len(documents))
+	for i := range documents {
+		probabilities[i] = c.Model.PredictProba(documents[i].X)
+		classes[i] = int(documents[i].Y)
+	}
+
+	calibration, err := base.FitCalibration(c.Method, probabilities, classes)
+	if err != nil {
+		return err
+	}
+
+	c.Calibration = calibration
+
+	return nil
+}
+
+// PredictProba returns the calibrated probability of
+// the document being in each class (indexed by class.)
+func (c *CalibratedNaiveBayes) PredictProba(sentence string) ([]float64, error) {
+	if c.Calibration == nil {
+		return nil, fmt.Errorf("ERROR: the model hasn't been calibrated! Call Fit first")
+	}
+
+	return c.Calibration.Calibrate(c.Model.PredictProba(sentence))
+}
+
+// Predict returns the class with the highest
+// calibrated probability.
+func (c *CalibratedNaiveBayes) Predict(sentence string) (uint8, error) {
+	proba, err := c.PredictProba(sentence)
+	if err != nil {
+		return 0, err
+	}
+
+	var maxI int
+	for i := range proba {
+		if proba[i] > proba[maxI] {
+			maxI = i
+		}
+	}
+
+	return uint8(maxI), nil
+}
+
+// Reliability returns the reliability diagram (see
+// base.ReliabilityDiagram) of the calibrated model on
+// labeled documents. For 2 classes it compares the
+// probability of class 1 to how often documents were
+// in it. Otherwise it compares the probability of the
+// predicted class to how often the prediction was
+// right.
+func (c *CalibratedNaiveBayes) Reliability(documents []base.TextDatapoint, bins int) ([]base.ReliabilityBin, error) {
+	predicted := make([]float64, len(documents))
+	positive := make([]float64, len(documents))
+	for i := range documents {
+		proba, err := c.PredictProba(documents[i].X)
+		if err != nil {
+			return nil, err
+		}
+
+		best := 0
+		if len(proba) == 2 {
+			best = 1
+		} else {
+			for j := range proba {
+				if proba[j] > proba[best] {
+					best = j
+				}
+			}
+		}
+
+		predicted[i] = proba[best]
+		if int(documents[i].Y) == best {
+			positive[i] = 1
+		}
+	}
+
+	return base.ReliabilityDiagram(predicted, positive, bins)
+}
+
+// PersistToFile takes in an absolute filepath and saves
+// the calibration along with the model to a single
+// file, which can be restored later with
+// RestoreFromFile.
+func (c *CalibratedNaiveBayes) PersistToFile(path string) error {
+	if path == "" {
+		return fmt.Errorf("ERROR: you just tried to persist your model to a file with no path!! That's a no-no. Try it with a valid filepath")
+	}
+
+	model, err := json.Marshal(c.Model)
+	if err != nil {
+		return err
+	}
+
+	bytes, err := json.Marshal(persistedCalibratedNaiveBayes{
+		Calibration: c.Calibration,
+		Model:       model,
+	})
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, bytes, os.ModePerm)
+}
+
+// RestoreFromFile takes in a path to a persisted
+// CalibratedNaiveBayes and restores both the
+// calibration and the model, keeping the model's
+// sanitizer and tokenizer.
+func (c *CalibratedNaiveBayes) RestoreFromFile(path string) error {
+	if path == "" {
+		return fmt.Errorf("ERROR: you just tried to restore your model from a file with no path! That's a no-no. Try it with a valid filepath")
+	}
+
+	if c.Model == nil {
+		return fmt.Errorf("ERROR: Cannot restore a model to a nil pointer")
+	}
+
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var persisted persistedCalibratedNaiveBayes
+	err = json.Unmarshal(bytes, &persisted)
+	if err != nil {
+		return err
+	}
+
+	if persisted.Calibration == nil {
+		return fmt.Errorf("ERROR: the persisted model was never calibrated")
+	}
+
+	// decode into a fresh model so words the model
+	// has seen since it was persisted don't stick
+	// around
+	fresh := NewNaiveBayes(nil, 0, base.OnlyWordsAndNumbers)
+	err = json.Unmarshal(persisted.Model, fresh)
+	if err != nil {
+		return err
+	}
+
+	c.Model.Words.Lock()
+	c.Model.Words.words = fresh.Words.words
+	c.Model.Words.Unlock()
+
+	c.Model.Count = fresh.Count
+	c.Model.Probabilities = fresh.Probabilities
+	c.Model.DocumentCount = fresh.DocumentCount
+	c.Model.DictCount = fresh.DictCount
+
+	c.Method = persisted.Calibration.Method
+	c.Calibration = persisted.Calibration
+
+	return nil
+}
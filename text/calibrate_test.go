@@ -0,0 +1,117 @@
+package text
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/bountylabs/goml/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// noisyDocuments makes documents of words which lean
+// towards their class but are sometimes the other
+// class's words, so Naive Bayes is overconfident
+func noisyDocuments(random *rand.Rand, n int) []base.TextDatapoint {
+	vocabulary := [][]string{
+		{"rain", "cold", "grey", "wind", "storm"},
+		{"sun", "warm", "blue", "beach", "bright"},
+	}
+
+	documents := make([]base.TextDatapoint, n)
+	for i := range documents {
+		class := random.Intn(2)
+
+		words := []string{}
+		for j := 0; j < 6; j++ {
+			from := class
+			if random.Float64() < 0.4 {
+				from = 1 - class
+			}
+			words = append(words, vocabulary[from][random.Intn(len(vocabulary[from]))])
+		}
+
+		documents[i] = base.TextDatapoint{X: strings.Join(words, " "), Y: uint8(class)}
+	}
+
+	return documents
+}
+
+func TestCalibratedNaiveBayesShouldPass1(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+
+	stream := make(chan base.TextDatapoint, 100)
+	errors := make(chan error)
+	model := NewNaiveBayes(stream, 2, base.OnlyWordsAndNumbers)
+	go model.OnlineLearn(errors)
+
+	for _, document := range noisyDocuments(random, 500) {
+		stream <- document
+	}
+	close(stream)
+
+	for range errors {
+	}
+
+	heldOut := noisyDocuments(random, 1000)
+	test := noisyDocuments(random, 1000)
+
+	calibrated := NewCalibratedNaiveBayes(model, base.IsotonicCalibration)
+	err := calibrated.Fit(heldOut)
+	assert.Nil(t, err, "Fit error should be nil")
+
+	proba, err := calibrated.PredictProba("sun warm rain")
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.InDelta(t, 1, proba[0]+proba[1], 1e-9, "Probabilities should add up to 1")
+
+	class, err := calibrated.Predict("sun warm beach bright")
+	assert.Nil(t, err, "Prediction error should be nil")
+	assert.EqualValues(t, 1, class, "A sunny document should be class 1")
+
+	// compare against the raw probabilities
+	raw := make([]float64, len(test))
+	positive := make([]float64, len(test))
+	for i := range test {
+		raw[i] = model.PredictProba(test[i].X)[1]
+		positive[i] = float64(test[i].Y)
+	}
+	diagram, err := base.ReliabilityDiagram(raw, positive, 10)
+	assert.Nil(t, err, "Reliability diagram error should be nil")
+
+	calibratedDiagram, err := calibrated.Reliability(test, 10)
+	assert.Nil(t, err, "Reliability diagram error should be nil")
+	assert.True(t, base.ExpectedCalibrationError(calibratedDiagram) < base.ExpectedCalibrationError(diagram), "Calibration should lower the calibration error")
+
+	err = calibrated.PersistToFile("/tmp/.goml/calibrated_bayes.json")
+	assert.Nil(t, err, "Persistence error should be nil")
+
+	restored := NewCalibratedNaiveBayes(NewNaiveBayes(nil, 2, base.OnlyWordsAndNumbers), base.PlattCalibration)
+	err = restored.RestoreFromFile("/tmp/.goml/calibrated_bayes.json")
+	assert.Nil(t, err, "Restore error should be nil")
+	assert.Equal(t, base.IsotonicCalibration, restored.Method, "The method should be restored")
+
+	for _, document := range test[:20] {
+		expected, err := calibrated.PredictProba(document.X)
+		assert.Nil(t, err, "Prediction error should be nil")
+		got, err := restored.PredictProba(document.X)
+		assert.Nil(t, err, "Prediction error should be nil")
+		assert.Equal(t, expected, got, "Restored model should give the same probabilities")
+	}
+}
+
+func TestCalibratedNaiveBayesShouldFail1(t *testing.T) {
+	calibrated := NewCalibratedNaiveBayes(NewNaiveBayes(nil, 2, base.OnlyWordsAndNumbers), base.PlattCalibration)
+
+	_, err := calibrated.PredictProba("anything")
+	assert.NotNil(t, err, "Predicting before calibrating should return an error")
+
+	err = calibrated.Fit(nil)
+	assert.NotNil(t, err, "Calibrating with no documents should return an error")
+
+	err = calibrated.Fit([]base.TextDatapoint{{X: "sun", Y: 5}})
+	assert.NotNil(t, err, "Classes the model doesn't have should return an error")
+
+	err = calibrated.RestoreFromFile("/tmp/.goml/does_not_exist.json")
+	assert.NotNil(t, err, "Restoring from a missing file should return an error")
+}